@@ -0,0 +1,512 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/config"
+	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
+	"github.com/jackc/pgx/v5"
+)
+
+const adminUsage = `usage: gophermart admin [-c config] [-d dsn] <command> [-format table|json] [flags] [args]
+
+commands:
+  create-user [-password P] LOGIN              create a user, the password is read from stdin without -password
+  reset-password [-password P] LOGIN           replace the password of a user
+  balance [-limit N] LOGIN                     show the balance and the latest history records
+  requeue -status S -older-than D              return orders in status S to NEW and to the accrual queue
+  set-status -reason R [-actor A] ORDER STATUS force the order status (NEW, PROCESSING or INVALID) and record it in the audit log
+  adjust -reason R [-actor A] LOGIN AMOUNT     change the balance by AMOUNT points (negative to debit) and record it in the audit log
+  reconcile                                    list users whose balance differs from their operations
+  audit [-limit N]                             show the latest audit log records`
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+
+	minLoginLength    = 3
+	maxLoginLength    = 50
+	minPasswordLength = 6
+)
+
+// adminCLI подкоманды gophermart admin. Соединение с базой открывается только после разбора
+// аргументов команды, чтобы ошибка в них не требовала доступной базы.
+type adminCLI struct {
+	conf  *config.Config
+	in    io.Reader
+	out   io.Writer
+	dbObj *db.DB
+}
+
+// runAdmin выполняет подкоманду gophermart admin. Параметры подключения берутся из той же
+// конфигурации, что и у сервиса: файл, окружение и флаги -c и -d перед именем команды.
+func runAdmin(args []string, in io.Reader, out io.Writer) error {
+	conf, err := config.Read(args)
+	if err != nil {
+		return err
+	}
+	if len(conf.Args) == 0 {
+		return errors.New(adminUsage)
+	}
+	command, commandArgs := conf.Args[0], conf.Args[1:]
+
+	cli := &adminCLI{conf: conf, in: in, out: out}
+	defer cli.close()
+
+	commands := map[string]func(context.Context, []string) error{
+		"create-user":    cli.createUser,
+		"reset-password": cli.resetPassword,
+		"balance":        cli.balance,
+		"requeue":        cli.requeue,
+		"set-status":     cli.setStatus,
+		"adjust":         cli.adjust,
+		"reconcile":      cli.reconcile,
+		"audit":          cli.audit,
+	}
+	run, ok := commands[command]
+	if !ok {
+		return fmt.Errorf("unknown admin command %q\n%s", command, adminUsage)
+	}
+	if err = run(context.Background(), commandArgs); err != nil {
+		return fmt.Errorf("admin %s: %w", command, err)
+	}
+	return nil
+}
+
+func (cli *adminCLI) connect(ctx context.Context) (*db.DB, error) {
+	if cli.dbObj != nil {
+		return cli.dbObj, nil
+	}
+	if cli.conf.DatabaseDNS == "" {
+		return nil, errors.New("database_uri must not be empty (flag -d or DATABASE_URI)")
+	}
+	if cli.conf.GetStorageBackend() != config.StoragePostgres {
+		return nil, errors.New("admin commands require a Postgres database_uri")
+	}
+	applyRetryPolicies(cli.conf)
+
+	// Миграции не применяются: схемой управляет gophermart migrate или сам сервис
+	dbObj, err := db.NewDB(ctx, cli.conf.DatabaseDNS, false)
+	if err != nil {
+		if dbObj != nil {
+			dbObj.Close()
+		}
+		return nil, fmt.Errorf("unable to connect to database: %w", err)
+	}
+	dbObj.QueryTimeout = cli.conf.DatabaseQueryTimeout
+	cli.dbObj = dbObj
+	return dbObj, nil
+}
+
+func (cli *adminCLI) close() {
+	if cli.dbObj != nil {
+		cli.dbObj.Close()
+	}
+}
+
+// flagSet общий набор флагов подкоманды с флагом -format
+func (cli *adminCLI) flagSet(name string) (*flag.FlagSet, *string) {
+	flagSet := flag.NewFlagSet(name, flag.ContinueOnError)
+	format := flagSet.String("format", formatTable, "output format: table or json")
+	return flagSet, format
+}
+
+func parseAdminFlags(flagSet *flag.FlagSet, format *string, args []string, argNames ...string) ([]string, error) {
+	if err := flagSet.Parse(args); err != nil {
+		return nil, err
+	}
+	if *format != formatTable && *format != formatJSON {
+		return nil, fmt.Errorf("unknown format %q, expected table or json", *format)
+	}
+	if flagSet.NArg() != len(argNames) {
+		if len(argNames) == 0 {
+			return nil, fmt.Errorf("unexpected arguments %v\n%s", flagSet.Args(), adminUsage)
+		}
+		return nil, fmt.Errorf("expected %s\n%s", strings.Join(argNames, " and "), adminUsage)
+	}
+	return flagSet.Args(), nil
+}
+
+func (cli *adminCLI) createUser(ctx context.Context, args []string) error {
+	flagSet, format := cli.flagSet("create-user")
+	password := flagSet.String("password", "", "password, read from stdin if empty")
+	values, err := parseAdminFlags(flagSet, format, args, "login")
+	if err != nil {
+		return err
+	}
+	login := values[0]
+	if len(login) < minLoginLength || len(login) > maxLoginLength {
+		return fmt.Errorf("login must be between %d and %d characters", minLoginLength, maxLoginLength)
+	}
+	user := models.User{Login: login}
+	if err = cli.hashPassword(&user, *password); err != nil {
+		return err
+	}
+
+	dbObj, err := cli.connect(ctx)
+	if err != nil {
+		return err
+	}
+	userRepository := repository.NewUserRepository(dbObj)
+	if _, err = userRepository.GetUserByLogin(ctx, login); err == nil {
+		return fmt.Errorf("user %s already exists", login)
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	created, err := userRepository.CreateUser(ctx, user.Login, user.PasswordHash)
+	if err != nil {
+		return err
+	}
+	return cli.print(*format, created, adminTable{
+		header: []string{"ID", "LOGIN"},
+		rows:   [][]string{{strconv.Itoa(created.ID), created.Login}},
+	})
+}
+
+func (cli *adminCLI) resetPassword(ctx context.Context, args []string) error {
+	flagSet, format := cli.flagSet("reset-password")
+	password := flagSet.String("password", "", "new password, read from stdin if empty")
+	values, err := parseAdminFlags(flagSet, format, args, "login")
+	if err != nil {
+		return err
+	}
+	user := models.User{Login: values[0]}
+	if err = cli.hashPassword(&user, *password); err != nil {
+		return err
+	}
+
+	dbObj, err := cli.connect(ctx)
+	if err != nil {
+		return err
+	}
+	if err = repository.NewUserRepository(dbObj).UpdatePassword(ctx, user.Login, user.PasswordHash); err != nil {
+		return err
+	}
+	return cli.print(*format, map[string]string{"login": user.Login, "result": "password updated"}, adminTable{
+		header: []string{"LOGIN", "RESULT"},
+		rows:   [][]string{{user.Login, "password updated"}},
+	})
+}
+
+// hashPassword читает пароль из stdin, если он не передан флагом, чтобы он не оставался в истории команд
+func (cli *adminCLI) hashPassword(user *models.User, password string) error {
+	if password == "" {
+		scanner := bufio.NewScanner(cli.in)
+		if scanner.Scan() {
+			password = strings.TrimRight(scanner.Text(), "\r")
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("can't read password: %w", err)
+		}
+	}
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	return user.HashPassword(password)
+}
+
+type adminBalance struct {
+	Login     string                `json:"login"`
+	Current   float32               `json:"current"`
+	Withdrawn float32               `json:"withdrawn"`
+	History   []models.BalanceEvent `json:"history"`
+}
+
+func (cli *adminCLI) balance(ctx context.Context, args []string) error {
+	flagSet, format := cli.flagSet("balance")
+	limit := flagSet.Int("limit", 20, "number of history records")
+	values, err := parseAdminFlags(flagSet, format, args, "login")
+	if err != nil {
+		return err
+	}
+	if *limit <= 0 {
+		return fmt.Errorf("limit must be positive, got %d", *limit)
+	}
+
+	dbObj, err := cli.connect(ctx)
+	if err != nil {
+		return err
+	}
+	user, err := repository.NewUserRepository(dbObj).GetUserByLogin(ctx, values[0])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("user %s not found", values[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	balanceRepository := repository.NewBalanceRepository(dbObj)
+	balance, err := balanceRepository.GetBalanceUserID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	history, err := balanceRepository.GetHistory(ctx, user.ID, repository.BalanceHistoryFilter{Limit: *limit})
+	if err != nil {
+		return err
+	}
+
+	historyTable := adminTable{header: []string{"OCCURRED_AT", "TYPE", "REFERENCE", "AMOUNT", "BALANCE_AFTER"}}
+	for _, event := range history {
+		historyTable.rows = append(historyTable.rows, []string{
+			formatTime(event.OccurredAt), string(event.Type), event.Reference, formatAmount(event.Amount), formatAmount(event.BalanceAfter),
+		})
+	}
+	result := adminBalance{Login: user.Login, Current: balance.Current, Withdrawn: balance.Withdrawn, History: history}
+	return cli.print(*format, result, adminTable{
+		header: []string{"LOGIN", "CURRENT", "WITHDRAWN"},
+		rows:   [][]string{{user.Login, formatAmount(balance.Current), formatAmount(balance.Withdrawn)}},
+	}, historyTable)
+}
+
+type adminOrder struct {
+	Order      string             `json:"order"`
+	UserID     int                `json:"user_id"`
+	Status     models.OrderStatus `json:"status"`
+	UploadedAt time.Time          `json:"uploaded_at"`
+}
+
+func (cli *adminCLI) requeue(ctx context.Context, args []string) error {
+	flagSet, format := cli.flagSet("requeue")
+	status := flagSet.String("status", "", "status of stuck orders: NEW, PROCESSING or INVALID")
+	olderThan := flagSet.Duration("older-than", 0, "requeue only orders uploaded earlier than this, required")
+	if _, err := parseAdminFlags(flagSet, format, args); err != nil {
+		return err
+	}
+	orderStatus := models.OrderStatus(strings.ToUpper(*status))
+	if !orderStatus.IsValid() {
+		return fmt.Errorf("invalid status %q\n%s", *status, adminUsage)
+	}
+	// Без порога в очередь вернулись бы и заказы, которые воркеры опрашивают прямо сейчас
+	if *olderThan <= 0 {
+		return fmt.Errorf("-older-than must be positive\n%s", adminUsage)
+	}
+
+	dbObj, err := cli.connect(ctx)
+	if err != nil {
+		return err
+	}
+	orders, err := repository.NewOrderRepository(dbObj).Requeue(ctx, orderStatus, time.Now().Add(-*olderThan))
+	if err != nil {
+		return err
+	}
+
+	result := make([]adminOrder, 0, len(orders))
+	table := adminTable{header: []string{"ORDER", "USER_ID", "STATUS", "UPLOADED_AT"}}
+	for _, order := range orders {
+		result = append(result, adminOrder{Order: order.ID, UserID: order.UserID, Status: order.Status, UploadedAt: order.UploadedAt})
+		table.rows = append(table.rows, []string{order.ID, strconv.Itoa(order.UserID), string(order.Status), formatTime(order.UploadedAt)})
+	}
+	return cli.print(*format, result, table)
+}
+
+func (cli *adminCLI) setStatus(ctx context.Context, args []string) error {
+	flagSet, format := cli.flagSet("set-status")
+	reason := flagSet.String("reason", "", "reason recorded in the audit log")
+	actor := flagSet.String("actor", os.Getenv("USER"), "who made the change")
+	values, err := parseAdminFlags(flagSet, format, args, "order", "status")
+	if err != nil {
+		return err
+	}
+	orderID, status := values[0], models.OrderStatus(strings.ToUpper(values[1]))
+	if _, err = strconv.ParseInt(orderID, 10, 64); err != nil {
+		return fmt.Errorf("invalid order number %q", orderID)
+	}
+	if !status.IsValid() {
+		return fmt.Errorf("invalid status %q", values[1])
+	}
+	if status == models.ProcessedStatus {
+		return errors.New("status PROCESSED is set only with the accrual from the accrual system, use requeue")
+	}
+	if strings.TrimSpace(*reason) == "" {
+		return errors.New("reason is required (-reason)")
+	}
+	if strings.TrimSpace(*actor) == "" {
+		return errors.New("actor is required (-actor or USER)")
+	}
+
+	dbObj, err := cli.connect(ctx)
+	if err != nil {
+		return err
+	}
+	previous, err := repository.NewOrderRepository(dbObj).ForceStatus(ctx, orderID, status, models.AuditEntry{
+		Actor:  *actor,
+		Reason: *reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	change := models.OrderStatusChange{From: previous, To: status}
+	return cli.print(*format, change, adminTable{
+		header: []string{"ORDER", "FROM", "TO"},
+		rows:   [][]string{{orderID, string(change.From), string(change.To)}},
+	})
+}
+
+type adminAdjustment struct {
+	Login string `json:"login"`
+	models.BalanceAdjustment
+}
+
+// adjust корректирует баланс пользователя. Корректировка попадает в историю баланса и учитывается в reconcile.
+func (cli *adminCLI) adjust(ctx context.Context, args []string) error {
+	flagSet, format := cli.flagSet("adjust")
+	reason := flagSet.String("reason", "", "reason recorded in the audit log and in the balance history")
+	actor := flagSet.String("actor", os.Getenv("USER"), "who made the change")
+	values, err := parseAdminFlags(flagSet, format, args, "login", "amount")
+	if err != nil {
+		return err
+	}
+	amount, err := strconv.ParseFloat(values[1], 64)
+	if err != nil || math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return fmt.Errorf("invalid amount %q", values[1])
+	}
+	sum := int64(math.Round(amount * 100))
+	if sum == 0 {
+		return fmt.Errorf("amount must not be zero, got %q", values[1])
+	}
+	if strings.TrimSpace(*reason) == "" {
+		return errors.New("reason is required (-reason)")
+	}
+	if strings.TrimSpace(*actor) == "" {
+		return errors.New("actor is required (-actor or USER)")
+	}
+
+	dbObj, err := cli.connect(ctx)
+	if err != nil {
+		return err
+	}
+	user, err := repository.NewUserRepository(dbObj).GetUserByLogin(ctx, values[0])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("user %s not found", values[0])
+	}
+	if err != nil {
+		return err
+	}
+	adjustment, err := repository.NewBalanceRepository(dbObj).Adjust(ctx, user.ID, sum, models.AuditEntry{
+		Actor:  *actor,
+		Reason: *reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	result := adminAdjustment{Login: user.Login, BalanceAdjustment: adjustment}
+	return cli.print(*format, result, adminTable{
+		header: []string{"ID", "LOGIN", "AMOUNT", "CURRENT"},
+		rows:   [][]string{{strconv.FormatInt(adjustment.ID, 10), user.Login, formatAmount(adjustment.Amount), formatAmount(adjustment.Current)}},
+	})
+}
+
+// reconcile завершается ошибкой при найденных расхождениях, чтобы проверку можно было запускать по расписанию
+func (cli *adminCLI) reconcile(ctx context.Context, args []string) error {
+	flagSet, format := cli.flagSet("reconcile")
+	if _, err := parseAdminFlags(flagSet, format, args); err != nil {
+		return err
+	}
+
+	dbObj, err := cli.connect(ctx)
+	if err != nil {
+		return err
+	}
+	mismatches, err := repository.NewBalanceRepository(dbObj).Reconcile(ctx)
+	if err != nil {
+		return err
+	}
+
+	table := adminTable{header: []string{"USER_ID", "LOGIN", "CURRENT", "EXPECTED_CURRENT", "WITHDRAWN", "EXPECTED_WITHDRAWN"}}
+	for _, mismatch := range mismatches {
+		table.rows = append(table.rows, []string{
+			strconv.Itoa(mismatch.UserID), mismatch.Login,
+			formatAmount(mismatch.Current), formatAmount(mismatch.ExpectedCurrent),
+			formatAmount(mismatch.Withdrawn), formatAmount(mismatch.ExpectedWithdrawn),
+		})
+	}
+	if err = cli.print(*format, mismatches, table); err != nil {
+		return err
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("%d balances differ from the operations", len(mismatches))
+	}
+	return nil
+}
+
+func (cli *adminCLI) audit(ctx context.Context, args []string) error {
+	flagSet, format := cli.flagSet("audit")
+	limit := flagSet.Int("limit", 20, "number of records")
+	if _, err := parseAdminFlags(flagSet, format, args); err != nil {
+		return err
+	}
+	if *limit <= 0 {
+		return fmt.Errorf("limit must be positive, got %d", *limit)
+	}
+
+	dbObj, err := cli.connect(ctx)
+	if err != nil {
+		return err
+	}
+	entries, err := repository.NewAuditRepository(dbObj).GetList(ctx, *limit)
+	if err != nil {
+		return err
+	}
+
+	table := adminTable{header: []string{"ID", "CREATED_AT", "ACTOR", "ACTION", "TARGET", "REASON", "DETAILS"}}
+	for _, entry := range entries {
+		table.rows = append(table.rows, []string{
+			strconv.FormatInt(entry.ID, 10), formatTime(entry.CreatedAt), entry.Actor, entry.Action, entry.Target, entry.Reason, string(entry.Details),
+		})
+	}
+	return cli.print(*format, entries, table)
+}
+
+type adminTable struct {
+	header []string
+	rows   [][]string
+}
+
+// print выводит value в JSON или tables в виде выровненных таблиц, разделенных пустой строкой
+func (cli *adminCLI) print(format string, value any, tables ...adminTable) error {
+	if format == formatJSON {
+		encoder := json.NewEncoder(cli.out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+
+	for i, table := range tables {
+		if i > 0 {
+			fmt.Fprintln(cli.out)
+		}
+		writer := tabwriter.NewWriter(cli.out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, strings.Join(table.header, "\t"))
+		for _, row := range table.rows {
+			fmt.Fprintln(writer, strings.Join(row, "\t"))
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatAmount(value float32) string {
+	return strconv.FormatFloat(float64(value), 'f', 2, 32)
+}
+
+func formatTime(value time.Time) string {
+	return value.Format(time.RFC3339)
+}
@@ -2,67 +2,186 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/Bessima/diplom-gomarket/internal/cache"
+	"github.com/Bessima/diplom-gomarket/internal/clients/accrual"
 	"github.com/Bessima/diplom-gomarket/internal/config"
 	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/Bessima/diplom-gomarket/internal/events"
 	"github.com/Bessima/diplom-gomarket/internal/handlers"
+	"github.com/Bessima/diplom-gomarket/internal/health"
 	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
 	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/notifications"
+	"github.com/Bessima/diplom-gomarket/internal/outbox"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
+	"github.com/Bessima/diplom-gomarket/internal/repository/memory"
+	"github.com/Bessima/diplom-gomarket/internal/repository/sqlite"
 	"github.com/Bessima/diplom-gomarket/internal/server"
 	"github.com/Bessima/diplom-gomarket/internal/service"
+	"github.com/Bessima/diplom-gomarket/internal/tracing"
+	"github.com/Bessima/diplom-gomarket/internal/webhooks"
 	"go.uber.org/zap"
 	"log"
+	"os"
 	"os/signal"
 	"syscall"
 	"time"
 )
 
 func main() {
-	err := initLogger()
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "admin" {
+		if err := runAdmin(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	conf, errConfig := config.InitConfig()
+	if errors.Is(errConfig, flag.ErrHelp) {
+		return
+	}
+	if conf != nil && conf.PrintConfig {
+		if err := conf.Print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		if errConfig != nil {
+			log.Fatal(errConfig)
+		}
+		return
+	}
+	if conf != nil && len(conf.Args) > 0 {
+		log.Fatalf("unknown command %q, expected migrate, admin or no command to run the server", conf.Args[0])
+	}
+	if errConfig != nil {
+		log.Fatal(errConfig)
+	}
+
+	err := initLogger(conf.LogLevel)
 	if err != nil {
 		logger.Log.Warn(err.Error())
 	}
+	if conf.File != "" {
+		logger.Log.Info("Loaded config file", zap.String("path", conf.File))
+	}
 
-	if err := run(); err != nil {
+	if err := run(conf); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func run() error {
+func run(conf *config.Config) error {
 	ctx, cancelCtx := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancelCtx()
 
-	conf := config.InitConfig()
+	applyRetryPolicies(conf)
 
-	dbObj, errDB := db.NewDB(ctx, conf.DatabaseDNS)
-	if errDB != nil {
-		logger.Log.Error(
-			"Unable to connect to database",
-			zap.String("path", conf.DatabaseDNS),
-			zap.String("error", errDB.Error()),
-		)
+	shutdownTracing, errTracing := tracing.Init(ctx, tracing.Config{
+		Exporter:    conf.TracingExporter,
+		FilePath:    conf.TracingFile,
+		SampleRatio: conf.TracingSampleRatio,
+	})
+	if errTracing != nil {
+		return fmt.Errorf("unable to init tracing: %w", errTracing)
 	}
-	defer dbObj.Close()
+	defer func() {
+		// Контекст сервиса к этому моменту отменен, поэтому оставшиеся спаны отправляются с отдельным таймаутом
+		flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelFlush()
+		if err := shutdownTracing(flushCtx); err != nil {
+			logger.Log.Warn("Tracing shutdown error", zap.Error(err))
+		}
+	}()
 
-	ordersForProcessing := make(chan models.Order, 5)
-	defer close(ordersForProcessing)
+	storage, errStorage := openStorage(ctx, conf)
+	if errStorage != nil {
+		// Без базы сервис не может работать: завершаемся, чтобы оркестратор перезапустил процесс
+		return errStorage
+	}
+	if storage.Close != nil {
+		defer storage.Close()
+	}
+	dbObj := storage.DB
+
+	// Воркеры начислений и фоновые задачи работают в контексте, который не отменяется сигналом:
+	// при остановке они сначала доделывают начатые запросы и записи в базу, а workCancel прерывает
+	// их только после истечения WorkerShutdownTimeout
+	workCtx, workCancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer workCancel()
+
+	orderQueue := service.NewOrderQueue(conf.OrderQueueSize)
+	accrualClient := accrual.NewAccrualClientWithOptions(conf.GetAccrualAddressWithProtocol(), accrual.Options{
+		RequestTimeout:      conf.AccrualRequestTimeout,
+		RateLimitDelay:      conf.AccrualRateLimitDelay,
+		BreakerFailures:     conf.AccrualBreakerFailures,
+		BreakerOpenDuration: conf.AccrualBreakerOpenDuration,
+	})
+	orderService := service.NewOrderService(storage.Orders, accrualClient, conf.AccrualErrorDelay)
+
+	backgroundWorkers := health.NewWorkerGroup("background")
+	backgroundWorkers.Go(func() {
+		orderService.AddNotProcessedOrders(workCtx, orderQueue)
+	})
 
-	orderService := service.NewOrderService(dbObj, conf.GetAccrualAddressWithProtocol())
+	accrualWorkers := health.NewWorkerGroup("accrual")
+	accrualPool := service.NewAccrualWorkerPool(workCtx, orderService, orderQueue, accrualWorkers)
 
-	go orderService.AddNotProcessedOrders(ordersForProcessing)
+	settings := runtimeSettings{accrualClient: accrualClient, accrualPool: accrualPool}
+	settings.apply(conf)
+	go watchReload(ctx, conf, settings)
 
-	for w := 0; w < 5; w++ {
-		go orderService.GetAccrualForOrder(ctx, ordersForProcessing)
+	var orderEvents *events.Broker
+	if dbObj != nil {
+		orderEvents = events.NewBroker(dbObj)
+		stopPostgresWorkers, err := runPostgresWorkers(ctx, conf, dbObj, storage.Caches, orderEvents, orderQueue, backgroundWorkers)
+		if err != nil {
+			return err
+		}
+		defer stopPostgresWorkers()
+	}
+
+	registerRuntimeMetrics(dbObj, storage.Caches, orderQueue, accrualWorkers)
+
+	readiness := health.NewChecker()
+	if storage.Ping != nil {
+		readiness.Add("database", true, storage.Ping)
+		readiness.Add("migrations", true, storage.CheckMigrations)
+	}
+	if dbObj != nil && dbObj.HasReplica() {
+		// Без реплики чтения идут на основной сервер, поэтому проверка некритичная
+		readiness.Add("database_replica", false, dbObj.PingReplica)
 	}
+	readiness.Add("accrual_workers", true, accrualWorkers.Check)
+	// Ограничение запросов системой начислений не мешает принимать заказы, поэтому проверка некритичная
+	readiness.Add("accrual_breaker", false, func(_ context.Context) error {
+		if open, until := accrual.BreakerState(); open {
+			return fmt.Errorf("accrual requests are paused until %s", until.Format(time.RFC3339))
+		}
+		return nil
+	})
 
-	serverService := server.NewServerService(ctx, conf.Address, dbObj)
+	// Запросы не отменяются сигналом, чтобы начатые записи в базу завершились за HTTPShutdownTimeout
+	serverService := server.NewServerService(workCtx, conf.Address, storage)
 
 	// Конфигурация JWT
 	jwtConfig := &handlers.JWTConfig{
 		SecretKey:       conf.SecretKey,
-		AccessTokenTTL:  15 * time.Minute,
-		RefreshTokenTTL: 7 * 24 * time.Hour, // 7 дней
+		AccessTokenTTL:  conf.JWTAccessTokenTTL,
+		RefreshTokenTTL: conf.JWTRefreshTokenTTL,
 	}
-	serverService.SetRouter(jwtConfig, ordersForProcessing)
+	accessLog, errAccessLog := conf.GetAccessLogConfig()
+	if errAccessLog != nil {
+		return fmt.Errorf("invalid access log level: %w", errAccessLog)
+	}
+	serverService.SetRouter(jwtConfig, orderQueue, conf.GetTransferDailyLimit(), orderEvents, conf.AdminToken, readiness, accessLog)
 
 	serverErr := make(chan error, 1)
 	logger.Log.Info("Running Server on", zap.String("address", conf.Address))
@@ -75,20 +194,186 @@ func run() error {
 		logger.Log.Info("Received shutdown signal, shutting down.")
 	case err = <-serverErr:
 		logger.Log.Error("Server error", zap.Error(err))
-		return err
+		cancelCtx()
+	}
+
+	shutdown(conf, &serverService, orderQueue, accrualWorkers, backgroundWorkers, workCancel)
+
+	return err
+}
+
+// openStorage открывает хранилище, выбранное схемой DATABASE_URI
+func openStorage(ctx context.Context, conf *config.Config) (repository.Storage, error) {
+	switch conf.GetStorageBackend() {
+	case config.StorageMemory:
+		logger.Log.Warn("Using in-memory storage: data is lost on restart; transfers, order events, webhooks and notifications are disabled")
+		return memory.NewStorage(), nil
+	case config.StorageSQLite:
+		logger.Log.Info("Using SQLite storage: transfers, order events, webhooks and notifications are disabled")
+		sqliteDB, err := db.NewSQLiteDB(ctx, conf.DatabaseDNS, conf.AutoMigrate)
+		if err != nil {
+			if sqliteDB != nil {
+				sqliteDB.Close()
+			}
+			return repository.Storage{}, fmt.Errorf("unable to open sqlite database: %w", err)
+		}
+		sqliteDB.QueryTimeout = conf.DatabaseQueryTimeout
+		return sqlite.NewStorage(sqliteDB), nil
+	}
+
+	dbObj, errDB := db.NewDB(ctx, conf.DatabaseDNS, conf.AutoMigrate)
+	if errDB != nil {
+		logger.Log.Error(
+			"Unable to connect to database",
+			zap.String("path", conf.DatabaseDNS),
+			zap.String("error", errDB.Error()),
+		)
+		if dbObj != nil {
+			dbObj.Close()
+		}
+		return repository.Storage{}, fmt.Errorf("unable to connect to database: %w", errDB)
+	}
+	dbObj.QueryTimeout = conf.DatabaseQueryTimeout
+	if conf.DatabaseReplicaDNS != "" {
+		if err := dbObj.ConnectReplica(ctx, conf.DatabaseReplicaDNS, conf.DatabaseReplicaMaxStaleness); err != nil {
+			dbObj.Close()
+			return repository.Storage{}, err
+		}
+		logger.Log.Info("Using read replica for order, withdrawal and balance lists",
+			zap.Duration("max_staleness", conf.DatabaseReplicaMaxStaleness))
+	}
+	storage := repository.NewStorage(dbObj)
+	if conf.CacheSize > 0 {
+		storage = repository.NewCaches(conf.CacheSize, conf.CacheTTL).Wrap(storage)
+	}
+	return storage, nil
+}
+
+// runPostgresWorkers запускает фоновые задачи, которые работают только с Postgres:
+// события заказов, возврат заказов в очередь, инвалидация кешей, outbox, уведомления и вебхуки.
+// Возвращаемая функция отписывает уведомления от шины outbox.
+func runPostgresWorkers(
+	ctx context.Context,
+	conf *config.Config,
+	dbObj *db.DB,
+	caches *repository.Caches,
+	orderEvents *events.Broker,
+	orderQueue *service.OrderQueue,
+	backgroundWorkers *health.WorkerGroup,
+) (func(), error) {
+	backgroundWorkers.Go(func() { orderEvents.Run(ctx) })
+	// Заказы, возвращенные в обработку через gophermart admin requeue
+	backgroundWorkers.Go(func() {
+		events.ListenRequeued(ctx, dbObj, repository.NewOrderRepository(dbObj).ClaimRequeued,
+			func(order models.Order) bool { return orderQueue.Push(ctx, order) })
+	})
+	if caches != nil || dbObj.HasReplica() {
+		backgroundWorkers.Go(func() { listenCacheInvalidations(ctx, dbObj, caches) })
 	}
 
-	if shutdownErr := serverService.Shutdown(); shutdownErr != nil {
+	outboxBus := outbox.NewBus()
+	outboxSinks, errSinks := outbox.NewSinks(outbox.SinkConfig{
+		Names:    conf.GetOutboxSinkNames(),
+		FilePath: conf.OutboxFile,
+		HTTPURL:  conf.OutboxHTTPURL,
+	}, outboxBus)
+	if errSinks != nil {
+		return nil, errSinks
+	}
+	notificationChannels := []notifications.Channel{
+		notifications.NewHTTPChannel(),
+		notifications.NewLogChannel(conf.NotificationsFile),
+	}
+	if conf.SMTPAddress != "" {
+		notificationChannels = append(notificationChannels, notifications.NewSMTPChannel(notifications.SMTPConfig{
+			Address:  conf.SMTPAddress,
+			Username: conf.SMTPUsername,
+			Password: conf.SMTPPassword,
+			From:     conf.SMTPFrom,
+		}))
+	}
+	notifier := notifications.NewNotifier(repository.NewNotificationSettingsRepository(dbObj), notificationChannels...)
+	notificationEvents, unsubscribeNotifications := outboxBus.Subscribe()
+	backgroundWorkers.Go(func() { notifier.Run(ctx, notificationEvents) })
+
+	outboxRelay := outbox.NewRelay(repository.NewOutboxRepository(dbObj), conf.OutboxRetention, outboxSinks...)
+	backgroundWorkers.Go(func() { outboxRelay.Run(ctx) })
+
+	webhookDispatcher := webhooks.NewDispatcher(repository.NewWebhookRepository(dbObj))
+	backgroundWorkers.Go(func() { webhookDispatcher.Run(ctx) })
+
+	return unsubscribeNotifications, nil
+}
+
+// listenCacheInvalidations обрабатывает изменения данных пользователя, сделанные этой или другой репликой
+// сервиса. Следующие чтения пользователя идут в основной сервер, чтобы он сразу увидел свой заказ или
+// списание, а кеш не заполнился значением из реплики базы, которая еще не получила изменение.
+// caches равен nil, если кеш выключен.
+func listenCacheInvalidations(ctx context.Context, dbObj *db.DB, caches *repository.Caches) {
+	purge := func() {}
+	if caches != nil {
+		purge = func() { caches.Purge(ctx) }
+	}
+	events.ListenCacheInvalidations(ctx, dbObj, func(invalidation events.CacheInvalidation) {
+		switch invalidation.Entity {
+		case events.CacheEntityUser:
+			if caches != nil {
+				caches.Users.Invalidate(ctx, cache.SourceNotify, invalidation.UserID)
+			}
+		case events.CacheEntityBalance:
+			dbObj.MarkWrite(invalidation.UserID)
+			if caches != nil {
+				caches.Balances.Invalidate(ctx, cache.SourceNotify, invalidation.UserID)
+			}
+		case events.CacheEntityOrder, events.CacheEntityWithdrawal:
+			dbObj.MarkWrite(invalidation.UserID)
+		}
+	}, purge)
+}
+
+// shutdown останавливает сервис по шагам: закрывает очередь заказов, чтобы новые загрузки получали 503,
+// дожидается активных HTTP-запросов, затем воркеров начислений с их запросами к системе начислений
+// и записями в базу. Заказы, оставшиеся в очереди, не теряются: они хранятся в базе в статусах
+// NEW и PROCESSING и возвращаются в очередь при следующем запуске.
+func shutdown(
+	conf *config.Config,
+	serverService *server.ServerService,
+	orderQueue *service.OrderQueue,
+	accrualWorkers *health.WorkerGroup,
+	backgroundWorkers *health.WorkerGroup,
+	workCancel context.CancelFunc,
+) {
+	orderQueue.Close()
+
+	httpCtx, cancelHTTP := context.WithTimeout(context.Background(), conf.HTTPShutdownTimeout)
+	defer cancelHTTP()
+	if shutdownErr := serverService.Shutdown(httpCtx); shutdownErr != nil {
 		logger.Log.Error("Server shutdown error", zap.Error(shutdownErr))
 	}
 
-	logger.Log.Info("Received shutdown signal, shutting down.")
+	workerCtx, cancelWorkers := context.WithTimeout(context.Background(), conf.WorkerShutdownTimeout)
+	defer cancelWorkers()
+	if waitErr := accrualWorkers.Wait(workerCtx); waitErr != nil {
+		logger.Log.Warn("Accrual workers did not finish in time, cancelling in-flight requests", zap.Error(waitErr))
+	}
+	// Начатые операции либо завершились, либо прерываются: оставшиеся заказы будут обработаны после перезапуска
+	workCancel()
 
-	return err
+	// Фоновые задачи уже получили отмену по сигналу, после workCancel им остается только выйти
+	forceCtx, cancelForce := context.WithTimeout(context.Background(), conf.HTTPShutdownTimeout)
+	defer cancelForce()
+	if waitErr := accrualWorkers.Wait(forceCtx); waitErr != nil {
+		logger.Log.Error("Accrual workers were not stopped", zap.Error(waitErr))
+	}
+	if waitErr := backgroundWorkers.Wait(forceCtx); waitErr != nil {
+		logger.Log.Error("Background workers were not stopped", zap.Error(waitErr))
+	}
+
+	logger.Log.Info("Server stopped", zap.Int("orders_left_in_queue", orderQueue.Len()))
 }
 
-func initLogger() error {
-	if err := logger.Initialize("debug"); err != nil {
+func initLogger(level string) error {
+	if err := logger.Initialize(level); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/Bessima/diplom-gomarket/internal/health"
+	"github.com/Bessima/diplom-gomarket/internal/metrics"
+	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
+	"github.com/Bessima/diplom-gomarket/internal/service"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+const (
+	metricsQueryTimeout = 2 * time.Second
+	// metricsScrapeTTL сколько живет результат запроса, общий для нескольких метрик одного сбора
+	metricsScrapeTTL = time.Second
+)
+
+// scrapeResult запоминает результат collect на metricsScrapeTTL, чтобы метрики, построенные на одном
+// запросе, выполняли его один раз за сбор и показывали согласованные значения
+func scrapeResult[T any](collect func() T) func() T {
+	var (
+		mu          sync.Mutex
+		value       T
+		collectedAt time.Time
+	)
+	return func() T {
+		mu.Lock()
+		defer mu.Unlock()
+		if collectedAt.IsZero() || time.Since(collectedAt) > metricsScrapeTTL {
+			value = collect()
+			collectedAt = time.Now()
+		}
+		return value
+	}
+}
+
+// registerRuntimeMetrics регистрирует метрики, которые вычисляются в момент сбора
+func registerRuntimeMetrics(dbObj *db.DB, caches *repository.Caches, orderQueue *service.OrderQueue, accrualWorkers *health.WorkerGroup) {
+	factory := promauto.With(metrics.Registry)
+	factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "orders_processing_queue_length",
+		Help: "Orders waiting in the in-memory processing queue.",
+	}, func() float64 {
+		return float64(orderQueue.Len())
+	})
+
+	factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "accrual_workers_running",
+		Help: "Accrual workers that are running.",
+	}, func() float64 {
+		return float64(accrualWorkers.Running())
+	})
+
+	if caches != nil {
+		metrics.NewGaugeFunc("cache_hit_ratio",
+			"Share of cache lookups served from the cache since start, by cache.", []string{"cache"},
+			func() []metrics.Sample {
+				return []metrics.Sample{
+					{LabelValues: []string{caches.Users.Name()}, Value: caches.Users.HitRatio()},
+					{LabelValues: []string{caches.Balances.Name()}, Value: caches.Balances.HitRatio()},
+				}
+			})
+	}
+
+	// Статистика заказов и пула соединений собирается только из Postgres
+	if dbObj == nil {
+		return
+	}
+	orderRepository := repository.NewOrderRepository(dbObj)
+	collectQueueStats := scrapeResult(func() []models.OrderQueueStat {
+		ctx, cancel := context.WithTimeout(context.Background(), metricsQueryTimeout)
+		defer cancel()
+		stats, err := orderRepository.GetQueueStats(ctx)
+		if err != nil {
+			logger.Log.Debug("Can't collect order queue stats", zap.Error(err))
+			return nil
+		}
+		return stats
+	})
+	metrics.NewGaugeFunc("orders_pending",
+		"Orders not yet processed by the accrual system, by status.", []string{"status"},
+		func() []metrics.Sample {
+			queueStats := collectQueueStats()
+			samples := make([]metrics.Sample, 0, len(queueStats))
+			for _, stat := range queueStats {
+				samples = append(samples, metrics.Sample{LabelValues: []string{string(stat.Status)}, Value: float64(stat.Count)})
+			}
+			return samples
+		})
+	metrics.NewGaugeFunc("orders_pending_oldest_age_seconds",
+		"Age of the oldest unprocessed order, by status.", []string{"status"},
+		func() []metrics.Sample {
+			queueStats := collectQueueStats()
+			samples := make([]metrics.Sample, 0, len(queueStats))
+			for _, stat := range queueStats {
+				samples = append(samples, metrics.Sample{LabelValues: []string{string(stat.Status)}, Value: stat.OldestAgeSeconds})
+			}
+			return samples
+		})
+
+	if dbObj.HasReplica() {
+		metrics.NewGaugeFunc("database_replica_lag_seconds",
+			"Last measured replication lag of the read replica.", nil,
+			func() []metrics.Sample {
+				lag, err := dbObj.ReplicaLag()
+				if err != nil {
+					return nil
+				}
+				return []metrics.Sample{{Value: lag.Seconds()}}
+			})
+	}
+
+	pool, ok := dbObj.Pool.(*pgxpool.Pool)
+	if !ok {
+		return
+	}
+	poolGauge := func(name, help string, value func(stat *pgxpool.Stat) float64) {
+		factory.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, func() float64 {
+			return value(pool.Stat())
+		})
+	}
+	poolGauge("db_pool_total_connections", "Connections in the pgx pool.",
+		func(stat *pgxpool.Stat) float64 { return float64(stat.TotalConns()) })
+	poolGauge("db_pool_idle_connections", "Idle connections in the pgx pool.",
+		func(stat *pgxpool.Stat) float64 { return float64(stat.IdleConns()) })
+	poolGauge("db_pool_acquired_connections", "Connections currently acquired from the pgx pool.",
+		func(stat *pgxpool.Stat) float64 { return float64(stat.AcquiredConns()) })
+	poolGauge("db_pool_max_connections", "Maximum size of the pgx pool.",
+		func(stat *pgxpool.Stat) float64 { return float64(stat.MaxConns()) })
+	factory.NewCounterFunc(prometheus.CounterOpts{
+		Name: "db_pool_acquire_total",
+		Help: "Connections acquired from the pgx pool.",
+	}, func() float64 {
+		return float64(pool.Stat().AcquireCount())
+	})
+	factory.NewCounterFunc(prometheus.CounterOpts{
+		Name: "db_pool_acquire_wait_seconds_total",
+		Help: "Time spent waiting for a pgx pool connection.",
+	}, func() float64 {
+		return pool.Stat().AcquireDuration().Seconds()
+	})
+}
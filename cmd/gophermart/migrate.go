@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Bessima/diplom-gomarket/internal/config"
+	"github.com/Bessima/diplom-gomarket/internal/config/db"
+)
+
+const migrateUsage = `usage: gophermart migrate [-c config] [-d dsn] <command>
+
+commands:
+  up [N]                         apply all or N pending migrations
+  down N                         roll back N migrations
+  status                         show current and pending versions
+  force V                        set version V without running migrations and clear the dirty flag
+  create [-dir migrations] NAME  create empty up and down files with the next version`
+
+// runMigrate выполняет подкоманду gophermart migrate. Параметры подключения берутся из той же
+// конфигурации, что и у сервиса: файл, окружение и флаги -c и -d перед именем команды.
+func runMigrate(args []string, out io.Writer) error {
+	conf, err := config.Read(args)
+	if err != nil {
+		return err
+	}
+	if len(conf.Args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	command, commandArgs := conf.Args[0], conf.Args[1:]
+
+	if command == "create" {
+		return createMigration(commandArgs, out)
+	}
+	if conf.DatabaseDNS == "" {
+		return fmt.Errorf("database_uri must not be empty (flag -d or DATABASE_URI)")
+	}
+
+	var migrator *db.Migrator
+	switch conf.GetStorageBackend() {
+	case config.StoragePostgres:
+		pool, err := db.NewPool(context.Background(), conf.DatabaseDNS)
+		if err != nil {
+			return fmt.Errorf("unable to connect to database: %w", err)
+		}
+		defer pool.Close()
+
+		migrator, err = db.NewMigrator(pool)
+		if err != nil {
+			return err
+		}
+	case config.StorageSQLite:
+		migrator, err = db.NewSQLiteMigrator(conf.DatabaseDNS)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("migrations apply only to a Postgres or SQLite database_uri")
+	}
+	defer migrator.Close()
+
+	switch command {
+	case "up":
+		if len(commandArgs) == 0 {
+			err = migrator.Up()
+		} else {
+			var steps int
+			steps, err = parseMigrateArg(commandArgs, "number of migrations")
+			if err == nil {
+				err = migrator.Steps(steps)
+			}
+		}
+	case "down":
+		var steps int
+		steps, err = parseMigrateArg(commandArgs, "number of migrations")
+		if err == nil {
+			err = migrator.Steps(-steps)
+		}
+	case "force":
+		var version int
+		version, err = parseMigrateArg(commandArgs, "version")
+		if err == nil {
+			err = migrator.Force(version)
+		}
+	case "status":
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", command, migrateUsage)
+	}
+	if err != nil {
+		return fmt.Errorf("migrate %s: %w", command, err)
+	}
+
+	status, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+	printMigrationStatus(out, status)
+	return nil
+}
+
+func parseMigrateArg(args []string, name string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("expected %s\n%s", name, migrateUsage)
+	}
+	value, err := strconv.Atoi(args[0])
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, args[0])
+	}
+	return value, nil
+}
+
+func createMigration(args []string, out io.Writer) error {
+	flagSet := flag.NewFlagSet("create", flag.ContinueOnError)
+	dir := flagSet.String("dir", "migrations", "migrations directory")
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+	if flagSet.NArg() == 0 {
+		return fmt.Errorf("expected migration name\n%s", migrateUsage)
+	}
+
+	up, down, err := db.CreateMigration(*dir, strings.Join(flagSet.Args(), "_"))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "created %s\ncreated %s\n", up, down)
+	return nil
+}
+
+func printMigrationStatus(out io.Writer, status db.MigrationStatus) {
+	fmt.Fprintf(out, "version: %d\n", status.Version)
+	fmt.Fprintf(out, "dirty:   %t\n", status.Dirty)
+	fmt.Fprintf(out, "latest:  %d\n", status.Latest)
+	if len(status.Pending) == 0 {
+		fmt.Fprintln(out, "pending: none")
+		return
+	}
+	pending := make([]string, 0, len(status.Pending))
+	for _, version := range status.Pending {
+		pending = append(pending, strconv.FormatUint(uint64(version), 10))
+	}
+	fmt.Fprintf(out, "pending: %s\n", strings.Join(pending, ", "))
+}
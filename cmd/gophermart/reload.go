@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Bessima/diplom-gomarket/internal/clients/accrual"
+	"github.com/Bessima/diplom-gomarket/internal/config"
+	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"github.com/Bessima/diplom-gomarket/internal/retry"
+	"github.com/Bessima/diplom-gomarket/internal/service"
+	"go.uber.org/zap"
+)
+
+// runtimeSettings компоненты, параметры которых меняются без перезапуска
+type runtimeSettings struct {
+	accrualClient *accrual.AccrualClient
+	accrualPool   *service.AccrualWorkerPool
+}
+
+func applyRetryPolicies(conf *config.Config) {
+	retry.SetPolicy(conf.GetAccrualRetryConfig())
+	retry.SetPolicy(conf.GetDatabaseRetryConfig())
+}
+
+func (settings runtimeSettings) apply(conf *config.Config) {
+	if err := logger.SetLevel(conf.LogLevel); err != nil {
+		logger.Log.Warn("Invalid log level", zap.Error(err))
+	}
+	settings.accrualClient.SetOptions(accrual.Options{
+		RequestTimeout:      conf.AccrualRequestTimeout,
+		RateLimitDelay:      conf.AccrualRateLimitDelay,
+		BreakerFailures:     conf.AccrualBreakerFailures,
+		BreakerOpenDuration: conf.AccrualBreakerOpenDuration,
+	})
+	applyRetryPolicies(conf)
+	settings.accrualPool.Resize(conf.AccrualWorkers)
+}
+
+// watchReload по SIGHUP перечитывает файл конфигурации и окружение и применяет параметры,
+// которые можно менять на лету. Изменения остальных параметров логируются и ждут перезапуска.
+func watchReload(ctx context.Context, conf *config.Config, settings runtimeSettings) {
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-reload:
+		}
+
+		next, err := config.InitConfig()
+		if err != nil {
+			logger.Log.Error("Config was not reloaded", zap.Error(err))
+			continue
+		}
+
+		applied, ignored := conf.Reload(next)
+		if len(ignored) > 0 {
+			logger.Log.Warn("Config changes require restart and were ignored", zap.Strings("keys", ignored))
+		}
+		settings.apply(conf)
+		logger.Log.Info("Config reloaded", zap.Strings("applied", applied), zap.Int("accrual_workers", settings.accrualPool.Size()))
+	}
+}
@@ -0,0 +1,114 @@
+// Package cache кеширует данные, которые читаются на каждом запросе: пользователей для проверки
+// токена и балансы. Кеш заполняется при промахе и очищается после записей и по уведомлениям
+// из базы, поэтому данные, измененные другой репликой сервиса, не задерживаются в кеше.
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Bessima/diplom-gomarket/internal/metrics"
+)
+
+// Cache хранилище значений по ключу. LRU хранит значения в памяти процесса; распределенная
+// реализация (например, Redis) общая для всех реплик, и инвалидация в ней сразу видна всем.
+type Cache[K comparable, V any] interface {
+	// Get значение key и признак, что оно есть в кеше
+	Get(ctx context.Context, key K) (V, bool)
+	Set(ctx context.Context, key K, value V)
+	Delete(ctx context.Context, keys ...K)
+	// Purge удаляет все значения
+	Purge(ctx context.Context)
+}
+
+// Результаты обращений к кешу в метрике cache_requests_total
+const (
+	ResultHit  = "hit"
+	ResultMiss = "miss"
+)
+
+// Источники инвалидации в метрике cache_invalidations_total
+const (
+	// SourceWrite запись, выполненная этой репликой
+	SourceWrite = "write"
+	// SourceNotify уведомление базы об изменении, в том числе сделанном другой репликой
+	SourceNotify = "notify"
+)
+
+// Loading кеш, который при промахе загружает значение из хранилища и учитывает попадания в метриках
+type Loading[K comparable, V any] struct {
+	name  string
+	cache Cache[K, V]
+
+	// mu связывает проверку generation с сохранением загруженного значения
+	mu         sync.Mutex
+	generation uint64
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// NewLoading кеш с именем name для метрик поверх cache
+func NewLoading[K comparable, V any](name string, cache Cache[K, V]) *Loading[K, V] {
+	return &Loading[K, V]{name: name, cache: cache}
+}
+
+// Name имя кеша в метриках
+func (loading *Loading[K, V]) Name() string {
+	return loading.name
+}
+
+// Get значение key из кеша или из load при промахе. Ошибки load не кешируются. Значение не сохраняется,
+// если кеш инвалидировали во время загрузки: оно могло быть прочитано до изменения.
+func (loading *Loading[K, V]) Get(ctx context.Context, key K, load func(ctx context.Context) (V, error)) (V, error) {
+	if value, ok := loading.cache.Get(ctx, key); ok {
+		loading.hits.Add(1)
+		metrics.CacheRequests.WithLabelValues(loading.name, ResultHit).Inc()
+		return value, nil
+	}
+	loading.misses.Add(1)
+	metrics.CacheRequests.WithLabelValues(loading.name, ResultMiss).Inc()
+
+	loading.mu.Lock()
+	generation := loading.generation
+	loading.mu.Unlock()
+
+	value, err := load(ctx)
+	if err != nil {
+		return value, err
+	}
+
+	loading.mu.Lock()
+	defer loading.mu.Unlock()
+	if loading.generation == generation {
+		loading.cache.Set(ctx, key, value)
+	}
+	return value, nil
+}
+
+// Invalidate удаляет значения keys, source - источник инвалидации для метрик
+func (loading *Loading[K, V]) Invalidate(ctx context.Context, source string, keys ...K) {
+	loading.mu.Lock()
+	defer loading.mu.Unlock()
+	loading.generation++
+	loading.cache.Delete(ctx, keys...)
+	metrics.CacheInvalidations.WithLabelValues(loading.name, source).Add(float64(len(keys)))
+}
+
+// Purge удаляет все значения, например когда уведомления об изменениях могли быть пропущены
+func (loading *Loading[K, V]) Purge(ctx context.Context) {
+	loading.mu.Lock()
+	defer loading.mu.Unlock()
+	loading.generation++
+	loading.cache.Purge(ctx)
+}
+
+// HitRatio доля попаданий среди обращений к кешу с момента запуска
+func (loading *Loading[K, V]) HitRatio() float64 {
+	hits, misses := float64(loading.hits.Load()), float64(loading.misses.Load())
+	if hits+misses == 0 {
+		return 0
+	}
+	return hits / (hits + misses)
+}
@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoading_LoadsOnMissAndServesHits(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	loading := NewLoading[int, string]("test_hits", NewLRU[int, string](10, 0))
+	loads := 0
+	load := func(context.Context) (string, error) {
+		loads++
+		return "value", nil
+	}
+
+	// Act
+	first, errFirst := loading.Get(ctx, 1, load)
+	second, errSecond := loading.Get(ctx, 1, load)
+
+	// Assert
+	require.NoError(t, errFirst)
+	require.NoError(t, errSecond)
+	assert.Equal(t, "value", first)
+	assert.Equal(t, "value", second)
+	assert.Equal(t, 1, loads)
+	assert.InDelta(t, 0.5, loading.HitRatio(), 1e-9)
+}
+
+func TestLoading_DoesNotCacheErrors(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	loading := NewLoading[int, string]("test_errors", NewLRU[int, string](10, 0))
+	loads := 0
+	load := func(context.Context) (string, error) {
+		loads++
+		return "", errors.New("database is unavailable")
+	}
+
+	// Act
+	_, errFirst := loading.Get(ctx, 1, load)
+	_, errSecond := loading.Get(ctx, 1, load)
+
+	// Assert
+	assert.Error(t, errFirst)
+	assert.Error(t, errSecond)
+	assert.Equal(t, 2, loads)
+}
+
+func TestLoading_InvalidateRemovesValue(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	loading := NewLoading[int, string]("test_invalidate", NewLRU[int, string](10, 0))
+	value := "old"
+	load := func(context.Context) (string, error) { return value, nil }
+	_, err := loading.Get(ctx, 1, load)
+	require.NoError(t, err)
+
+	// Act
+	value = "new"
+	loading.Invalidate(ctx, SourceWrite, 1)
+	result, err := loading.Get(ctx, 1, load)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, "new", result)
+}
+
+func TestLoading_InvalidateDuringLoadSkipsStaleValue(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	loading := NewLoading[int, string]("test_race", NewLRU[int, string](10, 0))
+
+	// Act
+	// Значение прочитано до изменения, а инвалидация пришла до окончания загрузки
+	stale, err := loading.Get(ctx, 1, func(ctx context.Context) (string, error) {
+		loading.Invalidate(ctx, SourceNotify, 1)
+		return "old", nil
+	})
+	require.NoError(t, err)
+	fresh, err := loading.Get(ctx, 1, func(context.Context) (string, error) { return "new", nil })
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, "old", stale)
+	assert.Equal(t, "new", fresh)
+}
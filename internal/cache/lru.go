@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// LRU кеш в памяти процесса на capacity значений. При переполнении вытесняется значение,
+// к которому дольше всего не обращались. Значения старше ttl не отдаются: так ограничивается
+// устаревание, если уведомление об изменении не дошло, например во время переподключения к базе.
+type LRU[K comparable, V any] struct {
+	capacity int
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[K]*list.Element
+}
+
+type lruEntry[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+}
+
+// NewLRU кеш на capacity значений, ttl 0 - без ограничения времени хранения
+func NewLRU[K comparable, V any](capacity int, ttl time.Duration) *LRU[K, V] {
+	return &LRU[K, V]{
+		capacity: capacity,
+		ttl:      ttl,
+		now:      time.Now,
+		order:    list.New(),
+		entries:  make(map[K]*list.Element, capacity),
+	}
+}
+
+func (lru *LRU[K, V]) Get(_ context.Context, key K) (V, bool) {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	var zero V
+	element, ok := lru.entries[key]
+	if !ok {
+		return zero, false
+	}
+	entry := element.Value.(*lruEntry[K, V])
+	if lru.ttl > 0 && !lru.now().Before(entry.expiresAt) {
+		lru.remove(element)
+		return zero, false
+	}
+	lru.order.MoveToFront(element)
+	return entry.value, true
+}
+
+func (lru *LRU[K, V]) Set(_ context.Context, key K, value V) {
+	if lru.capacity <= 0 {
+		return
+	}
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	expiresAt := lru.now().Add(lru.ttl)
+	if element, ok := lru.entries[key]; ok {
+		entry := element.Value.(*lruEntry[K, V])
+		entry.value, entry.expiresAt = value, expiresAt
+		lru.order.MoveToFront(element)
+		return
+	}
+
+	lru.entries[key] = lru.order.PushFront(&lruEntry[K, V]{key: key, value: value, expiresAt: expiresAt})
+	if lru.order.Len() > lru.capacity {
+		lru.remove(lru.order.Back())
+	}
+}
+
+func (lru *LRU[K, V]) Delete(_ context.Context, keys ...K) {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	for _, key := range keys {
+		if element, ok := lru.entries[key]; ok {
+			lru.remove(element)
+		}
+	}
+}
+
+func (lru *LRU[K, V]) Purge(_ context.Context) {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	lru.order.Init()
+	clear(lru.entries)
+}
+
+// Len число значений в кеше, включая устаревшие, которые еще не вытеснены
+func (lru *LRU[K, V]) Len() int {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	return lru.order.Len()
+}
+
+func (lru *LRU[K, V]) remove(element *list.Element) {
+	lru.order.Remove(element)
+	delete(lru.entries, element.Value.(*lruEntry[K, V]).key)
+}
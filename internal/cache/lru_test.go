@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRU_EvictsLeastRecentlyUsed(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	lru := NewLRU[int, string](2, 0)
+	lru.Set(ctx, 1, "one")
+	lru.Set(ctx, 2, "two")
+
+	// Act
+	_, _ = lru.Get(ctx, 1)
+	lru.Set(ctx, 3, "three")
+
+	// Assert
+	value, ok := lru.Get(ctx, 1)
+	assert.True(t, ok)
+	assert.Equal(t, "one", value)
+	_, ok = lru.Get(ctx, 2)
+	assert.False(t, ok)
+	_, ok = lru.Get(ctx, 3)
+	assert.True(t, ok)
+	assert.Equal(t, 2, lru.Len())
+}
+
+func TestLRU_ExpiresAfterTTL(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	lru := NewLRU[int, string](10, time.Minute)
+	lru.now = func() time.Time { return now }
+	lru.Set(ctx, 1, "one")
+
+	// Act
+	_, freshOK := lru.Get(ctx, 1)
+	now = now.Add(time.Minute)
+	_, expiredOK := lru.Get(ctx, 1)
+
+	// Assert
+	assert.True(t, freshOK)
+	assert.False(t, expiredOK)
+	assert.Equal(t, 0, lru.Len())
+}
+
+func TestLRU_DeleteAndPurge(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	lru := NewLRU[int, string](10, 0)
+	for i := range 3 {
+		lru.Set(ctx, i, "value")
+	}
+
+	// Act
+	lru.Delete(ctx, 0, 100)
+	afterDelete := lru.Len()
+	lru.Purge(ctx)
+
+	// Assert
+	assert.Equal(t, 2, afterDelete)
+	assert.Equal(t, 0, lru.Len())
+	_, ok := lru.Get(ctx, 1)
+	assert.False(t, ok)
+}
+
+func TestLRU_ZeroCapacityStoresNothing(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	lru := NewLRU[int, string](0, 0)
+
+	// Act
+	lru.Set(ctx, 1, "one")
+
+	// Assert
+	_, ok := lru.Get(ctx, 1)
+	assert.False(t, ok)
+}
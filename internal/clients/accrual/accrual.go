@@ -10,8 +10,13 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/Bessima/diplom-gomarket/internal/metrics"
 	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
 	"github.com/Bessima/diplom-gomarket/internal/retry"
+	"github.com/Bessima/diplom-gomarket/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
 	"go.uber.org/zap"
 )
 
@@ -22,6 +27,9 @@ const (
 // Атомарная переменная для хранения времени следующего разрешенного запроса
 var nextAllowedRequestTime atomic.Int64
 
+// consecutiveFailures ошибок соединения и ответов 5xx подряд, сбрасывается успешным ответом
+var consecutiveFailures atomic.Int64
+
 type AccrualResponse struct {
 	Order   string  `json:"order"`
 	Status  string  `json:"status"`
@@ -36,19 +44,49 @@ type AccrualClient struct {
 	httpClient *http.Client
 	address    string
 
-	retryDelay time.Duration
+	options atomic.Pointer[Options]
+}
+
+// Options настраиваемые параметры клиента, нулевые значения заменяются значениями по умолчанию
+type Options struct {
+	// RequestTimeout ограничение одного HTTP-запроса, 0 - без ограничения
+	RequestTimeout time.Duration
+	// RateLimitDelay пауза в запросах после ответа 429
+	RateLimitDelay time.Duration
+	// BreakerFailures ошибок соединения или ответов 5xx подряд, после которых запросы приостанавливаются
+	// на BreakerOpenDuration, как после ответа 429. 0 - не приостанавливать.
+	BreakerFailures     int
+	BreakerOpenDuration time.Duration
 }
 
 func NewAccrualClient(address string) *AccrualClient {
-	client := AccrualClient{
+	return NewAccrualClientWithOptions(address, Options{})
+}
+
+func NewAccrualClientWithOptions(address string, options Options) *AccrualClient {
+	client := &AccrualClient{
 		address:    address,
 		httpClient: &http.Client{},
-		retryDelay: defaultRetryDelay,
 	}
-	return &client
+	client.SetOptions(options)
+	return client
+}
+
+// SetOptions меняет параметры клиента на лету, начатые запросы продолжают работать со старыми
+func (client *AccrualClient) SetOptions(options Options) {
+	if options.RateLimitDelay <= 0 {
+		options.RateLimitDelay = defaultRetryDelay
+	}
+	if options.BreakerOpenDuration <= 0 {
+		options.BreakerOpenDuration = defaultRetryDelay
+	}
+	client.options.Store(&options)
 }
 
-func (client AccrualClient) Get(ctx context.Context, orderNumber string) (*AccrualResponse, error) {
+func (client *AccrualClient) Get(ctx context.Context, orderNumber string) (result *AccrualResponse, err error) {
+	ctx, span := tracing.Start(ctx, "AccrualClient.Get", attribute.String("order.number", orderNumber))
+	defer func() { tracing.End(span, err) }()
+	options := client.options.Load()
 
 	if err := waitIfNeeded(ctx); err != nil {
 		return nil, fmt.Errorf("waiting was interrupted: %w", err)
@@ -56,27 +94,53 @@ func (client AccrualClient) Get(ctx context.Context, orderNumber string) (*Accru
 
 	url := fmt.Sprintf("%s/api/orders/%s", client.address, orderNumber)
 
-	return retry.DoRetryWithResult(ctx, func() (*AccrualResponse, error) {
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) (*AccrualResponse, error) {
 
 		if err := waitIfNeeded(ctx); err != nil {
 			return nil, fmt.Errorf("waiting was interrupted: %w", err)
 		}
 
-		response, err := client.httpClient.Get(url)
+		requestCtx := ctx
+		if options.RequestTimeout > 0 {
+			var cancel context.CancelFunc
+			requestCtx, cancel = context.WithTimeout(ctx, options.RequestTimeout)
+			defer cancel()
+		}
 
+		request, err := http.NewRequestWithContext(requestCtx, http.MethodGet, url, nil)
 		if err != nil {
+			return nil, err
+		}
+		// Контекст трассы передается в систему начислений в заголовке traceparent
+		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(request.Header))
+
+		start := time.Now()
+		response, err := client.httpClient.Do(request)
+
+		if err != nil {
+			observeRequest(metrics.AccrualOutcomeError, start)
+			// Отмена запроса вызывающим кодом не говорит о недоступности системы начислений
+			if ctx.Err() == nil {
+				recordFailure(options)
+			}
 			err = fmt.Errorf("failed to create resource at: %s and the error is: %w", url, err)
 			return nil, err
 		}
 
 		if response.StatusCode != http.StatusOK {
 			if response.StatusCode == http.StatusTooManyRequests {
-				setNextAllowedTime(client.retryDelay)
+				observeRequest(metrics.AccrualOutcomeRateLimited, start)
+				metrics.AccrualRateLimited.Inc()
+				setNextAllowedTime(options.RateLimitDelay)
 
 				err := fmt.Errorf("failed to create resource at: %s , too many requests by accrual system, retry after: %v",
-					url, client.retryDelay)
+					url, options.RateLimitDelay)
 				return nil, err
 			}
+			observeRequest(metrics.AccrualOutcomeError, start)
+			if response.StatusCode >= http.StatusInternalServerError {
+				recordFailure(options)
+			}
 			err := fmt.Errorf("failed to create resource at: %s , answer was with status code %d", url, response.StatusCode)
 			return nil, err
 		}
@@ -84,22 +148,26 @@ func (client AccrualClient) Get(ctx context.Context, orderNumber string) (*Accru
 		defer func() {
 			if err := response.Body.Close(); err != nil {
 				customErr := fmt.Errorf("error closing response body: %v", err)
-				logger.Log.Warn(customErr.Error())
+				logger.FromContext(ctx).Warn(customErr.Error())
 			}
 		}()
 
 		body, err := io.ReadAll(response.Body)
 		if err != nil {
-			logger.Log.Error("Error reading response body", zap.Error(err))
+			observeRequest(metrics.AccrualOutcomeError, start)
+			logger.FromContext(ctx).Error("Error reading response body", zap.Error(err))
 			return nil, err
 		}
 
 		var answer AccrualResponse
 		err = json.Unmarshal(body, &answer)
 		if err != nil {
-			logger.Log.Error("Error unmarshalling JSON", zap.Error(err))
+			observeRequest(metrics.AccrualOutcomeError, start)
+			logger.FromContext(ctx).Error("Error unmarshalling JSON", zap.Error(err))
 			return nil, err
 		}
+		observeRequest(metrics.AccrualOutcomeSuccess, start)
+		consecutiveFailures.Store(0)
 
 		log.Println("Successful getting answer for order: ", orderNumber)
 
@@ -107,6 +175,11 @@ func (client AccrualClient) Get(ctx context.Context, orderNumber string) (*Accru
 	}, retry.AccrualRetryConfig)
 }
 
+func observeRequest(outcome string, start time.Time) {
+	metrics.AccrualRequests.WithLabelValues(outcome).Inc()
+	metrics.AccrualRequestDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+}
+
 func waitIfNeeded(ctx context.Context) error {
 	nextTime := nextAllowedRequestTime.Load()
 	if nextTime == 0 {
@@ -116,7 +189,7 @@ func waitIfNeeded(ctx context.Context) error {
 	now := time.Now().UnixNano()
 	if now < nextTime {
 		waitDuration := time.Duration(nextTime - now)
-		logger.Log.Debug("Waiting due to rate limiting",
+		logger.FromContext(ctx).Debug("Waiting due to rate limiting",
 			zap.Duration("wait", waitDuration),
 			zap.Time("until", time.Unix(0, nextTime)))
 
@@ -127,7 +200,7 @@ func waitIfNeeded(ctx context.Context) error {
 		case <-timer.C:
 			return nil
 		case <-ctx.Done():
-			logger.Log.Info("Wait cancelled by context", zap.Error(ctx.Err()))
+			logger.FromContext(ctx).Info("Wait cancelled by context", zap.Error(ctx.Err()))
 			return ctx.Err()
 		}
 	}
@@ -144,7 +217,34 @@ func setNextAllowedTime(waitDuration time.Duration) {
 		zap.Time("next_allowed", time.Unix(0, nextTime)))
 }
 
+// recordFailure учитывает ошибку соединения или ответ 5xx. После options.BreakerFailures ошибок подряд
+// запросы приостанавливаются на options.BreakerOpenDuration.
+func recordFailure(options *Options) {
+	if options.BreakerFailures <= 0 {
+		return
+	}
+	if consecutiveFailures.Add(1) < int64(options.BreakerFailures) {
+		return
+	}
+	consecutiveFailures.Store(0)
+	logger.Log.Warn("Accrual system keeps failing, pausing requests",
+		zap.Int("failures", options.BreakerFailures),
+		zap.Duration("open_duration", options.BreakerOpenDuration))
+	setNextAllowedTime(options.BreakerOpenDuration)
+}
+
+// BreakerState сообщает, приостановлены ли запросы к системе начислений после ответа 429
+// или серии ошибок, и до какого времени
+func BreakerState() (open bool, until time.Time) {
+	nextTime := nextAllowedRequestTime.Load()
+	if nextTime == 0 || time.Now().UnixNano() >= nextTime {
+		return false, time.Time{}
+	}
+	return true, time.Unix(0, nextTime)
+}
+
 func ResetNextAllowedTime() {
 	nextAllowedRequestTime.Store(0)
+	consecutiveFailures.Store(0)
 	logger.Log.Debug("Rate limit timer reset")
 }
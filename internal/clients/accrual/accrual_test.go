@@ -9,10 +9,17 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/Bessima/diplom-gomarket/internal/retry"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestNewAccrualClient(t *testing.T) {
@@ -277,3 +284,117 @@ func TestAccrualClient_Get_URLFormat(t *testing.T) {
 	assert.Equal(t, "PROCESSED", response.Status)
 	assert.Equal(t, float32(1000), response.Accrual)
 }
+
+func TestBreakerState(t *testing.T) {
+	ResetNextAllowedTime()
+
+	open, _ := BreakerState()
+	assert.False(t, open)
+
+	setNextAllowedTime(time.Minute)
+	open, until := BreakerState()
+	assert.True(t, open)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), until, time.Second)
+
+	ResetNextAllowedTime()
+	open, _ = BreakerState()
+	assert.False(t, open)
+}
+
+func TestAccrualClient_Get_PropagatesTraceContext(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		json.NewEncoder(w).Encode(AccrualResponse{Order: "123", Status: "PROCESSED"})
+	}))
+	defer server.Close()
+
+	_, err := NewAccrualClient(server.URL).Get(context.Background(), "123")
+	require.NoError(t, err)
+
+	spans := exporter.GetSpans()
+	var getSpan, attemptSpan *tracetest.SpanStub
+	for i := range spans {
+		switch spans[i].Name {
+		case "AccrualClient.Get":
+			getSpan = &spans[i]
+		case "retry.attempt":
+			attemptSpan = &spans[i]
+		}
+	}
+	require.NotNil(t, getSpan)
+	require.NotNil(t, attemptSpan)
+	// Запрос выполняется внутри попытки, поэтому в систему начислений передается спан попытки
+	assert.Equal(t, getSpan.SpanContext.SpanID(), attemptSpan.Parent.SpanID())
+	assert.Equal(t, fmt.Sprintf("00-%s-%s-01", attemptSpan.SpanContext.TraceID(), attemptSpan.SpanContext.SpanID()), traceparent)
+}
+
+func TestAccrualClient_SetOptions(t *testing.T) {
+	retry.SetPolicy(retry.RetryConfig{Name: retry.AccrualRetryConfig.Name, MaxRetries: 1})
+	t.Cleanup(func() {
+		retry.SetPolicy(retry.AccrualRetryConfig)
+		ResetNextAllowedTime()
+	})
+
+	var slow atomic.Bool
+	slow.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slow.Load() {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := NewAccrualClientWithOptions(server.URL, Options{RequestTimeout: 20 * time.Millisecond})
+
+	_, err := client.Get(context.Background(), "123")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), context.DeadlineExceeded.Error())
+
+	// Новые параметры применяются к следующему запросу без пересоздания клиента
+	slow.Store(false)
+	client.SetOptions(Options{RateLimitDelay: time.Minute})
+	_, err = client.Get(context.Background(), "123")
+	require.Error(t, err)
+
+	open, until := BreakerState()
+	assert.True(t, open)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), until, time.Second)
+}
+
+func TestAccrualClient_Get_OpensBreakerAfterFailures(t *testing.T) {
+	retry.SetPolicy(retry.RetryConfig{Name: retry.AccrualRetryConfig.Name, MaxRetries: 1})
+	t.Cleanup(func() {
+		retry.SetPolicy(retry.AccrualRetryConfig)
+		ResetNextAllowedTime()
+	})
+	ResetNextAllowedTime()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := NewAccrualClientWithOptions(server.URL, Options{BreakerFailures: 2, BreakerOpenDuration: time.Minute})
+
+	_, err := client.Get(context.Background(), "123")
+	require.Error(t, err)
+	open, _ := BreakerState()
+	assert.False(t, open)
+
+	_, err = client.Get(context.Background(), "123")
+	require.Error(t, err)
+	open, until := BreakerState()
+	assert.True(t, open)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), until, time.Second)
+}
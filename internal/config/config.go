@@ -1,43 +1,239 @@
 package config
 
 import (
+	"fmt"
 	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"github.com/Bessima/diplom-gomarket/internal/retry"
 	"github.com/caarlos0/env"
-	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"math"
+	"os"
+	"slices"
 	"strings"
+	"time"
 )
 
 const DefaultSecretKey = "your-secret-key-change-this-in-production"
 
+// DefaultOutboxRetention срок хранения опубликованных событий outbox
+const DefaultOutboxRetention = 7 * 24 * time.Hour
+
+// DefaultDatabaseQueryTimeout ограничение времени обращения к базе по умолчанию
+const DefaultDatabaseQueryTimeout = 10 * time.Second
+
+// DefaultDatabaseReplicaMaxStaleness допустимое отставание реплики для чтения по умолчанию
+const DefaultDatabaseReplicaMaxStaleness = 5 * time.Second
+
+// DefaultCacheSize и DefaultCacheTTL размер кешей пользователей и балансов и срок хранения значений
+const (
+	DefaultCacheSize = 10000
+	DefaultCacheTTL  = time.Minute
+)
+
+// DefaultHTTPShutdownTimeout время на завершение активных HTTP-запросов при остановке
+const DefaultHTTPShutdownTimeout = 5 * time.Second
+
+// DefaultWorkerShutdownTimeout время на завершение начатых запросов к системе начислений и записей в базу при остановке
+const DefaultWorkerShutdownTimeout = 15 * time.Second
+
+// DefaultTransferDailyLimit суточный лимит переводов между пользователями в баллах
+const DefaultTransferDailyLimit = 10000
+
+const (
+	DefaultAccrualWorkers        = 5
+	DefaultOrderQueueSize        = 5
+	DefaultAccrualErrorDelay     = 10 * time.Second
+	DefaultAccrualRateLimitDelay = 30 * time.Second
+	// DefaultAccrualBreakerFailures ошибок подряд, после которых запросы к системе начислений приостанавливаются
+	DefaultAccrualBreakerFailures     = 5
+	DefaultAccrualBreakerOpenDuration = 30 * time.Second
+	DefaultJWTAccessTokenTTL          = 15 * time.Minute
+	DefaultJWTRefreshTokenTTL         = 7 * 24 * time.Hour
+	DefaultLogLevel                   = "debug"
+)
+
+// Хранилища, выбираемые схемой DATABASE_URI
+const (
+	StoragePostgres = "postgres"
+	// StorageMemory данные в памяти процесса для локальных демонстраций, DATABASE_URI=memory://
+	StorageMemory = "memory"
+	// StorageSQLite файл SQLite для установок на одном сервере, DATABASE_URI=sqlite:///path/to/gophermart.db
+	StorageSQLite = "sqlite"
+)
+
+// configEnvName переменная окружения с путем к файлу конфигурации, если не задан флаг -c
+const configEnvName = "CONFIG"
+
+// Config параметры сервиса. Источники в порядке возрастания приоритета: значения по умолчанию,
+// файл конфигурации (-c или CONFIG), переменные окружения, флаги командной строки.
+// Ключи файла совпадают с именами переменных окружения в нижнем регистре.
 type Config struct {
-	Address string `env:"RUN_ADDRESS"`
+	Address string `env:"RUN_ADDRESS" yaml:"run_address"`
 
-	DatabaseDNS    string `env:"DATABASE_URI"`
-	AccrualAddress string `env:"ACCRUAL_SYSTEM_ADDRESS"`
+	DatabaseDNS string `env:"DATABASE_URI" yaml:"database_uri"`
+	// DatabaseQueryTimeout ограничение времени одного обращения к базе вместе с повторными попытками, 0 - без ограничения
+	DatabaseQueryTimeout time.Duration `env:"DATABASE_QUERY_TIMEOUT" yaml:"database_query_timeout"`
+	// AutoMigrate применять встроенные миграции при старте. Отключается, если схемой управляет
+	// отдельная задача (gophermart migrate up)
+	AutoMigrate bool `env:"AUTO_MIGRATE" yaml:"auto_migrate"`
+	// DatabaseRetryMaxAttempts и DatabaseRetryDelays повторы запросов к базе при ошибках соединения
+	DatabaseRetryMaxAttempts int             `env:"DATABASE_RETRY_MAX_ATTEMPTS" yaml:"database_retry_max_attempts"`
+	DatabaseRetryDelays      []time.Duration `env:"DATABASE_RETRY_DELAYS" yaml:"database_retry_delays"`
+	// DatabaseReplicaDNS реплика Postgres для списков заказов, списаний и баланса, пустое значение - читать с основного сервера.
+	// Реплика не используется, если отстает больше чем на DatabaseReplicaMaxStaleness.
+	DatabaseReplicaDNS          string        `env:"DATABASE_REPLICA_URI" yaml:"database_replica_uri"`
+	DatabaseReplicaMaxStaleness time.Duration `env:"DATABASE_REPLICA_MAX_STALENESS" yaml:"database_replica_max_staleness"`
+	// CacheSize число пользователей и балансов в кеше каждого вида, 0 отключает кеш. Кеш работает только с Postgres:
+	// изменения других реплик приходят через LISTEN/NOTIFY. CacheTTL ограничивает срок хранения значения, 0 - без ограничения
+	CacheSize int           `env:"CACHE_SIZE" yaml:"cache_size"`
+	CacheTTL  time.Duration `env:"CACHE_TTL" yaml:"cache_ttl"`
 
-	SecretKey string `env:"SECRET_KEY"`
+	AccrualAddress string `env:"ACCRUAL_SYSTEM_ADDRESS" yaml:"accrual_system_address"`
+	// AccrualWorkers число воркеров опроса системы начислений, OrderQueueSize размер очереди заказов в памяти
+	AccrualWorkers int `env:"ACCRUAL_WORKERS" yaml:"accrual_workers"`
+	OrderQueueSize int `env:"ORDER_QUEUE_SIZE" yaml:"order_queue_size"`
+	// AccrualRequestTimeout ограничение одного HTTP-запроса к системе начислений, 0 - без ограничения
+	AccrualRequestTimeout time.Duration `env:"ACCRUAL_REQUEST_TIMEOUT" yaml:"accrual_request_timeout"`
+	// AccrualRateLimitDelay пауза в запросах после ответа 429
+	AccrualRateLimitDelay time.Duration `env:"ACCRUAL_RATE_LIMIT_DELAY" yaml:"accrual_rate_limit_delay"`
+	// AccrualBreakerFailures ошибок соединения или ответов 5xx подряд, после которых запросы к системе
+	// начислений приостанавливаются на AccrualBreakerOpenDuration, 0 - не приостанавливать
+	AccrualBreakerFailures     int           `env:"ACCRUAL_BREAKER_FAILURES" yaml:"accrual_breaker_failures"`
+	AccrualBreakerOpenDuration time.Duration `env:"ACCRUAL_BREAKER_OPEN_DURATION" yaml:"accrual_breaker_open_duration"`
+	// AccrualErrorDelay пауза перед возвратом заказа в очередь после ошибки системы начислений
+	AccrualErrorDelay       time.Duration   `env:"ACCRUAL_ERROR_DELAY" yaml:"accrual_error_delay"`
+	AccrualRetryMaxAttempts int             `env:"ACCRUAL_RETRY_MAX_ATTEMPTS" yaml:"accrual_retry_max_attempts"`
+	AccrualRetryDelays      []time.Duration `env:"ACCRUAL_RETRY_DELAYS" yaml:"accrual_retry_delays"`
+
+	SecretKey          string        `env:"SECRET_KEY" yaml:"secret_key"`
+	JWTAccessTokenTTL  time.Duration `env:"JWT_ACCESS_TOKEN_TTL" yaml:"jwt_access_token_ttl"`
+	JWTRefreshTokenTTL time.Duration `env:"JWT_REFRESH_TOKEN_TTL" yaml:"jwt_refresh_token_ttl"`
+
+	// TransferDailyLimit суточный лимит переводов в баллах, сутки отсчитываются от полуночи по UTC
+	TransferDailyLimit float64 `env:"TRANSFER_DAILY_LIMIT" yaml:"transfer_daily_limit"`
+
+	// AdminToken токен для /api/admin, пустое значение отключает административные эндпоинты
+	AdminToken string `env:"ADMIN_TOKEN" yaml:"admin_token"`
+
+	// OutboxSinks приемники событий outbox через запятую: log, file, http, bus
+	OutboxSinks     string        `env:"OUTBOX_SINKS" yaml:"outbox_sinks"`
+	OutboxFile      string        `env:"OUTBOX_FILE" yaml:"outbox_file"`
+	OutboxHTTPURL   string        `env:"OUTBOX_HTTP_URL" yaml:"outbox_http_url"`
+	OutboxRetention time.Duration `env:"OUTBOX_RETENTION" yaml:"outbox_retention"`
+
+	// SMTPAddress адрес SMTP-сервера host:port, пустое значение отключает канал email
+	SMTPAddress  string `env:"SMTP_ADDRESS" yaml:"smtp_address"`
+	SMTPUsername string `env:"SMTP_USERNAME" yaml:"smtp_username"`
+	SMTPPassword string `env:"SMTP_PASSWORD" yaml:"smtp_password"`
+	SMTPFrom     string `env:"SMTP_FROM" yaml:"smtp_from"`
+	// NotificationsFile файл канала log, по умолчанию уведомления пишутся в лог сервиса
+	NotificationsFile string `env:"NOTIFICATIONS_FILE" yaml:"notifications_file"`
+
+	// TracingExporter экспорт трасс: none, stdout, file или otlp (адрес из OTEL_EXPORTER_OTLP_ENDPOINT)
+	TracingExporter    string  `env:"TRACING_EXPORTER" yaml:"tracing_exporter"`
+	TracingFile        string  `env:"TRACING_FILE" yaml:"tracing_file"`
+	TracingSampleRatio float64 `env:"TRACING_SAMPLE_RATIO" yaml:"tracing_sample_ratio"`
+
+	// LogLevel уровень логов сервиса
+	LogLevel string `env:"LOG_LEVEL" yaml:"log_level"`
+	// AccessLogLevel уровень записей журнала доступа, AccessLogSampleRate доля записываемых запросов от 0 до 1
+	AccessLogLevel      string  `env:"ACCESS_LOG_LEVEL" yaml:"access_log_level"`
+	AccessLogSampleRate float64 `env:"ACCESS_LOG_SAMPLE_RATE" yaml:"access_log_sample_rate"`
+
+	// HTTPShutdownTimeout и WorkerShutdownTimeout ограничивают остановку сервиса: сначала ждем активные
+	// HTTP-запросы, затем воркеры начислений и фоновые задачи
+	HTTPShutdownTimeout   time.Duration `env:"HTTP_SHUTDOWN_TIMEOUT" yaml:"http_shutdown_timeout"`
+	WorkerShutdownTimeout time.Duration `env:"WORKER_SHUTDOWN_TIMEOUT" yaml:"worker_shutdown_timeout"`
+
+	// File путь к загруженному файлу конфигурации, PrintConfig режим вывода итоговой конфигурации,
+	// Args позиционные аргументы после флагов, например аргументы подкоманды
+	File        string   `env:"-" yaml:"-"`
+	PrintConfig bool     `env:"-" yaml:"-"`
+	Args        []string `env:"-" yaml:"-"`
+}
+
+// Default возвращает конфигурацию со значениями по умолчанию
+func Default() Config {
+	return Config{
+		Address:                     ":8080",
+		DatabaseQueryTimeout:        DefaultDatabaseQueryTimeout,
+		DatabaseReplicaMaxStaleness: DefaultDatabaseReplicaMaxStaleness,
+		AutoMigrate:                 true,
+		CacheSize:                   DefaultCacheSize,
+		CacheTTL:                    DefaultCacheTTL,
+		DatabaseRetryMaxAttempts:    retry.PostgresStorageRetryConfig.MaxRetries,
+		DatabaseRetryDelays:         slices.Clone(retry.PostgresStorageRetryConfig.Delays),
+		AccrualWorkers:              DefaultAccrualWorkers,
+		OrderQueueSize:              DefaultOrderQueueSize,
+		AccrualRateLimitDelay:       DefaultAccrualRateLimitDelay,
+		AccrualBreakerFailures:      DefaultAccrualBreakerFailures,
+		AccrualBreakerOpenDuration:  DefaultAccrualBreakerOpenDuration,
+		AccrualErrorDelay:           DefaultAccrualErrorDelay,
+		AccrualRetryMaxAttempts:     retry.AccrualRetryConfig.MaxRetries,
+		AccrualRetryDelays:          slices.Clone(retry.AccrualRetryConfig.Delays),
+		SecretKey:                   DefaultSecretKey,
+		JWTAccessTokenTTL:           DefaultJWTAccessTokenTTL,
+		JWTRefreshTokenTTL:          DefaultJWTRefreshTokenTTL,
+		TransferDailyLimit:          DefaultTransferDailyLimit,
+		OutboxSinks:                 "log,bus",
+		OutboxRetention:             DefaultOutboxRetention,
+		TracingExporter:             "none",
+		TracingSampleRatio:          1,
+		LogLevel:                    DefaultLogLevel,
+		AccessLogLevel:              "info",
+		AccessLogSampleRate:         1,
+		HTTPShutdownTimeout:         DefaultHTTPShutdownTimeout,
+		WorkerShutdownTimeout:       DefaultWorkerShutdownTimeout,
+	}
 }
 
-func InitConfig() *Config {
+// InitConfig читает конфигурацию из аргументов запуска, файла и окружения и проверяет ее
+func InitConfig() (*Config, error) {
+	return Load(os.Args[1:])
+}
+
+// Load собирает конфигурацию и проверяет ее.
+// Ошибка проверки возвращается вместе с конфигурацией, чтобы --print-config мог показать, что получилось.
+func Load(args []string) (*Config, error) {
+	cfg, err := Read(args)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// Read собирает конфигурацию без проверки: значения по умолчанию, затем файл, окружение и явно заданные флаги.
+// Подкоманды, которым нужна только часть параметров, проверяют их сами.
+func Read(args []string) (*Config, error) {
 	flags := Flags{}
-	flags.Init()
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
 
-	cfg := Config{
-		Address:        flags.address,
-		DatabaseDNS:    flags.dbDNS,
-		AccrualAddress: flags.accrualAddress,
-		SecretKey:      DefaultSecretKey,
+	cfg := Default()
+	cfg.File = flags.configFile
+	if cfg.File == "" {
+		cfg.File = os.Getenv(configEnvName)
+	}
+	if cfg.File != "" {
+		if err := cfg.loadFile(cfg.File); err != nil {
+			return nil, err
+		}
 	}
-	cfg.parseEnv()
 
-	return &cfg
+	if err := cfg.parseEnv(); err != nil {
+		return nil, err
+	}
+	flags.apply(&cfg)
+
+	return &cfg, nil
 }
 
-func (cfg *Config) parseEnv() {
-	err := env.Parse(cfg)
-	if err != nil {
-		logger.Log.Warn("Getting an error while parsing the configuration", zap.String("customerror", err.Error()))
+func (cfg *Config) parseEnv() error {
+	if err := env.Parse(cfg); err != nil {
+		return fmt.Errorf("invalid environment variable: %w", err)
 	}
+	return nil
 }
 
 func (cfg *Config) GetAccrualAddressWithProtocol() string {
@@ -49,3 +245,47 @@ func (cfg *Config) GetAccrualAddressWithProtocol() string {
 	}
 	return http + cfg.AccrualAddress
 }
+
+// GetStorageBackend хранилище по схеме DATABASE_URI. Строки подключения Postgres в формате
+// key=value схемы не имеют, поэтому все, кроме memory:// и sqlite://, считается Postgres.
+func (cfg *Config) GetStorageBackend() string {
+	for _, backend := range []string{StorageMemory, StorageSQLite} {
+		if strings.HasPrefix(cfg.DatabaseDNS, backend+"://") {
+			return backend
+		}
+	}
+	return StoragePostgres
+}
+
+// GetTransferDailyLimit возвращает суточный лимит переводов в копейках
+func (cfg *Config) GetTransferDailyLimit() int64 {
+	return int64(math.Round(cfg.TransferDailyLimit * 100))
+}
+
+func (cfg *Config) GetOutboxSinkNames() []string {
+	return strings.Split(cfg.OutboxSinks, ",")
+}
+
+func (cfg *Config) GetAccessLogConfig() (logger.AccessLogConfig, error) {
+	level, err := zapcore.ParseLevel(cfg.AccessLogLevel)
+	if err != nil {
+		return logger.AccessLogConfig{}, err
+	}
+	return logger.AccessLogConfig{Level: level, SampleRate: cfg.AccessLogSampleRate}, nil
+}
+
+// GetAccrualRetryConfig политика повторов запросов к системе начислений с учетом конфигурации
+func (cfg *Config) GetAccrualRetryConfig() retry.RetryConfig {
+	policy := retry.AccrualRetryConfig
+	policy.MaxRetries = cfg.AccrualRetryMaxAttempts
+	policy.Delays = cfg.AccrualRetryDelays
+	return policy
+}
+
+// GetDatabaseRetryConfig политика повторов запросов к базе с учетом конфигурации
+func (cfg *Config) GetDatabaseRetryConfig() retry.RetryConfig {
+	policy := retry.PostgresStorageRetryConfig
+	policy.MaxRetries = cfg.DatabaseRetryMaxAttempts
+	policy.Delays = cfg.DatabaseRetryDelays
+	return policy
+}
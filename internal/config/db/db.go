@@ -3,20 +3,28 @@ package db
 import (
 	"context"
 	"fmt"
-	"github.com/golang-migrate/migrate/v4"
-	"github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/jackc/pgx/v5/stdlib"
 	"log"
+	"time"
 )
 
 type DB struct {
 	Pool PgxPoolInterface
+
+	// QueryTimeout ограничение времени одного вызова репозитория вместе с повторными попытками, 0 - без ограничения
+	QueryTimeout time.Duration
+
+	// schemaVersion версия схемы после успешного применения миграций при старте, 0 - миграции не применены
+	schemaVersion uint
+
+	// replica реплика для чтения, nil если не подключена
+	replica *replica
 }
 
-func NewDB(ctx context.Context, dns string) (*DB, error) {
-	dbPool, err := pgxpool.New(ctx, dns)
+// NewDB подключается к базе. При autoMigrate применяет встроенные миграции, иначе только
+// запоминает ожидаемую версию схемы: ее применяет отдельная задача, а до тех пор сервис не готов.
+func NewDB(ctx context.Context, dns string, autoMigrate bool) (*DB, error) {
+	dbPool, err := NewPool(ctx, dns)
 	if err != nil {
 		return nil, err
 	}
@@ -24,7 +32,15 @@ func NewDB(ctx context.Context, dns string) (*DB, error) {
 	if err := dbPool.Ping(ctx); err != nil {
 		return &DB{Pool: dbPool}, err
 	}
+
 	obj := DB{Pool: dbPool}
+	if !autoMigrate {
+		obj.schemaVersion, err = LatestMigration()
+		if err != nil {
+			return &obj, err
+		}
+		return &obj, nil
+	}
 
 	err = obj.runMigrations()
 	if err != nil {
@@ -34,40 +50,71 @@ func NewDB(ctx context.Context, dns string) (*DB, error) {
 	return &obj, nil
 }
 
-func (db *DB) runMigrations() error {
-	// Получаем конфиг из пула
-	config := db.Pool.Config()
-
-	// Создаем стандартное sql.DB подключение через pgx
-	sqlDB := stdlib.OpenDB(*config.ConnConfig)
-	defer sqlDB.Close()
-
-	// Создаем драйвер для миграций
-	driver, err := postgres.WithInstance(sqlDB, &postgres.Config{})
+// NewPool создает пул соединений с трассировкой запросов
+func NewPool(ctx context.Context, dns string) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(dns)
 	if err != nil {
-		return fmt.Errorf("could not create driver: %w", err)
+		return nil, err
 	}
+	poolConfig.ConnConfig.Tracer = queryTracer{}
+
+	return pgxpool.NewWithConfig(ctx, poolConfig)
+}
 
-	m, err := migrate.NewWithDatabaseInstance(
-		"file://migrations",
-		"postgres",
-		driver,
-	)
+func (db *DB) runMigrations() error {
+	migrator, err := NewMigrator(db.Pool)
 	if err != nil {
-		return fmt.Errorf("could not create migrate instance: %w", err)
+		return err
 	}
+	defer migrator.Close()
 
-	err = m.Up()
-	if err != nil && err != migrate.ErrNoChange {
+	if err := migrator.Up(); err != nil {
 		return fmt.Errorf("could not run migrations: %w", err)
 	}
 
+	version, _, err := migrator.Version()
+	if err != nil {
+		return fmt.Errorf("could not get migration version: %w", err)
+	}
+	db.schemaVersion = version
 	log.Println("Migrations applied successfully")
 	return nil
 }
 
+// CheckMigrations проверяет, что схема в базе не ниже примененной при старте и не в состоянии dirty
+func (db *DB) CheckMigrations(ctx context.Context) error {
+	if db.schemaVersion == 0 {
+		return fmt.Errorf("migrations were not applied")
+	}
+
+	var version int64
+	var dirty bool
+	err := db.Pool.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		return fmt.Errorf("could not get migration version: %w", err)
+	}
+	if dirty {
+		return fmt.Errorf("migration %d is dirty", version)
+	}
+	if uint(version) < db.schemaVersion {
+		return fmt.Errorf("schema version %d is lower than expected %d", version, db.schemaVersion)
+	}
+	return nil
+}
+
+// WithQueryTimeout ограничивает контекст вызова репозитория значением QueryTimeout
+func (db *DB) WithQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if db.QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, db.QueryTimeout)
+}
+
 func (db *DB) Close() {
 	if db.Pool != nil {
 		db.Pool.Close()
 	}
+	if db.replica != nil {
+		db.replica.pool.Close()
+	}
 }
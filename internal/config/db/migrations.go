@@ -0,0 +1,192 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Bessima/diplom-gomarket/migrations"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// MigrationStatus состояние схемы: примененная версия и последняя доступная во встроенных миграциях
+type MigrationStatus struct {
+	Version uint
+	Dirty   bool
+	Latest  uint
+	// Pending версии, которые еще не применены
+	Pending []uint
+}
+
+// Migrator применяет встроенные миграции к базе
+type Migrator struct {
+	migrate *migrate.Migrate
+	// fsys миграции, из которых берется список доступных версий для Status
+	fsys fs.FS
+}
+
+func NewMigrator(pool PgxPoolInterface) (*Migrator, error) {
+	sourceDriver, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		return nil, fmt.Errorf("could not open embedded migrations: %w", err)
+	}
+
+	// Создаем стандартное sql.DB подключение через pgx
+	// Соединение закрывается драйвером миграций в Close
+	sqlDB := stdlib.OpenDB(*pool.Config().ConnConfig)
+
+	// Создаем драйвер для миграций
+	driver, err := postgres.WithInstance(sqlDB, &postgres.Config{})
+	if err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("could not create driver: %w", err)
+	}
+
+	m, err := migrate.NewWithInstance("iofs", sourceDriver, "postgres", driver)
+	if err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("could not create migrate instance: %w", err)
+	}
+	return &Migrator{migrate: m, fsys: migrations.FS}, nil
+}
+
+// Up применяет все непримененные миграции
+func (migrator *Migrator) Up() error {
+	return ignoreNoChange(migrator.migrate.Up())
+}
+
+// Steps применяет n миграций вперед или откатывает -n миграций назад
+func (migrator *Migrator) Steps(n int) error {
+	return ignoreNoChange(migrator.migrate.Steps(n))
+}
+
+// Force записывает версию схемы без выполнения миграций и снимает признак dirty
+func (migrator *Migrator) Force(version int) error {
+	return migrator.migrate.Force(version)
+}
+
+// Version текущая версия схемы, 0 если миграции еще не применялись
+func (migrator *Migrator) Version() (uint, bool, error) {
+	version, dirty, err := migrator.migrate.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
+
+func (migrator *Migrator) Status() (MigrationStatus, error) {
+	version, dirty, err := migrator.Version()
+	if err != nil {
+		return MigrationStatus{}, fmt.Errorf("could not get migration version: %w", err)
+	}
+	available, err := availableMigrations(migrator.fsys)
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+
+	status := MigrationStatus{Version: version, Dirty: dirty}
+	for _, v := range available {
+		status.Latest = v
+		if v > version {
+			status.Pending = append(status.Pending, v)
+		}
+	}
+	return status, nil
+}
+
+func (migrator *Migrator) Close() error {
+	sourceErr, databaseErr := migrator.migrate.Close()
+	return errors.Join(sourceErr, databaseErr)
+}
+
+// AvailableMigrations версии встроенных миграций Postgres по возрастанию
+func AvailableMigrations() ([]uint, error) {
+	return availableMigrations(migrations.FS)
+}
+
+func availableMigrations(fsys fs.FS) ([]uint, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	var versions []uint
+	seen := make(map[uint]bool)
+	for _, entry := range entries {
+		migration, err := source.DefaultParse(entry.Name())
+		if err != nil {
+			continue
+		}
+		if !seen[migration.Version] {
+			seen[migration.Version] = true
+			versions = append(versions, migration.Version)
+		}
+	}
+	return versions, nil
+}
+
+// LatestMigration последняя версия среди встроенных миграций Postgres
+func LatestMigration() (uint, error) {
+	return latestMigration(migrations.FS)
+}
+
+func latestMigration(fsys fs.FS) (uint, error) {
+	versions, err := availableMigrations(fsys)
+	if err != nil {
+		return 0, err
+	}
+	if len(versions) == 0 {
+		return 0, fmt.Errorf("no embedded migrations")
+	}
+	return versions[len(versions)-1], nil
+}
+
+func ignoreNoChange(err error) error {
+	if errors.Is(err, migrate.ErrNoChange) {
+		return nil
+	}
+	return err
+}
+
+var migrationNamePattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// CreateMigration создает в dir пустые файлы up и down со следующим номером версии и возвращает их пути
+func CreateMigration(dir, name string) (string, string, error) {
+	name = strings.Trim(migrationNamePattern.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return "", "", fmt.Errorf("migration name must contain letters or digits")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", "", fmt.Errorf("could not read migrations dir: %w", err)
+	}
+	var latest uint
+	for _, entry := range entries {
+		migration, err := source.DefaultParse(entry.Name())
+		if err == nil && migration.Version > latest {
+			latest = migration.Version
+		}
+	}
+
+	base := filepath.Join(dir, fmt.Sprintf("%06d_%s", latest+1, name))
+	up, down := base+".up.sql", base+".down.sql"
+	for _, path := range []string{up, down} {
+		// O_EXCL не дает затереть существующий файл
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err != nil {
+			return "", "", err
+		}
+		if err := file.Close(); err != nil {
+			return "", "", err
+		}
+	}
+	return up, down, nil
+}
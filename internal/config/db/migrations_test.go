@@ -0,0 +1,58 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Bessima/diplom-gomarket/migrations"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAvailableMigrations(t *testing.T) {
+	versions, err := AvailableMigrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, versions)
+
+	// Версии идут по возрастанию без пропусков
+	for i, version := range versions {
+		assert.Equal(t, uint(i+1), version)
+	}
+
+	latest, err := LatestMigration()
+	require.NoError(t, err)
+	assert.Equal(t, versions[len(versions)-1], latest)
+}
+
+func TestCreateMigration(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "000007_create_table.up.sql"), nil, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "000007_create_table.down.sql"), nil, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), nil, 0o644))
+
+	up, down, err := CreateMigration(dir, "Add user Email index")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "000008_add_user_email_index.up.sql"), up)
+	assert.Equal(t, filepath.Join(dir, "000008_add_user_email_index.down.sql"), down)
+	assert.FileExists(t, up)
+	assert.FileExists(t, down)
+
+	_, _, err = CreateMigration(dir, "!!!")
+	assert.Error(t, err)
+}
+
+func TestEmbeddedMigrationsSource(t *testing.T) {
+	sourceDriver, err := iofs.New(migrations.FS, ".")
+	require.NoError(t, err)
+	defer sourceDriver.Close()
+
+	first, err := sourceDriver.First()
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), first)
+
+	body, _, err := sourceDriver.ReadUp(first)
+	require.NoError(t, err)
+	defer body.Close()
+}
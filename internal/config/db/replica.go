@@ -0,0 +1,210 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/metrics"
+)
+
+const (
+	// replicaCheckInterval как часто измеряется отставание реплики
+	replicaCheckInterval = time.Second
+	// replicaCheckTimeout ограничение времени запроса отставания, чтобы недоступная реплика не задерживала чтение
+	replicaCheckTimeout = 500 * time.Millisecond
+)
+
+// replicaLagQuery отставание реплики в секундах. Если реплика применила весь полученный WAL, отставания нет,
+// даже когда на основном сервере давно не было транзакций и pg_last_xact_replay_timestamp устарел.
+const replicaLagQuery = `SELECT (CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0) END)::float8`
+
+// Причины выбора пула для чтения в метрике database_reads_total
+const (
+	readReasonReplica     = "replica"
+	readReasonRecentWrite = "recent_write"
+	readReasonLagging     = "lagging"
+	readReasonUnavailable = "unavailable"
+)
+
+var errReplicaNotChecked = errors.New("replica lag was not checked yet")
+
+type replicaReadKey struct{}
+
+// WithReplicaRead разрешает обслужить чтения в ctx репликой. Используется для данных, которые только
+// показываются пользователю: проверки перед списанием и переводом всегда читают основной сервер.
+func WithReplicaRead(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replicaReadKey{}, true)
+}
+
+// ReplicaReadAllowed сообщает, что данные ctx только показываются и могут немного отставать:
+// такие чтения обслуживаются репликой и кешем
+func ReplicaReadAllowed(ctx context.Context) bool {
+	allowed, _ := ctx.Value(replicaReadKey{}).(bool)
+	return allowed
+}
+
+// replica пул реплики для чтения и состояние, по которому решается, можно ли ей пользоваться
+type replica struct {
+	pool PgxPoolInterface
+	// maxStaleness допустимое отставание реплики
+	maxStaleness time.Duration
+
+	mu        sync.Mutex
+	checking  bool
+	checkedAt time.Time
+	lag       time.Duration
+	lagErr    error
+
+	writesMu sync.Mutex
+	writes   map[int]time.Time
+	prunedAt time.Time
+}
+
+// SetReplica подключает пул реплики. Чтения, разрешенные WithReplicaRead, идут в реплику,
+// пока ее отставание не превышает maxStaleness.
+func (db *DB) SetReplica(pool PgxPoolInterface, maxStaleness time.Duration) {
+	db.replica = &replica{
+		pool:         pool,
+		maxStaleness: maxStaleness,
+		lagErr:       errReplicaNotChecked,
+		writes:       make(map[int]time.Time),
+	}
+}
+
+// ConnectReplica подключается к реплике dns и использует ее для чтения
+func (db *DB) ConnectReplica(ctx context.Context, dns string, maxStaleness time.Duration) error {
+	pool, err := NewPool(ctx, dns)
+	if err != nil {
+		return fmt.Errorf("unable to connect to replica: %w", err)
+	}
+	db.SetReplica(pool, maxStaleness)
+	return nil
+}
+
+// HasReplica сообщает, подключена ли реплика
+func (db *DB) HasReplica() bool {
+	return db.replica != nil
+}
+
+// ReadPool пул для чтения данных пользователя userID. Реплика выбирается, только если чтение разрешено
+// WithReplicaRead, пользователь недавно ничего не записывал и отставание реплики в допустимых пределах.
+func (db *DB) ReadPool(ctx context.Context, userID int) PgxPoolInterface {
+	if db.replica == nil || !ReplicaReadAllowed(ctx) {
+		return db.Pool
+	}
+
+	reason := db.replica.route(ctx, userID)
+	if reason != readReasonReplica {
+		metrics.DatabaseReads.WithLabelValues("primary", reason).Inc()
+		return db.Pool
+	}
+	metrics.DatabaseReads.WithLabelValues("replica", reason).Inc()
+	return db.replica.pool
+}
+
+// MarkWrite запоминает запись от имени пользователя: пока реплика может ее не содержать,
+// его чтения идут в основной сервер, и пользователь сразу видит свой заказ или списание.
+// Записи запоминаются в памяти процесса. О записях других экземпляров сервиса MarkWrite вызывается
+// по уведомлениям базы (events.CacheInvalidationChannel), которые приходят после фиксации транзакции.
+func (db *DB) MarkWrite(userIDs ...int) {
+	if db.replica == nil {
+		return
+	}
+	db.replica.markWrite(userIDs...)
+}
+
+// ReplicaLag последнее измеренное отставание реплики
+func (db *DB) ReplicaLag() (time.Duration, error) {
+	if db.replica == nil {
+		return 0, errors.New("replica is not configured")
+	}
+	db.replica.mu.Lock()
+	defer db.replica.mu.Unlock()
+	return db.replica.lag, db.replica.lagErr
+}
+
+// PingReplica проверяет доступность реплики
+func (db *DB) PingReplica(ctx context.Context) error {
+	if db.replica == nil {
+		return nil
+	}
+	return db.replica.pool.Ping(ctx)
+}
+
+func (replica *replica) route(ctx context.Context, userID int) string {
+	if replica.recentWrite(userID) {
+		return readReasonRecentWrite
+	}
+	lag, err := replica.currentLag(ctx)
+	if err != nil {
+		return readReasonUnavailable
+	}
+	if lag > replica.maxStaleness {
+		return readReasonLagging
+	}
+	return readReasonReplica
+}
+
+// currentLag отставание реплики. Раз в replicaCheckInterval его измеряет один из вызывающих,
+// остальные тем временем используют предыдущее значение.
+func (replica *replica) currentLag(ctx context.Context) (time.Duration, error) {
+	replica.mu.Lock()
+	if replica.checking || time.Since(replica.checkedAt) < replicaCheckInterval {
+		defer replica.mu.Unlock()
+		return replica.lag, replica.lagErr
+	}
+	replica.checking = true
+	replica.mu.Unlock()
+
+	// Отмена запроса пользователя не должна оставлять реплику помеченной как недоступная
+	checkCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), replicaCheckTimeout)
+	defer cancel()
+	var seconds float64
+	err := replica.pool.QueryRow(checkCtx, replicaLagQuery).Scan(&seconds)
+	lag := time.Duration(seconds * float64(time.Second))
+
+	replica.mu.Lock()
+	defer replica.mu.Unlock()
+	replica.checking = false
+	replica.checkedAt = time.Now()
+	replica.lag, replica.lagErr = lag, err
+	return lag, err
+}
+
+// writeWindow сколько после записи чтения пользователя идут в основной сервер. Реплика используется
+// только при отставании не больше maxStaleness, а отставание могло вырасти с последнего измерения.
+func (replica *replica) writeWindow() time.Duration {
+	return replica.maxStaleness + replicaCheckInterval
+}
+
+func (replica *replica) markWrite(userIDs ...int) {
+	replica.writesMu.Lock()
+	defer replica.writesMu.Unlock()
+
+	now := time.Now()
+	for _, userID := range userIDs {
+		replica.writes[userID] = now
+	}
+
+	// Записи старше окна больше не влияют на выбор пула
+	if now.Sub(replica.prunedAt) < replica.writeWindow() {
+		return
+	}
+	replica.prunedAt = now
+	for userID, writtenAt := range replica.writes {
+		if now.Sub(writtenAt) >= replica.writeWindow() {
+			delete(replica.writes, userID)
+		}
+	}
+}
+
+func (replica *replica) recentWrite(userID int) bool {
+	replica.writesMu.Lock()
+	defer replica.writesMu.Unlock()
+	writtenAt, ok := replica.writes[userID]
+	return ok && time.Since(writtenAt) < replica.writeWindow()
+}
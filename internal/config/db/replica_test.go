@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newReplicaTestDB(t *testing.T, maxStaleness time.Duration) (*DB, pgxmock.PgxPoolIface, pgxmock.PgxPoolIface) {
+	t.Helper()
+	primary, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	replicaPool, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, primary.ExpectationsWereMet())
+		assert.NoError(t, replicaPool.ExpectationsWereMet())
+	})
+
+	dbObj := &DB{Pool: primary}
+	dbObj.SetReplica(replicaPool, maxStaleness)
+	return dbObj, primary, replicaPool
+}
+
+func expectLag(replicaPool pgxmock.PgxPoolIface, seconds float64) {
+	replicaPool.ExpectQuery("pg_last_wal_replay_lsn").
+		WillReturnRows(pgxmock.NewRows([]string{"lag"}).AddRow(seconds))
+}
+
+func TestDB_ReadPool_WithoutReplica(t *testing.T) {
+	primary, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	dbObj := &DB{Pool: primary}
+
+	assert.Same(t, primary, dbObj.ReadPool(WithReplicaRead(context.Background()), 1))
+	assert.False(t, dbObj.HasReplica())
+	// Без реплики запись не запоминается
+	dbObj.MarkWrite(1)
+}
+
+func TestDB_ReadPool_RequiresReplicaRead(t *testing.T) {
+	dbObj, primary, _ := newReplicaTestDB(t, 5*time.Second)
+
+	// Чтения без WithReplicaRead, например проверка баланса перед списанием, идут в основной сервер
+	assert.Same(t, primary, dbObj.ReadPool(context.Background(), 1))
+}
+
+func TestDB_ReadPool_UsesReplicaWithinStaleness(t *testing.T) {
+	dbObj, _, replicaPool := newReplicaTestDB(t, 5*time.Second)
+	expectLag(replicaPool, 1.5)
+	ctx := WithReplicaRead(context.Background())
+
+	assert.Same(t, replicaPool, dbObj.ReadPool(ctx, 1))
+	// Отставание измеряется не чаще replicaCheckInterval
+	assert.Same(t, replicaPool, dbObj.ReadPool(ctx, 2))
+
+	lag, err := dbObj.ReplicaLag()
+	require.NoError(t, err)
+	assert.Equal(t, 1500*time.Millisecond, lag)
+}
+
+func TestDB_ReadPool_LaggingReplica(t *testing.T) {
+	dbObj, primary, replicaPool := newReplicaTestDB(t, 5*time.Second)
+	expectLag(replicaPool, 30)
+
+	assert.Same(t, primary, dbObj.ReadPool(WithReplicaRead(context.Background()), 1))
+}
+
+func TestDB_ReadPool_UnavailableReplica(t *testing.T) {
+	dbObj, primary, replicaPool := newReplicaTestDB(t, 5*time.Second)
+	replicaPool.ExpectQuery("pg_last_wal_replay_lsn").WillReturnError(errors.New("connection refused"))
+
+	assert.Same(t, primary, dbObj.ReadPool(WithReplicaRead(context.Background()), 1))
+	_, err := dbObj.ReplicaLag()
+	assert.Error(t, err)
+}
+
+func TestDB_ReadPool_ReadYourWrites(t *testing.T) {
+	dbObj, primary, replicaPool := newReplicaTestDB(t, 5*time.Second)
+	expectLag(replicaPool, 0)
+	ctx := WithReplicaRead(context.Background())
+
+	dbObj.MarkWrite(1, 2)
+
+	// Пользователи, которые только что записали данные, читают основной сервер, остальные - реплику
+	assert.Same(t, primary, dbObj.ReadPool(ctx, 1))
+	assert.Same(t, primary, dbObj.ReadPool(ctx, 2))
+	assert.Same(t, replicaPool, dbObj.ReadPool(ctx, 3))
+}
+
+func TestReplica_WriteWindowExpires(t *testing.T) {
+	dbObj, _, _ := newReplicaTestDB(t, 5*time.Second)
+	replica := dbObj.replica
+
+	replica.markWrite(1)
+	assert.True(t, replica.recentWrite(1))
+
+	replica.writes[1] = time.Now().Add(-replica.writeWindow())
+	assert.False(t, replica.recentWrite(1))
+
+	// Устаревшие записи удаляются при следующей записи
+	replica.prunedAt = time.Time{}
+	replica.markWrite(2)
+	assert.NotContains(t, replica.writes, 1)
+	assert.Contains(t, replica.writes, 2)
+}
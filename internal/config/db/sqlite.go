@@ -0,0 +1,186 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/migrations"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// SQLiteScheme схема DATABASE_URI для SQLite: sqlite:///var/lib/gophermart.db или sqlite://gophermart.db
+const SQLiteScheme = "sqlite://"
+
+// sqliteOptions параметры соединений драйвера go-sqlite3. Внешние ключи и CHECK работают как в Postgres,
+// WAL позволяет читать во время записи, а _txlock=immediate берет блокировку записи в начале транзакции,
+// чтобы одновременные транзакции ждали друг друга (busy_timeout), а не завершались ошибкой при обновлении.
+var sqliteOptions = map[string]string{
+	"_foreign_keys": "on",
+	"_busy_timeout": "5000",
+	"_journal_mode": "WAL",
+	"_txlock":       "immediate",
+	"_synchronous":  "NORMAL",
+}
+
+// SQLiteDB соединение с файлом SQLite
+type SQLiteDB struct {
+	SQL *sql.DB
+
+	// QueryTimeout ограничение времени одного вызова репозитория вместе с повторными попытками, 0 - без ограничения
+	QueryTimeout time.Duration
+
+	// schemaVersion версия схемы после успешного применения миграций при старте, 0 - миграции не применены
+	schemaVersion uint
+}
+
+// NewSQLiteDB открывает базу SQLite по строке sqlite://path. При autoMigrate применяет встроенные миграции SQLite.
+func NewSQLiteDB(ctx context.Context, dsn string, autoMigrate bool) (*SQLiteDB, error) {
+	driverDSN, err := SQLiteDriverDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := sql.Open("sqlite3", driverDSN)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := SQLiteDB{SQL: sqlDB}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return &obj, err
+	}
+
+	if !autoMigrate {
+		obj.schemaVersion, err = latestMigration(sqliteMigrationsFS())
+		return &obj, err
+	}
+
+	migrator, err := NewSQLiteMigrator(dsn)
+	if err != nil {
+		return &obj, err
+	}
+	defer migrator.Close()
+
+	if err := migrator.Up(); err != nil {
+		return &obj, fmt.Errorf("could not run migrations: %w", err)
+	}
+	obj.schemaVersion, _, err = migrator.Version()
+	if err != nil {
+		return &obj, fmt.Errorf("could not get migration version: %w", err)
+	}
+	log.Println("Migrations applied successfully")
+	return &obj, nil
+}
+
+// SQLiteDriverDSN преобразует sqlite://path?params в строку подключения go-sqlite3.
+// Параметры из DATABASE_URI перекрывают параметры по умолчанию.
+func SQLiteDriverDSN(dsn string) (string, error) {
+	if !strings.HasPrefix(dsn, SQLiteScheme) {
+		return "", fmt.Errorf("sqlite database_uri must start with %s", SQLiteScheme)
+	}
+	path, rawQuery, _ := strings.Cut(strings.TrimPrefix(dsn, SQLiteScheme), "?")
+	if path == "" {
+		return "", fmt.Errorf("sqlite database_uri must contain a file path")
+	}
+	if path == ":memory:" {
+		// Каждое соединение пула получило бы свою пустую базу
+		return "", fmt.Errorf("sqlite in-memory database is not supported, use the memory:// storage instead")
+	}
+
+	params, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", fmt.Errorf("invalid sqlite database_uri parameters: %w", err)
+	}
+	for key, value := range sqliteOptions {
+		if !params.Has(key) {
+			params.Set(key, value)
+		}
+	}
+	return "file:" + path + "?" + params.Encode(), nil
+}
+
+// NewSQLiteMigrator применяет встроенные миграции SQLite к базе dsn через отдельное соединение,
+// которое закрывается в Close
+func NewSQLiteMigrator(dsn string) (*Migrator, error) {
+	driverDSN, err := SQLiteDriverDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	fsys := sqliteMigrationsFS()
+	sourceDriver, err := iofs.New(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("could not open embedded migrations: %w", err)
+	}
+
+	sqlDB, err := sql.Open("sqlite3", driverDSN)
+	if err != nil {
+		return nil, err
+	}
+	driver, err := sqlite3.WithInstance(sqlDB, &sqlite3.Config{})
+	if err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("could not create driver: %w", err)
+	}
+
+	m, err := migrate.NewWithInstance("iofs", sourceDriver, "sqlite3", driver)
+	if err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("could not create migrate instance: %w", err)
+	}
+	return &Migrator{migrate: m, fsys: fsys}, nil
+}
+
+func sqliteMigrationsFS() fs.FS {
+	fsys, err := fs.Sub(migrations.SQLiteFS, "sqlite")
+	if err != nil {
+		// Каталог встроен в бинарный файл директивой go:embed
+		panic(err)
+	}
+	return fsys
+}
+
+// CheckMigrations проверяет, что схема в базе не ниже примененной при старте и не в состоянии dirty
+func (db *SQLiteDB) CheckMigrations(ctx context.Context) error {
+	if db.schemaVersion == 0 {
+		return fmt.Errorf("migrations were not applied")
+	}
+
+	var version int64
+	var dirty bool
+	err := db.SQL.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		return fmt.Errorf("could not get migration version: %w", err)
+	}
+	if dirty {
+		return fmt.Errorf("migration %d is dirty", version)
+	}
+	if uint(version) < db.schemaVersion {
+		return fmt.Errorf("schema version %d is lower than expected %d", version, db.schemaVersion)
+	}
+	return nil
+}
+
+// WithQueryTimeout ограничивает контекст вызова репозитория значением QueryTimeout
+func (db *SQLiteDB) WithQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if db.QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, db.QueryTimeout)
+}
+
+func (db *SQLiteDB) Ping(ctx context.Context) error {
+	return db.SQL.PingContext(ctx)
+}
+
+func (db *SQLiteDB) Close() {
+	if db.SQL != nil {
+		db.SQL.Close()
+	}
+}
@@ -0,0 +1,50 @@
+//go:build cgo
+
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteDriverDSN(t *testing.T) {
+	dsn, err := SQLiteDriverDSN("sqlite:///var/lib/gophermart.db?_busy_timeout=100")
+	require.NoError(t, err)
+	assert.Equal(t, "file:/var/lib/gophermart.db?_busy_timeout=100&_foreign_keys=on&_journal_mode=WAL&_synchronous=NORMAL&_txlock=immediate", dsn)
+
+	for _, invalid := range []string{"postgres://localhost/db", "sqlite://", "sqlite://:memory:", "sqlite://db?%zz"} {
+		_, err = SQLiteDriverDSN(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestSQLiteMigrator(t *testing.T) {
+	dsn := SQLiteScheme + filepath.Join(t.TempDir(), "gophermart.db")
+	migrator, err := NewSQLiteMigrator(dsn)
+	require.NoError(t, err)
+	defer migrator.Close()
+
+	status, err := migrator.Status()
+	require.NoError(t, err)
+	assert.Equal(t, uint(0), status.Version)
+	require.NotEmpty(t, status.Pending)
+
+	require.NoError(t, migrator.Up())
+	status, err = migrator.Status()
+	require.NoError(t, err)
+	assert.Equal(t, status.Latest, status.Version)
+	assert.Empty(t, status.Pending)
+
+	// База с примененными миграциями проходит проверку готовности без повторного применения
+	sqliteDB, err := NewSQLiteDB(context.Background(), dsn, false)
+	require.NoError(t, err)
+	defer sqliteDB.Close()
+	assert.NoError(t, sqliteDB.CheckMigrations(context.Background()))
+
+	require.NoError(t, migrator.Steps(-int(status.Version)))
+	assert.Error(t, sqliteDB.CheckMigrations(context.Background()))
+}
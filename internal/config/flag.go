@@ -11,13 +11,54 @@ type Flags struct {
 
 	dbDNS          string
 	accrualAddress string
+
+	configFile  string
+	printConfig bool
+	autoMigrate bool
+	args        []string
+
+	// set флаги, явно заданные при запуске: только они перекрывают файл и окружение
+	set map[string]bool
 }
 
-func (flags *Flags) Init() {
-	flag.StringVar(&flags.address, "a", ":8080", "Address and port to run server")
+// Parse разбирает аргументы запуска, неизвестные флаги приводят к ошибке
+func (flags *Flags) Parse(args []string) error {
+	flagSet := flag.NewFlagSet("gophermart", flag.ContinueOnError)
+
+	flagSet.StringVar(&flags.address, "a", ":8080", "Address and port to run server")
+
+	flagSet.StringVar(&flags.dbDNS, "d", defaultDBDNS, "db dns")
+	flagSet.StringVar(&flags.accrualAddress, "r", "", "accrual address")
 
-	flag.StringVar(&flags.dbDNS, "d", defaultDBDNS, "db dns")
-	flag.StringVar(&flags.accrualAddress, "r", "", "accrual address")
+	flagSet.StringVar(&flags.configFile, "c", "", "path to YAML or JSON config file (CONFIG)")
+	flagSet.BoolVar(&flags.printConfig, "print-config", false, "print effective config with secrets redacted and exit")
+	flagSet.BoolVar(&flags.autoMigrate, "auto-migrate", true, "apply embedded migrations at startup (AUTO_MIGRATE)")
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+
+	flags.args = flagSet.Args()
+	flags.set = make(map[string]bool)
+	flagSet.Visit(func(f *flag.Flag) {
+		flags.set[f.Name] = true
+	})
+	return nil
+}
 
-	flag.Parse()
+func (flags *Flags) apply(cfg *Config) {
+	if flags.set["a"] {
+		cfg.Address = flags.address
+	}
+	if flags.set["d"] {
+		cfg.DatabaseDNS = flags.dbDNS
+	}
+	if flags.set["r"] {
+		cfg.AccrualAddress = flags.accrualAddress
+	}
+	if flags.set["auto-migrate"] {
+		cfg.AutoMigrate = flags.autoMigrate
+	}
+	cfg.PrintConfig = flags.printConfig
+	cfg.Args = flags.args
 }
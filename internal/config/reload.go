@@ -0,0 +1,44 @@
+package config
+
+import (
+	"reflect"
+)
+
+// reloadableKeys параметры, которые можно менять без перезапуска по SIGHUP
+var reloadableKeys = map[string]bool{
+	"log_level":                     true,
+	"accrual_workers":               true,
+	"accrual_request_timeout":       true,
+	"accrual_rate_limit_delay":      true,
+	"accrual_breaker_failures":      true,
+	"accrual_breaker_open_duration": true,
+	"accrual_retry_max_attempts":    true,
+	"accrual_retry_delays":          true,
+	"database_retry_max_attempts":   true,
+	"database_retry_delays":         true,
+}
+
+// Reload переносит из next параметры, которые можно менять на лету, и возвращает ключи
+// остальных изменившихся параметров: они применяются только после перезапуска.
+func (cfg *Config) Reload(next *Config) (applied, ignored []string) {
+	current := reflect.ValueOf(cfg).Elem()
+	updated := reflect.ValueOf(next).Elem()
+	fields := current.Type()
+
+	for i := 0; i < fields.NumField(); i++ {
+		key := fields.Field(i).Tag.Get("yaml")
+		if key == "" || key == "-" {
+			continue
+		}
+		if reflect.DeepEqual(current.Field(i).Interface(), updated.Field(i).Interface()) {
+			continue
+		}
+		if !reloadableKeys[key] {
+			ignored = append(ignored, key)
+			continue
+		}
+		current.Field(i).Set(updated.Field(i))
+		applied = append(applied, key)
+	}
+	return applied, ignored
+}
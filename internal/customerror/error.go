@@ -5,11 +5,33 @@ import (
 	"net/http"
 )
 
+// CustomError ошибка предметной области с HTTP-статусом и стабильным кодом для клиентов API.
+// Ответ по ней формирует Write.
 type CustomError interface {
 	Error() string
 	GetHTTPCode() int
+	// GetCode машиночитаемый код ошибки, не меняется вместе с текстом сообщения
+	GetCode() string
 }
 
+// Коды ошибок в ответах API
+const (
+	CodeBadRequest         = "bad_request"
+	CodeValidationFailed   = "validation_failed"
+	CodeRequestTooLarge    = "request_too_large"
+	CodeUnauthorized       = "unauthorized"
+	CodeNotFound           = "not_found"
+	CodeConflict           = "conflict"
+	CodeAlreadyExists      = "already_exists"
+	CodeOrderConflict      = "order_conflict"
+	CodeInvalidOrderNumber = "invalid_order_number"
+	CodeInsufficientFunds  = "insufficient_funds"
+	CodeLimitExceeded      = "limit_exceeded"
+	CodeServiceUnavailable = "service_unavailable"
+	CodeNotImplemented     = "not_implemented"
+	CodeInternal           = "internal_error"
+)
+
 type UniqueViolationError struct {
 	httpCode int
 	message  string
@@ -27,6 +49,10 @@ func (e *UniqueViolationError) GetHTTPCode() int {
 	return e.httpCode
 }
 
+func (e *UniqueViolationError) GetCode() string {
+	return CodeAlreadyExists
+}
+
 type CommonPGError struct {
 	httpCode int
 	message  string
@@ -43,3 +69,304 @@ func (e *CommonPGError) Error() string {
 func (e *CommonPGError) GetHTTPCode() int {
 	return e.httpCode
 }
+
+func (e *CommonPGError) GetCode() string {
+	return CodeInternal
+}
+
+type InsufficientFundsError struct {
+	httpCode int
+	message  string
+}
+
+func NewInsufficientFundsError(msg string) *InsufficientFundsError {
+	return &InsufficientFundsError{httpCode: http.StatusPaymentRequired, message: msg}
+}
+
+func (e *InsufficientFundsError) Error() string {
+	return fmt.Sprintf("insufficient funds: %s", e.message)
+}
+
+func (e *InsufficientFundsError) GetHTTPCode() int {
+	return e.httpCode
+}
+
+func (e *InsufficientFundsError) GetCode() string {
+	return CodeInsufficientFunds
+}
+
+type LimitExceededError struct {
+	httpCode int
+	message  string
+}
+
+func NewLimitExceededError(msg string) *LimitExceededError {
+	return &LimitExceededError{httpCode: http.StatusUnprocessableEntity, message: msg}
+}
+
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("limit exceeded: %s", e.message)
+}
+
+func (e *LimitExceededError) GetHTTPCode() int {
+	return e.httpCode
+}
+
+func (e *LimitExceededError) GetCode() string {
+	return CodeLimitExceeded
+}
+
+type NotFoundError struct {
+	httpCode int
+	message  string
+}
+
+func NewNotFoundError(msg string) *NotFoundError {
+	return &NotFoundError{httpCode: http.StatusNotFound, message: msg}
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("not found: %s", e.message)
+}
+
+func (e *NotFoundError) GetHTTPCode() int {
+	return e.httpCode
+}
+
+func (e *NotFoundError) GetCode() string {
+	return CodeNotFound
+}
+
+// BadRequestError запрос не удалось разобрать
+type BadRequestError struct {
+	httpCode int
+	message  string
+}
+
+func NewBadRequestError(msg string) *BadRequestError {
+	return &BadRequestError{httpCode: http.StatusBadRequest, message: msg}
+}
+
+func (e *BadRequestError) Error() string {
+	return e.message
+}
+
+func (e *BadRequestError) GetHTTPCode() int {
+	return e.httpCode
+}
+
+func (e *BadRequestError) GetCode() string {
+	return CodeBadRequest
+}
+
+// FieldError ошибка в значении поля запроса. Code - имя нарушенного правила, например required или min.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+// RequestTooLargeError тело запроса больше допустимого размера
+type RequestTooLargeError struct {
+	httpCode int
+	message  string
+}
+
+func NewRequestTooLargeError(msg string) *RequestTooLargeError {
+	return &RequestTooLargeError{httpCode: http.StatusRequestEntityTooLarge, message: msg}
+}
+
+func (e *RequestTooLargeError) Error() string {
+	return e.message
+}
+
+func (e *RequestTooLargeError) GetHTTPCode() int {
+	return e.httpCode
+}
+
+func (e *RequestTooLargeError) GetCode() string {
+	return CodeRequestTooLarge
+}
+
+// ValidationError запрос разобран, но значения полей не прошли проверку
+type ValidationError struct {
+	httpCode int
+	message  string
+	fields   []FieldError
+}
+
+func NewValidationError(msg string, fields ...FieldError) *ValidationError {
+	return &ValidationError{httpCode: http.StatusBadRequest, message: msg, fields: fields}
+}
+
+func (e *ValidationError) Error() string {
+	return e.message
+}
+
+func (e *ValidationError) GetHTTPCode() int {
+	return e.httpCode
+}
+
+func (e *ValidationError) GetCode() string {
+	return CodeValidationFailed
+}
+
+// FieldErrors ошибки отдельных полей
+func (e *ValidationError) FieldErrors() []FieldError {
+	return e.fields
+}
+
+// UnauthorizedError пользователь не авторизован или токен недействителен
+type UnauthorizedError struct {
+	httpCode int
+	message  string
+}
+
+func NewUnauthorizedError(msg string) *UnauthorizedError {
+	return &UnauthorizedError{httpCode: http.StatusUnauthorized, message: msg}
+}
+
+func (e *UnauthorizedError) Error() string {
+	return e.message
+}
+
+func (e *UnauthorizedError) GetHTTPCode() int {
+	return e.httpCode
+}
+
+func (e *UnauthorizedError) GetCode() string {
+	return CodeUnauthorized
+}
+
+// ConflictError ресурс уже существует, например пользователь с таким логином
+type ConflictError struct {
+	httpCode int
+	message  string
+}
+
+func NewConflictError(msg string) *ConflictError {
+	return &ConflictError{httpCode: http.StatusConflict, message: msg}
+}
+
+func (e *ConflictError) Error() string {
+	return e.message
+}
+
+func (e *ConflictError) GetHTTPCode() int {
+	return e.httpCode
+}
+
+func (e *ConflictError) GetCode() string {
+	return CodeConflict
+}
+
+// OrderConflictError номер заказа уже загружен другим пользователем
+type OrderConflictError struct {
+	httpCode int
+	message  string
+}
+
+func NewOrderConflictError(msg string) *OrderConflictError {
+	return &OrderConflictError{httpCode: http.StatusConflict, message: msg}
+}
+
+func (e *OrderConflictError) Error() string {
+	return e.message
+}
+
+func (e *OrderConflictError) GetHTTPCode() int {
+	return e.httpCode
+}
+
+func (e *OrderConflictError) GetCode() string {
+	return CodeOrderConflict
+}
+
+// InvalidNumberError номер заказа не проходит проверку по алгоритму Луна
+type InvalidNumberError struct {
+	httpCode int
+	message  string
+}
+
+func NewInvalidNumberError(msg string) *InvalidNumberError {
+	return &InvalidNumberError{httpCode: http.StatusUnprocessableEntity, message: msg}
+}
+
+func (e *InvalidNumberError) Error() string {
+	return e.message
+}
+
+func (e *InvalidNumberError) GetHTTPCode() int {
+	return e.httpCode
+}
+
+func (e *InvalidNumberError) GetCode() string {
+	return CodeInvalidOrderNumber
+}
+
+// ServiceUnavailableError сервис временно не принимает запросы, например при остановке
+type ServiceUnavailableError struct {
+	httpCode int
+	message  string
+}
+
+func NewServiceUnavailableError(msg string) *ServiceUnavailableError {
+	return &ServiceUnavailableError{httpCode: http.StatusServiceUnavailable, message: msg}
+}
+
+func (e *ServiceUnavailableError) Error() string {
+	return e.message
+}
+
+func (e *ServiceUnavailableError) GetHTTPCode() int {
+	return e.httpCode
+}
+
+func (e *ServiceUnavailableError) GetCode() string {
+	return CodeServiceUnavailable
+}
+
+// NotImplementedError возможность недоступна в этой конфигурации сервиса, например с выбранным хранилищем
+type NotImplementedError struct {
+	httpCode int
+	message  string
+}
+
+func NewNotImplementedError(msg string) *NotImplementedError {
+	return &NotImplementedError{httpCode: http.StatusNotImplemented, message: msg}
+}
+
+func (e *NotImplementedError) Error() string {
+	return e.message
+}
+
+func (e *NotImplementedError) GetHTTPCode() int {
+	return e.httpCode
+}
+
+func (e *NotImplementedError) GetCode() string {
+	return CodeNotImplemented
+}
+
+// InternalError внутренняя ошибка сервиса. Сообщение показывается клиенту, поэтому не должно
+// содержать подробностей: причина пишется в лог обработчиком.
+type InternalError struct {
+	httpCode int
+	message  string
+}
+
+func NewInternalError(msg string) *InternalError {
+	return &InternalError{httpCode: http.StatusInternalServerError, message: msg}
+}
+
+func (e *InternalError) Error() string {
+	return e.message
+}
+
+func (e *InternalError) GetHTTPCode() int {
+	return e.httpCode
+}
+
+func (e *InternalError) GetCode() string {
+	return CodeInternal
+}
@@ -0,0 +1,102 @@
+package customerror
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"go.uber.org/zap"
+)
+
+// ProblemContentType тип ответа об ошибке по RFC 7807
+const ProblemContentType = "application/problem+json"
+
+// Problem ответ об ошибке по RFC 7807 с расширениями: код ошибки, идентификатор запроса и ошибки полей
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// fieldErrors ошибки с подробностями по полям запроса
+type fieldErrors interface {
+	FieldErrors() []FieldError
+}
+
+// NewProblem описание ошибки err для ответа на запрос r. Ошибки, не реализующие CustomError,
+// считаются внутренними, и их текст клиенту не показывается.
+func NewProblem(r *http.Request, err error) Problem {
+	var customErr CustomError
+	if !errors.As(err, &customErr) {
+		customErr = NewInternalError("internal server error")
+	}
+
+	detail := customErr.Error()
+	var pgErr *CommonPGError
+	if errors.As(customErr, &pgErr) {
+		// Текст ошибки базы может раскрыть схему, причину пишет в лог вызывающий код
+		detail = "database error"
+	}
+
+	problem := Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(customErr.GetHTTPCode()),
+		Status:    customErr.GetHTTPCode(),
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      customErr.GetCode(),
+		RequestID: logger.RequestIDFromContext(r.Context()),
+	}
+	if withFields, ok := customErr.(fieldErrors); ok {
+		problem.Errors = withFields.FieldErrors()
+	}
+	return problem
+}
+
+// Write отвечает на запрос r ошибкой err. Клиент, принимающий JSON (Accept: application/problem+json
+// или application/json), получает Problem. Остальным, как в исходной спецификации сервиса,
+// отвечаем текстом ошибки.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	problem := NewProblem(r, err)
+	if !AcceptsProblemJSON(r) {
+		http.Error(w, problem.Detail, problem.Status)
+		return
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	if errEncode := json.NewEncoder(w).Encode(problem); errEncode != nil {
+		logger.FromContext(r.Context()).Error("Error encoding problem details", zap.Error(errEncode))
+	}
+}
+
+// AcceptsProblemJSON сообщает, что клиент явно принимает ответ в JSON. Accept: */* и отсутствие
+// заголовка сохраняют текстовые ответы, поэтому клиенты исходного API ничего не замечают.
+func AcceptsProblemJSON(r *http.Request) bool {
+	for _, mediaRange := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+		if mediaType != ProblemContentType && mediaType != "application/json" {
+			continue
+		}
+		if quality, ok := params["q"]; ok {
+			if value, err := strconv.ParseFloat(quality, 64); err != nil || value <= 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package customerror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite_ProblemJSON(t *testing.T) {
+	// Arrange
+	request := httptest.NewRequest(http.MethodPost, "/api/user/orders", nil)
+	request.Header.Set("Accept", "application/problem+json")
+	request.Header.Set(logger.RequestIDHeader, "request-1")
+	recorder := httptest.NewRecorder()
+
+	// Act
+	logger.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Write(w, r, NewOrderConflictError("order was already added other user"))
+	})).ServeHTTP(recorder, request)
+
+	// Assert
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Equal(t, ProblemContentType, recorder.Header().Get("Content-Type"))
+	var problem Problem
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+	assert.Equal(t, Problem{
+		Type:      "about:blank",
+		Title:     "Conflict",
+		Status:    http.StatusConflict,
+		Detail:    "order was already added other user",
+		Instance:  "/api/user/orders",
+		Code:      CodeOrderConflict,
+		RequestID: "request-1",
+	}, problem)
+}
+
+func TestWrite_PlainTextByDefault(t *testing.T) {
+	for _, accept := range []string{"", "*/*", "text/plain", "application/json;q=0"} {
+		t.Run(accept, func(t *testing.T) {
+			// Arrange
+			request := httptest.NewRequest(http.MethodPost, "/api/user/orders", nil)
+			request.Header.Set("Accept", accept)
+			recorder := httptest.NewRecorder()
+
+			// Act
+			Write(recorder, request, NewInvalidNumberError("invalid order number"))
+
+			// Assert
+			assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+			assert.Contains(t, recorder.Header().Get("Content-Type"), "text/plain")
+			assert.Equal(t, "invalid order number\n", recorder.Body.String())
+		})
+	}
+}
+
+func TestWrite_NotImplemented(t *testing.T) {
+	// Arrange
+	request := httptest.NewRequest(http.MethodGet, "/api/user/transfers", nil)
+	request.Header.Set("Accept", "application/problem+json")
+	recorder := httptest.NewRecorder()
+
+	// Act
+	Write(recorder, request, NewNotImplementedError("this feature requires the postgres storage"))
+
+	// Assert
+	assert.Equal(t, http.StatusNotImplemented, recorder.Code)
+	var problem Problem
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+	assert.Equal(t, "Not Implemented", problem.Title)
+	assert.Equal(t, CodeNotImplemented, problem.Code)
+	assert.Equal(t, "this feature requires the postgres storage", problem.Detail)
+}
+
+func TestWrite_ValidationFieldErrors(t *testing.T) {
+	// Arrange
+	request := httptest.NewRequest(http.MethodPost, "/api/user/register", nil)
+	request.Header.Set("Accept", "text/html, application/json;q=0.9")
+	recorder := httptest.NewRecorder()
+	field := FieldError{Field: "login", Message: "Login must be between 3 and 50 characters"}
+
+	// Act
+	Write(recorder, request, NewValidationError("Login must be between 3 and 50 characters", field))
+
+	// Assert
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	var problem Problem
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+	assert.Equal(t, CodeValidationFailed, problem.Code)
+	assert.Equal(t, []FieldError{field}, problem.Errors)
+}
+
+func TestNewProblem_HidesInternalDetails(t *testing.T) {
+	// Arrange
+	request := httptest.NewRequest(http.MethodGet, "/api/user/balance", nil)
+
+	// Act
+	unknown := NewProblem(request, errors.New("dial tcp 10.0.0.1:5432: connection refused"))
+	database := NewProblem(request, NewCommonPGError(`relation "balance" does not exist`))
+	wrapped := NewProblem(request, errors.Join(errors.New("withdraw"), NewInsufficientFundsError("not enough points")))
+
+	// Assert
+	assert.Equal(t, http.StatusInternalServerError, unknown.Status)
+	assert.Equal(t, CodeInternal, unknown.Code)
+	assert.Equal(t, "internal server error", unknown.Detail)
+	assert.Equal(t, "database error", database.Detail)
+	assert.Equal(t, http.StatusPaymentRequired, wrapped.Status)
+	assert.Equal(t, CodeInsufficientFunds, wrapped.Code)
+}
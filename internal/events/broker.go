@@ -0,0 +1,124 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"go.uber.org/zap"
+)
+
+// OrderEventsChannel канал LISTEN/NOTIFY, в который триггер на таблице orders пишет изменения заказов
+const OrderEventsChannel = "order_events"
+
+const subscriberBufferSize = 16
+
+// Broker получает события заказов через LISTEN/NOTIFY и раздает их подписчикам этой реплики.
+// Так события доходят до клиента, даже если заказ обработал воркер другой реплики.
+type Broker struct {
+	db *db.DB
+
+	mu          sync.RWMutex
+	subscribers map[int]map[chan models.OrderEvent]struct{}
+}
+
+func NewBroker(dbObj *db.DB) *Broker {
+	return &Broker{
+		db:          dbObj,
+		subscribers: make(map[int]map[chan models.OrderEvent]struct{}),
+	}
+}
+
+// Subscribe подписывает на события заказов пользователя. Возвращаемую функцию нужно вызвать для отписки.
+func (broker *Broker) Subscribe(userID int) (<-chan models.OrderEvent, func()) {
+	ch := make(chan models.OrderEvent, subscriberBufferSize)
+
+	broker.mu.Lock()
+	if broker.subscribers[userID] == nil {
+		broker.subscribers[userID] = make(map[chan models.OrderEvent]struct{})
+	}
+	broker.subscribers[userID][ch] = struct{}{}
+	broker.mu.Unlock()
+
+	unsubscribe := func() {
+		broker.mu.Lock()
+		defer broker.mu.Unlock()
+		if _, ok := broker.subscribers[userID][ch]; !ok {
+			return
+		}
+		delete(broker.subscribers[userID], ch)
+		if len(broker.subscribers[userID]) == 0 {
+			delete(broker.subscribers, userID)
+		}
+		close(ch)
+	}
+	return ch, unsubscribe
+}
+
+// Publish отправляет событие подписчикам пользователя. Подписка, буфер которой заполнен, закрывается:
+// подписчик получает уже отправленные события и закрытый канал, а пропущенные события читает из истории
+// при переподключении по Last-Event-ID. Так события не теряются незаметно для клиента.
+func (broker *Broker) Publish(event models.OrderEvent) {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	for ch := range broker.subscribers[event.UserID] {
+		select {
+		case ch <- event:
+		default:
+			logger.Log.Warn("Order event subscriber is too slow, subscription closed",
+				zap.Int("user_id", event.UserID), zap.Int64("event_id", event.ID))
+			delete(broker.subscribers[event.UserID], ch)
+			close(ch)
+		}
+	}
+	if len(broker.subscribers[event.UserID]) == 0 {
+		delete(broker.subscribers, event.UserID)
+	}
+}
+
+// Run слушает канал уведомлений до отмены ctx, переподключаясь при обрыве соединения
+func (broker *Broker) Run(ctx context.Context) {
+	Listen(ctx, broker.db, OrderEventsChannel, broker.handleNotification)
+}
+
+func (broker *Broker) handleNotification(payload string) {
+	event, err := decodeNotification(payload)
+	if err != nil {
+		logger.Log.Warn("Can't decode order event", zap.String("payload", payload), zap.Error(err))
+		return
+	}
+	broker.Publish(event)
+}
+
+type notificationPayload struct {
+	ID        int64              `json:"id"`
+	Order     string             `json:"order"`
+	UserID    int                `json:"user_id"`
+	Status    models.OrderStatus `json:"status"`
+	Accrual   *int64             `json:"accrual"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+func decodeNotification(payload string) (models.OrderEvent, error) {
+	var decoded notificationPayload
+	if err := json.Unmarshal([]byte(payload), &decoded); err != nil {
+		return models.OrderEvent{}, err
+	}
+
+	event := models.OrderEvent{
+		ID:        decoded.ID,
+		Order:     decoded.Order,
+		UserID:    decoded.UserID,
+		Status:    decoded.Status,
+		CreatedAt: decoded.CreatedAt,
+	}
+	if decoded.Accrual != nil {
+		event.SetAccrualAsFloat(*decoded.Accrual)
+	}
+	return event, nil
+}
@@ -0,0 +1,94 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroker_PublishToUserSubscribers(t *testing.T) {
+	// Arrange
+	broker := NewBroker(nil)
+	first, unsubscribeFirst := broker.Subscribe(1)
+	defer unsubscribeFirst()
+	other, unsubscribeOther := broker.Subscribe(2)
+	defer unsubscribeOther()
+
+	event := models.OrderEvent{ID: 10, Order: "12345678903", UserID: 1, Status: models.ProcessedStatus}
+
+	// Act
+	broker.Publish(event)
+
+	// Assert
+	select {
+	case received := <-first:
+		assert.Equal(t, event, received)
+	case <-time.After(time.Second):
+		t.Fatal("event was not delivered")
+	}
+	assert.Empty(t, other)
+}
+
+func TestBroker_Unsubscribe(t *testing.T) {
+	// Arrange
+	broker := NewBroker(nil)
+	ch, unsubscribe := broker.Subscribe(1)
+
+	// Act
+	unsubscribe()
+	unsubscribe()
+	broker.Publish(models.OrderEvent{ID: 1, UserID: 1})
+
+	// Assert
+	_, ok := <-ch
+	assert.False(t, ok)
+	assert.Empty(t, broker.subscribers)
+}
+
+func TestBroker_PublishClosesLaggingSubscriber(t *testing.T) {
+	// Arrange
+	broker := NewBroker(nil)
+	ch, unsubscribe := broker.Subscribe(1)
+	defer unsubscribe()
+	other, unsubscribeOther := broker.Subscribe(1)
+	defer unsubscribeOther()
+
+	// Act
+	// Второй подписчик успевает читать, первый заполняет буфер
+	for i := 0; i < subscriberBufferSize+5; i++ {
+		broker.Publish(models.OrderEvent{ID: int64(i), UserID: 1})
+		<-other
+	}
+
+	// Assert
+	var received []int64
+	for event := range ch {
+		received = append(received, event.ID)
+	}
+	require.Len(t, received, subscriberBufferSize)
+	assert.Equal(t, int64(subscriberBufferSize-1), received[len(received)-1])
+	assert.Len(t, broker.subscribers[1], 1)
+
+	// Отписка после закрытия брокером не паникует
+	unsubscribe()
+}
+
+func TestDecodeNotification(t *testing.T) {
+	// Arrange
+	payload := `{"id" : 7, "order" : "12345678903", "user_id" : 3, "status" : "PROCESSED", "accrual" : 72998, "created_at" : "2020-12-10T15:15:45.123456+03:00"}`
+
+	// Act
+	event, err := decodeNotification(payload)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), event.ID)
+	assert.Equal(t, "12345678903", event.Order)
+	assert.Equal(t, 3, event.UserID)
+	assert.Equal(t, models.ProcessedStatus, event.Status)
+	require.NotNil(t, event.Accrual)
+	assert.Equal(t, float32(729.98), *event.Accrual)
+}
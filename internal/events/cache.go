@@ -0,0 +1,43 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"go.uber.org/zap"
+)
+
+// CacheInvalidationChannel канал LISTEN/NOTIFY, в который триггеры на таблицах users, balance, orders
+// и withdrawals пишут изменения данных пользователей. По ним реплики сервиса очищают кеши и направляют
+// чтения пользователя в основной сервер базы, пока ее реплика может не содержать изменение.
+const CacheInvalidationChannel = "cache_invalidation"
+
+// Сущности в уведомлениях CacheInvalidationChannel
+const (
+	CacheEntityUser       = "user"
+	CacheEntityBalance    = "balance"
+	CacheEntityOrder      = "order"
+	CacheEntityWithdrawal = "withdrawal"
+)
+
+// CacheInvalidation изменение данных пользователя UserID
+type CacheInvalidation struct {
+	Entity string `json:"entity"`
+	UserID int    `json:"user_id"`
+}
+
+// ListenCacheInvalidations передает в invalidate изменения закешированных данных до отмены ctx.
+// Уведомление получает каждая реплика, в том числе та, что сделала изменение. После каждого
+// подключения к каналу вызывается purge: пока соединения не было, уведомления могли быть пропущены.
+func ListenCacheInvalidations(ctx context.Context, dbObj *db.DB, invalidate func(CacheInvalidation), purge func()) {
+	listenWithReconnect(ctx, dbObj, CacheInvalidationChannel, purge, func(payload string) {
+		var invalidation CacheInvalidation
+		if err := json.Unmarshal([]byte(payload), &invalidation); err != nil {
+			logger.Log.Warn("Can't decode cache invalidation", zap.String("payload", payload), zap.Error(err))
+			return
+		}
+		invalidate(invalidation)
+	})
+}
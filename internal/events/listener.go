@@ -0,0 +1,66 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+const reconnectDelay = 5 * time.Second
+
+// Listen слушает канал LISTEN/NOTIFY до отмены ctx и передает полезную нагрузку уведомлений в handle,
+// переподключаясь при обрыве соединения
+func Listen(ctx context.Context, dbObj *db.DB, channel string, handle func(payload string)) {
+	listenWithReconnect(ctx, dbObj, channel, nil, handle)
+}
+
+// listenWithReconnect то же, что Listen, и вызывает onListen после каждой подписки на канал: уведомления,
+// отправленные, пока соединения не было, потеряны, и подписчик может сбросить накопленное состояние
+func listenWithReconnect(ctx context.Context, dbObj *db.DB, channel string, onListen func(), handle func(payload string)) {
+	for {
+		err := listen(ctx, dbObj, channel, onListen, handle)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Log.Warn("Notification listener stopped, reconnecting", zap.String("channel", channel), zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+func listen(ctx context.Context, dbObj *db.DB, channel string, onListen func(), handle func(payload string)) error {
+	if dbObj == nil || dbObj.Pool == nil {
+		return errors.New("database is not configured")
+	}
+
+	// Для LISTEN нужно отдельное соединение, которое не вернется в пул
+	conn, err := pgx.ConnectConfig(ctx, dbObj.Pool.Config().ConnConfig.Copy())
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err = conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return err
+	}
+	if onListen != nil {
+		onListen()
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		handle(notification.Payload)
+	}
+}
@@ -0,0 +1,44 @@
+package events
+
+import (
+	"context"
+
+	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"go.uber.org/zap"
+)
+
+// OrderRequeueChannel канал LISTEN/NOTIFY, в который gophermart admin requeue сообщает о заказах,
+// возвращенных в обработку
+const OrderRequeueChannel = "order_requeue"
+
+// requeueClaimLimit сколько заказов забирается из базы за один вызов claim
+const requeueClaimLimit = 100
+
+// ListenRequeued до отмены ctx забирает через claim заказы, возвращенные в обработку, и передает их в enqueue.
+// Уведомление получает каждая реплика, но claim отдает заказ только одной из них. Заказы забираются
+// и после каждой подписки на канал, чтобы не потерять отправленные без подписчиков уведомления.
+func ListenRequeued(ctx context.Context, dbObj *db.DB, claim func(context.Context, int) ([]models.Order, error), enqueue func(models.Order) bool) {
+	drain := func() { drainRequeued(ctx, claim, enqueue) }
+	listenWithReconnect(ctx, dbObj, OrderRequeueChannel, drain, func(string) { drain() })
+}
+
+// drainRequeued забирает заказы, пока claim их возвращает
+func drainRequeued(ctx context.Context, claim func(context.Context, int) ([]models.Order, error), enqueue func(models.Order) bool) {
+	for {
+		orders, err := claim(ctx, requeueClaimLimit)
+		if err != nil {
+			logger.Log.Warn("Can't claim requeued orders", zap.Error(err))
+			return
+		}
+		for _, order := range orders {
+			if !enqueue(order) {
+				logger.Log.Warn("Requeued order was not added to the queue", zap.String("order", order.ID))
+			}
+		}
+		if len(orders) < requeueClaimLimit {
+			return
+		}
+	}
+}
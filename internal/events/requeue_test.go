@@ -0,0 +1,55 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrainRequeued_ClaimsUntilEmpty(t *testing.T) {
+	// Arrange
+	pending := make([]models.Order, requeueClaimLimit+1)
+	for i := range pending {
+		pending[i] = models.Order{ID: strconv.Itoa(i), UserID: 1, Status: models.NewStatus}
+	}
+	claims := 0
+	claim := func(_ context.Context, limit int) ([]models.Order, error) {
+		claims++
+		batch := pending[:min(limit, len(pending))]
+		pending = pending[len(batch):]
+		return batch, nil
+	}
+	var enqueued []models.Order
+
+	// Act
+	drainRequeued(context.Background(), claim, func(order models.Order) bool {
+		enqueued = append(enqueued, order)
+		return true
+	})
+
+	// Assert
+	assert.Equal(t, 2, claims)
+	assert.Len(t, enqueued, requeueClaimLimit+1)
+	assert.Empty(t, pending)
+}
+
+func TestDrainRequeued_ClaimError(t *testing.T) {
+	// Arrange
+	claim := func(context.Context, int) ([]models.Order, error) {
+		return nil, errors.New("connection refused")
+	}
+	enqueued := 0
+
+	// Act
+	drainRequeued(context.Background(), claim, func(models.Order) bool {
+		enqueued++
+		return true
+	})
+
+	// Assert
+	assert.Zero(t, enqueued)
+}
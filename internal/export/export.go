@@ -0,0 +1,191 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	CSV    Format = "csv"
+	NDJSON Format = "ndjson"
+)
+
+// ParseFormat определяет формат выгрузки по параметру format или по заголовку Accept.
+// Параметр format имеет приоритет, по умолчанию используется CSV.
+func ParseFormat(format, accept string) (Format, error) {
+	switch strings.ToLower(format) {
+	case "csv":
+		return CSV, nil
+	case "ndjson", "jsonl":
+		return NDJSON, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unknown export format %q", format)
+	}
+
+	switch {
+	case strings.Contains(accept, "application/x-ndjson"), strings.Contains(accept, "application/jsonl"):
+		return NDJSON, nil
+	default:
+		return CSV, nil
+	}
+}
+
+func (format Format) ContentType() string {
+	if format == NDJSON {
+		return "application/x-ndjson"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+func (format Format) Extension() string {
+	if format == NDJSON {
+		return "ndjson"
+	}
+	return "csv"
+}
+
+// Money сумма в копейках, выводится с двумя знаками после точки без округлений float
+type Money int64
+
+func (money Money) String() string {
+	value := int64(money)
+	sign := ""
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, value/100, value%100)
+}
+
+// Field одна колонка строки выгрузки. Value может быть string, Money, time.Time или nil.
+type Field struct {
+	Name  string
+	Value any
+}
+
+type Writer interface {
+	// WriteHeader записывает заголовок с именами колонок, если он есть в формате. Вызывается
+	// до строк, чтобы и пустая выгрузка содержала заголовок.
+	WriteHeader(names []string) error
+	Write(row []Field) error
+	Flush() error
+}
+
+func NewWriter(format Format, w io.Writer, location *time.Location) Writer {
+	if location == nil {
+		location = time.UTC
+	}
+	if format == NDJSON {
+		return &ndjsonWriter{w: bufio.NewWriter(w), location: location}
+	}
+	return &csvWriter{w: csv.NewWriter(w), location: location}
+}
+
+type csvWriter struct {
+	w             *csv.Writer
+	location      *time.Location
+	headerWritten bool
+}
+
+func (writer *csvWriter) WriteHeader(names []string) error {
+	if writer.headerWritten {
+		return nil
+	}
+	writer.headerWritten = true
+	return writer.w.Write(names)
+}
+
+func (writer *csvWriter) Write(row []Field) error {
+	if !writer.headerWritten {
+		header := make([]string, 0, len(row))
+		for _, field := range row {
+			header = append(header, field.Name)
+		}
+		if err := writer.WriteHeader(header); err != nil {
+			return err
+		}
+	}
+
+	record := make([]string, 0, len(row))
+	for _, field := range row {
+		record = append(record, formatValue(field.Value, writer.location))
+	}
+	return writer.w.Write(record)
+}
+
+func (writer *csvWriter) Flush() error {
+	writer.w.Flush()
+	return writer.w.Error()
+}
+
+type ndjsonWriter struct {
+	w        *bufio.Writer
+	location *time.Location
+}
+
+// WriteHeader ничего не делает: в NDJSON имена полей есть в каждой строке
+func (writer *ndjsonWriter) WriteHeader([]string) error {
+	return nil
+}
+
+func (writer *ndjsonWriter) Write(row []Field) error {
+	var line strings.Builder
+	line.WriteByte('{')
+	for i, field := range row {
+		if i > 0 {
+			line.WriteByte(',')
+		}
+		name, _ := json.Marshal(field.Name)
+		line.Write(name)
+		line.WriteByte(':')
+
+		switch value := field.Value.(type) {
+		case nil:
+			line.WriteString("null")
+		case Money:
+			// Сумма выводится JSON-числом в точном десятичном представлении
+			line.WriteString(value.String())
+		default:
+			encoded, _ := json.Marshal(formatValue(value, writer.location))
+			line.Write(encoded)
+		}
+	}
+	line.WriteString("}\n")
+
+	_, err := writer.w.WriteString(line.String())
+	return err
+}
+
+func (writer *ndjsonWriter) Flush() error {
+	return writer.w.Flush()
+}
+
+func formatValue(value any, location *time.Location) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case Money:
+		return v.String()
+	case time.Time:
+		return v.In(location).Format(time.RFC3339)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
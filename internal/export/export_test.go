@@ -0,0 +1,112 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMoney_String(t *testing.T) {
+	testCases := []struct {
+		name     string
+		money    Money
+		expected string
+	}{
+		{name: "zero", money: 0, expected: "0.00"},
+		{name: "kopecks only", money: 5, expected: "0.05"},
+		{name: "fractional", money: 72998, expected: "729.98"},
+		{name: "negative", money: -10050, expected: "-100.50"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.money.String())
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	testCases := []struct {
+		name     string
+		format   string
+		accept   string
+		expected Format
+		wantErr  bool
+	}{
+		{name: "default", expected: CSV},
+		{name: "query csv", format: "csv", accept: "application/x-ndjson", expected: CSV},
+		{name: "query jsonl", format: "jsonl", expected: NDJSON},
+		{name: "accept ndjson", accept: "application/x-ndjson", expected: NDJSON},
+		{name: "accept csv", accept: "text/csv", expected: CSV},
+		{name: "unknown", format: "xml", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			format, err := ParseFormat(tc.format, tc.accept)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, format)
+		})
+	}
+}
+
+func TestWriter_CSV(t *testing.T) {
+	// Arrange
+	var buf bytes.Buffer
+	location, err := time.LoadLocation("Europe/Moscow")
+	require.NoError(t, err)
+	writer := NewWriter(CSV, &buf, location)
+	at := time.Date(2020, 12, 10, 12, 9, 57, 0, time.UTC)
+
+	// Act
+	require.NoError(t, writer.Write([]Field{{Name: "order", Value: "2377225624"}, {Name: "sum", Value: Money(50000)}, {Name: "processed_at", Value: at}}))
+	require.NoError(t, writer.Write([]Field{{Name: "order", Value: "12345678903"}, {Name: "sum", Value: Money(29)}, {Name: "processed_at", Value: nil}}))
+	require.NoError(t, writer.Flush())
+
+	// Assert
+	expected := "order,sum,processed_at\n" +
+		"2377225624,500.00,2020-12-10T15:09:57+03:00\n" +
+		"12345678903,0.29,\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestWriter_NDJSON(t *testing.T) {
+	// Arrange
+	var buf bytes.Buffer
+	writer := NewWriter(NDJSON, &buf, nil)
+	at := time.Date(2020, 12, 10, 12, 9, 57, 0, time.UTC)
+
+	// Act
+	require.NoError(t, writer.Write([]Field{{Name: "number", Value: "9278923470"}, {Name: "accrual", Value: Money(72998)}, {Name: "uploaded_at", Value: at}}))
+	require.NoError(t, writer.Write([]Field{{Name: "number", Value: "346436439"}, {Name: "accrual", Value: nil}, {Name: "uploaded_at", Value: at}}))
+	require.NoError(t, writer.Flush())
+
+	// Assert
+	expected := `{"number":"9278923470","accrual":729.98,"uploaded_at":"2020-12-10T12:09:57Z"}` + "\n" +
+		`{"number":"346436439","accrual":null,"uploaded_at":"2020-12-10T12:09:57Z"}` + "\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestWriter_EmptyExportHasHeader(t *testing.T) {
+	// Arrange
+	var csvBuf, ndjsonBuf bytes.Buffer
+	csvWriter := NewWriter(CSV, &csvBuf, nil)
+	ndjsonWriter := NewWriter(NDJSON, &ndjsonBuf, nil)
+
+	// Act
+	require.NoError(t, csvWriter.WriteHeader([]string{"order", "sum", "processed_at"}))
+	require.NoError(t, csvWriter.Flush())
+	require.NoError(t, ndjsonWriter.WriteHeader([]string{"order", "sum", "processed_at"}))
+	require.NoError(t, ndjsonWriter.Flush())
+
+	// Assert
+	assert.Equal(t, "order,sum,processed_at\n", csvBuf.String())
+	assert.Empty(t, ndjsonBuf.String())
+}
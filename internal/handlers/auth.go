@@ -3,10 +3,12 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"github.com/Bessima/diplom-gomarket/internal/customerror"
 	"github.com/Bessima/diplom-gomarket/internal/handlers/schemas"
 	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
 	"github.com/Bessima/diplom-gomarket/internal/repository"
+	"github.com/Bessima/diplom-gomarket/internal/tracing"
+	"go.uber.org/zap"
 	"net/http"
 	"time"
 
@@ -47,45 +49,37 @@ func NewAuthHandler(jwtConfig *JWTConfig, storage repository.UserStorageReposito
 }
 
 func (h *AuthHandler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
-	var req schemas.RegisterRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	req, ok := decodeJSON[schemas.RegisterRequest](w, r)
+	if !ok {
 		return
 	}
 
-	if len(req.Login) < 3 || len(req.Login) > 50 {
-		http.Error(w, "Login must be between 3 and 50 characters", http.StatusBadRequest)
-		return
-	}
-	if len(req.Password) < 6 {
-		http.Error(w, "Password must be at least 6 characters", http.StatusBadRequest)
-		return
-	}
-
-	existingUser, _ := h.UserStorage.GetUserByLogin(req.Login)
+	existingUser, _ := h.UserStorage.GetUserByLogin(r.Context(), req.Login)
 	if existingUser != nil {
-		http.Error(w, "User already exists", http.StatusConflict)
+		customerror.Write(w, r, customerror.NewConflictError("User already exists"))
 		return
 	}
 
+	_, span := tracing.Start(r.Context(), "bcrypt.GenerateFromPassword")
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	span.End()
 	if err != nil {
-		http.Error(w, "Error creating user", http.StatusInternalServerError)
-		logger.Log.Error(fmt.Errorf("error generate password hash %v", err).Error())
+		customerror.Write(w, r, customerror.NewInternalError("Error creating user"))
+		logger.FromContext(r.Context()).Error("error generate password hash", zap.Error(err))
 		return
 	}
 
-	user, err := h.UserStorage.CreateUser(req.Login, string(hashedPassword))
+	user, err := h.UserStorage.CreateUser(r.Context(), req.Login, string(hashedPassword))
 	if err != nil {
-		http.Error(w, "Error creating user", http.StatusInternalServerError)
-		logger.Log.Error(fmt.Errorf("error creating user in DB: %v", err).Error())
+		customerror.Write(w, r, customerror.NewInternalError("Error creating user"))
+		logger.FromContext(r.Context()).Error("error creating user in DB", zap.Error(err))
 		return
 	}
 
 	// Автоматическая аутентификация после регистрации
 	accessToken, refreshToken, err := h.generateTokens(user)
 	if err != nil {
-		http.Error(w, "Error generating tokens", http.StatusInternalServerError)
+		customerror.Write(w, r, customerror.NewInternalError("Error generating tokens"))
 		return
 	}
 
@@ -104,32 +98,33 @@ func (h *AuthHandler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
-		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		customerror.Write(w, r, customerror.NewInternalError("Error encoding response"))
 	}
 }
 
 func (h *AuthHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
-	var req schemas.LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	req, ok := decodeJSON[schemas.LoginRequest](w, r)
+	if !ok {
 		return
 	}
 
-	user, err := h.UserStorage.GetUserByLogin(req.Login)
+	user, err := h.UserStorage.GetUserByLogin(r.Context(), req.Login)
 	if err != nil || user == nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		customerror.Write(w, r, customerror.NewUnauthorizedError("Invalid credentials"))
 		return
 	}
 
+	_, span := tracing.Start(r.Context(), "bcrypt.CompareHashAndPassword")
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password))
+	span.End()
 	if err != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		customerror.Write(w, r, customerror.NewUnauthorizedError("Invalid credentials"))
 		return
 	}
 
 	accessToken, refreshToken, err := h.generateTokens(user)
 	if err != nil {
-		http.Error(w, "Error generating tokens", http.StatusInternalServerError)
+		customerror.Write(w, r, customerror.NewInternalError("Error generating tokens"))
 		return
 	}
 
@@ -145,7 +140,7 @@ func (h *AuthHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
-		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		customerror.Write(w, r, customerror.NewInternalError("Error encoding response"))
 	}
 }
 
@@ -176,26 +171,26 @@ func (h *AuthHandler) RefreshHandler(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" || len(authHeader) < 8 || authHeader[:7] != "Bearer " {
-			http.Error(w, "Refresh token required", http.StatusUnauthorized)
+			customerror.Write(w, r, customerror.NewUnauthorizedError("Refresh token required"))
 			return
 		}
 		refreshToken := authHeader[7:]
 
 		claims, err := h.ValidateToken(refreshToken)
 		if err != nil {
-			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			customerror.Write(w, r, customerror.NewUnauthorizedError("Invalid refresh token"))
 			return
 		}
 
-		user, err := h.UserStorage.GetUserByID(claims.UserID)
+		user, err := h.UserStorage.GetUserByID(r.Context(), claims.UserID)
 		if err != nil {
-			http.Error(w, "User not found", http.StatusUnauthorized)
+			customerror.Write(w, r, customerror.NewUnauthorizedError("User not found"))
 			return
 		}
 
 		accessToken, newRefreshToken, err := h.generateTokens(user)
 		if err != nil {
-			http.Error(w, "Error generating tokens", http.StatusInternalServerError)
+			customerror.Write(w, r, customerror.NewInternalError("Error generating tokens"))
 			return
 		}
 
@@ -211,26 +206,26 @@ func (h *AuthHandler) RefreshHandler(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		err = json.NewEncoder(w).Encode(response)
 		if err != nil {
-			http.Error(w, "Error encoding response", http.StatusInternalServerError)
+			customerror.Write(w, r, customerror.NewInternalError("Error encoding response"))
 		}
 		return
 	}
 
 	claims, err := h.ValidateToken(refreshCookie.Value)
 	if err != nil {
-		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		customerror.Write(w, r, customerror.NewUnauthorizedError("Invalid refresh token"))
 		return
 	}
 
-	user, err := h.UserStorage.GetUserByID(claims.UserID)
+	user, err := h.UserStorage.GetUserByID(r.Context(), claims.UserID)
 	if err != nil {
-		http.Error(w, "User not found", http.StatusUnauthorized)
+		customerror.Write(w, r, customerror.NewUnauthorizedError("User not found"))
 		return
 	}
 
 	accessToken, newRefreshToken, err := h.generateTokens(user)
 	if err != nil {
-		http.Error(w, "Error generating tokens", http.StatusInternalServerError)
+		customerror.Write(w, r, customerror.NewInternalError("Error generating tokens"))
 		return
 	}
 
@@ -246,7 +241,7 @@ func (h *AuthHandler) RefreshHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
-		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		customerror.Write(w, r, customerror.NewInternalError("Error encoding response"))
 	}
 }
 
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Bessima/diplom-gomarket/internal/customerror"
+	"github.com/Bessima/diplom-gomarket/internal/handlers/schemas"
+	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+)
+
+type BalanceHandler struct {
+	BalanceRepository repository.BalanceStorageRepositoryI
+}
+
+func NewBalanceHandler(balanceRepository repository.BalanceStorageRepositoryI) *BalanceHandler {
+	return &BalanceHandler{BalanceRepository: balanceRepository}
+}
+
+func (h *BalanceHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		customerror.Write(w, r, customerror.NewBadRequestError("user was not got"))
+		logger.FromContext(r.Context()).Error("user was not got")
+		return
+	}
+
+	filter, err := parseHistoryFilter(r)
+	if err != nil {
+		customerror.Write(w, r, customerror.NewBadRequestError(err.Error()))
+		return
+	}
+	limit := filter.Limit
+	// Запрашиваем на одну запись больше, чтобы понять, есть ли следующая страница
+	filter.Limit++
+
+	events, err := h.BalanceRepository.GetHistory(r.Context(), user.ID, filter)
+	if err != nil {
+		customerror.Write(w, r, customerror.NewInternalError("balance history was not found"))
+		logger.FromContext(r.Context()).Error("balance history was not found", zap.Error(err))
+		return
+	}
+
+	response := schemas.BalanceHistoryResponse{Events: events}
+	if len(events) > limit {
+		response.Events = events[:limit]
+		response.NextCursor = response.Events[limit-1].Cursor().Encode()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("Error encoding response", zap.Error(err))
+	}
+}
+
+func parseHistoryFilter(r *http.Request) (repository.BalanceHistoryFilter, error) {
+	query := r.URL.Query()
+	filter := repository.BalanceHistoryFilter{Limit: defaultHistoryLimit}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxHistoryLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", maxHistoryLimit)
+		}
+		filter.Limit = limit
+	}
+
+	var err error
+	if filter.From, err = parseTimeParam(query.Get("from")); err != nil {
+		return filter, fmt.Errorf("invalid from: %w", err)
+	}
+	if filter.To, err = parseTimeParam(query.Get("to")); err != nil {
+		return filter, fmt.Errorf("invalid to: %w", err)
+	}
+
+	for _, value := range query["type"] {
+		for _, item := range strings.Split(value, ",") {
+			eventType := models.BalanceEventType(strings.ToUpper(strings.TrimSpace(item)))
+			if !eventType.IsValid() {
+				return filter, fmt.Errorf("unknown event type %q", item)
+			}
+			filter.Types = append(filter.Types, eventType)
+		}
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := models.DecodeBalanceEventCursor(value)
+		if err != nil {
+			return filter, err
+		}
+		filter.Cursor = cursor
+	}
+
+	return filter, nil
+}
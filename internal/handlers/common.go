@@ -1,19 +1,104 @@
 package handlers
 
+import (
+	"errors"
+	"fmt"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
+	"github.com/Bessima/diplom-gomarket/internal/validation"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxListLimit = 1000
+
+var errBadListParams = errors.New("invalid list parameters")
+
+// CheckLuhn проверяет номер заказа по алгоритму Луна
 func CheckLuhn(number string) bool {
-	sum := 0
-	double := false
-	for i := len(number) - 1; i >= 0; i-- {
-		digit := int(number[i] - '0')
-
-		if double {
-			digit *= 2
-			if digit > 9 {
-				digit -= 9
-			}
+	return validation.Luhn(number)
+}
+
+// parseTimeParam принимает время в формате RFC3339 или дату в формате YYYY-MM-DD
+func parseTimeParam(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return &parsed, nil
+	}
+	parsed, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+// listPage общие параметры постраничного вывода списков
+type listPage struct {
+	sort   repository.SortOrder
+	cursor *models.ListCursor
+	limit  int
+}
+
+// listPageParams query-параметры постраничного вывода, общие для всех списков
+var listPageParams = []string{"sort", "limit", "cursor"}
+
+// hasListParams сообщает, что в запросе есть параметры пагинации или фильтры filters. Остальные
+// параметры, например от кеша браузера, не меняют формат ответа.
+func hasListParams(r *http.Request, filters ...string) bool {
+	query := r.URL.Query()
+	for _, name := range append(slices.Clone(listPageParams), filters...) {
+		if query.Has(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseListPage(r *http.Request) (listPage, error) {
+	query := r.URL.Query()
+	page := listPage{sort: repository.SortDesc}
+
+	switch sort := strings.ToLower(query.Get("sort")); sort {
+	case "", string(repository.SortDesc):
+	case string(repository.SortAsc):
+		page.sort = repository.SortAsc
+	default:
+		return page, fmt.Errorf("sort must be %q or %q", repository.SortAsc, repository.SortDesc)
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxListLimit {
+			return page, fmt.Errorf("limit must be between 1 and %d", maxListLimit)
+		}
+		page.limit = limit
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := models.DecodeListCursor(value)
+		if err != nil {
+			return page, err
 		}
-		sum += digit
-		double = !double
+		page.cursor = cursor
 	}
-	return sum%10 == 0
+
+	return page, nil
+}
+
+// setNextPageHeaders выставляет Link и X-Next-Cursor, тело ответа остается массивом как в спецификации
+func setNextPageHeaders(w http.ResponseWriter, r *http.Request, cursor models.ListCursor) {
+	encoded := cursor.Encode()
+
+	next := *r.URL
+	query := next.Query()
+	query.Set("cursor", encoded)
+	next.RawQuery = query.Encode()
+
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+	w.Header().Set("X-Next-Cursor", encoded)
 }
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/Bessima/diplom-gomarket/internal/customerror"
+	"github.com/Bessima/diplom-gomarket/internal/export"
+	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// exportFlushEvery через сколько строк буфер выгрузки отправляется клиенту
+const exportFlushEvery = 100
+
+// Колонки выгрузок. Заголовок пишется до строк, поэтому пустая выгрузка тоже его содержит.
+var (
+	orderExportColumns      = []string{"number", "status", "accrual", "uploaded_at", "processed_at"}
+	withdrawalExportColumns = []string{"order", "sum", "processed_at"}
+)
+
+// countingResponseWriter считает байты, дошедшие до клиента. Буфер формата выгрузки может отправить
+// статус и часть строк раньше явного сброса, после этого ответить ошибкой уже нельзя.
+type countingResponseWriter struct {
+	http.ResponseWriter
+	written int64
+}
+
+func (w *countingResponseWriter) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.written += int64(n)
+	return n, err
+}
+
+type ExportHandler struct {
+	OrderStorage    repository.OrderStorageRepositoryI
+	WithdrawStorage repository.WithdrawStorageRepositoryI
+}
+
+func NewExportHandler(orderStorage repository.OrderStorageRepositoryI, withdrawStorage repository.WithdrawStorageRepositoryI) *ExportHandler {
+	return &ExportHandler{OrderStorage: orderStorage, WithdrawStorage: withdrawStorage}
+}
+
+type exportParams struct {
+	format   export.Format
+	location *time.Location
+	from     *time.Time
+	to       *time.Time
+}
+
+func parseExportParams(r *http.Request) (exportParams, error) {
+	query := r.URL.Query()
+	params := exportParams{location: time.UTC}
+
+	format, err := export.ParseFormat(query.Get("format"), r.Header.Get("Accept"))
+	if err != nil {
+		return params, err
+	}
+	params.format = format
+
+	if tz := query.Get("tz"); tz != "" {
+		location, err := time.LoadLocation(tz)
+		if err != nil {
+			return params, fmt.Errorf("unknown time zone %q", tz)
+		}
+		params.location = location
+	}
+
+	if params.from, err = parseTimeParam(query.Get("from")); err != nil {
+		return params, fmt.Errorf("invalid from: %w", err)
+	}
+	if params.to, err = parseTimeParam(query.Get("to")); err != nil {
+		return params, fmt.Errorf("invalid to: %w", err)
+	}
+
+	return params, nil
+}
+
+func (h *ExportHandler) ExportOrders(w http.ResponseWriter, r *http.Request) {
+	h.export(w, r, "orders", orderExportColumns, func(userID int, params exportParams, writeRow func([]export.Field) error) error {
+		return h.OrderStorage.StreamByUserID(r.Context(), userID, params.from, params.to, func(record models.OrderRecord) error {
+			var accrual any
+			if record.AccrualKopecks != nil {
+				accrual = export.Money(*record.AccrualKopecks)
+			}
+			var processedAt any
+			if record.ProcessedAt != nil {
+				processedAt = *record.ProcessedAt
+			}
+			return writeRow([]export.Field{
+				{Name: "number", Value: record.Number},
+				{Name: "status", Value: string(record.Status)},
+				{Name: "accrual", Value: accrual},
+				{Name: "uploaded_at", Value: record.UploadedAt},
+				{Name: "processed_at", Value: processedAt},
+			})
+		})
+	})
+}
+
+func (h *ExportHandler) ExportWithdrawals(w http.ResponseWriter, r *http.Request) {
+	h.export(w, r, "withdrawals", withdrawalExportColumns, func(userID int, params exportParams, writeRow func([]export.Field) error) error {
+		return h.WithdrawStorage.StreamByUserID(r.Context(), userID, params.from, params.to, func(record models.WithdrawalRecord) error {
+			return writeRow([]export.Field{
+				{Name: "order", Value: record.Order},
+				{Name: "sum", Value: export.Money(record.SumKopecks)},
+				{Name: "processed_at", Value: record.ProcessedAt},
+			})
+		})
+	})
+}
+
+func (h *ExportHandler) export(
+	w http.ResponseWriter,
+	r *http.Request,
+	name string,
+	columns []string,
+	stream func(userID int, params exportParams, writeRow func([]export.Field) error) error,
+) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		customerror.Write(w, r, customerror.NewBadRequestError("user was not got"))
+		logger.FromContext(r.Context()).Error("user was not got")
+		return
+	}
+
+	params, err := parseExportParams(r)
+	if err != nil {
+		customerror.Write(w, r, customerror.NewBadRequestError(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", params.format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, params.format.Extension()))
+
+	sent := &countingResponseWriter{ResponseWriter: w}
+	writer := export.NewWriter(params.format, sent, params.location)
+	flusher, _ := w.(http.Flusher)
+	rowsWritten := 0
+
+	err = writer.WriteHeader(columns)
+	if err == nil {
+		err = stream(user.ID, params, func(row []export.Field) error {
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+			rowsWritten++
+			if rowsWritten%exportFlushEvery == 0 {
+				if err := writer.Flush(); err != nil {
+					return err
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		logger.FromContext(r.Context()).Error("export was interrupted", zap.String("export", name), zap.Error(err))
+		// Пока клиенту не ушло ни байта, можно ответить ошибкой
+		if sent.written == 0 {
+			w.Header().Del("Content-Disposition")
+			customerror.Write(w, r, customerror.NewInternalError("export failed"))
+			return
+		}
+		// Иначе файл уже частично отправлен: обрываем соединение, чтобы клиент не принял обрезанную
+		// выгрузку за полную
+		panic(http.ErrAbortHandler)
+	}
+
+	if err = writer.Flush(); err != nil {
+		logger.FromContext(r.Context()).Error("Error flushing export", zap.Error(err))
+	}
+}
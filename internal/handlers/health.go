@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/Bessima/diplom-gomarket/internal/health"
+	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+type HealthHandler struct {
+	checker *health.Checker
+}
+
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{checker: checker}
+}
+
+// Liveness процесс жив и обрабатывает запросы
+func (h *HealthHandler) Liveness(w http.ResponseWriter, r *http.Request) {
+	writeHealthReport(w, r, http.StatusOK, health.Report{Status: health.StatusOK, Checks: map[string]health.CheckResult{}})
+}
+
+// Readiness сервис готов принимать трафик, если прошли все критичные проверки
+func (h *HealthHandler) Readiness(w http.ResponseWriter, r *http.Request) {
+	report := h.checker.Check(r.Context())
+
+	status := http.StatusOK
+	if report.Status != health.StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	writeHealthReport(w, r, status, report)
+}
+
+func writeHealthReport(w http.ResponseWriter, r *http.Request, status int, report health.Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(report)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("Error encoding response", zap.Error(err))
+	}
+}
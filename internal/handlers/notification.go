@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Bessima/diplom-gomarket/internal/customerror"
+	"github.com/Bessima/diplom-gomarket/internal/handlers/schemas"
+	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/netguard"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
+	"go.uber.org/zap"
+	"net/http"
+	"net/mail"
+)
+
+type NotificationHandler struct {
+	SettingsStorage repository.NotificationSettingsRepositoryI
+}
+
+func NewNotificationHandler(settingsStorage repository.NotificationSettingsRepositoryI) *NotificationHandler {
+	return &NotificationHandler{SettingsStorage: settingsStorage}
+}
+
+func (h *NotificationHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		customerror.Write(w, r, customerror.NewBadRequestError("user was not got"))
+		logger.FromContext(r.Context()).Error("user was not got")
+		return
+	}
+
+	settings, err := h.SettingsStorage.Get(r.Context(), user.ID)
+	if err != nil {
+		customerror.Write(w, r, customerror.NewInternalError("notification settings were not found"))
+		logger.FromContext(r.Context()).Error("notification settings were not found", zap.Error(err))
+		return
+	}
+
+	writeNotificationSettings(w, r, settings)
+}
+
+func (h *NotificationHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	body, ok := decodeJSON[schemas.NotificationSettingsRequest](w, r)
+	if !ok {
+		return
+	}
+
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		customerror.Write(w, r, customerror.NewBadRequestError("user was not got"))
+		logger.FromContext(r.Context()).Error("user was not got")
+		return
+	}
+
+	settings, err := parseNotificationSettings(r.Context(), user.ID, body)
+	if err != nil {
+		customerror.Write(w, r, customerror.NewBadRequestError(err.Error()))
+		return
+	}
+
+	err = h.SettingsStorage.Save(r.Context(), settings)
+	if err != nil {
+		customerror.Write(w, r, customerror.NewInternalError("notification settings were not saved"))
+		logger.FromContext(r.Context()).Error("notification settings were not saved", zap.Error(err))
+		return
+	}
+
+	writeNotificationSettings(w, r, &settings)
+}
+
+func parseNotificationSettings(ctx context.Context, userID int, body schemas.NotificationSettingsRequest) (models.NotificationSettings, error) {
+	settings := models.NotificationSettings{
+		UserID:   userID,
+		Language: body.Language,
+		Channels: []string{},
+		Events:   []string{},
+		Email:    body.Email,
+		HTTPURL:  body.HTTPURL,
+	}
+
+	if settings.Language != models.LanguageRU && settings.Language != models.LanguageEN {
+		return settings, fmt.Errorf("unsupported language %q", body.Language)
+	}
+
+	for _, channel := range body.Channels {
+		if !isKnown(models.NotificationChannels, channel) {
+			return settings, fmt.Errorf("unknown channel %q", channel)
+		}
+		if !settings.HasChannel(channel) {
+			settings.Channels = append(settings.Channels, channel)
+		}
+	}
+	for _, event := range body.Events {
+		if !isKnown(models.NotificationEvents, event) {
+			return settings, fmt.Errorf("unknown event %q", event)
+		}
+		if !settings.HasEvent(event) {
+			settings.Events = append(settings.Events, event)
+		}
+	}
+
+	if settings.Email != "" {
+		if _, err := mail.ParseAddress(settings.Email); err != nil {
+			return settings, fmt.Errorf("invalid email")
+		}
+	} else if settings.HasChannel(models.EmailChannel) {
+		return settings, fmt.Errorf("email is required for the email channel")
+	}
+
+	if settings.HTTPURL != "" {
+		if err := netguard.ValidateURL(ctx, settings.HTTPURL); err != nil {
+			return settings, fmt.Errorf("http_url %w", err)
+		}
+	} else if settings.HasChannel(models.HTTPChannel) {
+		return settings, fmt.Errorf("http_url is required for the http channel")
+	}
+
+	return settings, nil
+}
+
+func isKnown(known []string, value string) bool {
+	for _, item := range known {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func writeNotificationSettings(w http.ResponseWriter, r *http.Request, settings *models.NotificationSettings) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(w).Encode(settings)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("Error encoding response", zap.Error(err))
+	}
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Bessima/diplom-gomarket/internal/customerror"
+	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	streamHeartbeatInterval = 30 * time.Second
+	// streamReplayLimit размер страницы пропущенных событий, история читается страницами до конца
+	streamReplayLimit = 1000
+)
+
+// OrderEventSubscriber источник событий заказов для SSE, реализуется events.Broker
+type OrderEventSubscriber interface {
+	Subscribe(userID int) (<-chan models.OrderEvent, func())
+}
+
+type OrderStreamHandler struct {
+	EventStorage repository.OrderEventStorageRepositoryI
+	subscriber   OrderEventSubscriber
+}
+
+func NewOrderStreamHandler(eventStorage repository.OrderEventStorageRepositoryI, subscriber OrderEventSubscriber) *OrderStreamHandler {
+	return &OrderStreamHandler{EventStorage: eventStorage, subscriber: subscriber}
+}
+
+func (h *OrderStreamHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		customerror.Write(w, r, customerror.NewBadRequestError("user was not got"))
+		logger.FromContext(r.Context()).Error("user was not got")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		customerror.Write(w, r, customerror.NewInternalError("streaming is not supported"))
+		return
+	}
+
+	var lastEventID int64
+	if value := r.Header.Get("Last-Event-ID"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			customerror.Write(w, r, customerror.NewBadRequestError("invalid Last-Event-ID"))
+			return
+		}
+		lastEventID = parsed
+	}
+
+	// Подписываемся до чтения пропущенных событий, чтобы не потерять события между запросом и подпиской
+	events, unsubscribe := h.subscriber.Subscribe(user.ID)
+	defer unsubscribe()
+
+	var missed []models.OrderEvent
+	if lastEventID > 0 {
+		var err error
+		missed, err = h.EventStorage.GetListAfterID(r.Context(), user.ID, lastEventID, streamReplayLimit)
+		if err != nil {
+			customerror.Write(w, r, customerror.NewInternalError("order events were not found"))
+			logger.FromContext(r.Context()).Error("order events were not found", zap.Error(err))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		for _, event := range missed {
+			if err := writeOrderEvent(w, r, event); err != nil {
+				return
+			}
+			lastEventID = event.ID
+		}
+		flusher.Flush()
+		if len(missed) < streamReplayLimit {
+			break
+		}
+
+		var err error
+		missed, err = h.EventStorage.GetListAfterID(r.Context(), user.ID, lastEventID, streamReplayLimit)
+		if err != nil {
+			// Ответ уже начат: закрываем поток, клиент переподключится с последним полученным Last-Event-ID
+			logger.FromContext(r.Context()).Error("order events were not found", zap.Error(err))
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event, ok := <-events:
+			if !ok {
+				// Брокер закрыл подписку, потому что клиент не успевал получать события. Закрываем поток:
+				// клиент переподключится с Last-Event-ID и получит пропущенные события из истории.
+				logger.FromContext(r.Context()).Warn("order event subscription lagged, closing stream",
+					zap.Int64("last_event_id", lastEventID))
+				return
+			}
+			// Событие могло уже прийти из истории
+			if event.ID <= lastEventID {
+				continue
+			}
+			if err := writeOrderEvent(w, r, event); err != nil {
+				return
+			}
+			lastEventID = event.ID
+			flusher.Flush()
+		}
+	}
+}
+
+func writeOrderEvent(w http.ResponseWriter, r *http.Request, event models.OrderEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("Error encoding order event", zap.Error(err))
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: order\ndata: %s\n\n", event.ID, data)
+	return err
+}
@@ -1,61 +1,91 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/Bessima/diplom-gomarket/internal/customerror"
+	"github.com/Bessima/diplom-gomarket/internal/handlers/schemas"
 	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
 	"github.com/Bessima/diplom-gomarket/internal/models"
 	"github.com/Bessima/diplom-gomarket/internal/repository"
-	"io"
+	"github.com/Bessima/diplom-gomarket/internal/service"
+	"go.uber.org/zap"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// maxBatchOrders максимальное количество номеров в одной пакетной загрузке
+const maxBatchOrders = 1000
+
+// maxBatchPushers сколько пакетов одновременно отправляются в очередь обработки в фоне
+const maxBatchPushers = 8
+
 type OrdersHandler struct {
-	OrderStorage        repository.OrderStorageRepositoryI
-	BalanceStorage      *repository.BalanceRepository
-	ordersForProcessing chan models.Order
+	OrderStorage   repository.OrderStorageRepositoryI
+	BalanceStorage repository.BalanceStorageRepositoryI
+	orderQueue     *service.OrderQueue
+	// ctx контекст сервиса: фоновая отправка пакетов в очередь прекращается при его отмене
+	ctx          context.Context
+	batchPushers chan struct{}
 }
 
-func NewOrderHandler(storage repository.OrderStorageRepositoryI, balanceRepository *repository.BalanceRepository, ordersForProcessing chan models.Order) *OrdersHandler {
+func NewOrderHandler(ctx context.Context, storage repository.OrderStorageRepositoryI, balanceRepository repository.BalanceStorageRepositoryI, orderQueue *service.OrderQueue) *OrdersHandler {
 	return &OrdersHandler{
-		OrderStorage:        storage,
-		BalanceStorage:      balanceRepository,
-		ordersForProcessing: ordersForProcessing,
+		OrderStorage:   storage,
+		BalanceStorage: balanceRepository,
+		orderQueue:     orderQueue,
+		ctx:            ctx,
+		batchPushers:   make(chan struct{}, maxBatchPushers),
+	}
+}
+
+// acceptingOrders отвечает 503, если очередь обработки закрыта при остановке сервиса
+func (h *OrdersHandler) acceptingOrders(w http.ResponseWriter, r *http.Request) bool {
+	select {
+	case <-h.orderQueue.Done():
+		w.Header().Set("Retry-After", "30")
+		customerror.Write(w, r, customerror.NewServiceUnavailableError("service is shutting down"))
+		return false
+	default:
+		return true
 	}
 }
 
 func (h *OrdersHandler) Add(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
+	if !h.acceptingOrders(w, r) {
+		return
+	}
 
-	bodyBytes, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "can't read body", http.StatusBadRequest)
-		logger.Log.Error(err.Error())
+	bodyBytes, ok := readBody(w, r)
+	if !ok {
 		return
 	}
 
 	bodyString := string(bodyBytes)
 	if !CheckLuhn(bodyString) {
-		http.Error(w, "invalid order number", http.StatusUnprocessableEntity)
-		logger.Log.Error(fmt.Sprintf("invalid order number: %s", bodyString))
-		w.WriteHeader(http.StatusBadRequest)
+		customerror.Write(w, r, customerror.NewInvalidNumberError("invalid order number"))
+		logger.FromContext(r.Context()).Warn("invalid order number", zap.String("order", bodyString))
 		return
 	}
 	orderID, err := strconv.Atoi(bodyString)
 	if err != nil {
-		http.Error(w, "invalid order number", http.StatusBadRequest)
+		customerror.Write(w, r, customerror.NewBadRequestError("invalid order number"))
 		return
 	}
 
 	user := GetUserFromContext(r.Context())
 	if user == nil {
-		http.Error(w, "user was not got", http.StatusBadRequest)
-		logger.Log.Error("user was not got")
+		customerror.Write(w, r, customerror.NewBadRequestError("user was not got"))
+		logger.FromContext(r.Context()).Error("user was not got")
 		return
 	}
-	order, _ := h.OrderStorage.GetByID(orderID)
+	order, _ := h.OrderStorage.GetByID(r.Context(), orderID)
 	if order != nil {
 		if order.UserID == user.ID {
 			w.WriteHeader(http.StatusOK)
@@ -63,36 +93,187 @@ func (h *OrdersHandler) Add(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		http.Error(w, "order was already added other user", http.StatusConflict)
-		logger.Log.Warn(fmt.Sprintf("order %d was already added other user", orderID))
+		customerror.Write(w, r, customerror.NewOrderConflictError("order was already added other user"))
+		logger.FromContext(r.Context()).Warn("order was already added by other user", zap.Int("order", orderID))
 		return
 	}
 
-	err = h.OrderStorage.Create(user.ID, orderID)
+	err = h.OrderStorage.Create(r.Context(), user.ID, orderID)
 
 	if err != nil {
-		http.Error(w, "order was not created", http.StatusInternalServerError)
-		logger.Log.Warn(fmt.Sprintf("order was not created, error: %v", err))
+		customerror.Write(w, r, customerror.NewInternalError("order was not created"))
+		logger.FromContext(r.Context()).Warn("order was not created", zap.Error(err))
 		return
 	}
-	h.ordersForProcessing <- models.Order{ID: bodyString, UserID: user.ID, Status: models.NewStatus}
+	if !h.orderQueue.Push(r.Context(), models.Order{ID: bodyString, UserID: user.ID, Status: models.NewStatus}) {
+		// Заказ уже сохранен в статусе NEW и попадет в очередь при следующем запуске
+		logger.FromContext(r.Context()).Info("order was not queued for processing", zap.Int("order", orderID))
+	}
 
 	w.WriteHeader(http.StatusAccepted)
 	w.Write([]byte("Order added successfully!"))
 }
 
+func (h *OrdersHandler) BatchAdd(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if !h.acceptingOrders(w, r) {
+		return
+	}
+
+	bodyBytes, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+
+	numbers, err := parseBatchNumbers(bodyBytes)
+	if err != nil {
+		customerror.Write(w, r, customerror.NewBadRequestError(err.Error()))
+		return
+	}
+	if len(numbers) == 0 || len(numbers) > maxBatchOrders {
+		customerror.Write(w, r, customerror.NewBadRequestError(fmt.Sprintf("batch must contain from 1 to %d orders", maxBatchOrders)))
+		return
+	}
+
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		customerror.Write(w, r, customerror.NewBadRequestError("user was not got"))
+		logger.FromContext(r.Context()).Error("user was not got")
+		return
+	}
+
+	results := make([]schemas.BatchOrderResult, len(numbers))
+	ids := make([]int64, len(numbers))
+	valid := make([]bool, len(numbers))
+	validIDs := make([]int64, 0, len(numbers))
+	for i, number := range numbers {
+		results[i] = schemas.BatchOrderResult{Number: number, Status: models.BatchInvalid}
+		id, err := strconv.ParseInt(number, 10, 64)
+		if err != nil || id <= 0 || !CheckLuhn(number) {
+			continue
+		}
+		ids[i], valid[i] = id, true
+		validIDs = append(validIDs, id)
+	}
+
+	if len(validIDs) > 0 {
+		statuses, err := h.OrderStorage.CreateBatch(r.Context(), user.ID, validIDs)
+		if err != nil {
+			customerror.Write(w, r, customerror.NewInternalError("orders were not created"))
+			logger.FromContext(r.Context()).Warn("orders batch was not created", zap.Error(err))
+			return
+		}
+
+		// Один номер может встретиться в пакете несколько раз, принятым считается только первое вхождение
+		enqueued := make(map[int64]bool)
+		var accepted []models.Order
+		for i := range results {
+			if !valid[i] {
+				continue
+			}
+			status, ok := statuses[ids[i]]
+			if !ok {
+				continue
+			}
+			if status == models.BatchAccepted && enqueued[ids[i]] {
+				status = models.BatchDuplicateOwn
+			}
+			results[i].Status = status
+			if status == models.BatchAccepted {
+				enqueued[ids[i]] = true
+				accepted = append(accepted, models.Order{ID: results[i].Number, UserID: user.ID, Status: models.NewStatus})
+			}
+		}
+
+		if len(accepted) > 0 {
+			h.enqueueBatch(r, accepted)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(results)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("Error encoding response", zap.Error(err))
+	}
+}
+
+// enqueueBatch отправляет принятые заказы пакета в очередь обработки в фоне: очередь ограничена,
+// и ответ не ждет, пока в ней освободится место. Фоновых отправителей не больше maxBatchPushers,
+// когда все заняты, запрос ждет свободного. Если клиент отключился раньше, заказы остаются в базе
+// в статусе NEW и попадают в очередь при следующем запуске сервиса или через gophermart admin requeue.
+func (h *OrdersHandler) enqueueBatch(r *http.Request, orders []models.Order) {
+	select {
+	case h.batchPushers <- struct{}{}:
+	case <-r.Context().Done():
+		logger.FromContext(r.Context()).Warn("batch orders were not enqueued", zap.Int("orders", len(orders)))
+		return
+	}
+
+	go func() {
+		defer func() { <-h.batchPushers }()
+		for _, order := range orders {
+			if !h.orderQueue.Push(h.ctx, order) {
+				return
+			}
+		}
+	}()
+}
+
+// parseBatchNumbers принимает JSON-массив номеров (строки или числа) или список номеров через перевод строки
+func parseBatchNumbers(body []byte) ([]string, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var items []json.RawMessage
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, errors.New("can't parse body")
+		}
+		numbers := make([]string, 0, len(items))
+		for _, item := range items {
+			var number string
+			if err := json.Unmarshal(item, &number); err != nil {
+				var numeric json.Number
+				if err := json.Unmarshal(item, &numeric); err != nil {
+					return nil, errors.New("order numbers must be strings or numbers")
+				}
+				number = numeric.String()
+			}
+			numbers = append(numbers, strings.TrimSpace(number))
+		}
+		return numbers, nil
+	}
+
+	var numbers []string
+	for _, line := range strings.Split(string(trimmed), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			numbers = append(numbers, line)
+		}
+	}
+	return numbers, nil
+}
+
 func (h *OrdersHandler) GetOrders(w http.ResponseWriter, r *http.Request) {
+	var err error
 	user := GetUserFromContext(r.Context())
 	if user == nil {
-		http.Error(w, "user was not got", http.StatusBadRequest)
-		logger.Log.Error("user was not got")
+		customerror.Write(w, r, customerror.NewBadRequestError("user was not got"))
+		logger.FromContext(r.Context()).Error("user was not got")
 		return
 	}
 
-	orders, err := h.OrderStorage.GetListByUserID(user.ID)
+	var orders []models.Order
+	if !hasListParams(r, orderListFilters...) {
+		orders, err = h.OrderStorage.GetListByUserID(r.Context(), user.ID)
+	} else {
+		orders, err = h.getOrdersPage(w, r, user.ID)
+		if errors.Is(err, errBadListParams) {
+			customerror.Write(w, r, customerror.NewBadRequestError(err.Error()))
+			return
+		}
+	}
 	if err != nil {
-		http.Error(w, "orders were not found", http.StatusInternalServerError)
-		logger.Log.Error(fmt.Sprintf("orders were not found, error: %v", err))
+		customerror.Write(w, r, customerror.NewInternalError("orders were not found"))
+		logger.FromContext(r.Context()).Error("orders were not found", zap.Error(err))
 		return
 	}
 
@@ -100,25 +281,74 @@ func (h *OrdersHandler) GetOrders(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	err = json.NewEncoder(w).Encode(orders)
 	if err != nil {
-		logger.Log.Error(fmt.Sprintf("Error encoding response: %v", err))
+		logger.FromContext(r.Context()).Error("Error encoding response", zap.Error(err))
+	}
+
+}
+
+// orderListFilters фильтры списка заказов
+var orderListFilters = []string{"status", "uploaded_from", "uploaded_to", "processed_from", "processed_to"}
+
+// getOrdersPage выбирает заказы с учетом фильтров и пагинации из query-параметров
+func (h *OrdersHandler) getOrdersPage(w http.ResponseWriter, r *http.Request, userID int) ([]models.Order, error) {
+	page, err := parseListPage(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errBadListParams, err)
 	}
+	filter := repository.OrderListFilter{Sort: page.sort, Cursor: page.cursor, Limit: page.limit}
 
+	query := r.URL.Query()
+	for _, value := range query["status"] {
+		for _, item := range strings.Split(value, ",") {
+			status := models.OrderStatus(strings.ToUpper(strings.TrimSpace(item)))
+			if !status.IsValid() {
+				return nil, fmt.Errorf("%w: unknown status %q", errBadListParams, item)
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+	for name, target := range map[string]**time.Time{
+		"uploaded_from":  &filter.UploadedFrom,
+		"uploaded_to":    &filter.UploadedTo,
+		"processed_from": &filter.ProcessedFrom,
+		"processed_to":   &filter.ProcessedTo,
+	} {
+		if *target, err = parseTimeParam(query.Get(name)); err != nil {
+			return nil, fmt.Errorf("%w: invalid %s", errBadListParams, name)
+		}
+	}
+
+	if page.limit > 0 {
+		filter.Limit++
+	}
+	orders, err := h.OrderStorage.GetPageByUserID(r.Context(), userID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if page.limit > 0 && len(orders) > page.limit {
+		orders = orders[:page.limit]
+		last := orders[page.limit-1]
+		id, _ := strconv.ParseInt(last.ID, 10, 64)
+		setNextPageHeaders(w, r, models.ListCursor{At: last.UploadedAt, ID: id})
+	}
+	return orders, nil
 }
 
 func (h *OrdersHandler) GetBalance(w http.ResponseWriter, r *http.Request) {
 	user := GetUserFromContext(r.Context())
 	if user == nil {
-		http.Error(w, "user was not got", http.StatusBadRequest)
-		logger.Log.Error("user was not got")
+		customerror.Write(w, r, customerror.NewBadRequestError("user was not got"))
+		logger.FromContext(r.Context()).Error("user was not got")
 		return
 	}
 
-	balance, err := h.BalanceStorage.GetBalanceUserID(user.ID)
+	balance, err := h.BalanceStorage.GetBalanceUserID(r.Context(), user.ID)
 	if err != nil {
 		errNoRow := errors.New("no rows in result set")
 		if err.Error() != errNoRow.Error() {
-			http.Error(w, "Error to getting orders", http.StatusInternalServerError)
-			logger.Log.Warn(fmt.Sprintf("Error to getting orders, error: %v", err))
+			customerror.Write(w, r, customerror.NewInternalError("Error to getting orders"))
+			logger.FromContext(r.Context()).Warn("Error to getting orders", zap.Error(err))
 			return
 		}
 	}
@@ -127,6 +357,6 @@ func (h *OrdersHandler) GetBalance(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	err = json.NewEncoder(w).Encode(balance)
 	if err != nil {
-		logger.Log.Error(fmt.Sprintf("Error encoding response: %v", err))
+		logger.FromContext(r.Context()).Error("Error encoding response", zap.Error(err))
 	}
 }
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/Bessima/diplom-gomarket/internal/customerror"
+	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"github.com/Bessima/diplom-gomarket/internal/validation"
+	"go.uber.org/zap"
+)
+
+// maxRequestBodySize ограничение тела запроса: самый большой запрос API - пакет из maxBatchOrders номеров
+const maxRequestBodySize = 1 << 20
+
+// decodeJSON читает из тела запроса один JSON-объект T и проверяет его поля по тегам validate.
+// Неизвестные поля и данные после объекта отклоняются, тело больше maxRequestBodySize не читается.
+// При ошибке отвечает клиенту и возвращает false. Неверный номер заказа (правило luhn)
+// возвращается со статусом 422, как требует спецификация.
+func decodeJSON[T any](w http.ResponseWriter, r *http.Request) (T, bool) {
+	var body T
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(&body)
+	if err == nil && decoder.Decode(&struct{}{}) != io.EOF {
+		err = errors.New("body must contain a single JSON object")
+	}
+	if err != nil {
+		logger.FromContext(r.Context()).Warn("can't parse body", zap.Error(err))
+		customerror.Write(w, r, decodeError(err))
+		return body, false
+	}
+
+	fieldErrors := validation.Struct(body)
+	if len(fieldErrors) == 0 {
+		return body, true
+	}
+	isLuhn := func(fieldError customerror.FieldError) bool { return fieldError.Code == "luhn" }
+	if slices.ContainsFunc(fieldErrors, isLuhn) {
+		customerror.Write(w, r, customerror.NewInvalidNumberError("invalid order number"))
+		return body, false
+	}
+	customerror.Write(w, r, customerror.NewValidationError("request validation failed", fieldErrors...))
+	return body, false
+}
+
+// readBody читает тело запроса не в JSON, например номер заказа, с тем же ограничением размера.
+// При ошибке отвечает клиенту и возвращает false.
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	if err != nil {
+		logger.FromContext(r.Context()).Warn("can't read body", zap.Error(err))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			customerror.Write(w, r, decodeError(err))
+		} else {
+			customerror.Write(w, r, customerror.NewBadRequestError("can't read body"))
+		}
+		return nil, false
+	}
+	return body, true
+}
+
+// decodeError ошибка для клиента по ошибке чтения или разбора тела запроса
+func decodeError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return customerror.NewRequestTooLargeError(fmt.Sprintf("request body must not exceed %d bytes", tooLarge.Limit))
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		message := "must be " + jsonTypeName(typeErr.Type)
+		return customerror.NewValidationError("request validation failed",
+			customerror.FieldError{Field: typeErr.Field, Code: "type", Message: message})
+	}
+
+	// Ошибку неизвестного поля encoding/json возвращает только текстом: json: unknown field "name"
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return customerror.NewBadRequestError("unknown field " + field)
+	}
+	return customerror.NewBadRequestError("can't parse body")
+}
+
+// jsonTypeName название типа JSON, в который декодируется тип Go, для сообщения клиенту
+func jsonTypeName(goType reflect.Type) string {
+	switch goType.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+	return "an object"
+}
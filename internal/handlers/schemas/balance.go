@@ -0,0 +1,8 @@
+package schemas
+
+import "github.com/Bessima/diplom-gomarket/internal/models"
+
+type BalanceHistoryResponse struct {
+	Events     []models.BalanceEvent `json:"events"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+}
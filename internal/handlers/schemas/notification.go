@@ -0,0 +1,9 @@
+package schemas
+
+type NotificationSettingsRequest struct {
+	Language string   `json:"language" validate:"required"`
+	Channels []string `json:"channels"`
+	Events   []string `json:"events"`
+	Email    string   `json:"email"`
+	HTTPURL  string   `json:"http_url"`
+}
@@ -0,0 +1,8 @@
+package schemas
+
+import "github.com/Bessima/diplom-gomarket/internal/models"
+
+type BatchOrderResult struct {
+	Number string                  `json:"number"`
+	Status models.BatchOrderStatus `json:"status"`
+}
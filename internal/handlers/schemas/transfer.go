@@ -0,0 +1,12 @@
+package schemas
+
+import "math"
+
+type TransferRequest struct {
+	Login string  `json:"login" validate:"required"`
+	Sum   float32 `json:"sum" validate:"required,money"`
+}
+
+func (req TransferRequest) GetSumAsInt() int64 {
+	return int64(math.Round(float64(req.Sum) * 100))
+}
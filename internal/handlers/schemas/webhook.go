@@ -0,0 +1,6 @@
+package schemas
+
+type WebhookRequest struct {
+	URL        string   `json:"url" validate:"required"`
+	EventTypes []string `json:"event_types" validate:"required"`
+}
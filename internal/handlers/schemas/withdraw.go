@@ -1,21 +1,23 @@
 package schemas
 
 import (
+	"math"
 	"strconv"
 	"time"
 )
 
 type WithdrawRequest struct {
-	Order string  `json:"order" validate:"required"`
-	Sum   float32 `json:"sum" validate:"required"`
+	Order string  `json:"order" validate:"required,luhn"`
+	Sum   float32 `json:"sum" validate:"required,money"`
 }
 
 func (req WithdrawRequest) GetOrderAsInt() (int64, error) {
 	return strconv.ParseInt(req.Order, 10, 64)
 }
 
+// GetSumAsInt сумма в копейках. Округление нужно, потому что float32 хранит, например, 0.53 как 0.52999...
 func (req WithdrawRequest) GetSumAsInt() int {
-	return int(req.Sum * 100)
+	return int(math.Round(float64(req.Sum) * 100))
 }
 
 type WithdrawResponse struct {
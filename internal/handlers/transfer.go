@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Bessima/diplom-gomarket/internal/customerror"
+	"github.com/Bessima/diplom-gomarket/internal/handlers/schemas"
+	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
+	"github.com/Bessima/diplom-gomarket/internal/service"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+type TransferHandler struct {
+	TransferRepository repository.TransferStorageRepositoryI
+	UserRepository     repository.UserStorageRepositoryI
+	dailyLimit         int64
+}
+
+func NewTransferHandler(transferStorage repository.TransferStorageRepositoryI, userStorage repository.UserStorageRepositoryI, dailyLimit int64) *TransferHandler {
+	return &TransferHandler{
+		TransferRepository: transferStorage,
+		UserRepository:     userStorage,
+		dailyLimit:         dailyLimit,
+	}
+}
+
+func (h *TransferHandler) Add(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	body, ok := decodeJSON[schemas.TransferRequest](w, r)
+	if !ok {
+		return
+	}
+
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		customerror.Write(w, r, customerror.NewBadRequestError("user was not got"))
+		logger.FromContext(r.Context()).Error("user was not got")
+		return
+	}
+
+	recipient, err := h.UserRepository.GetUserByLogin(r.Context(), body.Login)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && recipient == nil) {
+		customerror.Write(w, r, customerror.NewNotFoundError("recipient"))
+		return
+	}
+	if err != nil {
+		customerror.Write(w, r, customerror.NewInternalError("can't get recipient"))
+		logger.FromContext(r.Context()).Error("can't get recipient", zap.String("login", body.Login), zap.Error(err))
+		return
+	}
+
+	transferService := service.NewTransferService(h.TransferRepository, h.dailyLimit)
+	err = transferService.Transfer(r.Context(), user, recipient, body)
+
+	if err != nil {
+		if errors.Is(err, service.ErrTransferToSelf) || errors.Is(err, service.ErrTransferNonPositive) {
+			customerror.Write(w, r, customerror.NewBadRequestError(err.Error()))
+			return
+		}
+		if customErr, ok := err.(customerror.CustomError); ok {
+			customerror.Write(w, r, customErr)
+			logger.FromContext(r.Context()).Warn("transfer was rejected", zap.Error(customErr))
+			return
+		}
+		customerror.Write(w, r, customerror.NewInternalError("transfer was not completed"))
+		logger.FromContext(r.Context()).Warn("error while transferring", zap.Int("recipient_id", recipient.ID), zap.Error(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Transfer successfully completed!"))
+}
+
+func (h *TransferHandler) GetList(w http.ResponseWriter, r *http.Request) {
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		customerror.Write(w, r, customerror.NewBadRequestError("user was not got"))
+		logger.FromContext(r.Context()).Error("user was not got")
+		return
+	}
+
+	transfers, err := h.TransferRepository.GetListByUserID(r.Context(), user.ID)
+	if err != nil {
+		customerror.Write(w, r, customerror.NewInternalError("transfers were not found"))
+		logger.FromContext(r.Context()).Error("transfers were not found", zap.Error(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(transfers)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("Error encoding response", zap.Error(err))
+	}
+}
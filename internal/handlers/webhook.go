@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Bessima/diplom-gomarket/internal/customerror"
+	"github.com/Bessima/diplom-gomarket/internal/handlers/schemas"
+	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/netguard"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
+	"github.com/Bessima/diplom-gomarket/internal/webhooks"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+const webhookDeliveriesLimit = 100
+
+type WebhookHandler struct {
+	WebhookStorage repository.WebhookStorageRepositoryI
+	// admin вебхуки партнеров без владельца, доступ проверяется AdminMiddleware
+	admin bool
+}
+
+func NewWebhookHandler(webhookStorage repository.WebhookStorageRepositoryI) *WebhookHandler {
+	return &WebhookHandler{WebhookStorage: webhookStorage}
+}
+
+func NewAdminWebhookHandler(webhookStorage repository.WebhookStorageRepositoryI) *WebhookHandler {
+	return &WebhookHandler{WebhookStorage: webhookStorage, admin: true}
+}
+
+// getOwner возвращает владельца вебхуков: пользователя из контекста или nil для администратора
+func (h *WebhookHandler) getOwner(w http.ResponseWriter, r *http.Request) (*int, bool) {
+	if h.admin {
+		return nil, true
+	}
+
+	user := GetUserFromContext(r.Context())
+	if user == nil {
+		customerror.Write(w, r, customerror.NewBadRequestError("user was not got"))
+		logger.FromContext(r.Context()).Error("user was not got")
+		return nil, false
+	}
+	return &user.ID, true
+}
+
+func (h *WebhookHandler) Create(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	body, ok := decodeJSON[schemas.WebhookRequest](w, r)
+	if !ok {
+		return
+	}
+
+	ownerID, ok := h.getOwner(w, r)
+	if !ok {
+		return
+	}
+
+	if err := netguard.ValidateURL(r.Context(), body.URL); err != nil {
+		customerror.Write(w, r, customerror.NewBadRequestError("url "+err.Error()))
+		return
+	}
+
+	eventTypes, err := parseWebhookEventTypes(body.EventTypes)
+	if err != nil {
+		customerror.Write(w, r, customerror.NewBadRequestError(err.Error()))
+		return
+	}
+
+	secret, err := webhooks.GenerateSecret()
+	if err != nil {
+		customerror.Write(w, r, customerror.NewInternalError("webhook was not created"))
+		logger.FromContext(r.Context()).Error("can't generate webhook secret", zap.Error(err))
+		return
+	}
+
+	webhook, err := h.WebhookStorage.Create(r.Context(), ownerID, body.URL, secret, eventTypes)
+	if err != nil {
+		customerror.Write(w, r, customerror.NewInternalError("webhook was not created"))
+		logger.FromContext(r.Context()).Error("webhook was not created", zap.Error(err))
+		return
+	}
+
+	// Секрет возвращается только при создании
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(webhook)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("Error encoding response", zap.Error(err))
+	}
+}
+
+func (h *WebhookHandler) GetList(w http.ResponseWriter, r *http.Request) {
+	ownerID, ok := h.getOwner(w, r)
+	if !ok {
+		return
+	}
+
+	webhookList, err := h.WebhookStorage.GetListByOwner(r.Context(), ownerID)
+	if err != nil {
+		customerror.Write(w, r, customerror.NewInternalError("webhooks were not found"))
+		logger.FromContext(r.Context()).Error("webhooks were not found", zap.Error(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(webhookList)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("Error encoding response", zap.Error(err))
+	}
+}
+
+func (h *WebhookHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	ownerID, ok := h.getOwner(w, r)
+	if !ok {
+		return
+	}
+
+	webhookID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		customerror.Write(w, r, customerror.NewBadRequestError("invalid webhook id"))
+		return
+	}
+
+	err = h.WebhookStorage.Delete(r.Context(), ownerID, webhookID)
+	if err != nil {
+		if customErr, ok := err.(customerror.CustomError); ok {
+			customerror.Write(w, r, customErr)
+			return
+		}
+		customerror.Write(w, r, customerror.NewInternalError("webhook was not deleted"))
+		logger.FromContext(r.Context()).Error("webhook was not deleted", zap.Int64("webhook_id", webhookID), zap.Error(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	ownerID, ok := h.getOwner(w, r)
+	if !ok {
+		return
+	}
+
+	webhookID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		customerror.Write(w, r, customerror.NewBadRequestError("invalid webhook id"))
+		return
+	}
+
+	deliveries, err := h.WebhookStorage.GetDeliveries(r.Context(), ownerID, webhookID, webhookDeliveriesLimit)
+	if err != nil {
+		customerror.Write(w, r, customerror.NewInternalError("webhook deliveries were not found"))
+		logger.FromContext(r.Context()).Error("webhook deliveries were not found", zap.Error(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(deliveries)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("Error encoding response", zap.Error(err))
+	}
+}
+
+func parseWebhookEventTypes(values []string) ([]models.WebhookEventType, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("event_types must not be empty")
+	}
+
+	eventTypes := make([]models.WebhookEventType, 0, len(values))
+	seen := make(map[models.WebhookEventType]bool, len(values))
+	for _, value := range values {
+		eventType := models.WebhookEventType(value)
+		if !eventType.IsValid() {
+			return nil, fmt.Errorf("unknown event type %q", value)
+		}
+		if seen[eventType] {
+			continue
+		}
+		seen[eventType] = true
+		eventTypes = append(eventTypes, eventType)
+	}
+	return eventTypes, nil
+}
@@ -2,23 +2,26 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/Bessima/diplom-gomarket/internal/customerror"
 	"github.com/Bessima/diplom-gomarket/internal/handlers/schemas"
 	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"github.com/Bessima/diplom-gomarket/internal/models"
 	"github.com/Bessima/diplom-gomarket/internal/repository"
 	"github.com/Bessima/diplom-gomarket/internal/service"
-	"io"
+	"go.uber.org/zap"
 	"net/http"
+	"strconv"
 )
 
 type WithdrawHandler struct {
 	WithdrawRepository repository.WithdrawStorageRepositoryI
 	OrderRepository    repository.OrderStorageRepositoryI
-	BalanceRepository  *repository.BalanceRepository
+	BalanceRepository  repository.BalanceStorageRepositoryI
 }
 
-func NewWithdrawHandler(withdrawStorage repository.WithdrawStorageRepositoryI, orderStorage repository.OrderStorageRepositoryI, balanceRepository *repository.BalanceRepository) *WithdrawHandler {
+func NewWithdrawHandler(withdrawStorage repository.WithdrawStorageRepositoryI, orderStorage repository.OrderStorageRepositoryI, balanceRepository repository.BalanceStorageRepositoryI) *WithdrawHandler {
 
 	return &WithdrawHandler{
 		WithdrawRepository: withdrawStorage,
@@ -30,56 +33,40 @@ func NewWithdrawHandler(withdrawStorage repository.WithdrawStorageRepositoryI, o
 func (h *WithdrawHandler) Add(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
-	bodyBytes, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "can't read body", http.StatusBadRequest)
-		logger.Log.Error(err.Error())
-		return
-	}
-	var body schemas.WithdrawRequest
-	err = json.Unmarshal(bodyBytes, &body)
-	if err != nil {
-		http.Error(w, "can't parse body", http.StatusBadRequest)
-		logger.Log.Error(err.Error())
-		return
-	}
-
-	if !CheckLuhn(body.Order) {
-		http.Error(w, "invalid order number", http.StatusUnprocessableEntity)
-		logger.Log.Error(fmt.Sprintf("invalid order number: %s", body.Order))
+	body, ok := decodeJSON[schemas.WithdrawRequest](w, r)
+	if !ok {
 		return
 	}
 
 	user := GetUserFromContext(r.Context())
 	if user == nil {
-		http.Error(w, "user was not got", http.StatusBadRequest)
-		logger.Log.Error("user was not got")
+		customerror.Write(w, r, customerror.NewBadRequestError("user was not got"))
+		logger.FromContext(r.Context()).Error("user was not got")
 		return
 	}
 
-	balance, err := h.BalanceRepository.GetBalanceUserID(user.ID)
+	balance, err := h.BalanceRepository.GetBalanceUserID(r.Context(), user.ID)
 	if err != nil {
-		http.Error(w, "can't get balance of user", http.StatusBadRequest)
+		customerror.Write(w, r, customerror.NewBadRequestError("can't get balance of user"))
 		return
 	}
 
 	if body.Sum > balance.Current {
-		http.Error(w, "There are insufficient funds", http.StatusPaymentRequired)
+		customerror.Write(w, r, customerror.NewInsufficientFundsError("there are not enough points on the balance"))
 		return
 	}
 
-	withdrawService := service.NewWithdrawService(h.WithdrawRepository, h.BalanceRepository)
-	err = withdrawService.Set(user, body)
+	withdrawService := service.NewWithdrawService(h.WithdrawRepository)
+	err = withdrawService.Set(r.Context(), user, body)
 
 	if err != nil {
 		if customErr, ok := err.(customerror.CustomError); ok {
-			http.Error(w, customErr.Error(), customErr.GetHTTPCode())
-			logger.Log.Warn(customErr.Error())
+			customerror.Write(w, r, customErr)
+			logger.FromContext(r.Context()).Warn("withdraw was rejected", zap.Error(customErr))
 			return
 		}
-		errWithMessage := fmt.Sprintf("error while setting withdraw `%v` for user %d", err, user.ID)
-		http.Error(w, "withdraw was not installed for user", http.StatusInternalServerError)
-		logger.Log.Warn(errWithMessage)
+		customerror.Write(w, r, customerror.NewInternalError("withdraw was not installed for user"))
+		logger.FromContext(r.Context()).Warn("error while setting withdraw", zap.Error(err))
 		return
 	}
 
@@ -91,15 +78,25 @@ func (h *WithdrawHandler) Add(w http.ResponseWriter, r *http.Request) {
 func (h *WithdrawHandler) GetList(w http.ResponseWriter, r *http.Request) {
 	user := GetUserFromContext(r.Context())
 	if user == nil {
-		http.Error(w, "user was not got", http.StatusBadRequest)
-		logger.Log.Error("user was not got")
+		customerror.Write(w, r, customerror.NewBadRequestError("user was not got"))
+		logger.FromContext(r.Context()).Error("user was not got")
 		return
 	}
 
-	withdrawals, err := h.WithdrawRepository.GetListByUserID(user.ID)
+	var withdrawals []models.Withdrawal
+	var err error
+	if !hasListParams(r, withdrawalListFilters...) {
+		withdrawals, err = h.WithdrawRepository.GetListByUserID(r.Context(), user.ID)
+	} else {
+		withdrawals, err = h.getWithdrawalsPage(w, r, user.ID)
+		if errors.Is(err, errBadListParams) {
+			customerror.Write(w, r, customerror.NewBadRequestError(err.Error()))
+			return
+		}
+	}
 	if err != nil {
-		http.Error(w, "withdrawals were not found", http.StatusInternalServerError)
-		logger.Log.Error(fmt.Sprintf("withdrawals were not found, error: %v", err))
+		customerror.Write(w, r, customerror.NewInternalError("withdrawals were not found"))
+		logger.FromContext(r.Context()).Error("withdrawals were not found", zap.Error(err))
 		return
 	}
 	//err = json.NewEncoder(w).Encode(withdrawals)
@@ -117,6 +114,42 @@ func (h *WithdrawHandler) GetList(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	err = json.NewEncoder(w).Encode(withdrawals)
 	if err != nil {
-		logger.Log.Error(fmt.Sprintf("Error encoding response: %v", err))
+		logger.FromContext(r.Context()).Error("Error encoding response", zap.Error(err))
+	}
+}
+
+// withdrawalListFilters фильтры списка списаний
+var withdrawalListFilters = []string{"from", "to"}
+
+// getWithdrawalsPage выбирает списания с учетом фильтров и пагинации из query-параметров
+func (h *WithdrawHandler) getWithdrawalsPage(w http.ResponseWriter, r *http.Request, userID int) ([]models.Withdrawal, error) {
+	page, err := parseListPage(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errBadListParams, err)
+	}
+	filter := repository.WithdrawalListFilter{Sort: page.sort, Cursor: page.cursor, Limit: page.limit}
+
+	query := r.URL.Query()
+	if filter.From, err = parseTimeParam(query.Get("from")); err != nil {
+		return nil, fmt.Errorf("%w: invalid from", errBadListParams)
+	}
+	if filter.To, err = parseTimeParam(query.Get("to")); err != nil {
+		return nil, fmt.Errorf("%w: invalid to", errBadListParams)
+	}
+
+	if page.limit > 0 {
+		filter.Limit++
+	}
+	withdrawals, err := h.WithdrawRepository.GetPageByUserID(r.Context(), userID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if page.limit > 0 && len(withdrawals) > page.limit {
+		withdrawals = withdrawals[:page.limit]
+		last := withdrawals[page.limit-1]
+		id, _ := strconv.ParseInt(last.OrderID, 10, 64)
+		setNextPageHeaders(w, r, models.ListCursor{At: last.ProcessedAt, ID: id})
 	}
+	return withdrawals, nil
 }
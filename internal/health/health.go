@@ -0,0 +1,151 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+
+	defaultCheckTimeout = 2 * time.Second
+)
+
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name string
+	// critical проверка влияет на готовность, некритичные только попадают в детали ответа
+	critical bool
+	fn       CheckFunc
+}
+
+type CheckResult struct {
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	Error    string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// Checker набор проверок готовности сервиса
+type Checker struct {
+	mu      sync.RWMutex
+	checks  []check
+	timeout time.Duration
+}
+
+func NewChecker() *Checker {
+	return &Checker{timeout: defaultCheckTimeout}
+}
+
+func (checker *Checker) Add(name string, critical bool, fn CheckFunc) {
+	checker.mu.Lock()
+	defer checker.mu.Unlock()
+	checker.checks = append(checker.checks, check{name: name, critical: critical, fn: fn})
+}
+
+// Check выполняет все проверки параллельно, каждую с общим таймаутом
+func (checker *Checker) Check(ctx context.Context) Report {
+	checker.mu.RLock()
+	checks := append([]check{}, checker.checks...)
+	checker.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, checker.timeout)
+	defer cancel()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c check) {
+			defer wg.Done()
+			result := CheckResult{Status: StatusOK, Critical: c.critical}
+			if err := c.fn(ctx); err != nil {
+				result.Status = StatusFail
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[c.name] = result
+			if result.Status == StatusFail && c.critical {
+				report.Status = StatusFail
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	return report
+}
+
+// WorkerGroup учитывает запущенные фоновые воркеры для проверки готовности
+// и позволяет дождаться их завершения при остановке сервиса
+type WorkerGroup struct {
+	name     string
+	expected atomic.Int32
+	running  atomic.Int32
+	wg       sync.WaitGroup
+}
+
+func NewWorkerGroup(name string) *WorkerGroup {
+	return &WorkerGroup{name: name}
+}
+
+// Go запускает воркер в отдельной горутине
+func (group *WorkerGroup) Go(fn func()) {
+	group.expected.Add(1)
+	group.running.Add(1)
+	group.wg.Add(1)
+	go func() {
+		defer group.wg.Done()
+		defer group.running.Add(-1)
+		fn()
+	}()
+}
+
+// Wait ждет завершения всех воркеров группы. Возвращает ошибку, если ctx истек раньше
+func (group *WorkerGroup) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		group.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d %s workers are still running: %w", group.Running(), group.name, ctx.Err())
+	}
+}
+
+// Retire уменьшает ожидаемое число воркеров, когда один из них останавливается намеренно,
+// чтобы проверка готовности не считала его упавшим
+func (group *WorkerGroup) Retire() {
+	group.expected.Add(-1)
+}
+
+func (group *WorkerGroup) Running() int {
+	return int(group.running.Load())
+}
+
+// Check завершается ошибкой, если хотя бы один из запущенных воркеров остановился
+func (group *WorkerGroup) Check(_ context.Context) error {
+	running, expected := group.running.Load(), group.expected.Load()
+	if expected == 0 {
+		return fmt.Errorf("%s workers were not started", group.name)
+	}
+	if running < expected {
+		return fmt.Errorf("%d of %d %s workers are running", running, expected, group.name)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecker_Check(t *testing.T) {
+	checker := NewChecker()
+	checker.Add("database", true, func(context.Context) error { return nil })
+	checker.Add("accrual_breaker", false, func(context.Context) error { return errors.New("paused") })
+
+	report := checker.Check(context.Background())
+
+	assert.Equal(t, StatusOK, report.Status)
+	assert.Equal(t, StatusOK, report.Checks["database"].Status)
+	assert.Equal(t, StatusFail, report.Checks["accrual_breaker"].Status)
+	assert.Equal(t, "paused", report.Checks["accrual_breaker"].Error)
+
+	checker.Add("migrations", true, func(context.Context) error { return errors.New("dirty") })
+
+	report = checker.Check(context.Background())
+
+	assert.Equal(t, StatusFail, report.Status)
+	assert.False(t, report.Checks["accrual_breaker"].Critical)
+	assert.True(t, report.Checks["migrations"].Critical)
+}
+
+func TestChecker_Check_Timeout(t *testing.T) {
+	checker := NewChecker()
+	checker.timeout = 10 * time.Millisecond
+	checker.Add("database", true, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	report := checker.Check(context.Background())
+
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Contains(t, report.Checks["database"].Error, "deadline exceeded")
+}
+
+func TestWorkerGroup_Check(t *testing.T) {
+	group := NewWorkerGroup("accrual")
+	assert.Error(t, group.Check(context.Background()))
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	group.Go(func() { <-stop })
+	group.Go(func() {
+		<-stop
+		close(stopped)
+	})
+	assert.NoError(t, group.Check(context.Background()))
+	assert.Equal(t, 2, group.Running())
+
+	close(stop)
+	<-stopped
+	assert.Eventually(t, func() bool { return group.Running() == 0 }, time.Second, time.Millisecond)
+	assert.Error(t, group.Check(context.Background()))
+}
+
+func TestWorkerGroup_Wait(t *testing.T) {
+	group := NewWorkerGroup("accrual")
+	assert.NoError(t, group.Wait(context.Background()))
+
+	stop := make(chan struct{})
+	group.Go(func() { <-stop })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := group.Wait(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "1 accrual workers are still running")
+
+	close(stop)
+	assert.NoError(t, group.Wait(context.Background()))
+	assert.Equal(t, 0, group.Running())
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Sample одно значение метрики с набором меток в порядке labelNames
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// sampleCollector метрика, значения и набор меток которой вычисляются при каждом сборе,
+// например число заказов по статусам. Для значений без меток достаточно prometheus.GaugeFunc.
+type sampleCollector struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	collect   func() []Sample
+}
+
+// NewGaugeFunc регистрирует в Registry метрику, значения которой возвращает collect
+func NewGaugeFunc(name, help string, labelNames []string, collect func() []Sample) prometheus.Collector {
+	return register(name, help, prometheus.GaugeValue, labelNames, collect)
+}
+
+// NewCounterFunc то же, что NewGaugeFunc, для значений, которые только растут
+func NewCounterFunc(name, help string, labelNames []string, collect func() []Sample) prometheus.Collector {
+	return register(name, help, prometheus.CounterValue, labelNames, collect)
+}
+
+func register(name, help string, valueType prometheus.ValueType, labelNames []string, collect func() []Sample) prometheus.Collector {
+	collector := &sampleCollector{
+		desc:      prometheus.NewDesc(name, help, labelNames, nil),
+		valueType: valueType,
+		collect:   collect,
+	}
+	Registry.MustRegister(collector)
+	return collector
+}
+
+func (collector *sampleCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.desc
+}
+
+// Collect пропускает значения с неверным числом меток, чтобы одна ошибка не ломала весь сбор
+func (collector *sampleCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, sample := range collector.collect() {
+		metric, err := prometheus.NewConstMetric(collector.desc, collector.valueType, sample.Value, sample.LabelValues...)
+		if err != nil {
+			continue
+		}
+		ch <- metric
+	}
+}
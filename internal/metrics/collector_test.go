@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSampleCollector_Collect(t *testing.T) {
+	// Arrange
+	collector := &sampleCollector{
+		desc:      prometheus.NewDesc("orders_pending", "Orders by status.", []string{"status"}, nil),
+		valueType: prometheus.GaugeValue,
+		collect: func() []Sample {
+			return []Sample{
+				{LabelValues: []string{"NEW"}, Value: 3},
+				{LabelValues: []string{"PROCESSING"}, Value: 1},
+				// Значение с неверным числом меток пропускается
+				{Value: 5},
+			}
+		},
+	}
+	expected := `# HELP orders_pending Orders by status.
+# TYPE orders_pending gauge
+orders_pending{status="NEW"} 3
+orders_pending{status="PROCESSING"} 1
+`
+
+	// Act
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected))
+
+	// Assert
+	require.NoError(t, err)
+}
+
+func TestSampleCollector_CounterWithoutLabels(t *testing.T) {
+	// Arrange
+	collector := &sampleCollector{
+		desc:      prometheus.NewDesc("db_pool_acquire_total", "Connections acquired.", nil, nil),
+		valueType: prometheus.CounterValue,
+		collect: func() []Sample {
+			return []Sample{{Value: 42}}
+		},
+	}
+
+	// Act
+	value := testutil.ToFloat64(collector)
+
+	// Assert
+	assert.Equal(t, float64(42), value)
+	assert.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(`# HELP db_pool_acquire_total Connections acquired.
+# TYPE db_pool_acquire_total counter
+db_pool_acquire_total 42
+`)))
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry реестр метрик сервиса, отдается на /metrics
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of HTTP requests by route pattern and status.",
+	}, []string{"method", "route", "status"})
+	HTTPRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by route pattern and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	AccrualRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "accrual_requests_total",
+		Help: "Requests to the accrual system by outcome.",
+	}, []string{"outcome"})
+	AccrualRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "accrual_request_duration_seconds",
+		Help:    "Accrual system request latency by outcome.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"outcome"})
+	AccrualRateLimited = factory.NewCounter(prometheus.CounterOpts{
+		Name: "accrual_rate_limited_total",
+		Help: "Responses 429 Too Many Requests from the accrual system.",
+	})
+
+	RetryAttempts = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "retry_attempts_total",
+		Help: "Repeated attempts made by retry.DoRetry by retry policy.",
+	}, []string{"policy"})
+
+	DatabaseReads = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "database_reads_total",
+		Help: "Reads allowed to use the replica by the pool that served them and the reason.",
+	}, []string{"pool", "reason"})
+
+	CacheRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_requests_total",
+		Help: "Cache lookups by cache and result (hit or miss).",
+	}, []string{"cache", "result"})
+	CacheInvalidations = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_invalidations_total",
+		Help: "Keys removed from the cache after changes, by cache and source (write or notify).",
+	}, []string{"cache", "source"})
+
+	AccrualWorkersBusy = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "accrual_workers_busy",
+		Help: "Accrual workers currently processing an order.",
+	})
+
+	PointsAccrued = factory.NewCounter(prometheus.CounterOpts{
+		Name: "points_accrued_total",
+		Help: "Loyalty points credited to users for processed orders.",
+	})
+	PointsWithdrawn = factory.NewCounter(prometheus.CounterOpts{
+		Name: "points_withdrawn_total",
+		Help: "Loyalty points withdrawn by users.",
+	})
+)
+
+// Accrual исходы запросов к системе начислений
+const (
+	AccrualOutcomeSuccess     = "success"
+	AccrualOutcomeError       = "error"
+	AccrualOutcomeRateLimited = "rate_limited"
+)
+
+// Handler отдает метрики Registry в формате Prometheus
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"github.com/Bessima/diplom-gomarket/internal/customerror"
+	"net/http"
+)
+
+const AdminTokenHeader = "X-Admin-Token"
+
+// AdminMiddleware пропускает запросы с токеном администратора. Пустой токен запрещает доступ полностью.
+func AdminMiddleware(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			provided := r.Header.Get(AdminTokenHeader)
+			if token == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				customerror.Write(w, r, customerror.NewUnauthorizedError("Admin token required"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
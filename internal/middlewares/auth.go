@@ -4,7 +4,10 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/Bessima/diplom-gomarket/internal/customerror"
 	"github.com/Bessima/diplom-gomarket/internal/handlers"
+	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"go.uber.org/zap"
 )
 
 func AuthMiddleware(authHandler *handlers.AuthHandler) func(http.Handler) http.Handler {
@@ -23,22 +26,23 @@ func AuthMiddleware(authHandler *handlers.AuthHandler) func(http.Handler) http.H
 			}
 
 			if tokenString == "" {
-				http.Error(w, "Authorization token required", http.StatusUnauthorized)
+				customerror.Write(w, r, customerror.NewUnauthorizedError("Authorization token required"))
 				return
 			}
 
 			claims, err := authHandler.ValidateToken(tokenString)
 			if err != nil {
-				http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+				customerror.Write(w, r, customerror.NewUnauthorizedError("Invalid or expired token"))
 				return
 			}
-			user, err := authHandler.UserStorage.GetUserByID(claims.UserID)
+			user, err := authHandler.UserStorage.GetUserByID(r.Context(), claims.UserID)
 			if err != nil || user == nil {
-				http.Error(w, "User not found", http.StatusUnauthorized)
+				customerror.Write(w, r, customerror.NewUnauthorizedError("User not found"))
 				return
 			}
 
 			ctx := handlers.SetUserInContext(r, user)
+			ctx = logger.WithFields(ctx, zap.Int("user_id", user.ID))
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -1,19 +1,27 @@
 package logger
 
 import (
+	"context"
+	"sync/atomic"
+
+	"github.com/Bessima/diplom-gomarket/internal/tracing"
+	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 var Log *zap.Logger = zap.NewNop()
 
+// atomicLevel уровень общего логгера, его можно менять без пересоздания логгера
+var atomicLevel = zap.NewAtomicLevel()
+
 func Initialize(level string) error {
-	lvl, err := zap.ParseAtomicLevel(level)
-	if err != nil {
+	if err := SetLevel(level); err != nil {
 		return err
 	}
 
 	cfg := zap.NewProductionConfig()
-	cfg.Level = lvl
+	cfg.Level = atomicLevel
 
 	zl, err := cfg.Build()
 	if err != nil {
@@ -23,3 +31,66 @@ func Initialize(level string) error {
 	Log = zl
 	return nil
 }
+
+// SetLevel меняет уровень логов на лету, в том числе для уже созданных логгеров запросов
+func SetLevel(level string) error {
+	lvl, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	atomicLevel.SetLevel(lvl)
+	return nil
+}
+
+// Level текущий уровень логов
+func Level() zapcore.Level {
+	return atomicLevel.Level()
+}
+
+type contextKey string
+
+const loggerContextKey contextKey = "logger"
+
+// requestLogger общий для всех слоев запроса логгер: поля, добавленные глубже по цепочке
+// (например user_id в AuthMiddleware), видны и в журнале доступа
+type requestLogger struct {
+	log atomic.Pointer[zap.Logger]
+}
+
+// WithContext сохраняет логгер в контексте, его получают обработчики, сервисы и репозитории через FromContext
+func WithContext(ctx context.Context, log *zap.Logger) context.Context {
+	holder := &requestLogger{}
+	holder.log.Store(log)
+	return context.WithValue(ctx, loggerContextKey, holder)
+}
+
+// WithFields добавляет поля к логгеру запроса, например user_id после авторизации
+func WithFields(ctx context.Context, fields ...zap.Field) context.Context {
+	if holder, ok := ctx.Value(loggerContextKey).(*requestLogger); ok {
+		holder.log.Store(holder.log.Load().With(fields...))
+		return ctx
+	}
+	return WithContext(ctx, contextLogger(ctx).With(fields...))
+}
+
+// FromContext возвращает логгер запроса с request_id, user_id и trace_id, а также шаблоном маршрута chi.
+// Вне запроса возвращается общий логгер с полями трассы, если она есть в контексте.
+func FromContext(ctx context.Context) *zap.Logger {
+	log := contextLogger(ctx)
+	if routeContext := chi.RouteContext(ctx); routeContext != nil {
+		if pattern := routeContext.RoutePattern(); pattern != "" {
+			log = log.With(zap.String("route", pattern))
+		}
+	}
+	return log
+}
+
+func contextLogger(ctx context.Context) *zap.Logger {
+	if holder, ok := ctx.Value(loggerContextKey).(*requestLogger); ok {
+		return holder.log.Load()
+	}
+	if fields := tracing.LogFields(ctx); len(fields) > 0 {
+		return Log.With(fields...)
+	}
+	return Log
+}
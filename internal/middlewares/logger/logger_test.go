@@ -0,0 +1,26 @@
+package logger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSetLevel_AppliesToExistingLoggers(t *testing.T) {
+	previous := Log
+	t.Cleanup(func() { Log = previous })
+
+	require.NoError(t, Initialize("info"))
+	requestLog := Log.With(zap.String("request_id", "1"))
+	assert.False(t, requestLog.Core().Enabled(zapcore.DebugLevel))
+
+	require.NoError(t, SetLevel("debug"))
+	assert.Equal(t, zapcore.DebugLevel, Level())
+	assert.True(t, requestLog.Core().Enabled(zapcore.DebugLevel))
+
+	assert.Error(t, SetLevel("verbose"))
+	assert.Equal(t, zapcore.DebugLevel, Level())
+}
@@ -1,36 +1,90 @@
 package logger
 
 import (
+	"github.com/Bessima/diplom-gomarket/internal/metrics"
+	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"math/rand/v2"
 	"net/http"
+	"strconv"
 	"time"
 )
 
+// AccessLogConfig уровень журнала доступа и доля записываемых запросов.
+// Ответы 5xx записываются всегда, независимо от SampleRate.
+type AccessLogConfig struct {
+	Level      zapcore.Level
+	SampleRate float64
+}
+
+var DefaultAccessLogConfig = AccessLogConfig{Level: zapcore.InfoLevel, SampleRate: 1}
+
 func RequestLogger(handler http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
+	return NewRequestLogger(DefaultAccessLogConfig)(handler)
+}
 
-		responseData := &responseData{
-			status: 0,
-			size:   0,
-		}
-		logWriter := loggingResponseWriter{
-			ResponseWriter: w,
-			responseData:   responseData,
-		}
+// NewRequestLogger журнал доступа: метрики учитывают каждый запрос, а строка лога пишется с учетом выборки
+func NewRequestLogger(cfg AccessLogConfig) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			responseData := &responseData{
+				status: 0,
+				size:   0,
+			}
+			logWriter := loggingResponseWriter{
+				ResponseWriter: w,
+				responseData:   responseData,
+			}
+
+			handler.ServeHTTP(&logWriter, r)
+
+			duration := time.Since(start)
+			status := responseData.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			observeRequest(r, status, duration)
 
-		handler.ServeHTTP(&logWriter, r)
+			if status < http.StatusInternalServerError && !sampled(cfg.SampleRate) {
+				return
+			}
+			entry := FromContext(r.Context()).Check(cfg.Level, "HTTP request")
+			if entry == nil {
+				return
+			}
+			entry.Write(
+				zap.String("method", r.Method),
+				zap.String("uri", r.URL.RequestURI()),
+				zap.Duration("duration", duration),
+				zap.Int("status", status),
+				zap.Int("size", responseData.size),
+			)
+		})
+	}
+}
 
-		duration := time.Since(start)
-		Log.Debug("Got incoming HTTP request",
-			zap.String("method", r.Method),
-			zap.String("uri", r.URL.RequestURI()),
-			zap.Duration("duration", duration),
-			zap.Int("status", responseData.status),
-			zap.Int("size", responseData.size),
-		)
+func sampled(rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	return rate > 0 && rand.Float64() < rate
+}
 
-	})
+// observeRequest учитывает запрос в метриках по шаблону маршрута chi, а не по URI,
+// чтобы номера заказов и id не раздували число рядов
+func observeRequest(r *http.Request, status int, duration time.Duration) {
+	route := "unmatched"
+	if routeContext := chi.RouteContext(r.Context()); routeContext != nil {
+		if pattern := routeContext.RoutePattern(); pattern != "" {
+			route = pattern
+		}
+	}
+	statusLabel := strconv.Itoa(status)
+	metrics.HTTPRequests.WithLabelValues(r.Method, route, statusLabel).Inc()
+	metrics.HTTPRequestDuration.WithLabelValues(r.Method, route, statusLabel).Observe(duration.Seconds())
 }
 
 type (
@@ -55,3 +109,10 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.ResponseWriter.WriteHeader(statusCode)
 	r.responseData.status = statusCode
 }
+
+// Flush нужен потоковым ответам (выгрузки, SSE), которые работают через этот writer
+func (r *loggingResponseWriter) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,81 @@
+package logger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Bessima/diplom-gomarket/internal/metrics"
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRequestLogger_CountsByRoutePattern(t *testing.T) {
+	router := chi.NewRouter()
+	router.Use(RequestLogger)
+	router.Get("/api/test/orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	counter := metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/api/test/orders/{id}", "200")
+	before := testutil.ToFloat64(counter)
+
+	for _, id := range []string{"1", "2"} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/test/orders/"+id, nil))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	}
+
+	assert.Equal(t, before+2, testutil.ToFloat64(counter))
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, "unmatched", "404")))
+}
+
+func TestNewRequestLogger_AccessLog(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	previous := Log
+	Log = zap.New(core)
+	t.Cleanup(func() { Log = previous })
+
+	newRouter := func(cfg AccessLogConfig) chi.Router {
+		router := chi.NewRouter()
+		router.Use(RequestID)
+		router.Use(NewRequestLogger(cfg))
+		router.With(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(w, r.WithContext(WithFields(r.Context(), zap.Int("user_id", 3))))
+			})
+		}).Get("/api/test/access/{id}", func(w http.ResponseWriter, r *http.Request) {
+			if chi.URLParam(r, "id") == "fail" {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		})
+		return router
+	}
+
+	router := newRouter(AccessLogConfig{Level: zapcore.InfoLevel, SampleRate: 1})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/test/access/1", nil))
+
+	require.Equal(t, 1, logs.Len())
+	entry := logs.TakeAll()[0]
+	assert.Equal(t, zapcore.InfoLevel, entry.Level)
+	fields := entry.ContextMap()
+	assert.Equal(t, "/api/test/access/{id}", fields["route"])
+	assert.Equal(t, int64(3), fields["user_id"])
+	assert.Equal(t, int64(http.StatusOK), fields["status"])
+	assert.NotEmpty(t, fields["request_id"])
+
+	// Без выборки записываются только ответы 5xx
+	router = newRouter(AccessLogConfig{Level: zapcore.InfoLevel, SampleRate: 0})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/test/access/1", nil))
+	assert.Equal(t, 0, logs.Len())
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/test/access/fail", nil))
+	assert.Equal(t, 1, logs.Len())
+}
@@ -0,0 +1,66 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/Bessima/diplom-gomarket/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength ограничение на входящий идентификатор, чтобы клиент не мог раздуть логи
+const maxRequestIDLength = 128
+
+const requestIDContextKey contextKey = "request_id"
+
+// RequestID принимает X-Request-ID клиента или генерирует новый, возвращает его в ответе
+// и кладет в контекст логгер запроса с request_id и полями трассы
+func RequestID(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !isValidRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		ctx := r.Context()
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("http.request_id", requestID))
+
+		fields := append([]zap.Field{zap.String("request_id", requestID)}, tracing.LogFields(ctx)...)
+		ctx = context.WithValue(ctx, requestIDContextKey, requestID)
+		ctx = WithContext(ctx, Log.With(fields...))
+
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestIDFromContext возвращает идентификатор текущего запроса или пустую строку
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey).(string)
+	return requestID
+}
+
+func isValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range requestID {
+		// Допускаются только печатные ASCII-символы, чтобы значение безопасно попадало в заголовки и логи
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
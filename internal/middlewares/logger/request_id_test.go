@@ -0,0 +1,73 @@
+package logger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRequestID(t *testing.T) {
+	testCases := []struct {
+		name      string
+		header    string
+		keepValue bool
+	}{
+		{name: "accepts client id", header: "client-request-42", keepValue: true},
+		{name: "generates when missing", header: ""},
+		{name: "rejects spaces", header: "bad id"},
+		{name: "rejects too long", header: strings.Repeat("a", maxRequestIDLength+1)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var fromContext string
+			handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fromContext = RequestIDFromContext(r.Context())
+			}))
+
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.header != "" {
+				request.Header.Set(RequestIDHeader, tc.header)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			responseID := recorder.Header().Get(RequestIDHeader)
+			require.NotEmpty(t, responseID)
+			assert.Equal(t, responseID, fromContext)
+			if tc.keepValue {
+				assert.Equal(t, tc.header, responseID)
+			} else {
+				assert.NotEqual(t, tc.header, responseID)
+				assert.Len(t, responseID, 32)
+			}
+		})
+	}
+}
+
+func TestRequestID_ContextLoggerCarriesFields(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	previous := Log
+	Log = zap.New(core)
+	t.Cleanup(func() { Log = previous })
+
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := WithFields(r.Context(), zap.Int("user_id", 7))
+		FromContext(ctx).Info("handled")
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(RequestIDHeader, "req-1")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	require.Equal(t, 1, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	assert.Equal(t, "req-1", fields["request_id"])
+	assert.Equal(t, int64(7), fields["user_id"])
+}
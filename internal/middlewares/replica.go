@@ -0,0 +1,15 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/Bessima/diplom-gomarket/internal/config/db"
+)
+
+// ReplicaReadMiddleware разрешает обслужить чтения запроса репликой базы и кешем. Подключается только
+// к маршрутам, которые показывают данные и ничего не проверяют перед записью.
+func ReplicaReadMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(db.WithReplicaRead(r.Context())))
+	})
+}
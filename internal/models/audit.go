@@ -0,0 +1,43 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	// AuditOrderStatusForced действие gophermart admin set-status
+	AuditOrderStatusForced = "order.status_forced"
+	// AuditBalanceAdjusted действие gophermart admin adjust
+	AuditBalanceAdjusted = "balance.adjusted"
+)
+
+// AuditEntry запись журнала ручных изменений, сделанных через gophermart admin
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	Action    string          `json:"action"`
+	Target    string          `json:"target"`
+	Actor     string          `json:"actor"`
+	Reason    string          `json:"reason"`
+	Details   json.RawMessage `json:"details"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// OrderStatusChange детали записи AuditOrderStatusForced
+type OrderStatusChange struct {
+	From OrderStatus `json:"from"`
+	To   OrderStatus `json:"to"`
+}
+
+// BalanceAdjustment детали записи AuditBalanceAdjusted: корректировка и баланс после нее в баллах
+type BalanceAdjustment struct {
+	ID      int64   `json:"id"`
+	Amount  float32 `json:"amount"`
+	Current float32 `json:"current"`
+}
+
+// SetAmounts переводит суммы в копейках в баллы
+func (adjustment *BalanceAdjustment) SetAmounts(amount, current int64) {
+	adjustment.Amount = float32(amount) / 100
+	adjustment.Current = float32(current) / 100
+}
@@ -23,3 +23,20 @@ func (balance *Balance) SetWithdrawn(value int32) {
 	withdrawn := float32(value) / 100
 	balance.Withdrawn = withdrawn
 }
+
+// BalanceMismatch расхождение сохраненного баланса пользователя с суммой его операций
+type BalanceMismatch struct {
+	UserID            int     `json:"user_id"`
+	Login             string  `json:"login"`
+	Current           float32 `json:"current"`
+	ExpectedCurrent   float32 `json:"expected_current"`
+	Withdrawn         float32 `json:"withdrawn"`
+	ExpectedWithdrawn float32 `json:"expected_withdrawn"`
+}
+
+func (mismatch *BalanceMismatch) SetAmounts(current, expectedCurrent, withdrawn, expectedWithdrawn int64) {
+	mismatch.Current = float32(current) / 100
+	mismatch.ExpectedCurrent = float32(expectedCurrent) / 100
+	mismatch.Withdrawn = float32(withdrawn) / 100
+	mismatch.ExpectedWithdrawn = float32(expectedWithdrawn) / 100
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+type BalanceEventType string
+
+const (
+	AccrualEvent     BalanceEventType = "ACCRUAL"
+	WithdrawalEvent  BalanceEventType = "WITHDRAWAL"
+	TransferInEvent  BalanceEventType = "TRANSFER_IN"
+	TransferOutEvent BalanceEventType = "TRANSFER_OUT"
+	AdjustmentEvent  BalanceEventType = "ADJUSTMENT"
+)
+
+var BalanceEventTypes = []BalanceEventType{AccrualEvent, WithdrawalEvent, TransferInEvent, TransferOutEvent, AdjustmentEvent}
+
+func (eventType BalanceEventType) IsValid() bool {
+	for _, known := range BalanceEventTypes {
+		if eventType == known {
+			return true
+		}
+	}
+	return false
+}
+
+// BalanceEvent одно событие, изменившее баланс пользователя
+type BalanceEvent struct {
+	Type         BalanceEventType `json:"type"`
+	Reference    string           `json:"reference"`
+	Amount       float32          `json:"amount"`
+	BalanceAfter float32          `json:"balance_after"`
+	OccurredAt   time.Time        `json:"occurred_at"`
+}
+
+func (event *BalanceEvent) SetAmounts(amount, balanceAfter int64) {
+	event.Amount = float32(amount) / 100
+	event.BalanceAfter = float32(balanceAfter) / 100
+}
+
+// Cursor возвращает курсор, указывающий на это событие
+func (event *BalanceEvent) Cursor() BalanceEventCursor {
+	return BalanceEventCursor{OccurredAt: event.OccurredAt, Type: event.Type, Reference: event.Reference}
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// BalanceEventCursor позиция в истории баланса для keyset-пагинации
+type BalanceEventCursor struct {
+	OccurredAt time.Time
+	Type       BalanceEventType
+	Reference  string
+}
+
+func (cursor BalanceEventCursor) Encode() string {
+	raw := strings.Join([]string{cursor.OccurredAt.UTC().Format(time.RFC3339Nano), string(cursor.Type), cursor.Reference}, "|")
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeBalanceEventCursor(value string) (*BalanceEventCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), "|", 3)
+	if len(parts) != 3 {
+		return nil, ErrInvalidCursor
+	}
+	occurredAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	eventType := BalanceEventType(parts[1])
+	if !eventType.IsValid() {
+		return nil, ErrInvalidCursor
+	}
+	return &BalanceEventCursor{OccurredAt: occurredAt, Type: eventType, Reference: parts[2]}, nil
+}
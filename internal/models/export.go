@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// OrderRecord строка выгрузки заказов, суммы хранятся в копейках без потери точности
+type OrderRecord struct {
+	Number         string
+	Status         OrderStatus
+	AccrualKopecks *int64
+	UploadedAt     time.Time
+	ProcessedAt    *time.Time
+}
+
+// WithdrawalRecord строка выгрузки списаний, суммы хранятся в копейках без потери точности
+type WithdrawalRecord struct {
+	Order       string
+	SumKopecks  int64
+	ProcessedAt time.Time
+}
@@ -0,0 +1,51 @@
+package models
+
+const (
+	LanguageRU = "ru"
+	LanguageEN = "en"
+
+	EmailChannel = "email"
+	HTTPChannel  = "http"
+	LogChannel   = "log"
+)
+
+var NotificationChannels = []string{EmailChannel, HTTPChannel, LogChannel}
+
+var NotificationEvents = []string{OutboxOrderProcessed, OutboxWithdrawalCreated}
+
+// NotificationSettings настройки уведомлений пользователя
+type NotificationSettings struct {
+	UserID   int      `json:"-"`
+	Language string   `json:"language"`
+	Channels []string `json:"channels"`
+	Events   []string `json:"events"`
+	Email    string   `json:"email,omitempty"`
+	HTTPURL  string   `json:"http_url,omitempty"`
+}
+
+// DefaultNotificationSettings пока пользователь не выбрал каналы, уведомления не отправляются
+func DefaultNotificationSettings(userID int) NotificationSettings {
+	return NotificationSettings{
+		UserID:   userID,
+		Language: LanguageRU,
+		Channels: []string{},
+		Events:   append([]string{}, NotificationEvents...),
+	}
+}
+
+func (settings NotificationSettings) HasChannel(channel string) bool {
+	return contains(settings.Channels, channel)
+}
+
+func (settings NotificationSettings) HasEvent(eventType string) bool {
+	return contains(settings.Events, eventType)
+}
+
+func contains(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -27,3 +27,28 @@ const (
 	RegisterAcSystemStatus OrderStatus = "REGISTER"
 	ProcessedStatus        OrderStatus = "PROCESSED"
 )
+
+func (status OrderStatus) IsValid() bool {
+	switch status {
+	case NewStatus, InvalidStatus, ProcessingStatus, ProcessedStatus:
+		return true
+	}
+	return false
+}
+
+// BatchOrderStatus результат загрузки одного номера при пакетной загрузке заказов
+type BatchOrderStatus string
+
+const (
+	BatchAccepted     BatchOrderStatus = "ACCEPTED"
+	BatchDuplicateOwn BatchOrderStatus = "DUPLICATE_OWN"
+	BatchConflict     BatchOrderStatus = "CONFLICT_OTHER_USER"
+	BatchInvalid      BatchOrderStatus = "INVALID"
+)
+
+// OrderQueueStat необработанные заказы в одном статусе
+type OrderQueueStat struct {
+	Status           OrderStatus
+	Count            int64
+	OldestAgeSeconds float64
+}
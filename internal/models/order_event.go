@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// OrderEvent изменение статуса или начисления по заказу пользователя
+type OrderEvent struct {
+	ID        int64       `json:"-"`
+	Order     string      `json:"number"`
+	UserID    int         `json:"-"`
+	Status    OrderStatus `json:"status"`
+	Accrual   *float32    `json:"accrual,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+func (event *OrderEvent) SetAccrualAsFloat(accrualInt int64) {
+	if accrualInt == 0 {
+		return
+	}
+	val := float32(accrualInt) / 100
+	event.Accrual = &val
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	OutboxOrderProcessed    = "order.processed"
+	OutboxWithdrawalCreated = "withdrawal.created"
+)
+
+// OutboxEvent доменное событие, записанное в outbox в одной транзакции с изменением
+type OutboxEvent struct {
+	ID        int64           `json:"id"`
+	UserID    int             `json:"user_id"`
+	EventType string          `json:"event_type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type OrderProcessedPayload struct {
+	Order   string  `json:"order"`
+	Accrual float32 `json:"accrual"`
+}
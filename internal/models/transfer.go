@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+type TransferDirection string
+
+const (
+	TransferIncoming TransferDirection = "IN"
+	TransferOutgoing TransferDirection = "OUT"
+)
+
+type Transfer struct {
+	ID           int64             `json:"id"`
+	FromUserID   int               `json:"-"`
+	ToUserID     int               `json:"-"`
+	Direction    TransferDirection `json:"direction"`
+	Counterparty string            `json:"counterparty"`
+	Sum          float32           `json:"sum"`
+	CreatedAt    time.Time         `json:"created_at"`
+}
+
+func (model *Transfer) SetSumInFloat(sumInt int64) {
+	model.Sum = float32(sumInt) / 100
+}
+
+// SetDirectionFor заполняет направление перевода относительно пользователя userID
+func (model *Transfer) SetDirectionFor(userID int, fromLogin, toLogin string) {
+	if model.FromUserID == userID {
+		model.Direction = TransferOutgoing
+		model.Counterparty = toLogin
+		return
+	}
+	model.Direction = TransferIncoming
+	model.Counterparty = fromLogin
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type WebhookEventType string
+
+const (
+	OrderProcessedEvent    WebhookEventType = "order.processed"
+	OrderInvalidEvent      WebhookEventType = "order.invalid"
+	WithdrawalCreatedEvent WebhookEventType = "withdrawal.created"
+	BalanceChangedEvent    WebhookEventType = "balance.changed"
+)
+
+var WebhookEventTypes = []WebhookEventType{OrderProcessedEvent, OrderInvalidEvent, WithdrawalCreatedEvent, BalanceChangedEvent}
+
+func (eventType WebhookEventType) IsValid() bool {
+	for _, known := range WebhookEventTypes {
+		if eventType == known {
+			return true
+		}
+	}
+	return false
+}
+
+type Webhook struct {
+	ID           int64              `json:"id"`
+	UserID       *int               `json:"-"`
+	URL          string             `json:"url"`
+	Secret       string             `json:"secret,omitempty"`
+	EventTypes   []WebhookEventType `json:"event_types"`
+	Active       bool               `json:"active"`
+	FailureCount int                `json:"failure_count"`
+	CreatedAt    time.Time          `json:"created_at"`
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	DeliveryPending   WebhookDeliveryStatus = "PENDING"
+	DeliveryDelivered WebhookDeliveryStatus = "DELIVERED"
+	DeliveryFailed    WebhookDeliveryStatus = "FAILED"
+)
+
+// WebhookDelivery одна доставка события на вебхук, она же запись журнала доставок
+type WebhookDelivery struct {
+	ID            int64                 `json:"id"`
+	WebhookID     int64                 `json:"webhook_id"`
+	EventType     WebhookEventType      `json:"event_type"`
+	Payload       json.RawMessage       `json:"payload"`
+	Status        WebhookDeliveryStatus `json:"status"`
+	Attempts      int                   `json:"attempts"`
+	NextAttemptAt time.Time             `json:"next_attempt_at"`
+	ResponseCode  *int                  `json:"response_code,omitempty"`
+	LastError     *string               `json:"last_error,omitempty"`
+	CreatedAt     time.Time             `json:"created_at"`
+	DeliveredAt   *time.Time            `json:"delivered_at,omitempty"`
+
+	// Заполняются при выборке доставок для отправки
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
@@ -0,0 +1,91 @@
+// Package netguard защищает исходящие запросы на адреса, которые задают пользователи (вебхуки,
+// HTTP-уведомления), от обращений во внутреннюю сеть сервиса (SSRF). Адрес проверяется дважды:
+// при сохранении, чтобы сразу ответить пользователю, и при каждом соединении, потому что DNS-имя
+// к моменту отправки может указывать уже на другой адрес.
+package netguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress адрес относится к внутренней сети и недоступен для исходящих запросов
+var ErrForbiddenAddress = errors.New("address is not allowed")
+
+// reservedPrefixes служебные диапазоны, которые не покрывают методы netip.Addr
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// IsAllowedAddr сообщает, что на адрес можно отправлять запросы: он не loopback, не link-local,
+// не из частных и служебных диапазонов и не неопределенный
+func IsAllowedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateURL проверяет, что rawURL - абсолютный http(s)-адрес, все адреса хоста которого разрешены
+func ValidateURL(ctx context.Context, rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return fmt.Errorf("must be an absolute http or https address")
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", parsed.Hostname())
+	if err != nil {
+		return fmt.Errorf("host %q can't be resolved", parsed.Hostname())
+	}
+	for _, addr := range addrs {
+		if !IsAllowedAddr(addr) {
+			return fmt.Errorf("host %q: %w", parsed.Hostname(), ErrForbiddenAddress)
+		}
+	}
+	return nil
+}
+
+// control проверяет адрес, с которым устанавливается соединение, уже после разрешения имени
+func control(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !IsAllowedAddr(addrPort.Addr()) {
+		return fmt.Errorf("dial %s: %w", address, ErrForbiddenAddress)
+	}
+	return nil
+}
+
+// NewHTTPClient HTTP-клиент, который не соединяется с запрещенными адресами, в том числе после
+// перенаправлений. Прокси из окружения не используется: иначе проверялся бы адрес прокси.
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   control,
+	}).DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
@@ -0,0 +1,112 @@
+package netguard
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsAllowedAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		allowed bool
+	}{
+		{addr: "127.0.0.1", allowed: false},
+		{addr: "127.10.0.1", allowed: false},
+		{addr: "::1", allowed: false},
+		{addr: "169.254.169.254", allowed: false},
+		{addr: "fe80::1", allowed: false},
+		{addr: "10.0.0.5", allowed: false},
+		{addr: "172.16.0.1", allowed: false},
+		{addr: "172.31.255.255", allowed: false},
+		{addr: "192.168.1.1", allowed: false},
+		{addr: "fd00::1", allowed: false},
+		{addr: "0.0.0.0", allowed: false},
+		{addr: "::", allowed: false},
+		{addr: "::ffff:127.0.0.1", allowed: false},
+		{addr: "::ffff:10.0.0.1", allowed: false},
+		{addr: "100.64.0.1", allowed: false},
+		{addr: "224.0.0.1", allowed: false},
+		{addr: "172.32.0.1", allowed: true},
+		{addr: "93.184.216.34", allowed: true},
+		{addr: "2606:4700::1111", allowed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			// Act
+			allowed := IsAllowedAddr(netip.MustParseAddr(tt.addr))
+
+			// Assert
+			assert.Equal(t, tt.allowed, allowed)
+		})
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	tests := []struct {
+		url       string
+		forbidden bool
+	}{
+		{url: "http://127.0.0.1:8080/hook", forbidden: true},
+		{url: "http://localhost/hook", forbidden: true},
+		{url: "http://[::1]/hook", forbidden: true},
+		{url: "http://169.254.169.254/latest/meta-data/", forbidden: true},
+		{url: "https://10.1.2.3/hook", forbidden: true},
+		{url: "https://192.168.0.10/hook", forbidden: true},
+		{url: "https://93.184.216.34/hook", forbidden: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			// Act
+			err := ValidateURL(context.Background(), tt.url)
+
+			// Assert
+			if tt.forbidden {
+				assert.ErrorIs(t, err, ErrForbiddenAddress)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateURL_InvalidURL(t *testing.T) {
+	for _, value := range []string{"ftp://example.com/hook", "/relative", "http://", "not a url"} {
+		t.Run(value, func(t *testing.T) {
+			// Act
+			err := ValidateURL(context.Background(), value)
+
+			// Assert
+			assert.Error(t, err)
+			assert.NotErrorIs(t, err, ErrForbiddenAddress)
+		})
+	}
+}
+
+func TestNewHTTPClient_RefusesLoopback(t *testing.T) {
+	// Arrange
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+	client := NewHTTPClient(time.Second)
+
+	// Act
+	// Имя проверено при сохранении, но к моменту отправки указывает на loopback, как при DNS rebinding
+	response, err := client.Get(server.URL)
+	if response != nil {
+		response.Body.Close()
+	}
+
+	// Assert
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrForbiddenAddress)
+	assert.False(t, called)
+}
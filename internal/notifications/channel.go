@@ -0,0 +1,162 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/netguard"
+	"go.uber.org/zap"
+)
+
+// Channel способ доставки уведомления пользователю
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, settings models.NotificationSettings, message Message) error
+}
+
+type SMTPConfig struct {
+	Address  string
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPChannel отправляет уведомления по электронной почте
+type SMTPChannel struct {
+	cfg      SMTPConfig
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func NewSMTPChannel(cfg SMTPConfig) *SMTPChannel {
+	return &SMTPChannel{cfg: cfg, sendMail: smtp.SendMail}
+}
+
+func (channel *SMTPChannel) Name() string {
+	return models.EmailChannel
+}
+
+func (channel *SMTPChannel) Send(_ context.Context, settings models.NotificationSettings, message Message) error {
+	if settings.Email == "" {
+		return fmt.Errorf("email is not set for user %d", settings.UserID)
+	}
+
+	var auth smtp.Auth
+	if channel.cfg.Username != "" {
+		host := channel.cfg.Address
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", channel.cfg.Username, channel.cfg.Password, host)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", channel.cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", settings.Email)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(message.Body)
+	msg.WriteString("\r\n")
+
+	return channel.sendMail(channel.cfg.Address, auth, channel.cfg.From, []string{settings.Email}, msg.Bytes())
+}
+
+// HTTPChannel отправляет уведомление POST-запросом на адрес, указанный пользователем
+type HTTPChannel struct {
+	httpClient *http.Client
+}
+
+func NewHTTPChannel() *HTTPChannel {
+	return &HTTPChannel{httpClient: netguard.NewHTTPClient(10 * time.Second)}
+}
+
+func (channel *HTTPChannel) Name() string {
+	return models.HTTPChannel
+}
+
+func (channel *HTTPChannel) Send(ctx context.Context, settings models.NotificationSettings, message Message) error {
+	if settings.HTTPURL == "" {
+		return fmt.Errorf("http url is not set for user %d", settings.UserID)
+	}
+
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, settings.HTTPURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := channel.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("notification endpoint answered with status code %d", response.StatusCode)
+	}
+	return nil
+}
+
+// LogChannel для локальной разработки: пишет уведомления в файл или, если путь не задан, в лог
+type LogChannel struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewLogChannel(path string) *LogChannel {
+	return &LogChannel{path: path}
+}
+
+func (channel *LogChannel) Name() string {
+	return models.LogChannel
+}
+
+func (channel *LogChannel) Send(_ context.Context, settings models.NotificationSettings, message Message) error {
+	if channel.path == "" {
+		logger.Log.Info("Notification",
+			zap.Int("user_id", settings.UserID),
+			zap.String("subject", message.Subject),
+			zap.String("body", message.Body),
+		)
+		return nil
+	}
+
+	line, err := json.Marshal(struct {
+		UserID int `json:"user_id"`
+		Message
+	}{UserID: settings.UserID, Message: message})
+	if err != nil {
+		return err
+	}
+
+	channel.mu.Lock()
+	defer channel.mu.Unlock()
+
+	file, err := os.OpenFile(channel.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,124 @@
+package notifications
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
+	"github.com/Bessima/diplom-gomarket/internal/retry"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultWorkers   = 2
+	defaultQueueSize = 100
+)
+
+type job struct {
+	channel  Channel
+	settings models.NotificationSettings
+	message  Message
+}
+
+// Notifier получает события из outbox и рассылает уведомления в каналы, выбранные пользователем.
+// Отправка выполняется отдельными воркерами с повторными попытками и не задерживает обработку заказов.
+type Notifier struct {
+	settingsStorage repository.NotificationSettingsRepositoryI
+	channels        map[string]Channel
+	retryConfig     retry.RetryConfig
+	workers         int
+	queue           chan job
+}
+
+func NewNotifier(settingsStorage repository.NotificationSettingsRepositoryI, channels ...Channel) *Notifier {
+	byName := make(map[string]Channel, len(channels))
+	for _, channel := range channels {
+		byName[channel.Name()] = channel
+	}
+
+	return &Notifier{
+		settingsStorage: settingsStorage,
+		channels:        byName,
+		retryConfig:     retry.NotificationRetryConfig,
+		workers:         defaultWorkers,
+		queue:           make(chan job, defaultQueueSize),
+	}
+}
+
+// Run обрабатывает события до закрытия канала events или отмены ctx
+func (notifier *Notifier) Run(ctx context.Context, events <-chan models.OutboxEvent) {
+	var wg sync.WaitGroup
+	for i := 0; i < notifier.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			notifier.worker(ctx)
+		}()
+	}
+
+	defer func() {
+		close(notifier.queue)
+		wg.Wait()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			notifier.Handle(ctx, event)
+		}
+	}
+}
+
+// Handle подготавливает уведомления по событию и ставит их в очередь отправки
+func (notifier *Notifier) Handle(ctx context.Context, event models.OutboxEvent) {
+	settings, err := notifier.settingsStorage.Get(ctx, event.UserID)
+	if err != nil {
+		logger.Log.Warn("Can't get notification settings", zap.Int("user_id", event.UserID), zap.Error(err))
+		return
+	}
+	if !settings.HasEvent(event.EventType) || len(settings.Channels) == 0 {
+		return
+	}
+
+	message, err := Render(settings.Language, event.EventType, event.Payload)
+	if err != nil {
+		logger.Log.Warn("Can't render notification", zap.Int64("event_id", event.ID), zap.Error(err))
+		return
+	}
+
+	for _, name := range settings.Channels {
+		channel, ok := notifier.channels[name]
+		if !ok {
+			logger.Log.Debug("Notification channel is not configured", zap.String("channel", name))
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case notifier.queue <- job{channel: channel, settings: *settings, message: message}:
+		}
+	}
+}
+
+func (notifier *Notifier) worker(ctx context.Context) {
+	for job := range notifier.queue {
+		err := retry.DoRetry(ctx, func(ctx context.Context) error {
+			return job.channel.Send(ctx, job.settings, job.message)
+		}, notifier.retryConfig)
+		if err != nil {
+			logger.Log.Warn("Notification was not sent",
+				zap.String("channel", job.channel.Name()),
+				zap.Int("user_id", job.settings.UserID),
+				zap.Error(err),
+			)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/netguard"
+	"github.com/Bessima/diplom-gomarket/internal/retry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockSettingsRepository struct {
+	settings map[int]models.NotificationSettings
+}
+
+func (m *mockSettingsRepository) Get(ctx context.Context, userID int) (*models.NotificationSettings, error) {
+	settings, ok := m.settings[userID]
+	if !ok {
+		defaults := models.DefaultNotificationSettings(userID)
+		return &defaults, nil
+	}
+	return &settings, nil
+}
+
+func (m *mockSettingsRepository) Save(ctx context.Context, settings models.NotificationSettings) error {
+	m.settings[settings.UserID] = settings
+	return nil
+}
+
+type fakeChannel struct {
+	name     string
+	failures int
+	mu       sync.Mutex
+	attempts int
+	sent     []Message
+}
+
+func (channel *fakeChannel) Name() string {
+	return channel.name
+}
+
+func (channel *fakeChannel) Send(_ context.Context, _ models.NotificationSettings, message Message) error {
+	channel.mu.Lock()
+	defer channel.mu.Unlock()
+	channel.attempts++
+	if channel.attempts <= channel.failures {
+		return errors.New("channel is unavailable")
+	}
+	channel.sent = append(channel.sent, message)
+	return nil
+}
+
+func (channel *fakeChannel) sentMessages() []Message {
+	channel.mu.Lock()
+	defer channel.mu.Unlock()
+	return append([]Message{}, channel.sent...)
+}
+
+func TestRender(t *testing.T) {
+	payload := json.RawMessage(`{"order":"79927398713","accrual":12.5}`)
+
+	ru, err := Render(models.LanguageRU, models.OutboxOrderProcessed, payload)
+	require.NoError(t, err)
+	assert.Equal(t, "Начислены баллы за заказ 79927398713", ru.Subject)
+	assert.Contains(t, ru.Body, "12.50 баллов")
+
+	en, err := Render(models.LanguageEN, models.OutboxWithdrawalCreated, json.RawMessage(`{"order":"2377225624","sum":751}`))
+	require.NoError(t, err)
+	assert.Equal(t, "751.00 points were withdrawn for order 2377225624.", en.Body)
+
+	_, err = Render(models.LanguageEN, "unknown.event", payload)
+	assert.Error(t, err)
+}
+
+func TestNotifier_SendsToSelectedChannelsWithRetry(t *testing.T) {
+	require.NoError(t, logger.Initialize("error"))
+
+	settingsRepo := &mockSettingsRepository{settings: map[int]models.NotificationSettings{
+		1: {UserID: 1, Language: models.LanguageEN, Channels: []string{models.HTTPChannel}, Events: []string{models.OutboxOrderProcessed}},
+	}}
+	httpChannel := &fakeChannel{name: models.HTTPChannel, failures: 1}
+	logChannel := &fakeChannel{name: models.LogChannel}
+	notifier := NewNotifier(settingsRepo, httpChannel, logChannel)
+	notifier.retryConfig = retry.RetryConfig{MaxRetries: 3, ShouldRetry: func(error) bool { return true }}
+
+	events := make(chan models.OutboxEvent, 3)
+	events <- models.OutboxEvent{ID: 1, UserID: 1, EventType: models.OutboxOrderProcessed, Payload: json.RawMessage(`{"order":"1","accrual":5}`)}
+	// Событие, на которое пользователь не подписан
+	events <- models.OutboxEvent{ID: 2, UserID: 1, EventType: models.OutboxWithdrawalCreated, Payload: json.RawMessage(`{"order":"1","sum":5}`)}
+	// Пользователь без настроек не получает уведомлений
+	events <- models.OutboxEvent{ID: 3, UserID: 2, EventType: models.OutboxOrderProcessed, Payload: json.RawMessage(`{"order":"2","accrual":5}`)}
+	close(events)
+
+	done := make(chan struct{})
+	go func() {
+		notifier.Run(context.Background(), events)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("notifier did not stop")
+	}
+
+	sent := httpChannel.sentMessages()
+	require.Len(t, sent, 1)
+	assert.Equal(t, "Points credited for order 1", sent[0].Subject)
+	assert.Equal(t, 2, httpChannel.attempts)
+	assert.Empty(t, logChannel.sentMessages())
+}
+
+func TestSMTPChannel_Send(t *testing.T) {
+	channel := NewSMTPChannel(SMTPConfig{Address: "smtp.example.com:587", Username: "user", Password: "pass", From: "noreply@example.com"})
+
+	var gotAddr string
+	var gotTo []string
+	var gotMsg []byte
+	channel.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		gotAddr, gotTo, gotMsg = addr, to, msg
+		return nil
+	}
+
+	err := channel.Send(context.Background(), models.NotificationSettings{UserID: 1, Email: "user@example.com"}, Message{Subject: "Тема", Body: "Текст"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "smtp.example.com:587", gotAddr)
+	assert.Equal(t, []string{"user@example.com"}, gotTo)
+	assert.Contains(t, string(gotMsg), "Subject: =?utf-8?q?")
+	assert.True(t, strings.HasSuffix(string(gotMsg), "Текст\r\n"))
+
+	err = channel.Send(context.Background(), models.NotificationSettings{UserID: 1}, Message{})
+	assert.Error(t, err)
+}
+
+func TestHTTPChannel_RefusesInternalAddress(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+	channel := NewHTTPChannel()
+
+	err := channel.Send(context.Background(), models.NotificationSettings{UserID: 1, HTTPURL: server.URL}, Message{Subject: "s", Body: "b"})
+
+	assert.ErrorIs(t, err, netguard.ErrForbiddenAddress)
+	assert.False(t, called)
+}
+
+func TestLogChannel_WritesToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifications.ndjson")
+	channel := NewLogChannel(path)
+
+	err := channel.Send(context.Background(), models.NotificationSettings{UserID: 7}, Message{Subject: "s", Body: "b"})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"user_id":7,"subject":"s","body":"b"}`, strings.TrimSpace(string(data)))
+}
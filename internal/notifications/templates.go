@@ -0,0 +1,78 @@
+package notifications
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/template"
+
+	"github.com/Bessima/diplom-gomarket/internal/models"
+)
+
+// Message готовое к отправке уведомление
+type Message struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+type messageTemplate struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+func newMessageTemplate(subject, body string) messageTemplate {
+	return messageTemplate{
+		subject: template.Must(template.New("subject").Parse(subject)),
+		body:    template.Must(template.New("body").Parse(body)),
+	}
+}
+
+// templates шаблоны по языку и типу события. Данные шаблона - payload события из outbox.
+var templates = map[string]map[string]messageTemplate{
+	models.LanguageRU: {
+		models.OutboxOrderProcessed: newMessageTemplate(
+			"Начислены баллы за заказ {{.order}}",
+			`Заказ {{.order}} обработан, на ваш счет начислено {{printf "%.2f" .accrual}} баллов.`,
+		),
+		models.OutboxWithdrawalCreated: newMessageTemplate(
+			"Списание баллов в счет заказа {{.order}}",
+			`В счет заказа {{.order}} списано {{printf "%.2f" .sum}} баллов.`,
+		),
+	},
+	models.LanguageEN: {
+		models.OutboxOrderProcessed: newMessageTemplate(
+			"Points credited for order {{.order}}",
+			`Order {{.order}} has been processed, {{printf "%.2f" .accrual}} points were credited to your account.`,
+		),
+		models.OutboxWithdrawalCreated: newMessageTemplate(
+			"Points withdrawn for order {{.order}}",
+			`{{printf "%.2f" .sum}} points were withdrawn for order {{.order}}.`,
+		),
+	},
+}
+
+// Render собирает уведомление на языке пользователя, для неизвестного языка используется русский
+func Render(language, eventType string, payload json.RawMessage) (Message, error) {
+	byEvent, ok := templates[language]
+	if !ok {
+		byEvent = templates[models.LanguageRU]
+	}
+	tmpl, ok := byEvent[eventType]
+	if !ok {
+		return Message{}, fmt.Errorf("no notification template for event %q", eventType)
+	}
+
+	var data map[string]any
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return Message{}, err
+	}
+
+	var subject, body bytes.Buffer
+	if err := tmpl.subject.Execute(&subject, data); err != nil {
+		return Message{}, err
+	}
+	if err := tmpl.body.Execute(&body, data); err != nil {
+		return Message{}, err
+	}
+	return Message{Subject: subject.String(), Body: body.String()}, nil
+}
@@ -0,0 +1,60 @@
+package outbox
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Bessima/diplom-gomarket/internal/models"
+)
+
+const busSubscriberBuffer = 64
+
+// Bus шина событий внутри процесса. Если буфер подписчика заполнен, Publish возвращает ошибку,
+// и relay повторит событие позже, поэтому подписчики должны учитывать повторы по ID события.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[int]chan models.OutboxEvent
+	nextID      int
+}
+
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[int]chan models.OutboxEvent)}
+}
+
+func (bus *Bus) Subscribe() (<-chan models.OutboxEvent, func()) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	id := bus.nextID
+	bus.nextID++
+	ch := make(chan models.OutboxEvent, busSubscriberBuffer)
+	bus.subscribers[id] = ch
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			bus.mu.Lock()
+			defer bus.mu.Unlock()
+			delete(bus.subscribers, id)
+			close(ch)
+		})
+	}
+}
+
+func (bus *Bus) Publish(event models.OutboxEvent) error {
+	bus.mu.RLock()
+	defer bus.mu.RUnlock()
+
+	var dropped int
+	for _, ch := range bus.subscribers {
+		select {
+		case ch <- event:
+		default:
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		return fmt.Errorf("outbox event %d was not accepted by %d subscribers", event.ID, dropped)
+	}
+	return nil
+}
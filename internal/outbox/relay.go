@@ -0,0 +1,148 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultPollInterval    = time.Second
+	defaultBatchSize       = 100
+	defaultCleanupInterval = time.Hour
+	// defaultLease на сколько захватывается пачка. Публикация пачки прерывается по его истечении,
+	// чтобы другая реплика не начала публиковать те же события.
+	defaultLease = 5 * time.Minute
+	// defaultRetryDelay через сколько повторяются события, которые не приняли приемники
+	defaultRetryDelay = 10 * time.Second
+)
+
+// Relay публикует события из outbox во все приемники. Доставка не реже одного раза:
+// событие отмечается опубликованным, только когда его приняли все приемники.
+// После первой неудачи события того же пользователя в пачке пропускаются, чтобы не нарушить порядок.
+// Пачка захватывается в базе на время публикации, транзакция и соединение на время обращений
+// к приемникам не удерживаются.
+type Relay struct {
+	repository      repository.OutboxRepositoryI
+	sinks           []Sink
+	retention       time.Duration
+	pollInterval    time.Duration
+	cleanupInterval time.Duration
+	batchSize       int
+	lease           time.Duration
+	retryDelay      time.Duration
+}
+
+func NewRelay(outboxRepository repository.OutboxRepositoryI, retention time.Duration, sinks ...Sink) *Relay {
+	return &Relay{
+		repository:      outboxRepository,
+		sinks:           sinks,
+		retention:       retention,
+		pollInterval:    defaultPollInterval,
+		cleanupInterval: defaultCleanupInterval,
+		batchSize:       defaultBatchSize,
+		lease:           defaultLease,
+		retryDelay:      defaultRetryDelay,
+	}
+}
+
+func (relay *Relay) Run(ctx context.Context) {
+	poll := time.NewTicker(relay.pollInterval)
+	defer poll.Stop()
+	cleanup := time.NewTicker(relay.cleanupInterval)
+	defer cleanup.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-poll.C:
+			relay.PublishPending(ctx)
+		case <-cleanup.C:
+			relay.Cleanup(ctx)
+		}
+	}
+}
+
+// PublishPending захватывает и публикует одну пачку событий
+func (relay *Relay) PublishPending(ctx context.Context) {
+	events, err := relay.repository.ClaimPending(ctx, relay.batchSize, relay.lease)
+	if err != nil {
+		logger.Log.Warn("Can't claim outbox events", zap.Error(err))
+		return
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	publishCtx, cancel := context.WithTimeout(ctx, relay.lease)
+	published, unpublished := relay.publish(publishCtx, events)
+	cancel()
+
+	// Результат записывается и при остановке сервиса, иначе опубликованные события уйдут повторно
+	resultCtx := context.WithoutCancel(ctx)
+	if len(published) > 0 {
+		if err = relay.repository.MarkPublished(resultCtx, published); err != nil {
+			logger.Log.Warn("Can't mark outbox events published", zap.Error(err))
+		}
+	}
+	if len(unpublished) > 0 {
+		if err = relay.repository.ReleaseClaims(resultCtx, unpublished, relay.retryDelay); err != nil {
+			logger.Log.Warn("Can't release outbox events", zap.Error(err))
+		}
+	}
+}
+
+// publish отправляет события в приемники и возвращает id опубликованных и неопубликованных событий
+func (relay *Relay) publish(ctx context.Context, events []models.OutboxEvent) ([]int64, []int64) {
+	published := make([]int64, 0, len(events))
+	var unpublished []int64
+	blockedUsers := make(map[int]bool)
+
+	for _, event := range events {
+		if ctx.Err() != nil || blockedUsers[event.UserID] {
+			unpublished = append(unpublished, event.ID)
+			continue
+		}
+
+		if err := relay.publishToSinks(ctx, event); err != nil {
+			blockedUsers[event.UserID] = true
+			unpublished = append(unpublished, event.ID)
+			logger.Log.Warn("Outbox event was not published",
+				zap.Int64("id", event.ID),
+				zap.Int("user_id", event.UserID),
+				zap.Error(err),
+			)
+			continue
+		}
+		published = append(published, event.ID)
+	}
+
+	return published, unpublished
+}
+
+func (relay *Relay) publishToSinks(ctx context.Context, event models.OutboxEvent) error {
+	for _, sink := range relay.sinks {
+		if err := sink.Publish(ctx, event); err != nil {
+			return fmt.Errorf("sink %s: %w", sink.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Cleanup удаляет опубликованные события старше срока хранения
+func (relay *Relay) Cleanup(ctx context.Context) {
+	deleted, err := relay.repository.DeletePublished(ctx, time.Now().Add(-relay.retention))
+	if err != nil {
+		logger.Log.Warn("Can't delete published outbox events", zap.Error(err))
+		return
+	}
+	if deleted > 0 {
+		logger.Log.Info("Published outbox events deleted", zap.Int64("count", deleted))
+	}
+}
@@ -0,0 +1,127 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockOutboxRepository struct {
+	pending    []models.OutboxEvent
+	published  []int64
+	released   []int64
+	retryAfter time.Duration
+	olderThan  time.Time
+}
+
+func (m *mockOutboxRepository) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error) {
+	pending := m.pending
+	m.pending = nil
+	return pending, nil
+}
+
+func (m *mockOutboxRepository) MarkPublished(ctx context.Context, ids []int64) error {
+	m.published = append(m.published, ids...)
+	return nil
+}
+
+func (m *mockOutboxRepository) ReleaseClaims(ctx context.Context, ids []int64, retryAfter time.Duration) error {
+	m.released = append(m.released, ids...)
+	m.retryAfter = retryAfter
+	return nil
+}
+
+func (m *mockOutboxRepository) DeletePublished(ctx context.Context, olderThan time.Time) (int64, error) {
+	m.olderThan = olderThan
+	return 0, nil
+}
+
+type recordingSink struct {
+	failOn   map[int64]bool
+	slowOn   map[int64]bool
+	received []int64
+}
+
+func (sink *recordingSink) Name() string {
+	return "recording"
+}
+
+func (sink *recordingSink) Publish(ctx context.Context, event models.OutboxEvent) error {
+	if sink.slowOn[event.ID] {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	if sink.failOn[event.ID] {
+		return errors.New("sink is unavailable")
+	}
+	sink.received = append(sink.received, event.ID)
+	return nil
+}
+
+func TestRelay_PublishPending_PublishesToAllSinks(t *testing.T) {
+	require.NoError(t, logger.Initialize("error"))
+
+	repo := &mockOutboxRepository{pending: []models.OutboxEvent{{ID: 1, UserID: 1}, {ID: 2, UserID: 2}}}
+	first := &recordingSink{}
+	second := &recordingSink{}
+	relay := NewRelay(repo, time.Hour, first, second)
+
+	relay.PublishPending(context.Background())
+
+	assert.Equal(t, []int64{1, 2}, repo.published)
+	assert.Equal(t, []int64{1, 2}, first.received)
+	assert.Equal(t, []int64{1, 2}, second.received)
+}
+
+func TestRelay_PublishPending_KeepsOrderPerUser(t *testing.T) {
+	require.NoError(t, logger.Initialize("error"))
+
+	repo := &mockOutboxRepository{pending: []models.OutboxEvent{
+		{ID: 1, UserID: 1},
+		{ID: 2, UserID: 2},
+		{ID: 3, UserID: 1},
+		{ID: 4, UserID: 2},
+	}}
+	sink := &recordingSink{failOn: map[int64]bool{1: true}}
+	relay := NewRelay(repo, time.Hour, sink)
+
+	relay.PublishPending(context.Background())
+
+	// Событие 3 не публикуется раньше неудавшегося события 1 того же пользователя
+	assert.Equal(t, []int64{2, 4}, repo.published)
+	assert.Equal(t, []int64{2, 4}, sink.received)
+	assert.Equal(t, []int64{1, 3}, repo.released)
+	assert.Equal(t, defaultRetryDelay, repo.retryAfter)
+}
+
+func TestRelay_PublishPending_StopsWhenLeaseExpires(t *testing.T) {
+	require.NoError(t, logger.Initialize("error"))
+
+	repo := &mockOutboxRepository{pending: []models.OutboxEvent{{ID: 1, UserID: 1}, {ID: 2, UserID: 2}, {ID: 3, UserID: 3}}}
+	sink := &recordingSink{slowOn: map[int64]bool{2: true}}
+	relay := NewRelay(repo, time.Hour, sink)
+	relay.lease = 50 * time.Millisecond
+
+	relay.PublishPending(context.Background())
+
+	// Медленный приемник не держит пачку дольше захвата, результат записывается для всех событий
+	assert.Equal(t, []int64{1}, repo.published)
+	assert.Equal(t, []int64{2, 3}, repo.released)
+}
+
+func TestRelay_Cleanup(t *testing.T) {
+	require.NoError(t, logger.Initialize("error"))
+
+	repo := &mockOutboxRepository{}
+	relay := NewRelay(repo, 24*time.Hour)
+
+	relay.Cleanup(context.Background())
+
+	assert.WithinDuration(t, time.Now().Add(-24*time.Hour), repo.olderThan, time.Second)
+}
@@ -0,0 +1,170 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"go.uber.org/zap"
+)
+
+// Sink приемник событий. Publish должен быть идемпотентным для получателя:
+// при сбое событие будет передано повторно.
+type Sink interface {
+	Name() string
+	Publish(ctx context.Context, event models.OutboxEvent) error
+}
+
+const (
+	LogSinkName  = "log"
+	FileSinkName = "file"
+	HTTPSinkName = "http"
+	BusSinkName  = "bus"
+)
+
+type SinkConfig struct {
+	Names    []string
+	FilePath string
+	HTTPURL  string
+}
+
+// NewSinks создает приемники по списку имен из конфигурации
+func NewSinks(cfg SinkConfig, bus *Bus) ([]Sink, error) {
+	sinks := make([]Sink, 0, len(cfg.Names))
+	for _, name := range cfg.Names {
+		switch strings.TrimSpace(name) {
+		case "":
+			continue
+		case LogSinkName:
+			sinks = append(sinks, LogSink{})
+		case FileSinkName:
+			if cfg.FilePath == "" {
+				return nil, fmt.Errorf("outbox file sink requires a file path")
+			}
+			sinks = append(sinks, NewFileSink(cfg.FilePath))
+		case HTTPSinkName:
+			if cfg.HTTPURL == "" {
+				return nil, fmt.Errorf("outbox http sink requires a url")
+			}
+			sinks = append(sinks, NewHTTPSink(cfg.HTTPURL))
+		case BusSinkName:
+			sinks = append(sinks, BusSink{bus: bus})
+		default:
+			return nil, fmt.Errorf("unknown outbox sink %q", name)
+		}
+	}
+	return sinks, nil
+}
+
+// LogSink пишет события в лог
+type LogSink struct{}
+
+func (LogSink) Name() string {
+	return LogSinkName
+}
+
+func (LogSink) Publish(_ context.Context, event models.OutboxEvent) error {
+	logger.Log.Info("Outbox event",
+		zap.Int64("id", event.ID),
+		zap.Int("user_id", event.UserID),
+		zap.String("event_type", event.EventType),
+		zap.ByteString("payload", event.Payload),
+	)
+	return nil
+}
+
+// FileSink дописывает события в файл в формате NDJSON
+type FileSink struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileSink(path string) *FileSink {
+	return &FileSink{path: path}
+}
+
+func (sink *FileSink) Name() string {
+	return FileSinkName
+}
+
+func (sink *FileSink) Publish(_ context.Context, event models.OutboxEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	file, err := os.OpenFile(sink.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// HTTPSink отправляет события POST-запросом, успешным считается ответ 2xx
+type HTTPSink struct {
+	url        string
+	httpClient *http.Client
+}
+
+func NewHTTPSink(url string) *HTTPSink {
+	return &HTTPSink{url: url, httpClient: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (sink *HTTPSink) Name() string {
+	return HTTPSinkName
+}
+
+func (sink *HTTPSink) Publish(ctx context.Context, event models.OutboxEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, sink.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Idempotency-Key", fmt.Sprintf("outbox-%d", event.ID))
+
+	response, err := sink.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("outbox http sink answered with status code %d", response.StatusCode)
+	}
+	return nil
+}
+
+// BusSink передает события подписчикам внутри процесса
+type BusSink struct {
+	bus *Bus
+}
+
+func (BusSink) Name() string {
+	return BusSinkName
+}
+
+func (sink BusSink) Publish(_ context.Context, event models.OutboxEvent) error {
+	return sink.bus.Publish(event)
+}
@@ -0,0 +1,95 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSinks(t *testing.T) {
+	sinks, err := NewSinks(SinkConfig{Names: []string{"log", " bus", ""}}, NewBus())
+	require.NoError(t, err)
+	require.Len(t, sinks, 2)
+	assert.Equal(t, LogSinkName, sinks[0].Name())
+	assert.Equal(t, BusSinkName, sinks[1].Name())
+
+	_, err = NewSinks(SinkConfig{Names: []string{"file"}}, NewBus())
+	assert.Error(t, err)
+
+	_, err = NewSinks(SinkConfig{Names: []string{"kafka"}}, NewBus())
+	assert.Error(t, err)
+}
+
+func TestFileSink_AppendsNDJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.ndjson")
+	sink := NewFileSink(path)
+
+	require.NoError(t, sink.Publish(context.Background(), models.OutboxEvent{ID: 1, UserID: 1, Payload: json.RawMessage(`{}`)}))
+	require.NoError(t, sink.Publish(context.Background(), models.OutboxEvent{ID: 2, UserID: 1, Payload: json.RawMessage(`{}`)}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+
+	var event models.OutboxEvent
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &event))
+	assert.Equal(t, int64(2), event.ID)
+}
+
+func TestHTTPSink_Publish(t *testing.T) {
+	var gotKey string
+	var gotBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = r.Header.Get("Idempotency-Key")
+		gotBody, _ = io.ReadAll(r.Body)
+		if strings.Contains(string(gotBody), `"id":2`) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sink := NewHTTPSink(server.URL)
+
+	assert.NoError(t, sink.Publish(context.Background(), models.OutboxEvent{ID: 1, Payload: json.RawMessage(`{}`)}))
+	assert.Equal(t, "outbox-1", gotKey)
+	assert.Error(t, sink.Publish(context.Background(), models.OutboxEvent{ID: 2, Payload: json.RawMessage(`{}`)}))
+}
+
+func TestBus_PublishAndUnsubscribe(t *testing.T) {
+	bus := NewBus()
+	events, unsubscribe := bus.Subscribe()
+
+	require.NoError(t, bus.Publish(models.OutboxEvent{ID: 1}))
+	event := <-events
+	assert.Equal(t, int64(1), event.ID)
+
+	unsubscribe()
+	unsubscribe()
+	_, ok := <-events
+	assert.False(t, ok)
+	assert.NoError(t, bus.Publish(models.OutboxEvent{ID: 2}))
+}
+
+func TestBus_PublishFailsWhenSubscriberIsFull(t *testing.T) {
+	bus := NewBus()
+	_, unsubscribe := bus.Subscribe()
+	defer unsubscribe()
+
+	for i := 0; i < busSubscriberBuffer; i++ {
+		require.NoError(t, bus.Publish(models.OutboxEvent{ID: int64(i)}))
+	}
+	assert.Error(t, bus.Publish(models.OutboxEvent{ID: busSubscriberBuffer}))
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/retry"
+	"github.com/Bessima/diplom-gomarket/internal/tracing"
+	"github.com/jackc/pgx/v5"
+)
+
+type AuditRepository struct {
+	db *db.DB
+}
+
+func NewAuditRepository(dbObj *db.DB) *AuditRepository {
+	return &AuditRepository{db: dbObj}
+}
+
+// Add записывает действие администратора внутри транзакции, выполняющей это действие
+func (repository *AuditRepository) Add(ctx context.Context, tx pgx.Tx, entry models.AuditEntry, details any) (err error) {
+	ctx, span := tracing.Start(ctx, "AuditRepository.Add")
+	defer func() { tracing.End(span, err) }()
+
+	query := `INSERT INTO admin_audit (action, target, actor, reason, details) VALUES ($1, $2, $3, $4, $5)`
+
+	data, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, query, entry.Action, entry.Target, entry.Actor, entry.Reason, data)
+	return err
+}
+
+// GetList возвращает последние limit записей журнала, от новых к старым
+func (repository *AuditRepository) GetList(ctx context.Context, limit int) (_ []models.AuditEntry, err error) {
+	ctx, span := tracing.Start(ctx, "AuditRepository.GetList")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT id, action, target, actor, reason, details, created_at FROM admin_audit ORDER BY id DESC LIMIT $1`
+
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) ([]models.AuditEntry, error) {
+		rows, err := repository.db.Pool.Query(ctx, query, limit)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		entries := []models.AuditEntry{}
+		for rows.Next() {
+			var entry models.AuditEntry
+			var details []byte
+			err = rows.Scan(&entry.ID, &entry.Action, &entry.Target, &entry.Actor, &entry.Reason, &details, &entry.CreatedAt)
+			if err != nil {
+				return nil, err
+			}
+			entry.Details = details
+			entries = append(entries, entry)
+		}
+		return entries, rows.Err()
+	})
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditRepository_GetList_Success(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewAuditRepository(NewTestDB(mock))
+	createdAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	details := []byte(`{"from":"PROCESSING","to":"INVALID"}`)
+
+	rows := pgxmock.NewRows([]string{"id", "action", "target", "actor", "reason", "details", "created_at"}).
+		AddRow(int64(2), models.AuditOrderStatusForced, "12345678903", "ops", "stuck", details, createdAt)
+	mock.ExpectQuery("SELECT id, action, target, actor, reason, details, created_at FROM admin_audit").
+		WithArgs(10).
+		WillReturnRows(rows)
+
+	// Act
+	entries, err := repo.GetList(context.Background(), 10)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, []models.AuditEntry{{
+		ID:        2,
+		Action:    models.AuditOrderStatusForced,
+		Target:    "12345678903",
+		Actor:     "ops",
+		Reason:    "stuck",
+		Details:   json.RawMessage(details),
+		CreatedAt: createdAt,
+	}}, entries)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -5,24 +5,48 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/Bessima/diplom-gomarket/internal/customerror"
 	"github.com/Bessima/diplom-gomarket/internal/models"
 	"github.com/Bessima/diplom-gomarket/internal/retry"
+	"github.com/Bessima/diplom-gomarket/internal/tracing"
 	"github.com/jackc/pgx/v5"
+	"strconv"
+	"time"
 )
 
+// BalanceHistoryFilter параметры выборки истории баланса
+type BalanceHistoryFilter struct {
+	From   *time.Time
+	To     *time.Time
+	Types  []models.BalanceEventType
+	Cursor *models.BalanceEventCursor
+	Limit  int
+}
+
 type BalanceRepository struct {
 	db *db.DB
 }
 
+type BalanceStorageRepositoryI interface {
+	GetBalanceUserID(ctx context.Context, userID int) (models.Balance, error)
+	GetHistory(ctx context.Context, userID int, filter BalanceHistoryFilter) ([]models.BalanceEvent, error)
+}
+
 func NewBalanceRepository(dbObj *db.DB) *BalanceRepository {
 	return &BalanceRepository{db: dbObj}
 }
 
-func (repository *BalanceRepository) GetBalanceUserID(userID int) (models.Balance, error) {
+func (repository *BalanceRepository) GetBalanceUserID(ctx context.Context, userID int) (_ models.Balance, err error) {
+	ctx, span := tracing.Start(ctx, "BalanceRepository.GetBalanceUserID")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
 	query := `SELECT current, withdrawals FROM balance WHERE user_id = $1`
-	return retry.DoRetryWithResult(context.Background(), func() (models.Balance, error) {
-		row := repository.db.Pool.QueryRow(
-			context.Background(),
+	pool := repository.db.ReadPool(ctx, userID)
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) (models.Balance, error) {
+		row := pool.QueryRow(
+			ctx,
 			query,
 			userID,
 		)
@@ -47,33 +71,14 @@ func (repository *BalanceRepository) GetBalanceUserID(userID int) (models.Balanc
 	})
 }
 
-func (repository *BalanceRepository) SetWithdrawForUserID(userID int, withdraw int) error {
-	query := `UPDATE balance SET current = (balance.current - $1), withdrawals = (balance.withdrawals + $1) WHERE user_id=$2`
-	return retry.DoRetry(context.Background(), func() error {
-		row, err := repository.db.Pool.Exec(
-			context.Background(),
-			query,
-			withdraw,
-			userID,
-		)
-		if err != nil {
-			return err
-		}
-
-		if row.RowsAffected() == 0 {
-			errNoRow := fmt.Errorf("not update balance for user %d", userID)
-			return errNoRow
-		}
-
-		return nil
-	})
-}
+func (repository *BalanceRepository) SetAccrual(ctx context.Context, tx pgx.Tx, orderID string, userID int, accrual int32) (err error) {
+	ctx, span := tracing.Start(ctx, "BalanceRepository.SetAccrual")
+	defer func() { tracing.End(span, err) }()
 
-func (repository *BalanceRepository) SetAccrual(tx pgx.Tx, orderID string, userID int, accrual int32) error {
 	queryBalance := `INSERT INTO balance (user_id, current) VALUES ($1,$2) ON CONFLICT (user_id) DO UPDATE SET current = balance.current + EXCLUDED.current`
 
 	rowBalance, err := tx.Exec(
-		context.Background(),
+		ctx,
 		queryBalance,
 		userID,
 		accrual,
@@ -88,3 +93,192 @@ func (repository *BalanceRepository) SetAccrual(tx pgx.Tx, orderID string, userI
 	}
 	return err
 }
+
+// GetHistory возвращает события, изменившие баланс пользователя, от новых к старым.
+// Баланс после каждого события считается по всей истории до применения фильтров.
+func (repository *BalanceRepository) GetHistory(ctx context.Context, userID int, filter BalanceHistoryFilter) (_ []models.BalanceEvent, err error) {
+	ctx, span := tracing.Start(ctx, "BalanceRepository.GetHistory")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `WITH events AS (
+			SELECT 'ACCRUAL' AS type, id::text AS ref, accrual AS amount, COALESCE(processed_at, uploaded_at) AS occurred_at
+			FROM orders WHERE user_id = $1 AND status = 'PROCESSED' AND accrual > 0
+			UNION ALL
+			SELECT 'WITHDRAWAL', order_id::text, -COALESCE(sum, 0), processed_at FROM withdrawals WHERE user_id = $1
+			UNION ALL
+			SELECT 'TRANSFER_OUT', id::text, -sum, created_at FROM transfers WHERE from_user_id = $1
+			UNION ALL
+			SELECT 'TRANSFER_IN', id::text, sum, created_at FROM transfers WHERE to_user_id = $1
+			UNION ALL
+			SELECT 'ADJUSTMENT', id::text, sum, created_at FROM balance_adjustments WHERE user_id = $1
+		), ledger AS (
+			SELECT type, ref, amount, occurred_at,
+				SUM(amount) OVER (ORDER BY occurred_at, type, ref ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW) AS balance_after
+			FROM events
+		)
+		SELECT type, ref, amount, occurred_at, balance_after FROM ledger
+		WHERE ($2::timestamptz IS NULL OR occurred_at >= $2)
+			AND ($3::timestamptz IS NULL OR occurred_at < $3)
+			AND ($4::text[] IS NULL OR type = ANY($4))
+			AND ($5::timestamptz IS NULL OR (occurred_at, type, ref) < ($5, $6, $7))
+		ORDER BY occurred_at DESC, type DESC, ref DESC
+		LIMIT $8`
+
+	var types []string
+	for _, eventType := range filter.Types {
+		types = append(types, string(eventType))
+	}
+	var cursorAt *time.Time
+	var cursorType, cursorRef string
+	if filter.Cursor != nil {
+		cursorAt = &filter.Cursor.OccurredAt
+		cursorType = string(filter.Cursor.Type)
+		cursorRef = filter.Cursor.Reference
+	}
+
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) ([]models.BalanceEvent, error) {
+		rows, err := repository.db.Pool.Query(
+			ctx,
+			query,
+			userID,
+			filter.From,
+			filter.To,
+			types,
+			cursorAt,
+			cursorType,
+			cursorRef,
+			filter.Limit,
+		)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		events := []models.BalanceEvent{}
+		for rows.Next() {
+			var event models.BalanceEvent
+			var amount, balanceAfter int64
+			err = rows.Scan(&event.Type, &event.Reference, &amount, &event.OccurredAt, &balanceAfter)
+			if err != nil {
+				return nil, err
+			}
+
+			event.SetAmounts(amount, balanceAfter)
+			events = append(events, event)
+		}
+
+		err = rows.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		return events, err
+	})
+}
+
+// Adjust меняет баланс пользователя на sum копеек (отрицательная сумма уменьшает баланс) и записывает
+// корректировку в balance_adjustments и запись журнала в одной транзакции. Корректировка, уводящая баланс
+// в минус, отклоняется с InsufficientFundsError.
+func (repository *BalanceRepository) Adjust(ctx context.Context, userID int, sum int64, audit models.AuditEntry) (_ models.BalanceAdjustment, err error) {
+	ctx, span := tracing.Start(ctx, "BalanceRepository.Adjust")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if sum == 0 {
+		return models.BalanceAdjustment{}, errors.New("adjustment sum must not be zero")
+	}
+
+	queryLock := `INSERT INTO balance (user_id) VALUES ($1) ON CONFLICT (user_id) DO UPDATE SET current = balance.current RETURNING current`
+	queryUpdate := `UPDATE balance SET current = (balance.current + $1) WHERE user_id = $2`
+	queryAdjustment := `INSERT INTO balance_adjustments (user_id, sum, reason) VALUES ($1, $2, $3) RETURNING id`
+	auditRepository := NewAuditRepository(repository.db)
+
+	repository.db.MarkWrite(userID)
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) (models.BalanceAdjustment, error) {
+		adjustment := models.BalanceAdjustment{}
+		tx, err := repository.db.Pool.Begin(ctx)
+		if err != nil {
+			return adjustment, err
+		}
+		defer tx.Rollback(ctx)
+
+		var current int64
+		if err = tx.QueryRow(ctx, queryLock, userID).Scan(&current); err != nil {
+			return adjustment, err
+		}
+		if current+sum < 0 {
+			return adjustment, customerror.NewInsufficientFundsError(fmt.Sprintf("balance of user %d can't become negative", userID))
+		}
+
+		if _, err = tx.Exec(ctx, queryUpdate, sum, userID); err != nil {
+			return adjustment, err
+		}
+		if err = tx.QueryRow(ctx, queryAdjustment, userID, sum, audit.Reason).Scan(&adjustment.ID); err != nil {
+			return adjustment, err
+		}
+		adjustment.SetAmounts(sum, current+sum)
+
+		audit.Action = models.AuditBalanceAdjusted
+		audit.Target = strconv.Itoa(userID)
+		if err = auditRepository.Add(ctx, tx, audit, adjustment); err != nil {
+			return adjustment, err
+		}
+		return adjustment, tx.Commit(ctx)
+	})
+}
+
+// Reconcile сравнивает сохраненный баланс каждого пользователя с суммой его операций из истории
+// и возвращает пользователей, у которых они расходятся
+func (repository *BalanceRepository) Reconcile(ctx context.Context) (_ []models.BalanceMismatch, err error) {
+	ctx, span := tracing.Start(ctx, "BalanceRepository.Reconcile")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `WITH operations AS (
+			SELECT user_id, accrual AS amount, 0 AS withdrawn FROM orders WHERE status = 'PROCESSED' AND accrual > 0
+			UNION ALL
+			SELECT user_id, -COALESCE(sum, 0), COALESCE(sum, 0) FROM withdrawals
+			UNION ALL
+			SELECT from_user_id, -sum, 0 FROM transfers
+			UNION ALL
+			SELECT to_user_id, sum, 0 FROM transfers
+			UNION ALL
+			SELECT user_id, sum, 0 FROM balance_adjustments
+		), expected AS (
+			SELECT user_id, SUM(amount) AS current, SUM(withdrawn) AS withdrawn FROM operations GROUP BY user_id
+		)
+		SELECT users.id, users.name,
+			COALESCE(balance.current, 0)::bigint, COALESCE(expected.current, 0)::bigint,
+			COALESCE(balance.withdrawals, 0)::bigint, COALESCE(expected.withdrawn, 0)::bigint
+		FROM users
+		LEFT JOIN balance ON balance.user_id = users.id
+		LEFT JOIN expected ON expected.user_id = users.id
+		WHERE COALESCE(balance.current, 0) <> COALESCE(expected.current, 0)
+			OR COALESCE(balance.withdrawals, 0) <> COALESCE(expected.withdrawn, 0)
+		ORDER BY users.id`
+
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) ([]models.BalanceMismatch, error) {
+		rows, err := repository.db.Pool.Query(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		mismatches := []models.BalanceMismatch{}
+		for rows.Next() {
+			var mismatch models.BalanceMismatch
+			var current, expectedCurrent, withdrawn, expectedWithdrawn int64
+			err = rows.Scan(&mismatch.UserID, &mismatch.Login, &current, &expectedCurrent, &withdrawn, &expectedWithdrawn)
+			if err != nil {
+				return nil, err
+			}
+			mismatch.SetAmounts(current, expectedCurrent, withdrawn, expectedWithdrawn)
+			mismatches = append(mismatches, mismatch)
+		}
+		return mismatches, rows.Err()
+	})
+}
@@ -4,6 +4,10 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/customerror"
+	"github.com/Bessima/diplom-gomarket/internal/models"
 
 	"github.com/pashagolub/pgxmock/v3"
 	"github.com/stretchr/testify/assert"
@@ -31,7 +35,7 @@ func TestBalanceRepository_GetBalanceUserID_Success(t *testing.T) {
 		WillReturnRows(rows)
 
 	// Act
-	balance, err := repo.GetBalanceUserID(userID)
+	balance, err := repo.GetBalanceUserID(context.Background(), userID)
 
 	// Assert
 	assert.NoError(t, err)
@@ -58,7 +62,7 @@ func TestBalanceRepository_GetBalanceUserID_NoRows(t *testing.T) {
 		WillReturnRows(rows)
 
 	// Act
-	balance, err := repo.GetBalanceUserID(userID)
+	balance, err := repo.GetBalanceUserID(context.Background(), userID)
 
 	// Assert
 	assert.NoError(t, err) // Метод возвращает пустой баланс без ошибки
@@ -85,7 +89,7 @@ func TestBalanceRepository_GetBalanceUserID_DatabaseError(t *testing.T) {
 		WillReturnError(expectedError)
 
 	// Act
-	balance, err := repo.GetBalanceUserID(userID)
+	balance, err := repo.GetBalanceUserID(context.Background(), userID)
 
 	// Assert
 	assert.Error(t, err)
@@ -115,7 +119,7 @@ func TestBalanceRepository_GetBalanceUserID_ZeroBalance(t *testing.T) {
 		WillReturnRows(rows)
 
 	// Act
-	balance, err := repo.GetBalanceUserID(userID)
+	balance, err := repo.GetBalanceUserID(context.Background(), userID)
 
 	// Assert
 	assert.NoError(t, err)
@@ -125,7 +129,7 @@ func TestBalanceRepository_GetBalanceUserID_ZeroBalance(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestBalanceRepository_SetWithdrawForUserID_Success(t *testing.T) {
+func TestBalanceRepository_SetAccrual_Success(t *testing.T) {
 	// Arrange
 	mock, err := pgxmock.NewPool()
 	require.NoError(t, err)
@@ -134,22 +138,29 @@ func TestBalanceRepository_SetWithdrawForUserID_Success(t *testing.T) {
 	dbObj := NewTestDB(mock)
 	repo := NewBalanceRepository(dbObj)
 
+	orderID := "12345"
 	userID := 1
-	withdraw := 10000 // 100.00 рублей
+	accrual := int32(50000)
 
-	mock.ExpectExec("UPDATE balance SET current").
-		WithArgs(withdraw, userID).
-		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	// Начинаем транзакцию
+	mock.ExpectBegin()
+
+	tx, err := mock.Begin(context.Background())
+	require.NoError(t, err)
+
+	mock.ExpectExec("INSERT INTO balance").
+		WithArgs(userID, accrual).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
 
 	// Act
-	err = repo.SetWithdrawForUserID(userID, withdraw)
+	err = repo.SetAccrual(context.Background(), tx, orderID, userID, accrual)
 
 	// Assert
 	assert.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestBalanceRepository_SetWithdrawForUserID_NoRowsAffected(t *testing.T) {
+func TestBalanceRepository_SetAccrual_NoRowsAffected(t *testing.T) {
 	// Arrange
 	mock, err := pgxmock.NewPool()
 	require.NoError(t, err)
@@ -158,23 +169,29 @@ func TestBalanceRepository_SetWithdrawForUserID_NoRowsAffected(t *testing.T) {
 	dbObj := NewTestDB(mock)
 	repo := NewBalanceRepository(dbObj)
 
-	userID := 999
-	withdraw := 10000
+	orderID := "12345"
+	userID := 1
+	accrual := int32(50000)
 
-	mock.ExpectExec("UPDATE balance SET current").
-		WithArgs(withdraw, userID).
-		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	mock.ExpectBegin()
+
+	tx, err := mock.Begin(context.Background())
+	require.NoError(t, err)
+
+	mock.ExpectExec("INSERT INTO balance").
+		WithArgs(userID, accrual).
+		WillReturnResult(pgxmock.NewResult("INSERT", 0))
 
 	// Act
-	err = repo.SetWithdrawForUserID(userID, withdraw)
+	err = repo.SetAccrual(context.Background(), tx, orderID, userID, accrual)
 
 	// Assert
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "not update balance for user")
+	assert.Contains(t, err.Error(), "was not installed accrual value")
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestBalanceRepository_SetWithdrawForUserID_DatabaseError(t *testing.T) {
+func TestBalanceRepository_SetAccrual_DatabaseError(t *testing.T) {
 	// Arrange
 	mock, err := pgxmock.NewPool()
 	require.NoError(t, err)
@@ -183,16 +200,22 @@ func TestBalanceRepository_SetWithdrawForUserID_DatabaseError(t *testing.T) {
 	dbObj := NewTestDB(mock)
 	repo := NewBalanceRepository(dbObj)
 
+	orderID := "12345"
 	userID := 1
-	withdraw := 10000
+	accrual := int32(50000)
 	expectedError := errors.New("database error")
 
-	mock.ExpectExec("UPDATE balance SET current").
-		WithArgs(withdraw, userID).
+	mock.ExpectBegin()
+
+	tx, err := mock.Begin(context.Background())
+	require.NoError(t, err)
+
+	mock.ExpectExec("INSERT INTO balance").
+		WithArgs(userID, accrual).
 		WillReturnError(expectedError)
 
 	// Act
-	err = repo.SetWithdrawForUserID(userID, withdraw)
+	err = repo.SetAccrual(context.Background(), tx, orderID, userID, accrual)
 
 	// Assert
 	assert.Error(t, err)
@@ -200,7 +223,7 @@ func TestBalanceRepository_SetWithdrawForUserID_DatabaseError(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestBalanceRepository_SetAccrual_Success(t *testing.T) {
+func TestBalanceRepository_GetHistory_Success(t *testing.T) {
 	// Arrange
 	mock, err := pgxmock.NewPool()
 	require.NoError(t, err)
@@ -209,29 +232,36 @@ func TestBalanceRepository_SetAccrual_Success(t *testing.T) {
 	dbObj := NewTestDB(mock)
 	repo := NewBalanceRepository(dbObj)
 
-	orderID := "12345"
 	userID := 1
-	accrual := int32(50000)
+	now := time.Now()
 
-	// Начинаем транзакцию
-	mock.ExpectBegin()
+	rows := pgxmock.NewRows([]string{"type", "ref", "amount", "occurred_at", "balance_after"}).
+		AddRow(models.WithdrawalEvent, "2377225624", int64(-10050), now, int64(39950)).
+		AddRow(models.AccrualEvent, "12345678903", int64(50000), now.Add(-time.Hour), int64(50000))
 
-	tx, err := mock.Begin(context.Background())
-	require.NoError(t, err)
-
-	mock.ExpectExec("INSERT INTO balance").
-		WithArgs(userID, accrual).
-		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectQuery("WITH events AS").
+		WithArgs(userID, pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), 10).
+		WillReturnRows(rows)
 
 	// Act
-	err = repo.SetAccrual(tx, orderID, userID, accrual)
+	events, err := repo.GetHistory(context.Background(), userID, BalanceHistoryFilter{Limit: 10})
 
 	// Assert
 	assert.NoError(t, err)
+	require.Len(t, events, 2)
+
+	assert.Equal(t, models.WithdrawalEvent, events[0].Type)
+	assert.Equal(t, "2377225624", events[0].Reference)
+	assert.Equal(t, float32(-100.50), events[0].Amount)
+	assert.Equal(t, float32(399.50), events[0].BalanceAfter)
+
+	assert.Equal(t, models.AccrualEvent, events[1].Type)
+	assert.Equal(t, float32(500), events[1].Amount)
+	assert.Equal(t, float32(500), events[1].BalanceAfter)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestBalanceRepository_SetAccrual_NoRowsAffected(t *testing.T) {
+func TestBalanceRepository_GetHistory_WithCursorAndTypes(t *testing.T) {
 	// Arrange
 	mock, err := pgxmock.NewPool()
 	require.NoError(t, err)
@@ -240,103 +270,172 @@ func TestBalanceRepository_SetAccrual_NoRowsAffected(t *testing.T) {
 	dbObj := NewTestDB(mock)
 	repo := NewBalanceRepository(dbObj)
 
-	orderID := "12345"
 	userID := 1
-	accrual := int32(50000)
+	cursor := &models.BalanceEventCursor{OccurredAt: time.Now(), Type: models.AccrualEvent, Reference: "12345678903"}
+	filter := BalanceHistoryFilter{
+		Types:  []models.BalanceEventType{models.AccrualEvent},
+		Cursor: cursor,
+		Limit:  5,
+	}
 
-	mock.ExpectBegin()
+	mock.ExpectQuery("WITH events AS").
+		WithArgs(userID, pgxmock.AnyArg(), pgxmock.AnyArg(), []string{"ACCRUAL"}, &cursor.OccurredAt, "ACCRUAL", "12345678903", 5).
+		WillReturnRows(pgxmock.NewRows([]string{"type", "ref", "amount", "occurred_at", "balance_after"}))
 
-	tx, err := mock.Begin(context.Background())
+	// Act
+	events, err := repo.GetHistory(context.Background(), userID, filter)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBalanceRepository_GetHistory_QueryError(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
 	require.NoError(t, err)
+	defer mock.Close()
 
-	mock.ExpectExec("INSERT INTO balance").
-		WithArgs(userID, accrual).
-		WillReturnResult(pgxmock.NewResult("INSERT", 0))
+	dbObj := NewTestDB(mock)
+	repo := NewBalanceRepository(dbObj)
+
+	expectedError := errors.New("query error")
+
+	mock.ExpectQuery("WITH events AS").
+		WithArgs(1, pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), 10).
+		WillReturnError(expectedError)
 
 	// Act
-	err = repo.SetAccrual(tx, orderID, userID, accrual)
+	events, err := repo.GetHistory(context.Background(), 1, BalanceHistoryFilter{Limit: 10})
 
 	// Assert
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "was not installed accrual value")
+	assert.Nil(t, events)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestBalanceRepository_SetAccrual_DatabaseError(t *testing.T) {
+func TestBalanceRepository_Reconcile_ReturnsMismatches(t *testing.T) {
 	// Arrange
 	mock, err := pgxmock.NewPool()
 	require.NoError(t, err)
 	defer mock.Close()
 
-	dbObj := NewTestDB(mock)
-	repo := NewBalanceRepository(dbObj)
+	repo := NewBalanceRepository(NewTestDB(mock))
 
-	orderID := "12345"
-	userID := 1
-	accrual := int32(50000)
-	expectedError := errors.New("database error")
+	rows := pgxmock.NewRows([]string{"id", "name", "current", "expected_current", "withdrawals", "expected_withdrawn"}).
+		AddRow(3, "alice", int64(50000), int64(45000), int64(1000), int64(1000))
+	mock.ExpectQuery("WITH operations AS").WillReturnRows(rows)
 
-	mock.ExpectBegin()
+	// Act
+	mismatches, err := repo.Reconcile(context.Background())
 
-	tx, err := mock.Begin(context.Background())
+	// Assert
 	require.NoError(t, err)
+	require.Len(t, mismatches, 1)
+	assert.Equal(t, models.BalanceMismatch{
+		UserID:            3,
+		Login:             "alice",
+		Current:           500,
+		ExpectedCurrent:   450,
+		Withdrawn:         10,
+		ExpectedWithdrawn: 10,
+	}, mismatches[0])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
 
-	mock.ExpectExec("INSERT INTO balance").
-		WithArgs(userID, accrual).
-		WillReturnError(expectedError)
+func TestBalanceRepository_Reconcile_NoMismatches(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewBalanceRepository(NewTestDB(mock))
+
+	mock.ExpectQuery("WITH operations AS").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "current", "expected_current", "withdrawals", "expected_withdrawn"}))
 
 	// Act
-	err = repo.SetAccrual(tx, orderID, userID, accrual)
+	mismatches, err := repo.Reconcile(context.Background())
 
 	// Assert
-	assert.Error(t, err)
-	assert.Equal(t, expectedError, err)
+	require.NoError(t, err)
+	assert.Empty(t, mismatches)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestBalanceRepository_SetWithdrawForUserID_DifferentAmounts(t *testing.T) {
-	testCases := []struct {
-		name     string
-		userID   int
-		withdraw int
-	}{
-		{
-			name:     "small withdraw",
-			userID:   1,
-			withdraw: 100,
-		},
-		{
-			name:     "large withdraw",
-			userID:   2,
-			withdraw: 100000,
-		},
-		{
-			name:     "medium withdraw",
-			userID:   3,
-			withdraw: 50000,
-		},
-	}
+func TestBalanceRepository_Adjust_Success(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
 
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			// Arrange
-			mock, err := pgxmock.NewPool()
-			require.NoError(t, err)
-			defer mock.Close()
+	repo := NewBalanceRepository(NewTestDB(mock))
+	userID := 3
 
-			dbObj := NewTestDB(mock)
-			repo := NewBalanceRepository(dbObj)
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO balance").
+		WithArgs(userID).
+		WillReturnRows(pgxmock.NewRows([]string{"current"}).AddRow(int64(1000)))
+	mock.ExpectExec("UPDATE balance SET current").
+		WithArgs(int64(-250), userID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectQuery("INSERT INTO balance_adjustments").
+		WithArgs(userID, int64(-250), "duplicate accrual").
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(int64(7)))
+	// Запись журнала в той же транзакции
+	mock.ExpectExec("INSERT INTO admin_audit").
+		WithArgs(models.AuditBalanceAdjusted, "3", "ops", "duplicate accrual", []byte(`{"id":7,"amount":-2.5,"current":7.5}`)).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+
+	// Act
+	adjustment, err := repo.Adjust(context.Background(), userID, -250, models.AuditEntry{
+		Actor:  "ops",
+		Reason: "duplicate accrual",
+	})
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, models.BalanceAdjustment{ID: 7, Amount: -2.5, Current: 7.5}, adjustment)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
 
-			mock.ExpectExec("UPDATE balance SET current").
-				WithArgs(tc.withdraw, tc.userID).
-				WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+func TestBalanceRepository_Adjust_NegativeBalanceRejected(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
 
-			// Act
-			err = repo.SetWithdrawForUserID(tc.userID, tc.withdraw)
+	repo := NewBalanceRepository(NewTestDB(mock))
+	userID := 3
 
-			// Assert
-			assert.NoError(t, err)
-			assert.NoError(t, mock.ExpectationsWereMet())
-		})
-	}
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO balance").
+		WithArgs(userID).
+		WillReturnRows(pgxmock.NewRows([]string{"current"}).AddRow(int64(100)))
+	mock.ExpectRollback()
+
+	// Act
+	_, err = repo.Adjust(context.Background(), userID, -250, models.AuditEntry{Actor: "ops", Reason: "fix"})
+
+	// Assert
+	assert.IsType(t, &customerror.InsufficientFundsError{}, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBalanceRepository_Adjust_ZeroSumRejected(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewBalanceRepository(NewTestDB(mock))
+
+	// Act
+	_, err = repo.Adjust(context.Background(), 3, 0, models.AuditEntry{Actor: "ops", Reason: "fix"})
+
+	// Assert
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
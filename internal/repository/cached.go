@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/cache"
+	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+)
+
+// Имена кешей в метриках
+const (
+	UsersCacheName    = "users"
+	BalancesCacheName = "balances"
+)
+
+// Caches кеши пользователей и балансов. Значения удаляются после записей этой реплики
+// и по уведомлениям базы об изменениях (events.ListenCacheInvalidations).
+type Caches struct {
+	Users    *cache.Loading[int, models.User]
+	Balances *cache.Loading[int, models.Balance]
+}
+
+// NewCaches кеши в памяти процесса на size значений каждый со сроком хранения ttl
+func NewCaches(size int, ttl time.Duration) *Caches {
+	return &Caches{
+		Users:    cache.NewLoading[int, models.User](UsersCacheName, cache.NewLRU[int, models.User](size, ttl)),
+		Balances: cache.NewLoading[int, models.Balance](BalancesCacheName, cache.NewLRU[int, models.Balance](size, ttl)),
+	}
+}
+
+// Wrap добавляет кеш к репозиториям storage
+func (caches *Caches) Wrap(storage Storage) Storage {
+	storage.Users = &cachedUserRepository{UserStorageRepositoryI: storage.Users, caches: caches}
+	storage.Orders = &cachedOrderRepository{OrderStorageRepositoryI: storage.Orders, caches: caches}
+	storage.Balance = &cachedBalanceRepository{BalanceStorageRepositoryI: storage.Balance, caches: caches}
+	storage.Withdrawals = &cachedWithdrawRepository{WithdrawStorageRepositoryI: storage.Withdrawals, caches: caches}
+	storage.Caches = caches
+	return storage
+}
+
+// WrapTransfers очищает кеш балансов после переводов
+func (caches *Caches) WrapTransfers(transfers TransferStorageRepositoryI) TransferStorageRepositoryI {
+	return &cachedTransferRepository{TransferStorageRepositoryI: transfers, caches: caches}
+}
+
+// InvalidateBalances удаляет балансы пользователей после записи этой реплики. Вызывается и при ошибке:
+// по ошибке, например по таймауту, нельзя понять, была ли запись зафиксирована.
+func (caches *Caches) InvalidateBalances(ctx context.Context, userIDs ...int) {
+	caches.Balances.Invalidate(ctx, cache.SourceWrite, userIDs...)
+}
+
+// Purge очищает все кеши
+func (caches *Caches) Purge(ctx context.Context) {
+	caches.Users.Purge(ctx)
+	caches.Balances.Purge(ctx)
+}
+
+// cachedUserRepository кеширует пользователей по идентификатору: AuthMiddleware запрашивает
+// пользователя на каждом запросе. Возвращается копия, чтобы вызывающий код не менял значение в кеше.
+type cachedUserRepository struct {
+	UserStorageRepositoryI
+	caches *Caches
+}
+
+func (repo *cachedUserRepository) GetUserByID(ctx context.Context, id int) (*models.User, error) {
+	user, err := repo.caches.Users.Get(ctx, id, func(ctx context.Context) (models.User, error) {
+		user, err := repo.UserStorageRepositoryI.GetUserByID(ctx, id)
+		if err != nil || user == nil {
+			return models.User{}, err
+		}
+		return *user, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// cachedBalanceRepository кеширует балансы для чтений, которым разрешено отставание (db.WithReplicaRead).
+// Проверки перед списанием и переводом читают базу.
+type cachedBalanceRepository struct {
+	BalanceStorageRepositoryI
+	caches *Caches
+}
+
+func (repo *cachedBalanceRepository) GetBalanceUserID(ctx context.Context, userID int) (models.Balance, error) {
+	if !db.ReplicaReadAllowed(ctx) {
+		return repo.BalanceStorageRepositoryI.GetBalanceUserID(ctx, userID)
+	}
+	return repo.caches.Balances.Get(ctx, userID, func(ctx context.Context) (models.Balance, error) {
+		return repo.BalanceStorageRepositoryI.GetBalanceUserID(ctx, userID)
+	})
+}
+
+// cachedWithdrawRepository очищает баланс пользователя после списания
+type cachedWithdrawRepository struct {
+	WithdrawStorageRepositoryI
+	caches *Caches
+}
+
+func (repo *cachedWithdrawRepository) Withdraw(ctx context.Context, userID int, orderID int64, sum int) error {
+	defer repo.caches.InvalidateBalances(ctx, userID)
+	return repo.WithdrawStorageRepositoryI.Withdraw(ctx, userID, orderID, sum)
+}
+
+// cachedOrderRepository очищает баланс пользователя после зачисления начисления
+type cachedOrderRepository struct {
+	OrderStorageRepositoryI
+	caches *Caches
+}
+
+func (repo *cachedOrderRepository) SetAccrual(ctx context.Context, orderID string, userID int, accrual int32) error {
+	defer repo.caches.InvalidateBalances(ctx, userID)
+	return repo.OrderStorageRepositoryI.SetAccrual(ctx, orderID, userID, accrual)
+}
+
+type cachedTransferRepository struct {
+	TransferStorageRepositoryI
+	caches *Caches
+}
+
+func (repo *cachedTransferRepository) Create(ctx context.Context, fromUserID, toUserID int, sum int64, dailyLimit int64) error {
+	defer repo.caches.InvalidateBalances(ctx, fromUserID, toUserID)
+	return repo.TransferStorageRepositoryI.Create(ctx, fromUserID, toUserID, sum, dailyLimit)
+}
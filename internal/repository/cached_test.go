@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaches_GetUserByID_QueriesOnce(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	storage := NewCaches(10, time.Minute).Wrap(NewStorage(NewTestDB(mock)))
+	mock.ExpectQuery("SELECT id, name, password FROM users WHERE id").
+		WithArgs(1).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "password"}).AddRow(1, "alice", "hash"))
+
+	// Act
+	first, errFirst := storage.Users.GetUserByID(context.Background(), 1)
+	first.Login = "changed by caller"
+	second, errSecond := storage.Users.GetUserByID(context.Background(), 1)
+
+	// Assert
+	require.NoError(t, errFirst)
+	require.NoError(t, errSecond)
+	assert.Equal(t, "alice", second.Login)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCaches_GetBalanceUserID_InvalidatedByWithdraw(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	storage := NewCaches(10, time.Minute).Wrap(NewStorage(NewTestDB(mock)))
+	ctx := db.WithReplicaRead(context.Background())
+	userID := 1
+	balanceQuery := "SELECT current, withdrawals FROM balance WHERE user_id"
+	balanceColumns := []string{"current", "withdrawals"}
+
+	mock.ExpectQuery(balanceQuery).
+		WithArgs(userID).
+		WillReturnRows(pgxmock.NewRows(balanceColumns).AddRow(int32(50000), int32(0)))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE balance SET current").
+		WithArgs(10000, userID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("INSERT INTO withdrawals").
+		WithArgs(userID, int64(2377225624), 10000).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(balanceQuery).
+		WithArgs(userID).
+		WillReturnRows(pgxmock.NewRows(balanceColumns).AddRow(int32(40000), int32(10000)))
+
+	// Act
+	before, errBefore := storage.Balance.GetBalanceUserID(ctx, userID)
+	cached, errCached := storage.Balance.GetBalanceUserID(ctx, userID)
+	errWithdraw := storage.Withdrawals.Withdraw(context.Background(), userID, 2377225624, 10000)
+	after, errAfter := storage.Balance.GetBalanceUserID(ctx, userID)
+
+	// Assert
+	require.NoError(t, errBefore)
+	require.NoError(t, errCached)
+	require.NoError(t, errWithdraw)
+	require.NoError(t, errAfter)
+	assert.Equal(t, float32(500), before.Current)
+	assert.Equal(t, before, cached)
+	assert.Equal(t, float32(400), after.Current)
+	assert.Equal(t, float32(100), after.Withdrawn)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCaches_GetBalanceUserID_ChecksBypassCache(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	storage := NewCaches(10, time.Minute).Wrap(NewStorage(NewTestDB(mock)))
+	userID := 1
+	for range 2 {
+		mock.ExpectQuery("SELECT current, withdrawals FROM balance WHERE user_id").
+			WithArgs(userID).
+			WillReturnRows(pgxmock.NewRows([]string{"current", "withdrawals"}).AddRow(int32(50000), int32(0)))
+	}
+
+	// Act
+	// Проверка перед списанием не разрешает чтение с отставанием и всегда читает базу
+	_, errFirst := storage.Balance.GetBalanceUserID(context.Background(), userID)
+	_, errSecond := storage.Balance.GetBalanceUserID(context.Background(), userID)
+
+	// Assert
+	assert.NoError(t, errFirst)
+	assert.NoError(t, errSecond)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
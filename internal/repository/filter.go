@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"fmt"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"strings"
+	"time"
+)
+
+type SortOrder string
+
+const (
+	SortDesc SortOrder = "desc"
+	SortAsc  SortOrder = "asc"
+)
+
+// OrderListFilter параметры постраничной выборки заказов. Сортировка по uploaded_at, Limit <= 0 - без ограничения.
+type OrderListFilter struct {
+	Statuses      []models.OrderStatus
+	UploadedFrom  *time.Time
+	UploadedTo    *time.Time
+	ProcessedFrom *time.Time
+	ProcessedTo   *time.Time
+	Sort          SortOrder
+	Cursor        *models.ListCursor
+	Limit         int
+}
+
+// WithdrawalListFilter параметры постраничной выборки списаний. Сортировка по processed_at, Limit <= 0 - без ограничения.
+type WithdrawalListFilter struct {
+	From   *time.Time
+	To     *time.Time
+	Sort   SortOrder
+	Cursor *models.ListCursor
+	Limit  int
+}
+
+// queryBuilder собирает условия WHERE и аргументы запроса с правильной нумерацией плейсхолдеров
+type queryBuilder struct {
+	conditions []string
+	args       []any
+}
+
+func (builder *queryBuilder) add(condition string, args ...any) {
+	placeholders := make([]any, 0, len(args))
+	for _, arg := range args {
+		builder.args = append(builder.args, arg)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(builder.args)))
+	}
+	builder.conditions = append(builder.conditions, fmt.Sprintf(condition, placeholders...))
+}
+
+func (builder *queryBuilder) addRange(column string, from, to *time.Time) {
+	if from != nil {
+		builder.add(column+" >= %s", *from)
+	}
+	if to != nil {
+		builder.add(column+" < %s", *to)
+	}
+}
+
+// addPage добавляет условие курсора, сортировку и лимит для пары колонок (timeColumn, idColumn)
+func (builder *queryBuilder) addPage(timeColumn, idColumn string, sort SortOrder, cursor *models.ListCursor, limit int) string {
+	direction, comparison := "DESC", "<"
+	if sort == SortAsc {
+		direction, comparison = "ASC", ">"
+	}
+	if cursor != nil {
+		builder.add(fmt.Sprintf("(%s, %s) %s (%%s, %%s)", timeColumn, idColumn, comparison), cursor.At, cursor.ID)
+	}
+
+	suffix := fmt.Sprintf(" ORDER BY %s %s, %s %s", timeColumn, direction, idColumn, direction)
+	if limit > 0 {
+		builder.args = append(builder.args, limit)
+		suffix += fmt.Sprintf(" LIMIT $%d", len(builder.args))
+	}
+	return suffix
+}
+
+func (builder *queryBuilder) where() string {
+	return " WHERE " + strings.Join(builder.conditions, " AND ")
+}
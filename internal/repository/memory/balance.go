@@ -0,0 +1,118 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
+)
+
+type BalanceRepository struct {
+	store *Store
+}
+
+func NewBalanceRepository(store *Store) *BalanceRepository {
+	return &BalanceRepository{store: store}
+}
+
+func (repo *BalanceRepository) GetBalanceUserID(_ context.Context, userID int) (models.Balance, error) {
+	store := repo.store
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	result := models.NewBalance(userID)
+	if elem, ok := store.balances[userID]; ok {
+		result.SetCurrent(int32(elem.current))
+		result.SetWithdrawn(int32(elem.withdrawn))
+	}
+	return result, nil
+}
+
+// GetHistory возвращает начисления и списания пользователя от новых к старым.
+// Переводы и корректировки хранятся только в Postgres, поэтому в истории их нет.
+func (repo *BalanceRepository) GetHistory(_ context.Context, userID int, filter repository.BalanceHistoryFilter) ([]models.BalanceEvent, error) {
+	store := repo.store
+	store.mu.Lock()
+	ledger := []models.BalanceEvent{}
+	amounts := []int64{}
+	for _, elem := range store.orders {
+		if elem.userID == userID && elem.status == models.ProcessedStatus && elem.accrual != nil && *elem.accrual > 0 {
+			occurredAt := elem.uploadedAt
+			if elem.processedAt != nil {
+				occurredAt = *elem.processedAt
+			}
+			ledger = append(ledger, models.BalanceEvent{Type: models.AccrualEvent, Reference: strconv.FormatInt(elem.id, 10), OccurredAt: occurredAt})
+			amounts = append(amounts, int64(*elem.accrual))
+		}
+	}
+	for _, elem := range store.withdrawals {
+		if elem.userID == userID {
+			ledger = append(ledger, models.BalanceEvent{Type: models.WithdrawalEvent, Reference: strconv.FormatInt(elem.orderID, 10), OccurredAt: elem.processedAt})
+			amounts = append(amounts, -elem.sum)
+		}
+	}
+	store.mu.Unlock()
+
+	// Баланс после события считается по всей истории в порядке (occurred_at, type, ref), как в оконной функции Postgres
+	order := make([]int, len(ledger))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortFunc(order, func(a, b int) int {
+		return compareEvents(ledger[a], ledger[b])
+	})
+	events := make([]models.BalanceEvent, 0, len(order))
+	var balanceAfter int64
+	for _, i := range order {
+		balanceAfter += amounts[i]
+		event := ledger[i]
+		event.SetAmounts(amounts[i], balanceAfter)
+		events = append(events, event)
+	}
+
+	result := []models.BalanceEvent{}
+	for i := len(events) - 1; i >= 0; i-- {
+		event := events[i]
+		if !inRange(event.OccurredAt, filter.From, filter.To) {
+			continue
+		}
+		if len(filter.Types) > 0 && !slices.Contains(filter.Types, event.Type) {
+			continue
+		}
+		if filter.Cursor != nil && compareEvents(event, models.BalanceEvent{
+			Type:       filter.Cursor.Type,
+			Reference:  filter.Cursor.Reference,
+			OccurredAt: filter.Cursor.OccurredAt,
+		}) >= 0 {
+			continue
+		}
+		if len(result) == filter.Limit {
+			break
+		}
+		result = append(result, event)
+	}
+	return result, nil
+}
+
+func compareEvents(a, b models.BalanceEvent) int {
+	if cmp := a.OccurredAt.Compare(b.OccurredAt); cmp != 0 {
+		return cmp
+	}
+	if cmp := strings.Compare(string(a.Type), string(b.Type)); cmp != 0 {
+		return cmp
+	}
+	return strings.Compare(a.Reference, b.Reference)
+}
+
+// userBalance баланс пользователя, созданный при первом начислении. Вызывается под мьютексом хранилища.
+func (store *Store) userBalance(userID int) *balance {
+	elem, ok := store.balances[userID]
+	if !ok {
+		elem = &balance{}
+		store.balances[userID] = elem
+	}
+	return elem
+}
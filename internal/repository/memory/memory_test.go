@@ -0,0 +1,15 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/Bessima/diplom-gomarket/internal/repository"
+	"github.com/Bessima/diplom-gomarket/internal/repository/memory"
+	"github.com/Bessima/diplom-gomarket/internal/repository/repositorytest"
+)
+
+func TestStorageContract(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repository.Storage {
+		return memory.NewStorage()
+	})
+}
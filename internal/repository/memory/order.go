@@ -0,0 +1,229 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
+	"github.com/jackc/pgx/v5"
+)
+
+type OrderRepository struct {
+	store *Store
+}
+
+func NewOrderRepository(store *Store) *OrderRepository {
+	return &OrderRepository{store: store}
+}
+
+func (repo *OrderRepository) Create(_ context.Context, userID, orderID int) error {
+	store := repo.store
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	id := int64(orderID)
+	if _, ok := store.orders[id]; ok {
+		return fmt.Errorf("order with id %v already exists", orderID)
+	}
+	store.orders[id] = &order{id: id, userID: userID, status: models.NewStatus, uploadedAt: now()}
+	return nil
+}
+
+// CreateBatch добавляет заказы пользователя и возвращает результат для каждого номера.
+// Номера, уже загруженные этим или другим пользователем, не изменяются.
+func (repo *OrderRepository) CreateBatch(_ context.Context, userID int, orderIDs []int64) (map[int64]models.BatchOrderStatus, error) {
+	store := repo.store
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	uploadedAt := now()
+	result := make(map[int64]models.BatchOrderStatus, len(orderIDs))
+	for _, id := range orderIDs {
+		if _, ok := result[id]; ok {
+			continue
+		}
+		existing, ok := store.orders[id]
+		switch {
+		case !ok:
+			store.orders[id] = &order{id: id, userID: userID, status: models.NewStatus, uploadedAt: uploadedAt}
+			result[id] = models.BatchAccepted
+		case existing.userID == userID:
+			result[id] = models.BatchDuplicateOwn
+		default:
+			result[id] = models.BatchConflict
+		}
+	}
+	return result, nil
+}
+
+func (repo *OrderRepository) GetByID(_ context.Context, id int) (*models.Order, error) {
+	store := repo.store
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	elem, ok := store.orders[int64(id)]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	result := elem.toModel()
+	return &result, nil
+}
+
+func (repo *OrderRepository) GetListByUserID(ctx context.Context, userID int) ([]models.Order, error) {
+	return repo.GetPageByUserID(ctx, userID, repository.OrderListFilter{Sort: repository.SortDesc})
+}
+
+// GetPageByUserID возвращает страницу заказов пользователя с учетом фильтров и курсора
+func (repo *OrderRepository) GetPageByUserID(_ context.Context, userID int, filter repository.OrderListFilter) ([]models.Order, error) {
+	orders := repo.selectOrders(func(elem *order) bool {
+		if elem.userID != userID {
+			return false
+		}
+		if len(filter.Statuses) > 0 && !slices.Contains(filter.Statuses, elem.status) {
+			return false
+		}
+		if !inRange(elem.uploadedAt, filter.UploadedFrom, filter.UploadedTo) {
+			return false
+		}
+		if filter.ProcessedFrom != nil || filter.ProcessedTo != nil {
+			return elem.processedAt != nil && inRange(*elem.processedAt, filter.ProcessedFrom, filter.ProcessedTo)
+		}
+		return true
+	})
+
+	orders = page(orders, func(elem order) (time.Time, int64) {
+		return elem.uploadedAt, elem.id
+	}, filter.Sort, filter.Cursor, filter.Limit)
+
+	result := make([]models.Order, 0, len(orders))
+	for _, elem := range orders {
+		result = append(result, elem.toModel())
+	}
+	return result, nil
+}
+
+// selectOrders копии подходящих заказов по возрастанию (uploaded_at, id). Копии позволяют
+// передавать заказы в обработчики без удержания мьютекса хранилища.
+func (repo *OrderRepository) selectOrders(match func(*order) bool) []order {
+	store := repo.store
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	orders := []order{}
+	for _, elem := range store.orders {
+		if match(elem) {
+			orders = append(orders, *elem)
+		}
+	}
+	slices.SortFunc(orders, func(a, b order) int {
+		return compareKeys(a.uploadedAt, a.id, b.uploadedAt, b.id)
+	})
+	return orders
+}
+
+// SetListForProcessing передает в enqueue необработанные заказы. Если enqueue вернул false
+// (очередь закрыта при остановке сервиса), передача прекращается.
+func (repo *OrderRepository) SetListForProcessing(_ context.Context, enqueue func(models.Order) bool) error {
+	orders := repo.selectOrders(func(elem *order) bool {
+		return elem.status == models.NewStatus || elem.status == models.ProcessingStatus
+	})
+	for _, elem := range orders {
+		if !enqueue(elem.toModel()) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (repo *OrderRepository) UpdateStatus(_ context.Context, orderID string, newStatus models.OrderStatus) error {
+	store := repo.store
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	elem, err := store.findOrder(orderID)
+	if err != nil {
+		return err
+	}
+	if elem.status == models.ProcessedStatus {
+		return fmt.Errorf("order with id %v not found or already processed", orderID)
+	}
+	elem.status = newStatus
+	return nil
+}
+
+// SetAccrual сохраняет начисление и зачисляет его на баланс пользователя одной операцией.
+// Повторный вызов для обработанного заказа баланс не меняет.
+// В отличие от Postgres событие для outbox не записывается: outbox работает только с Postgres.
+func (repo *OrderRepository) SetAccrual(_ context.Context, orderID string, userID int, accrual int32) error {
+	store := repo.store
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	elem, err := store.findOrder(orderID)
+	if err != nil {
+		return fmt.Errorf("order with id %v was not installed accrual value", orderID)
+	}
+	if elem.status == models.ProcessedStatus {
+		return nil
+	}
+	processedAt := now()
+	elem.accrual = &accrual
+	elem.status = models.ProcessedStatus
+	elem.processedAt = &processedAt
+
+	store.userBalance(userID).current += int64(accrual)
+	return nil
+}
+
+// StreamByUserID передает заказы пользователя в fn по возрастанию времени загрузки
+func (repo *OrderRepository) StreamByUserID(ctx context.Context, userID int, from, to *time.Time, fn func(models.OrderRecord) error) error {
+	orders := repo.selectOrders(func(elem *order) bool {
+		return elem.userID == userID && inRange(elem.uploadedAt, from, to)
+	})
+	for _, elem := range orders {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		record := models.OrderRecord{
+			Number:      strconv.FormatInt(elem.id, 10),
+			Status:      elem.status,
+			UploadedAt:  elem.uploadedAt,
+			ProcessedAt: elem.processedAt,
+		}
+		if elem.accrual != nil {
+			accrual := int64(*elem.accrual)
+			record.AccrualKopecks = &accrual
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *Store) findOrder(orderID string) (*order, error) {
+	id, err := strconv.ParseInt(orderID, 10, 64)
+	if err == nil {
+		if elem, ok := store.orders[id]; ok {
+			return elem, nil
+		}
+	}
+	return nil, fmt.Errorf("order with id %v not found", orderID)
+}
+
+func (elem order) toModel() models.Order {
+	result := models.Order{
+		ID:         strconv.FormatInt(elem.id, 10),
+		UserID:     elem.userID,
+		Status:     elem.status,
+		UploadedAt: elem.uploadedAt,
+	}
+	if elem.accrual != nil {
+		result.SetAccrualAsFloat(*elem.accrual)
+	}
+	return result
+}
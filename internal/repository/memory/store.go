@@ -0,0 +1,124 @@
+// Package memory реализует репозитории пользователей, заказов, списаний и баланса в памяти процесса.
+// Хранилище выбирается схемой memory:// в DATABASE_URI и предназначено для локальных демонстраций и тестов:
+// данные теряются при остановке сервиса.
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
+)
+
+// Store данные всех репозиториев. Каждая операция выполняется под общим мьютексом, поэтому изменения,
+// которые в Postgres делаются одной транзакцией (начисление меняет заказ и баланс), видны целиком или никак.
+type Store struct {
+	mu sync.Mutex
+
+	nextUserID   int
+	users        map[int]models.User
+	usersByLogin map[string]int
+	orders       map[int64]*order
+	withdrawals  map[int64]*withdrawal
+	balances     map[int]*balance
+}
+
+type order struct {
+	id          int64
+	userID      int
+	status      models.OrderStatus
+	accrual     *int32
+	uploadedAt  time.Time
+	processedAt *time.Time
+}
+
+type withdrawal struct {
+	orderID     int64
+	userID      int
+	sum         int64
+	processedAt time.Time
+}
+
+// balance суммы в копейках, как в таблице balance
+type balance struct {
+	current   int64
+	withdrawn int64
+}
+
+func NewStore() *Store {
+	return &Store{
+		nextUserID:   1,
+		users:        make(map[int]models.User),
+		usersByLogin: make(map[string]int),
+		orders:       make(map[int64]*order),
+		withdrawals:  make(map[int64]*withdrawal),
+		balances:     make(map[int]*balance),
+	}
+}
+
+// NewStorage репозитории, работающие с новым пустым хранилищем
+func NewStorage() repository.Storage {
+	store := NewStore()
+	return repository.Storage{
+		Users:       NewUserRepository(store),
+		Orders:      NewOrderRepository(store),
+		Withdrawals: NewWithdrawRepository(store),
+		Balance:     NewBalanceRepository(store),
+	}
+}
+
+// now текущее время с точностью Postgres, чтобы курсоры списков совпадали с сохраненными значениями
+func now() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
+
+// inRange проверяет условие value >= from AND value < to с пустыми границами как в запросах Postgres
+func inRange(value time.Time, from, to *time.Time) bool {
+	if from != nil && value.Before(*from) {
+		return false
+	}
+	if to != nil && !value.Before(*to) {
+		return false
+	}
+	return true
+}
+
+// compareKeys сравнивает пары (время, id) как кортежи в условиях курсора и сортировке
+func compareKeys(at time.Time, id int64, otherAt time.Time, otherID int64) int {
+	if cmp := at.Compare(otherAt); cmp != 0 {
+		return cmp
+	}
+	switch {
+	case id < otherID:
+		return -1
+	case id > otherID:
+		return 1
+	}
+	return 0
+}
+
+// page применяет курсор, сортировку и лимит к списку, отсортированному по возрастанию ключа
+func page[T any](items []T, key func(T) (time.Time, int64), sort repository.SortOrder, cursor *models.ListCursor, limit int) []T {
+	if sort != repository.SortAsc {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	result := make([]T, 0, len(items))
+	for _, item := range items {
+		if cursor != nil {
+			at, id := key(item)
+			cmp := compareKeys(at, id, cursor.At, cursor.ID)
+			if (sort == repository.SortAsc && cmp <= 0) || (sort != repository.SortAsc && cmp >= 0) {
+				continue
+			}
+		}
+		result = append(result, item)
+		if limit > 0 && len(result) == limit {
+			break
+		}
+	}
+	return result
+}
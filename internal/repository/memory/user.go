@@ -0,0 +1,58 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+type UserRepository struct {
+	store *Store
+}
+
+func NewUserRepository(store *Store) *UserRepository {
+	return &UserRepository{store: store}
+}
+
+// CreateUser как и таблица users в Postgres не проверяет уникальность логина:
+// ее проверяет обработчик регистрации до создания пользователя
+func (repo *UserRepository) CreateUser(_ context.Context, username, passwordHash string) (*models.User, error) {
+	store := repo.store
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	user := models.User{ID: store.nextUserID, Login: username, PasswordHash: passwordHash}
+	store.nextUserID++
+	store.users[user.ID] = user
+	if _, ok := store.usersByLogin[username]; !ok {
+		store.usersByLogin[username] = user.ID
+	}
+	return &user, nil
+}
+
+// GetUserByLogin как и репозиторий Postgres возвращает pgx.ErrNoRows, если пользователя нет
+func (repo *UserRepository) GetUserByLogin(_ context.Context, username string) (*models.User, error) {
+	store := repo.store
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	id, ok := store.usersByLogin[username]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	user := store.users[id]
+	return &user, nil
+}
+
+func (repo *UserRepository) GetUserByID(_ context.Context, id int) (*models.User, error) {
+	store := repo.store
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	user, ok := store.users[id]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	return &user, nil
+}
@@ -0,0 +1,101 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/customerror"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
+)
+
+type WithdrawRepository struct {
+	store *Store
+}
+
+func NewWithdrawRepository(store *Store) *WithdrawRepository {
+	return &WithdrawRepository{store: store}
+}
+
+// Withdraw списывает sum копеек с баланса пользователя и записывает списание под одной блокировкой.
+// При нехватке средств возвращает InsufficientFundsError, при повторном номере заказа - UniqueViolationError.
+func (repo *WithdrawRepository) Withdraw(_ context.Context, userID int, orderID int64, sum int) error {
+	store := repo.store
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	balance, ok := store.balances[userID]
+	if !ok || balance.current < int64(sum) {
+		return customerror.NewInsufficientFundsError(fmt.Sprintf("user %d has not enough points for withdraw", userID))
+	}
+	if _, ok := store.withdrawals[orderID]; ok {
+		return customerror.NewUniqueViolationError(fmt.Sprintf("withdraw with orderID %v already exists", orderID))
+	}
+	balance.current -= int64(sum)
+	balance.withdrawn += int64(sum)
+	store.withdrawals[orderID] = &withdrawal{orderID: orderID, userID: userID, sum: int64(sum), processedAt: now()}
+	return nil
+}
+
+func (repo *WithdrawRepository) GetListByUserID(ctx context.Context, id int) ([]models.Withdrawal, error) {
+	return repo.GetPageByUserID(ctx, id, repository.WithdrawalListFilter{Sort: repository.SortDesc})
+}
+
+// GetPageByUserID возвращает страницу списаний пользователя с учетом фильтров и курсора
+func (repo *WithdrawRepository) GetPageByUserID(_ context.Context, userID int, filter repository.WithdrawalListFilter) ([]models.Withdrawal, error) {
+	withdrawals := repo.selectWithdrawals(userID, filter.From, filter.To)
+	withdrawals = page(withdrawals, func(elem withdrawal) (time.Time, int64) {
+		return elem.processedAt, elem.orderID
+	}, filter.Sort, filter.Cursor, filter.Limit)
+
+	result := make([]models.Withdrawal, 0, len(withdrawals))
+	for _, elem := range withdrawals {
+		item := models.Withdrawal{
+			OrderID:     strconv.FormatInt(elem.orderID, 10),
+			UserID:      elem.userID,
+			ProcessedAt: elem.processedAt,
+		}
+		item.SetSumInFloat(int32(elem.sum))
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+// StreamByUserID передает списания пользователя в fn по возрастанию времени списания
+func (repo *WithdrawRepository) StreamByUserID(ctx context.Context, userID int, from, to *time.Time, fn func(models.WithdrawalRecord) error) error {
+	for _, elem := range repo.selectWithdrawals(userID, from, to) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		record := models.WithdrawalRecord{
+			Order:       strconv.FormatInt(elem.orderID, 10),
+			SumKopecks:  elem.sum,
+			ProcessedAt: elem.processedAt,
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selectWithdrawals копии списаний пользователя по возрастанию (processed_at, order_id)
+func (repo *WithdrawRepository) selectWithdrawals(userID int, from, to *time.Time) []withdrawal {
+	store := repo.store
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	withdrawals := []withdrawal{}
+	for _, elem := range store.withdrawals {
+		if elem.userID == userID && inRange(elem.processedAt, from, to) {
+			withdrawals = append(withdrawals, *elem)
+		}
+	}
+	slices.SortFunc(withdrawals, func(a, b withdrawal) int {
+		return compareKeys(a.processedAt, a.orderID, b.processedAt, b.orderID)
+	})
+	return withdrawals
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/retry"
+	"github.com/Bessima/diplom-gomarket/internal/tracing"
+	"github.com/jackc/pgx/v5"
+)
+
+type NotificationSettingsRepository struct {
+	db *db.DB
+}
+
+type NotificationSettingsRepositoryI interface {
+	Get(ctx context.Context, userID int) (*models.NotificationSettings, error)
+	Save(ctx context.Context, settings models.NotificationSettings) error
+}
+
+func NewNotificationSettingsRepository(dbObj *db.DB) *NotificationSettingsRepository {
+	return &NotificationSettingsRepository{db: dbObj}
+}
+
+// Get возвращает настройки пользователя или настройки по умолчанию, если они не сохранялись
+func (repository *NotificationSettingsRepository) Get(ctx context.Context, userID int) (_ *models.NotificationSettings, err error) {
+	ctx, span := tracing.Start(ctx, "NotificationSettingsRepository.Get")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT language, channels, events, COALESCE(email, ''), COALESCE(http_url, '')
+		FROM notification_settings WHERE user_id = $1`
+
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) (*models.NotificationSettings, error) {
+		settings := models.NotificationSettings{UserID: userID}
+		err := repository.db.Pool.QueryRow(ctx, query, userID).
+			Scan(&settings.Language, &settings.Channels, &settings.Events, &settings.Email, &settings.HTTPURL)
+		if errors.Is(err, pgx.ErrNoRows) {
+			defaults := models.DefaultNotificationSettings(userID)
+			return &defaults, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &settings, nil
+	})
+}
+
+func (repository *NotificationSettingsRepository) Save(ctx context.Context, settings models.NotificationSettings) (err error) {
+	ctx, span := tracing.Start(ctx, "NotificationSettingsRepository.Save")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `INSERT INTO notification_settings (user_id, language, channels, events, email, http_url)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''))
+		ON CONFLICT (user_id) DO UPDATE SET language = EXCLUDED.language, channels = EXCLUDED.channels,
+			events = EXCLUDED.events, email = EXCLUDED.email, http_url = EXCLUDED.http_url, updated_at = now()`
+
+	return retry.DoRetry(ctx, func(ctx context.Context) error {
+		_, err := repository.db.Pool.Exec(ctx, query, settings.UserID, settings.Language,
+			settings.Channels, settings.Events, settings.Email, settings.HTTPURL)
+		return err
+	})
+}
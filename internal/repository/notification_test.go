@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationSettingsRepository_Get_Defaults(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewNotificationSettingsRepository(dbObj)
+
+	mock.ExpectQuery("SELECT language, channels, events").
+		WithArgs(1).
+		WillReturnError(pgx.ErrNoRows)
+
+	// Act
+	settings, err := repo.Get(context.Background(), 1)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, models.DefaultNotificationSettings(1), *settings)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNotificationSettingsRepository_Get_Saved(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewNotificationSettingsRepository(dbObj)
+
+	mock.ExpectQuery("SELECT language, channels, events").
+		WithArgs(1).
+		WillReturnRows(pgxmock.NewRows([]string{"language", "channels", "events", "email", "http_url"}).
+			AddRow("en", []string{"email"}, []string{"order.processed"}, "user@example.com", ""))
+
+	// Act
+	settings, err := repo.Get(context.Background(), 1)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, "en", settings.Language)
+	assert.True(t, settings.HasChannel(models.EmailChannel))
+	assert.Equal(t, "user@example.com", settings.Email)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNotificationSettingsRepository_Save(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewNotificationSettingsRepository(dbObj)
+
+	settings := models.NotificationSettings{UserID: 1, Language: "ru", Channels: []string{"log"}, Events: []string{"order.processed"}}
+	mock.ExpectExec("INSERT INTO notification_settings").
+		WithArgs(1, "ru", []string{"log"}, []string{"order.processed"}, "", "").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	// Act
+	err = repo.Save(context.Background(), settings)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
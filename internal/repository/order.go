@@ -2,11 +2,16 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/Bessima/diplom-gomarket/internal/events"
 	"github.com/Bessima/diplom-gomarket/internal/models"
 	"github.com/Bessima/diplom-gomarket/internal/retry"
+	"github.com/Bessima/diplom-gomarket/internal/tracing"
+	"github.com/jackc/pgx/v5"
 	"strconv"
+	"time"
 )
 
 type OrderRepository struct {
@@ -14,23 +19,32 @@ type OrderRepository struct {
 }
 
 type OrderStorageRepositoryI interface {
-	Create(userID, orderID int) error
-	GetByID(id int) (*models.Order, error)
-	GetListByUserID(userID int) ([]models.Order, error)
-	UpdateStatus(orderID string, newStatus models.OrderStatus) error
-	SetAccrual(orderID string, userID int, accrual int32) error
-	SetListForProcessing(ch chan models.Order) error
+	Create(ctx context.Context, userID, orderID int) error
+	CreateBatch(ctx context.Context, userID int, orderIDs []int64) (map[int64]models.BatchOrderStatus, error)
+	GetByID(ctx context.Context, id int) (*models.Order, error)
+	GetListByUserID(ctx context.Context, userID int) ([]models.Order, error)
+	GetPageByUserID(ctx context.Context, userID int, filter OrderListFilter) ([]models.Order, error)
+	UpdateStatus(ctx context.Context, orderID string, newStatus models.OrderStatus) error
+	SetAccrual(ctx context.Context, orderID string, userID int, accrual int32) error
+	SetListForProcessing(ctx context.Context, enqueue func(models.Order) bool) error
+	StreamByUserID(ctx context.Context, userID int, from, to *time.Time, fn func(models.OrderRecord) error) error
 }
 
 func NewOrderRepository(dbObj *db.DB) *OrderRepository {
 	return &OrderRepository{db: dbObj}
 }
 
-func (repository *OrderRepository) Create(userID, orderID int) error {
+func (repository *OrderRepository) Create(ctx context.Context, userID, orderID int) (err error) {
+	ctx, span := tracing.Start(ctx, "OrderRepository.Create")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
 	query := `INSERT INTO orders (id, user_id, status) VALUES ($1, $2, $3) ON CONFLICT (id) DO NOTHING`
 
-	return retry.DoRetry(context.Background(), func() error {
-		row, err := repository.db.Pool.Exec(context.Background(), query, orderID, userID, models.NewStatus)
+	repository.db.MarkWrite(userID)
+	return retry.DoRetry(ctx, func(ctx context.Context) error {
+		row, err := repository.db.Pool.Exec(ctx, query, orderID, userID, models.NewStatus)
 		if err != nil {
 			return err
 		}
@@ -41,11 +55,68 @@ func (repository *OrderRepository) Create(userID, orderID int) error {
 	})
 }
 
-func (repository *OrderRepository) GetByID(id int) (*models.Order, error) {
+// CreateBatch добавляет заказы пользователя одним запросом и возвращает результат для каждого номера.
+// Номера, уже загруженные этим или другим пользователем, не изменяются.
+func (repository *OrderRepository) CreateBatch(ctx context.Context, userID int, orderIDs []int64) (_ map[int64]models.BatchOrderStatus, err error) {
+	ctx, span := tracing.Start(ctx, "OrderRepository.CreateBatch")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `WITH input AS (SELECT DISTINCT unnest($2::bigint[]) AS id),
+		inserted AS (
+			INSERT INTO orders (id, user_id, status) SELECT id, $1, $3 FROM input ON CONFLICT (id) DO NOTHING RETURNING id
+		)
+		SELECT input.id, inserted.id IS NOT NULL, COALESCE(existing.user_id = $1, false) FROM input
+		LEFT JOIN inserted ON inserted.id = input.id
+		LEFT JOIN orders existing ON existing.id = input.id`
+
+	repository.db.MarkWrite(userID)
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) (map[int64]models.BatchOrderStatus, error) {
+		rows, err := repository.db.Pool.Query(ctx, query, userID, orderIDs, models.NewStatus)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		result := make(map[int64]models.BatchOrderStatus, len(orderIDs))
+		for rows.Next() {
+			var id int64
+			var inserted, own bool
+			err = rows.Scan(&id, &inserted, &own)
+			if err != nil {
+				return nil, err
+			}
+
+			switch {
+			case inserted:
+				result[id] = models.BatchAccepted
+			case own:
+				result[id] = models.BatchDuplicateOwn
+			default:
+				result[id] = models.BatchConflict
+			}
+		}
+
+		err = rows.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		return result, nil
+	})
+}
+
+func (repository *OrderRepository) GetByID(ctx context.Context, id int) (_ *models.Order, err error) {
+	ctx, span := tracing.Start(ctx, "OrderRepository.GetByID")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
 	query := `SELECT id,user_id,accrual,status FROM orders WHERE id = $1`
-	return retry.DoRetryWithResult(context.Background(), func() (*models.Order, error) {
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) (*models.Order, error) {
 		row := repository.db.Pool.QueryRow(
-			context.Background(),
+			ctx,
 			query,
 			id,
 		)
@@ -66,13 +137,46 @@ func (repository *OrderRepository) GetByID(id int) (*models.Order, error) {
 	})
 }
 
-func (repository *OrderRepository) GetListByUserID(userID int) ([]models.Order, error) {
+func (repository *OrderRepository) GetListByUserID(ctx context.Context, userID int) (_ []models.Order, err error) {
+	ctx, span := tracing.Start(ctx, "OrderRepository.GetListByUserID")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
 	query := `SELECT id,user_id,accrual,status,uploaded_at FROM orders WHERE user_id = $1 ORDER BY uploaded_at DESC`
-	return retry.DoRetryWithResult(context.Background(), func() ([]models.Order, error) {
-		rows, err := repository.db.Pool.Query(
-			context.Background(),
+	return repository.getList(ctx, repository.db.ReadPool(ctx, userID), query, userID)
+}
+
+// GetPageByUserID возвращает страницу заказов пользователя с учетом фильтров и курсора
+func (repository *OrderRepository) GetPageByUserID(ctx context.Context, userID int, filter OrderListFilter) (_ []models.Order, err error) {
+	ctx, span := tracing.Start(ctx, "OrderRepository.GetPageByUserID")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	builder := queryBuilder{}
+	builder.add("user_id = %s", userID)
+	if len(filter.Statuses) > 0 {
+		statuses := make([]string, 0, len(filter.Statuses))
+		for _, status := range filter.Statuses {
+			statuses = append(statuses, string(status))
+		}
+		builder.add("status::text = ANY(%s)", statuses)
+	}
+	builder.addRange("uploaded_at", filter.UploadedFrom, filter.UploadedTo)
+	builder.addRange("processed_at", filter.ProcessedFrom, filter.ProcessedTo)
+	suffix := builder.addPage("uploaded_at", "id", filter.Sort, filter.Cursor, filter.Limit)
+
+	query := `SELECT id,user_id,accrual,status,uploaded_at FROM orders` + builder.where() + suffix
+	return repository.getList(ctx, repository.db.ReadPool(ctx, userID), query, builder.args...)
+}
+
+func (repository *OrderRepository) getList(ctx context.Context, pool db.PgxPoolInterface, query string, args ...any) ([]models.Order, error) {
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) ([]models.Order, error) {
+		rows, err := pool.Query(
+			ctx,
 			query,
-			userID,
+			args...,
 		)
 		if err != nil {
 			return nil, err
@@ -105,12 +209,17 @@ func (repository *OrderRepository) GetListByUserID(userID int) ([]models.Order,
 	})
 }
 
-func (repository *OrderRepository) SetListForProcessing(ch chan models.Order) error {
+// SetListForProcessing передает в enqueue необработанные заказы. Если enqueue вернул false
+// (очередь закрыта при остановке сервиса), чтение прекращается и соединение освобождается.
+func (repository *OrderRepository) SetListForProcessing(ctx context.Context, enqueue func(models.Order) bool) (err error) {
+	ctx, span := tracing.Start(ctx, "OrderRepository.SetListForProcessing")
+	defer func() { tracing.End(span, err) }()
+
 	query := `SELECT id,user_id,accrual,status FROM orders WHERE status IN ($1, $2)`
-	return retry.DoRetry(context.Background(), func() error {
+	return retry.DoRetry(ctx, func(ctx context.Context) error {
 
 		rows, err := repository.db.Pool.Query(
-			context.Background(),
+			ctx,
 			query,
 			models.NewStatus,
 			models.ProcessingStatus,
@@ -133,38 +242,54 @@ func (repository *OrderRepository) SetListForProcessing(ch chan models.Order) er
 				return err
 			}
 
-			ch <- order
+			if !enqueue(order) {
+				return nil
+			}
 		}
 
 		return rows.Err()
 	})
 }
 
-func (repository *OrderRepository) UpdateStatus(orderID string, newStatus models.OrderStatus) error {
-	query := `UPDATE orders SET status = $1 WHERE id = $2`
-	return retry.DoRetry(context.Background(), func() error {
+func (repository *OrderRepository) UpdateStatus(ctx context.Context, orderID string, newStatus models.OrderStatus) (err error) {
+	ctx, span := tracing.Start(ctx, "OrderRepository.UpdateStatus")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	// Статус обработанного заказа не меняется: иначе повторный опрос зачислил бы начисление еще раз
+	query := `UPDATE orders SET status = $1 WHERE id = $2 AND status <> $3`
+	return retry.DoRetry(ctx, func(ctx context.Context) error {
 
 		row, err := repository.db.Pool.Exec(
-			context.Background(),
+			ctx,
 			query,
 			newStatus,
 			orderID,
+			models.ProcessedStatus,
 		)
-		if row.RowsAffected() == 0 {
-			err = fmt.Errorf("order with id %v not found", orderID)
+		if err == nil && row.RowsAffected() == 0 {
+			err = fmt.Errorf("order with id %v not found or already processed", orderID)
 		}
 		return err
 
 	})
 }
 
-func (repository *OrderRepository) SetAccrual(orderID string, userID int, accrual int32) error {
-	ctx := context.Background()
+func (repository *OrderRepository) SetAccrual(ctx context.Context, orderID string, userID int, accrual int32) (err error) {
+	ctx, span := tracing.Start(ctx, "OrderRepository.SetAccrual")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
 
-	queryOrder := `UPDATE orders SET accrual = $1, status = $2 WHERE id = $3`
+	// Заказ может быть запрошен у системы начислений повторно (admin requeue, перезапуск воркера),
+	// поэтому начисление зачисляется только при первом переходе в PROCESSED
+	queryOrder := `UPDATE orders SET accrual = $1, status = $2, processed_at = now() WHERE id = $3 AND status <> $2`
+	queryExists := `SELECT EXISTS (SELECT 1 FROM orders WHERE id = $1)`
 	balanceRepository := NewBalanceRepository(repository.db)
+	outboxRepository := NewOutboxRepository(repository.db)
 
-	return retry.DoRetry(context.Background(), func() error {
+	return retry.DoRetry(ctx, func(ctx context.Context) error {
 		tx, err := repository.db.Pool.Begin(ctx)
 		if err != nil {
 			return err
@@ -176,7 +301,7 @@ func (repository *OrderRepository) SetAccrual(orderID string, userID int, accrua
 		}()
 
 		row, err := tx.Exec(
-			context.Background(),
+			ctx,
 			queryOrder,
 			accrual,
 			models.ProcessedStatus,
@@ -186,14 +311,230 @@ func (repository *OrderRepository) SetAccrual(orderID string, userID int, accrua
 			return err
 		}
 		if row.RowsAffected() == 0 {
-			err = fmt.Errorf("order with id %v was not installed accrual value", orderID)
+			var exists bool
+			if err = tx.QueryRow(ctx, queryExists, orderID).Scan(&exists); err != nil {
+				return err
+			}
+			if !exists {
+				err = fmt.Errorf("order with id %v was not installed accrual value", orderID)
+				return err
+			}
+			// Заказ уже обработан, баланс не меняется
+			return tx.Rollback(ctx)
+		}
+
+		err = balanceRepository.SetAccrual(ctx, tx, orderID, userID, accrual)
+		if err != nil {
 			return err
 		}
 
-		err = balanceRepository.SetAccrual(tx, orderID, userID, accrual)
+		// Событие публикуется relay-воркером только если транзакция зафиксирована
+		err = outboxRepository.Add(ctx, tx, userID, models.OutboxOrderProcessed, models.OrderProcessedPayload{
+			Order:   orderID,
+			Accrual: float32(accrual) / 100,
+		})
 		if err != nil {
 			return err
 		}
 		return tx.Commit(ctx)
 	})
 }
+
+// GetQueueStats возвращает число необработанных заказов и возраст самого старого из них по статусам
+func (repository *OrderRepository) GetQueueStats(ctx context.Context) (_ []models.OrderQueueStat, err error) {
+	ctx, span := tracing.Start(ctx, "OrderRepository.GetQueueStats")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT status, count(*), EXTRACT(EPOCH FROM now() - min(uploaded_at))::float8 FROM orders
+		WHERE status IN ($1, $2) GROUP BY status`
+
+	rows, err := repository.db.Pool.Query(ctx, query, models.NewStatus, models.ProcessingStatus)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []models.OrderQueueStat{}
+	for rows.Next() {
+		var stat models.OrderQueueStat
+		if err = rows.Scan(&stat.Status, &stat.Count, &stat.OldestAgeSeconds); err != nil {
+			return nil, err
+		}
+		stats = append(stats, stat)
+	}
+	return stats, rows.Err()
+}
+
+// StreamByUserID построчно передает заказы пользователя в fn, не загружая всю выборку в память.
+// Повторные попытки не выполняются, так как часть строк уже может быть передана.
+func (repository *OrderRepository) StreamByUserID(ctx context.Context, userID int, from, to *time.Time, fn func(models.OrderRecord) error) (err error) {
+	ctx, span := tracing.Start(ctx, "OrderRepository.StreamByUserID")
+	defer func() { tracing.End(span, err) }()
+
+	query := `SELECT id,status,accrual,uploaded_at,processed_at FROM orders
+		WHERE user_id = $1 AND ($2::timestamptz IS NULL OR uploaded_at >= $2) AND ($3::timestamptz IS NULL OR uploaded_at < $3)
+		ORDER BY uploaded_at`
+
+	rows, err := repository.db.Pool.Query(ctx, query, userID, from, to)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var record models.OrderRecord
+		var number int64
+		err = rows.Scan(&number, &record.Status, &record.AccrualKopecks, &record.UploadedAt, &record.ProcessedAt)
+		if err != nil {
+			return err
+		}
+		record.Number = strconv.FormatInt(number, 10)
+
+		if err = fn(record); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Requeue возвращает в статус NEW заказы в статусе status, загруженные до uploadedBefore, помечает их
+// для ClaimRequeued и уведомляет сервис через OrderRequeueChannel. Уведомление доставляется только после
+// фиксации транзакции. Обработанные заказы не возвращаются: начисление по ним уже зачислено на баланс.
+func (repository *OrderRepository) Requeue(ctx context.Context, status models.OrderStatus, uploadedBefore time.Time) (_ []models.Order, err error) {
+	ctx, span := tracing.Start(ctx, "OrderRepository.Requeue")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if status == models.ProcessedStatus {
+		return nil, fmt.Errorf("orders in status %s can't be requeued", status)
+	}
+
+	queryUpdate := `UPDATE orders SET status = $1, requeued_at = now() WHERE status = $2 AND uploaded_at < $3
+		RETURNING id, user_id, uploaded_at`
+	// Уведомление только будит реплики, заказы каждая из них забирает через ClaimRequeued
+	queryNotify := `SELECT pg_notify($1, '')`
+
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) ([]models.Order, error) {
+		tx, err := repository.db.Pool.Begin(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback(ctx)
+
+		rows, err := tx.Query(ctx, queryUpdate, models.NewStatus, status, uploadedBefore)
+		if err != nil {
+			return nil, err
+		}
+		orders := []models.Order{}
+		for rows.Next() {
+			var number int64
+			order := models.Order{Status: models.NewStatus}
+			if err = rows.Scan(&number, &order.UserID, &order.UploadedAt); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			order.ID = strconv.FormatInt(number, 10)
+			orders = append(orders, order)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+
+		if len(orders) > 0 {
+			if _, err = tx.Exec(ctx, queryNotify, events.OrderRequeueChannel); err != nil {
+				return nil, err
+			}
+		}
+		return orders, tx.Commit(ctx)
+	})
+}
+
+// ClaimRequeued снимает отметку Requeue не более чем с limit заказов и возвращает их. Заказы, которые
+// забирает другая реплика, пропускаются, поэтому каждый возвращенный в обработку заказ попадает
+// в очередь только одной реплики.
+func (repository *OrderRepository) ClaimRequeued(ctx context.Context, limit int) (_ []models.Order, err error) {
+	ctx, span := tracing.Start(ctx, "OrderRepository.ClaimRequeued")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE orders SET requeued_at = NULL WHERE id IN (
+			SELECT id FROM orders WHERE requeued_at IS NOT NULL ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED
+		) RETURNING id, user_id, status`
+
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) ([]models.Order, error) {
+		rows, err := repository.db.Pool.Query(ctx, query, limit)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		orders := []models.Order{}
+		for rows.Next() {
+			var number int64
+			var order models.Order
+			if err = rows.Scan(&number, &order.UserID, &order.Status); err != nil {
+				return nil, err
+			}
+			order.ID = strconv.FormatInt(number, 10)
+			orders = append(orders, order)
+		}
+		return orders, rows.Err()
+	})
+}
+
+// ForceStatus устанавливает статус заказа вручную и записывает изменение в журнал в той же транзакции.
+// Возвращает предыдущий статус. Статус обработанного заказа не меняется: его начисление уже на балансе.
+// Перевести заказ в PROCESSED нельзя: в этот статус заказ попадает только через SetAccrual вместе с
+// начислением, иначе оно никогда не будет зачислено.
+func (repository *OrderRepository) ForceStatus(ctx context.Context, orderID string, status models.OrderStatus, audit models.AuditEntry) (_ models.OrderStatus, err error) {
+	ctx, span := tracing.Start(ctx, "OrderRepository.ForceStatus")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	if status == models.ProcessedStatus {
+		return "", fmt.Errorf("orders can't be forced to %s, the status is set with the accrual", status)
+	}
+
+	querySelect := `SELECT status FROM orders WHERE id = $1 FOR UPDATE`
+	queryUpdate := `UPDATE orders SET status = $1 WHERE id = $2`
+	auditRepository := NewAuditRepository(repository.db)
+
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) (models.OrderStatus, error) {
+		tx, err := repository.db.Pool.Begin(ctx)
+		if err != nil {
+			return "", err
+		}
+		defer tx.Rollback(ctx)
+
+		var previous models.OrderStatus
+		err = tx.QueryRow(ctx, querySelect, orderID).Scan(&previous)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("order with id %v not found", orderID)
+		}
+		if err != nil {
+			return "", err
+		}
+		if previous == models.ProcessedStatus {
+			return previous, fmt.Errorf("order with id %v is already processed, its accrual is credited to the balance", orderID)
+		}
+
+		if _, err = tx.Exec(ctx, queryUpdate, status, orderID); err != nil {
+			return previous, err
+		}
+
+		audit.Action = models.AuditOrderStatusForced
+		audit.Target = orderID
+		err = auditRepository.Add(ctx, tx, audit, models.OrderStatusChange{From: previous, To: status})
+		if err != nil {
+			return previous, err
+		}
+		return previous, tx.Commit(ctx)
+	})
+}
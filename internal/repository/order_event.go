@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/retry"
+	"github.com/Bessima/diplom-gomarket/internal/tracing"
+	"strconv"
+)
+
+type OrderEventRepository struct {
+	db *db.DB
+}
+
+type OrderEventStorageRepositoryI interface {
+	GetListAfterID(ctx context.Context, userID int, afterID int64, limit int) ([]models.OrderEvent, error)
+}
+
+func NewOrderEventRepository(dbObj *db.DB) *OrderEventRepository {
+	return &OrderEventRepository{db: dbObj}
+}
+
+// GetListAfterID возвращает события заказов пользователя с id больше afterID в порядке возникновения
+func (repository *OrderEventRepository) GetListAfterID(ctx context.Context, userID int, afterID int64, limit int) (_ []models.OrderEvent, err error) {
+	ctx, span := tracing.Start(ctx, "OrderEventRepository.GetListAfterID")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT id,order_id,user_id,status,accrual,created_at FROM order_events WHERE user_id = $1 AND id > $2 ORDER BY id LIMIT $3`
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) ([]models.OrderEvent, error) {
+		rows, err := repository.db.Pool.Query(
+			ctx,
+			query,
+			userID,
+			afterID,
+			limit,
+		)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		events := []models.OrderEvent{}
+		for rows.Next() {
+			var event models.OrderEvent
+			var orderID int64
+			var accrualInKopecks *int64
+			err = rows.Scan(&event.ID, &orderID, &event.UserID, &event.Status, &accrualInKopecks, &event.CreatedAt)
+			if err != nil {
+				return nil, err
+			}
+
+			event.Order = strconv.FormatInt(orderID, 10)
+			if accrualInKopecks != nil {
+				event.SetAccrualAsFloat(*accrualInKopecks)
+			}
+			events = append(events, event)
+		}
+
+		err = rows.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		return events, err
+	})
+}
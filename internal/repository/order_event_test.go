@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderEventRepository_GetListAfterID_Success(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewOrderEventRepository(dbObj)
+
+	userID := 1
+	accrual := int64(50000)
+	now := time.Now()
+
+	rows := pgxmock.NewRows([]string{"id", "order_id", "user_id", "status", "accrual", "created_at"}).
+		AddRow(int64(11), int64(12345678903), userID, models.ProcessingStatus, nil, now).
+		AddRow(int64(12), int64(12345678903), userID, models.ProcessedStatus, &accrual, now)
+
+	mock.ExpectQuery("SELECT id,order_id,user_id,status,accrual,created_at FROM order_events").
+		WithArgs(userID, int64(10), 100).
+		WillReturnRows(rows)
+
+	// Act
+	events, err := repo.GetListAfterID(context.Background(), userID, 10, 100)
+
+	// Assert
+	assert.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, int64(11), events[0].ID)
+	assert.Equal(t, "12345678903", events[0].Order)
+	assert.Nil(t, events[0].Accrual)
+	require.NotNil(t, events[1].Accrual)
+	assert.Equal(t, float32(500), *events[1].Accrual)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderEventRepository_GetListAfterID_QueryError(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewOrderEventRepository(dbObj)
+
+	expectedError := errors.New("query error")
+
+	mock.ExpectQuery("SELECT id,order_id,user_id,status,accrual,created_at FROM order_events").
+		WithArgs(1, int64(0), 100).
+		WillReturnError(expectedError)
+
+	// Act
+	events, err := repo.GetListAfterID(context.Background(), 1, 0, 100)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Nil(t, events)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
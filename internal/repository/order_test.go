@@ -1,7 +1,10 @@
 package repository
 
 import (
+	"context"
 	"errors"
+	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/Bessima/diplom-gomarket/internal/events"
 	"github.com/Bessima/diplom-gomarket/internal/models"
 	"github.com/jackc/pgx/v5"
 	"github.com/pashagolub/pgxmock/v3"
@@ -30,7 +33,7 @@ func TestOrderRepository_Create_Success(t *testing.T) {
 		WillReturnResult(pgxmock.NewResult("INSERT", 1))
 
 	// Act
-	err = repo.Create(userID, orderID)
+	err = repo.Create(context.Background(), userID, orderID)
 
 	// Assert
 	assert.NoError(t, err)
@@ -55,7 +58,7 @@ func TestOrderRepository_Create_AlreadyExists(t *testing.T) {
 		WillReturnResult(pgxmock.NewResult("INSERT", 0))
 
 	// Act
-	err = repo.Create(userID, orderID)
+	err = repo.Create(context.Background(), userID, orderID)
 
 	// Assert
 	assert.Error(t, err)
@@ -81,7 +84,7 @@ func TestOrderRepository_Create_DatabaseError(t *testing.T) {
 		WillReturnError(expectedError)
 
 	// Act
-	err = repo.Create(userID, orderID)
+	err = repo.Create(context.Background(), userID, orderID)
 
 	// Assert
 	assert.Error(t, err)
@@ -113,7 +116,7 @@ func TestOrderRepository_GetByID_Success(t *testing.T) {
 		WillReturnRows(rows)
 
 	// Act
-	order, err := repo.GetByID(orderID)
+	order, err := repo.GetByID(context.Background(), orderID)
 
 	// Assert
 	assert.NoError(t, err)
@@ -142,7 +145,7 @@ func TestOrderRepository_GetByID_NotFound(t *testing.T) {
 		WillReturnError(pgx.ErrNoRows)
 
 	// Act
-	order, err := repo.GetByID(orderID)
+	order, err := repo.GetByID(context.Background(), orderID)
 
 	// Assert
 	assert.Error(t, err)
@@ -178,7 +181,7 @@ func TestOrderRepository_GetListByUserID_Success(t *testing.T) {
 		WillReturnRows(rows)
 
 	// Act
-	orders, err := repo.GetListByUserID(userID)
+	orders, err := repo.GetListByUserID(context.Background(), userID)
 
 	// Assert
 	assert.NoError(t, err)
@@ -219,7 +222,7 @@ func TestOrderRepository_GetListByUserID_Empty(t *testing.T) {
 		WillReturnRows(rows)
 
 	// Act
-	orders, err := repo.GetListByUserID(userID)
+	orders, err := repo.GetListByUserID(context.Background(), userID)
 
 	// Assert
 	assert.NoError(t, err)
@@ -227,6 +230,51 @@ func TestOrderRepository_GetListByUserID_Empty(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestOrderRepository_GetListByUserID_ReplicaReadYourWrites(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+	replicaMock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer replicaMock.Close()
+
+	dbObj := NewTestDB(mock)
+	dbObj.SetReplica(replicaMock, 5*time.Second)
+	repo := NewOrderRepository(dbObj)
+	ctx := db.WithReplicaRead(context.Background())
+
+	userID := 1
+	columns := []string{"id", "user_id", "accrual", "status", "uploaded_at"}
+
+	replicaMock.ExpectQuery("pg_last_wal_replay_lsn").
+		WillReturnRows(pgxmock.NewRows([]string{"lag"}).AddRow(0.0))
+	replicaMock.ExpectQuery(expextedSQLRequest).
+		WithArgs(userID).
+		WillReturnRows(pgxmock.NewRows(columns))
+	mock.ExpectExec("INSERT INTO orders").
+		WithArgs(12345, userID, models.NewStatus).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectQuery(expextedSQLRequest).
+		WithArgs(userID).
+		WillReturnRows(pgxmock.NewRows(columns).AddRow("12345", userID, nil, models.NewStatus, time.Now()))
+
+	// Act
+	before, errBefore := repo.GetListByUserID(ctx, userID)
+	errCreate := repo.Create(ctx, userID, 12345)
+	after, errAfter := repo.GetListByUserID(ctx, userID)
+
+	// Assert
+	assert.NoError(t, errBefore)
+	assert.Empty(t, before)
+	assert.NoError(t, errCreate)
+	assert.NoError(t, errAfter)
+	require.Len(t, after, 1)
+	assert.Equal(t, "12345", after[0].ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.NoError(t, replicaMock.ExpectationsWereMet())
+}
+
 func TestOrderRepository_GetListByUserID_WithNullAccrual(t *testing.T) {
 	// Arrange
 	mock, err := pgxmock.NewPool()
@@ -246,7 +294,7 @@ func TestOrderRepository_GetListByUserID_WithNullAccrual(t *testing.T) {
 		WillReturnRows(rows)
 
 	// Act
-	orders, err := repo.GetListByUserID(userID)
+	orders, err := repo.GetListByUserID(context.Background(), userID)
 
 	// Assert
 	assert.NoError(t, err)
@@ -274,7 +322,7 @@ func TestOrderRepository_GetListByUserID_QueryError(t *testing.T) {
 		WillReturnError(expectedError)
 
 	// Act
-	orders, err := repo.GetListByUserID(userID)
+	orders, err := repo.GetListByUserID(context.Background(), userID)
 
 	// Assert
 	assert.Error(t, err)
@@ -299,21 +347,24 @@ func TestOrderRepository_SetListForProcessing_Success(t *testing.T) {
 		WithArgs(models.NewStatus, models.ProcessingStatus).
 		WillReturnRows(rows)
 
-	ch := make(chan models.Order, 2)
-	defer close(ch)
+	var orders []models.Order
+	enqueue := func(order models.Order) bool {
+		orders = append(orders, order)
+		return true
+	}
 
 	// Act
-	err = repo.SetListForProcessing(ch)
+	err = repo.SetListForProcessing(context.Background(), enqueue)
 
 	// Assert
 	assert.NoError(t, err)
-	assert.Equal(t, 2, len(ch))
+	require.Len(t, orders, 2)
 
-	order1 := <-ch
+	order1 := orders[0]
 	assert.Equal(t, "12345", order1.ID)
 	assert.Equal(t, models.NewStatus, order1.Status)
 
-	order2 := <-ch
+	order2 := orders[1]
 	assert.Equal(t, "67890", order2.ID)
 	assert.Equal(t, models.ProcessingStatus, order2.Status)
 
@@ -335,17 +386,46 @@ func TestOrderRepository_SetListForProcessing_QueryError(t *testing.T) {
 		WithArgs(models.NewStatus, models.ProcessingStatus).
 		WillReturnError(expectedError)
 
-	ch := make(chan models.Order, 2)
-	defer close(ch)
-
 	// Act
-	err = repo.SetListForProcessing(ch)
+	err = repo.SetListForProcessing(context.Background(), func(models.Order) bool { return true })
 
 	// Assert
 	assert.Error(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestOrderRepository_SetListForProcessing_StopsWhenQueueClosed(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewOrderRepository(dbObj)
+
+	rows := pgxmock.NewRows([]string{"id", "user_id", "accrual", "status"}).
+		AddRow("12345", 1, nil, models.NewStatus).
+		AddRow("67890", 2, nil, models.ProcessingStatus)
+
+	mock.ExpectQuery("SELECT id,user_id,accrual,status FROM orders WHERE status IN").
+		WithArgs(models.NewStatus, models.ProcessingStatus).
+		WillReturnRows(rows)
+
+	calls := 0
+	enqueue := func(models.Order) bool {
+		calls++
+		return false
+	}
+
+	// Act
+	err = repo.SetListForProcessing(context.Background(), enqueue)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestOrderRepository_UpdateStatus_Success(t *testing.T) {
 	// Arrange
 	mock, err := pgxmock.NewPool()
@@ -359,11 +439,11 @@ func TestOrderRepository_UpdateStatus_Success(t *testing.T) {
 	newStatus := models.ProcessedStatus
 
 	mock.ExpectExec("UPDATE orders SET status").
-		WithArgs(newStatus, orderID).
+		WithArgs(newStatus, orderID, models.ProcessedStatus).
 		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
 
 	// Act
-	err = repo.UpdateStatus(orderID, newStatus)
+	err = repo.UpdateStatus(context.Background(), orderID, newStatus)
 
 	// Assert
 	assert.NoError(t, err)
@@ -383,11 +463,11 @@ func TestOrderRepository_UpdateStatus_OrderNotFound(t *testing.T) {
 	newStatus := models.ProcessedStatus
 
 	mock.ExpectExec("UPDATE orders SET status").
-		WithArgs(newStatus, orderID).
+		WithArgs(newStatus, orderID, models.ProcessedStatus).
 		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
 
 	// Act
-	err = repo.UpdateStatus(orderID, newStatus)
+	err = repo.UpdateStatus(context.Background(), orderID, newStatus)
 
 	// Assert
 	assert.Error(t, err)
@@ -409,11 +489,11 @@ func TestOrderRepository_UpdateStatus_DatabaseError(t *testing.T) {
 	expectedError := errors.New("database error")
 
 	mock.ExpectExec("UPDATE orders SET status").
-		WithArgs(newStatus, orderID).
+		WithArgs(newStatus, orderID, models.ProcessedStatus).
 		WillReturnError(expectedError)
 
 	// Act
-	err = repo.UpdateStatus(orderID, newStatus)
+	err = repo.UpdateStatus(context.Background(), orderID, newStatus)
 
 	// Assert
 	assert.Error(t, err)
@@ -446,11 +526,16 @@ func TestOrderRepository_SetAccrual_Success(t *testing.T) {
 		WithArgs(userID, accrual).
 		WillReturnResult(pgxmock.NewResult("INSERT", 1))
 
+	// Ожидаем запись события в outbox в той же транзакции
+	mock.ExpectExec("INSERT INTO outbox").
+		WithArgs(userID, models.OutboxOrderProcessed, []byte(`{"order":"12345","accrual":500}`)).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
 	// Ожидаем коммит транзакции
 	mock.ExpectCommit()
 
 	// Act
-	err = repo.SetAccrual(orderID, userID, accrual)
+	err = repo.SetAccrual(context.Background(), orderID, userID, accrual)
 
 	// Assert
 	assert.NoError(t, err)
@@ -476,11 +561,14 @@ func TestOrderRepository_SetAccrual_OrderNotFound(t *testing.T) {
 	mock.ExpectExec("UPDATE orders SET accrual").
 		WithArgs(accrual, models.ProcessedStatus, orderID).
 		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	mock.ExpectQuery("SELECT EXISTS").
+		WithArgs(orderID).
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(false))
 
 	mock.ExpectRollback()
 
 	// Act
-	err = repo.SetAccrual(orderID, userID, accrual)
+	err = repo.SetAccrual(context.Background(), orderID, userID, accrual)
 
 	// Assert
 	assert.Error(t, err)
@@ -488,6 +576,51 @@ func TestOrderRepository_SetAccrual_OrderNotFound(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestOrderRepository_SetAccrual_Twice(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewOrderRepository(NewTestDB(mock))
+
+	orderID := "12345"
+	userID := 1
+	accrual := int32(50000)
+
+	// Первый вызов переводит заказ в PROCESSED и зачисляет начисление
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE orders SET accrual .* AND status <> \\$2").
+		WithArgs(accrual, models.ProcessedStatus, orderID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("INSERT INTO balance").
+		WithArgs(userID, accrual).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec("INSERT INTO outbox").
+		WithArgs(userID, models.OutboxOrderProcessed, []byte(`{"order":"12345","accrual":500}`)).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+
+	// Повторный вызов не находит необработанного заказа: баланс и outbox не меняются
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE orders SET accrual").
+		WithArgs(accrual, models.ProcessedStatus, orderID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	mock.ExpectQuery("SELECT EXISTS").
+		WithArgs(orderID).
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	// Act
+	errFirst := repo.SetAccrual(context.Background(), orderID, userID, accrual)
+	errSecond := repo.SetAccrual(context.Background(), orderID, userID, accrual)
+
+	// Assert
+	assert.NoError(t, errFirst)
+	assert.NoError(t, errSecond)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestOrderRepository_SetAccrual_BalanceUpdateError(t *testing.T) {
 	// Arrange
 	mock, err := pgxmock.NewPool()
@@ -515,7 +648,41 @@ func TestOrderRepository_SetAccrual_BalanceUpdateError(t *testing.T) {
 	mock.ExpectRollback()
 
 	// Act
-	err = repo.SetAccrual(orderID, userID, accrual)
+	err = repo.SetAccrual(context.Background(), orderID, userID, accrual)
+
+	// Assert
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_SetAccrual_OutboxError(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewOrderRepository(dbObj)
+
+	orderID := "12345"
+	userID := 1
+	accrual := int32(50000)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE orders SET accrual").
+		WithArgs(accrual, models.ProcessedStatus, orderID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("INSERT INTO balance").
+		WithArgs(userID, accrual).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	// Без записи события начисление не фиксируется
+	mock.ExpectExec("INSERT INTO outbox").
+		WithArgs(userID, models.OutboxOrderProcessed, pgxmock.AnyArg()).
+		WillReturnError(errors.New("outbox insert error"))
+	mock.ExpectRollback()
+
+	// Act
+	err = repo.SetAccrual(context.Background(), orderID, userID, accrual)
 
 	// Assert
 	assert.Error(t, err)
@@ -539,7 +706,7 @@ func TestOrderRepository_SetAccrual_TransactionBeginError(t *testing.T) {
 	mock.ExpectBegin().WillReturnError(expectedError)
 
 	// Act
-	err = repo.SetAccrual(orderID, userID, accrual)
+	err = repo.SetAccrual(context.Background(), orderID, userID, accrual)
 
 	// Assert
 	assert.Error(t, err)
@@ -585,7 +752,7 @@ func TestOrderRepository_Create_WithDifferentOrderIDs(t *testing.T) {
 				WillReturnResult(pgxmock.NewResult("INSERT", tc.affected))
 
 			// Act
-			err = repo.Create(tc.userID, tc.orderID)
+			err = repo.Create(context.Background(), tc.userID, tc.orderID)
 
 			// Assert
 			if tc.wantErr {
@@ -620,11 +787,11 @@ func TestOrderRepository_UpdateStatus_AllStatuses(t *testing.T) {
 			orderID := "12345"
 
 			mock.ExpectExec("UPDATE orders SET status").
-				WithArgs(status, orderID).
+				WithArgs(status, orderID, models.ProcessedStatus).
 				WillReturnResult(pgxmock.NewResult("UPDATE", 1))
 
 			// Act
-			err = repo.UpdateStatus(orderID, status)
+			err = repo.UpdateStatus(context.Background(), orderID, status)
 
 			// Assert
 			assert.NoError(t, err)
@@ -632,3 +799,399 @@ func TestOrderRepository_UpdateStatus_AllStatuses(t *testing.T) {
 		})
 	}
 }
+
+func TestOrderRepository_StreamByUserID_Success(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewOrderRepository(dbObj)
+
+	userID := 1
+	accrual := int64(72998)
+	uploadedAt := time.Now()
+
+	rows := pgxmock.NewRows([]string{"id", "status", "accrual", "uploaded_at", "processed_at"}).
+		AddRow(int64(9278923470), models.ProcessedStatus, &accrual, uploadedAt, &uploadedAt).
+		AddRow(int64(346436439), models.NewStatus, nil, uploadedAt, nil)
+
+	mock.ExpectQuery("SELECT id,status,accrual,uploaded_at,processed_at FROM orders").
+		WithArgs(userID, pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnRows(rows)
+
+	// Act
+	var records []models.OrderRecord
+	err = repo.StreamByUserID(context.Background(), userID, nil, nil, func(record models.OrderRecord) error {
+		records = append(records, record)
+		return nil
+	})
+
+	// Assert
+	assert.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "9278923470", records[0].Number)
+	require.NotNil(t, records[0].AccrualKopecks)
+	assert.Equal(t, accrual, *records[0].AccrualKopecks)
+	assert.Equal(t, "346436439", records[1].Number)
+	assert.Nil(t, records[1].AccrualKopecks)
+	assert.Nil(t, records[1].ProcessedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_StreamByUserID_CallbackError(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewOrderRepository(dbObj)
+
+	userID := 1
+	expectedError := errors.New("client went away")
+
+	rows := pgxmock.NewRows([]string{"id", "status", "accrual", "uploaded_at", "processed_at"}).
+		AddRow(int64(9278923470), models.NewStatus, nil, time.Now(), nil).
+		AddRow(int64(346436439), models.NewStatus, nil, time.Now(), nil)
+
+	mock.ExpectQuery("SELECT id,status,accrual,uploaded_at,processed_at FROM orders").
+		WithArgs(userID, pgxmock.AnyArg(), pgxmock.AnyArg()).
+		WillReturnRows(rows)
+
+	// Act
+	calls := 0
+	err = repo.StreamByUserID(context.Background(), userID, nil, nil, func(record models.OrderRecord) error {
+		calls++
+		return expectedError
+	})
+
+	// Assert
+	assert.Equal(t, expectedError, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestOrderRepository_GetPageByUserID_WithFilters(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewOrderRepository(dbObj)
+
+	userID := 1
+	uploadedFrom := time.Now().Add(-24 * time.Hour)
+	cursor := &models.ListCursor{At: time.Now(), ID: 12345678903}
+	filter := OrderListFilter{
+		Statuses:     []models.OrderStatus{models.NewStatus, models.ProcessedStatus},
+		UploadedFrom: &uploadedFrom,
+		Sort:         SortAsc,
+		Cursor:       cursor,
+		Limit:        11,
+	}
+
+	rows := pgxmock.NewRows([]string{"id", "user_id", "accrual", "status", "uploaded_at"}).
+		AddRow("9278923470", userID, nil, models.NewStatus, time.Now())
+
+	mock.ExpectQuery("SELECT id,user_id,accrual,status,uploaded_at FROM orders WHERE user_id = $1 AND status::text = ANY($2) AND uploaded_at >= $3 AND (uploaded_at, id) > ($4, $5) ORDER BY uploaded_at ASC, id ASC LIMIT $6").
+		WithArgs(userID, []string{"NEW", "PROCESSED"}, uploadedFrom, cursor.At, cursor.ID, 11).
+		WillReturnRows(rows)
+
+	// Act
+	orders, err := repo.GetPageByUserID(context.Background(), userID, filter)
+
+	// Assert
+	assert.NoError(t, err)
+	require.Len(t, orders, 1)
+	assert.Equal(t, "9278923470", orders[0].ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_GetPageByUserID_Defaults(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewOrderRepository(dbObj)
+
+	userID := 1
+
+	mock.ExpectQuery("SELECT id,user_id,accrual,status,uploaded_at FROM orders WHERE user_id = $1 ORDER BY uploaded_at DESC, id DESC").
+		WithArgs(userID).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "user_id", "accrual", "status", "uploaded_at"}))
+
+	// Act
+	orders, err := repo.GetPageByUserID(context.Background(), userID, OrderListFilter{})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Empty(t, orders)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_CreateBatch_Success(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewOrderRepository(dbObj)
+
+	userID := 1
+	orderIDs := []int64{12345678903, 9278923470, 346436439}
+
+	rows := pgxmock.NewRows([]string{"id", "inserted", "own"}).
+		AddRow(int64(12345678903), true, false).
+		AddRow(int64(9278923470), false, true).
+		AddRow(int64(346436439), false, false)
+
+	mock.ExpectQuery("WITH input AS").
+		WithArgs(userID, orderIDs, models.NewStatus).
+		WillReturnRows(rows)
+
+	// Act
+	statuses, err := repo.CreateBatch(context.Background(), userID, orderIDs)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, map[int64]models.BatchOrderStatus{
+		12345678903: models.BatchAccepted,
+		9278923470:  models.BatchDuplicateOwn,
+		346436439:   models.BatchConflict,
+	}, statuses)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_CreateBatch_DatabaseError(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewOrderRepository(dbObj)
+
+	userID := 1
+	orderIDs := []int64{12345678903}
+	expectedError := errors.New("database error")
+
+	mock.ExpectQuery("WITH input AS").
+		WithArgs(userID, orderIDs, models.NewStatus).
+		WillReturnError(expectedError)
+
+	// Act
+	statuses, err := repo.CreateBatch(context.Background(), userID, orderIDs)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Nil(t, statuses)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_Requeue_Success(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewOrderRepository(dbObj)
+
+	uploadedBefore := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	uploadedAt := uploadedBefore.Add(-time.Hour)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE orders SET status = \\$1, requeued_at = now\\(\\)").
+		WithArgs(models.NewStatus, models.ProcessingStatus, uploadedBefore).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "user_id", "uploaded_at"}).
+			AddRow(int64(12345678903), 1, uploadedAt).
+			AddRow(int64(79927398713), 2, uploadedAt))
+	// Уведомление для сервиса отправляется в той же транзакции
+	mock.ExpectExec("SELECT pg_notify").
+		WithArgs(events.OrderRequeueChannel).
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	mock.ExpectCommit()
+
+	// Act
+	orders, err := repo.Requeue(context.Background(), models.ProcessingStatus, uploadedBefore)
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, orders, 2)
+	assert.Equal(t, "12345678903", orders[0].ID)
+	assert.Equal(t, 1, orders[0].UserID)
+	assert.Equal(t, models.NewStatus, orders[0].Status)
+	assert.Equal(t, uploadedAt, orders[0].UploadedAt)
+	assert.Equal(t, "79927398713", orders[1].ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_Requeue_NothingToRequeue(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewOrderRepository(dbObj)
+
+	uploadedBefore := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE orders SET status").
+		WithArgs(models.NewStatus, models.NewStatus, uploadedBefore).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "user_id", "uploaded_at"}))
+	mock.ExpectCommit()
+
+	// Act
+	orders, err := repo.Requeue(context.Background(), models.NewStatus, uploadedBefore)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Empty(t, orders)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_Requeue_ProcessedRejected(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewOrderRepository(NewTestDB(mock))
+
+	// Act
+	orders, err := repo.Requeue(context.Background(), models.ProcessedStatus, time.Now())
+
+	// Assert
+	require.Error(t, err)
+	assert.Nil(t, orders)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_ClaimRequeued_Success(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewOrderRepository(NewTestDB(mock))
+
+	// Заказы, которые в этот момент забирает другая реплика, пропускаются
+	mock.ExpectQuery("UPDATE orders SET requeued_at = NULL .* FOR UPDATE SKIP LOCKED").
+		WithArgs(100).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "user_id", "status"}).
+			AddRow(int64(12345678903), 1, models.NewStatus))
+
+	// Act
+	orders, err := repo.ClaimRequeued(context.Background(), 100)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, []models.Order{{ID: "12345678903", UserID: 1, Status: models.NewStatus}}, orders)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_ForceStatus_Success(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewOrderRepository(dbObj)
+
+	orderID := "12345678903"
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT status FROM orders").
+		WithArgs(orderID).
+		WillReturnRows(pgxmock.NewRows([]string{"status"}).AddRow(models.ProcessingStatus))
+	mock.ExpectExec("UPDATE orders SET status").
+		WithArgs(models.InvalidStatus, orderID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	// Запись журнала в той же транзакции
+	mock.ExpectExec("INSERT INTO admin_audit").
+		WithArgs(models.AuditOrderStatusForced, orderID, "ops", "stuck in accrual", []byte(`{"from":"PROCESSING","to":"INVALID"}`)).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+
+	// Act
+	previous, err := repo.ForceStatus(context.Background(), orderID, models.InvalidStatus, models.AuditEntry{
+		Actor:  "ops",
+		Reason: "stuck in accrual",
+	})
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, models.ProcessingStatus, previous)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_ForceStatus_OrderNotFound(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewOrderRepository(NewTestDB(mock))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT status FROM orders").
+		WithArgs("99999").
+		WillReturnError(pgx.ErrNoRows)
+	mock.ExpectRollback()
+
+	// Act
+	_, err = repo.ForceStatus(context.Background(), "99999", models.InvalidStatus, models.AuditEntry{Actor: "ops", Reason: "test"})
+
+	// Assert
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not found")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_ForceStatus_ProcessedTargetRejected(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewOrderRepository(NewTestDB(mock))
+
+	// Act
+	// Без начисления заказ в PROCESSED уже никогда не получил бы его: SetAccrual пропускает обработанные заказы
+	_, err = repo.ForceStatus(context.Background(), "12345678903", models.ProcessedStatus, models.AuditEntry{Actor: "ops", Reason: "test"})
+
+	// Assert
+	require.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOrderRepository_ForceStatus_ProcessedOrderIsNotChanged(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewOrderRepository(NewTestDB(mock))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT status FROM orders").
+		WithArgs("12345678903").
+		WillReturnRows(pgxmock.NewRows([]string{"status"}).AddRow(models.ProcessedStatus))
+	mock.ExpectRollback()
+
+	// Act
+	_, err = repo.ForceStatus(context.Background(), "12345678903", models.NewStatus, models.AuditEntry{Actor: "ops", Reason: "test"})
+
+	// Assert
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already processed")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/retry"
+	"github.com/Bessima/diplom-gomarket/internal/tracing"
+	"github.com/jackc/pgx/v5"
+	"slices"
+	"time"
+)
+
+// outboxClaimLockID ключ advisory-блокировки на время захвата пачки: захваты реплик выполняются
+// по очереди, поэтому каждая видит захваты остальных и порядок событий пользователя не нарушается
+const outboxClaimLockID = 7_339_001
+
+type OutboxRepository struct {
+	db *db.DB
+}
+
+type OutboxRepositoryI interface {
+	ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error)
+	MarkPublished(ctx context.Context, ids []int64) error
+	ReleaseClaims(ctx context.Context, ids []int64, retryAfter time.Duration) error
+	DeletePublished(ctx context.Context, olderThan time.Time) (int64, error)
+}
+
+func NewOutboxRepository(dbObj *db.DB) *OutboxRepository {
+	return &OutboxRepository{db: dbObj}
+}
+
+// Add записывает событие в outbox внутри транзакции, изменяющей данные
+func (repository *OutboxRepository) Add(ctx context.Context, tx pgx.Tx, userID int, eventType string, payload any) (err error) {
+	ctx, span := tracing.Start(ctx, "OutboxRepository.Add")
+	defer func() { tracing.End(span, err) }()
+
+	query := `INSERT INTO outbox (user_id, event_type, payload) VALUES ($1, $2, $3)`
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, query, userID, eventType, data)
+	return err
+}
+
+// ClaimPending захватывает на lease до limit неопубликованных событий в порядке записи. Событие не
+// захватывается, пока более раннее событие того же пользователя захвачено другой репликой или ждет
+// повтора после неудачи. Транзакция короткая: публикация идет уже без нее, а результат записывают
+// MarkPublished и ReleaseClaims. Если захват держит другая реплика, возвращает пустой список.
+func (repository *OutboxRepository) ClaimPending(ctx context.Context, limit int, lease time.Duration) (_ []models.OutboxEvent, err error) {
+	ctx, span := tracing.Start(ctx, "OutboxRepository.ClaimPending")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	queryClaim := `WITH claimable AS (
+			SELECT o.id FROM outbox o
+			WHERE o.published_at IS NULL AND (o.claimed_until IS NULL OR o.claimed_until < now())
+				AND NOT EXISTS (
+					SELECT 1 FROM outbox earlier
+					WHERE earlier.user_id = o.user_id AND earlier.id < o.id
+						AND earlier.published_at IS NULL AND earlier.claimed_until >= now()
+				)
+			ORDER BY o.id LIMIT $1
+		)
+		UPDATE outbox SET claimed_until = now() + make_interval(secs => $2)
+		FROM claimable WHERE outbox.id = claimable.id
+		RETURNING outbox.id, outbox.user_id, outbox.event_type, outbox.payload, outbox.created_at`
+
+	tx, err := repository.db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var locked bool
+	err = tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock($1)`, outboxClaimLockID).Scan(&locked)
+	if err != nil {
+		return nil, err
+	}
+	if !locked {
+		return nil, nil
+	}
+
+	rows, err := tx.Query(ctx, queryClaim, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	events := []models.OutboxEvent{}
+	for rows.Next() {
+		var event models.OutboxEvent
+		err = rows.Scan(&event.ID, &event.UserID, &event.EventType, &event.Payload, &event.CreatedAt)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	// UPDATE ... RETURNING не сохраняет порядок подзапроса
+	slices.SortFunc(events, func(a, b models.OutboxEvent) int { return cmp.Compare(a.ID, b.ID) })
+	return events, nil
+}
+
+// MarkPublished отмечает события опубликованными
+func (repository *OutboxRepository) MarkPublished(ctx context.Context, ids []int64) (err error) {
+	ctx, span := tracing.Start(ctx, "OutboxRepository.MarkPublished")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE outbox SET published_at = now(), claimed_until = NULL WHERE id = ANY($1)`
+	return retry.DoRetry(ctx, func(ctx context.Context) error {
+		_, err := repository.db.Pool.Exec(ctx, query, ids)
+		return err
+	})
+}
+
+// ReleaseClaims возвращает неопубликованные события: их можно будет захватить снова через retryAfter
+func (repository *OutboxRepository) ReleaseClaims(ctx context.Context, ids []int64, retryAfter time.Duration) (err error) {
+	ctx, span := tracing.Start(ctx, "OutboxRepository.ReleaseClaims")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE outbox SET claimed_until = now() + make_interval(secs => $2)
+		WHERE id = ANY($1) AND published_at IS NULL`
+	return retry.DoRetry(ctx, func(ctx context.Context) error {
+		_, err := repository.db.Pool.Exec(ctx, query, ids, retryAfter.Seconds())
+		return err
+	})
+}
+
+// DeletePublished удаляет события, опубликованные раньше olderThan
+func (repository *OutboxRepository) DeletePublished(ctx context.Context, olderThan time.Time) (_ int64, err error) {
+	ctx, span := tracing.Start(ctx, "OutboxRepository.DeletePublished")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `DELETE FROM outbox WHERE published_at IS NOT NULL AND published_at < $1`
+
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) (int64, error) {
+		result, err := repository.db.Pool.Exec(ctx, query, olderThan)
+		if err != nil {
+			return 0, err
+		}
+		return result.RowsAffected(), nil
+	})
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutboxRepository_ClaimPending_Success(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewOutboxRepository(dbObj)
+
+	createdAt := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT pg_try_advisory_xact_lock").
+		WithArgs(outboxClaimLockID).
+		WillReturnRows(pgxmock.NewRows([]string{"locked"}).AddRow(true))
+	mock.ExpectQuery("UPDATE outbox SET claimed_until").
+		WithArgs(10, float64(60)).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "user_id", "event_type", "payload", "created_at"}).
+			AddRow(int64(2), 2, models.OutboxOrderProcessed, json.RawMessage(`{}`), createdAt).
+			AddRow(int64(1), 1, models.OutboxOrderProcessed, json.RawMessage(`{}`), createdAt))
+	mock.ExpectCommit()
+	mock.ExpectRollback()
+
+	// Act
+	events, err := repo.ClaimPending(context.Background(), 10, time.Minute)
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, int64(1), events[0].ID)
+	assert.Equal(t, int64(2), events[1].ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOutboxRepository_ClaimPending_LockedByAnotherRelay(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewOutboxRepository(dbObj)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT pg_try_advisory_xact_lock").
+		WithArgs(outboxClaimLockID).
+		WillReturnRows(pgxmock.NewRows([]string{"locked"}).AddRow(false))
+	mock.ExpectRollback()
+
+	// Act
+	events, err := repo.ClaimPending(context.Background(), 10, time.Minute)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOutboxRepository_MarkPublishedAndReleaseClaims(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewOutboxRepository(dbObj)
+
+	mock.ExpectExec("UPDATE outbox SET published_at").
+		WithArgs([]int64{1, 2}).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 2))
+	mock.ExpectExec("UPDATE outbox SET claimed_until").
+		WithArgs([]int64{3}, float64(10)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	// Act
+	errPublished := repo.MarkPublished(context.Background(), []int64{1, 2})
+	errReleased := repo.ReleaseClaims(context.Background(), []int64{3}, 10*time.Second)
+
+	// Assert
+	assert.NoError(t, errPublished)
+	assert.NoError(t, errReleased)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOutboxRepository_DeletePublished(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewOutboxRepository(dbObj)
+
+	olderThan := time.Now().Add(-time.Hour)
+	mock.ExpectExec("DELETE FROM outbox").
+		WithArgs(olderThan).
+		WillReturnResult(pgxmock.NewResult("DELETE", 3))
+
+	// Act
+	deleted, err := repo.DeletePublished(context.Background(), olderThan)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), deleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
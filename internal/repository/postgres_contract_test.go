@@ -0,0 +1,32 @@
+package repository_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
+	"github.com/Bessima/diplom-gomarket/internal/repository/repositorytest"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPostgresStorageContract запускается только при заданной переменной TEST_DATABASE_URI,
+// все данные в указанной базе удаляются перед каждым тестом
+func TestPostgresStorageContract(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URI")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URI is not set")
+	}
+
+	ctx := context.Background()
+	dbObj, err := db.NewDB(ctx, dsn, true)
+	require.NoError(t, err)
+	t.Cleanup(dbObj.Close)
+
+	repositorytest.Run(t, func(t *testing.T) repository.Storage {
+		_, err := dbObj.Pool.Exec(ctx, `TRUNCATE users, orders, withdrawals, balance RESTART IDENTITY CASCADE`)
+		require.NoError(t, err)
+		return repository.NewStorage(dbObj)
+	})
+}
@@ -0,0 +1,491 @@
+// Package repositorytest общий набор тестов для реализаций repository.Storage.
+// Один и тот же набор запускается для хранилища в памяти и для Postgres, чтобы их поведение не расходилось.
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/Bessima/diplom-gomarket/internal/customerror"
+	"github.com/Bessima/diplom-gomarket/internal/handlers/schemas"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
+	"github.com/Bessima/diplom-gomarket/internal/service"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Run запускает набор тестов. newStorage вызывается для каждого теста и должен возвращать пустое хранилище.
+func Run(t *testing.T, newStorage func(t *testing.T) repository.Storage) {
+	tests := map[string]func(t *testing.T, storage repository.Storage){
+		"Users":                    testUsers,
+		"OrderUniqueness":          testOrderUniqueness,
+		"OrderBatch":               testOrderBatch,
+		"OrderPages":               testOrderPages,
+		"OrderProcessing":          testOrderProcessing,
+		"Withdrawals":              testWithdrawals,
+		"WithdrawalUniqueness":     testWithdrawalUniqueness,
+		"WithdrawKeepsBalance":     testWithdrawKeepsBalanceNonNegative,
+		"ConcurrentWithdrawals":    testConcurrentWithdrawals,
+		"WithdrawAtomic":           testWithdrawAtomic,
+		"WithdrawService":          testWithdrawService,
+		"BalanceHistory":           testBalanceHistory,
+		"StreamOrdersWithdrawals":  testStreams,
+		"ProcessingListStopsEarly": testProcessingListStopsEarly,
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			test(t, newStorage(t))
+		})
+	}
+}
+
+func createUser(t *testing.T, storage repository.Storage, login string) *models.User {
+	t.Helper()
+	user, err := storage.Users.CreateUser(context.Background(), login, "hash-"+login)
+	require.NoError(t, err)
+	require.NotNil(t, user)
+	return user
+}
+
+// fund зачисляет пользователю accrual копеек через обработанный заказ orderID
+func fund(t *testing.T, storage repository.Storage, user *models.User, orderID int, accrual int32) {
+	t.Helper()
+	ctx := context.Background()
+	require.NoError(t, storage.Orders.Create(ctx, user.ID, orderID))
+	require.NoError(t, storage.Orders.SetAccrual(ctx, strconv.Itoa(orderID), user.ID, accrual))
+}
+
+func testUsers(t *testing.T, storage repository.Storage) {
+	ctx := context.Background()
+	alice := createUser(t, storage, "alice")
+	bob := createUser(t, storage, "bob")
+
+	assert.NotEqual(t, alice.ID, bob.ID)
+	assert.Equal(t, "alice", alice.Login)
+	assert.Equal(t, "hash-alice", alice.PasswordHash)
+
+	byLogin, err := storage.Users.GetUserByLogin(ctx, "bob")
+	require.NoError(t, err)
+	assert.Equal(t, bob, byLogin)
+
+	byID, err := storage.Users.GetUserByID(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, alice, byID)
+
+	missing, err := storage.Users.GetUserByLogin(ctx, "carol")
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+	assert.Nil(t, missing)
+
+	missing, err = storage.Users.GetUserByID(ctx, bob.ID+100)
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+	assert.Nil(t, missing)
+}
+
+func testOrderUniqueness(t *testing.T, storage repository.Storage) {
+	ctx := context.Background()
+	alice := createUser(t, storage, "alice")
+	bob := createUser(t, storage, "bob")
+
+	require.NoError(t, storage.Orders.Create(ctx, alice.ID, 12345678903))
+	assert.Error(t, storage.Orders.Create(ctx, alice.ID, 12345678903))
+	assert.Error(t, storage.Orders.Create(ctx, bob.ID, 12345678903))
+
+	order, err := storage.Orders.GetByID(ctx, 12345678903)
+	require.NoError(t, err)
+	assert.Equal(t, "12345678903", order.ID)
+	assert.Equal(t, alice.ID, order.UserID)
+	assert.Equal(t, models.NewStatus, order.Status)
+	assert.Nil(t, order.Accrual)
+
+	missing, err := storage.Orders.GetByID(ctx, 79927398713)
+	assert.ErrorIs(t, err, pgx.ErrNoRows)
+	assert.Nil(t, missing)
+}
+
+func testOrderBatch(t *testing.T, storage repository.Storage) {
+	ctx := context.Background()
+	alice := createUser(t, storage, "alice")
+	bob := createUser(t, storage, "bob")
+	require.NoError(t, storage.Orders.Create(ctx, alice.ID, 1))
+	require.NoError(t, storage.Orders.Create(ctx, bob.ID, 2))
+
+	result, err := storage.Orders.CreateBatch(ctx, alice.ID, []int64{1, 2, 3, 3})
+
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]models.BatchOrderStatus{
+		1: models.BatchDuplicateOwn,
+		2: models.BatchConflict,
+		3: models.BatchAccepted,
+	}, result)
+
+	order, err := storage.Orders.GetByID(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, bob.ID, order.UserID)
+}
+
+func testOrderPages(t *testing.T, storage repository.Storage) {
+	ctx := context.Background()
+	alice := createUser(t, storage, "alice")
+	bob := createUser(t, storage, "bob")
+	// Заказы одного пакета загружены одновременно, порядок определяется номером
+	_, err := storage.Orders.CreateBatch(ctx, alice.ID, []int64{1, 2, 3})
+	require.NoError(t, err)
+	require.NoError(t, storage.Orders.Create(ctx, bob.ID, 4))
+	require.NoError(t, storage.Orders.UpdateStatus(ctx, "2", models.InvalidStatus))
+
+	all, err := storage.Orders.GetListByUserID(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"1", "2", "3"}, orderNumbers(all))
+
+	first, err := storage.Orders.GetPageByUserID(ctx, alice.ID, repository.OrderListFilter{Sort: repository.SortDesc, Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, []string{"3", "2"}, orderNumbers(first))
+
+	last := first[len(first)-1]
+	cursor := &models.ListCursor{At: last.UploadedAt, ID: 2}
+	second, err := storage.Orders.GetPageByUserID(ctx, alice.ID, repository.OrderListFilter{Sort: repository.SortDesc, Cursor: cursor, Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, orderNumbers(second))
+
+	ascending, err := storage.Orders.GetPageByUserID(ctx, alice.ID, repository.OrderListFilter{Sort: repository.SortAsc})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "3"}, orderNumbers(ascending))
+
+	invalid, err := storage.Orders.GetPageByUserID(ctx, alice.ID, repository.OrderListFilter{
+		Statuses: []models.OrderStatus{models.InvalidStatus},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2"}, orderNumbers(invalid))
+
+	// Фильтр по времени обработки исключает необработанные заказы
+	processedFrom := last.UploadedAt
+	processed, err := storage.Orders.GetPageByUserID(ctx, alice.ID, repository.OrderListFilter{ProcessedFrom: &processedFrom})
+	require.NoError(t, err)
+	assert.Empty(t, processed)
+}
+
+func testOrderProcessing(t *testing.T, storage repository.Storage) {
+	ctx := context.Background()
+	alice := createUser(t, storage, "alice")
+	_, err := storage.Orders.CreateBatch(ctx, alice.ID, []int64{1, 2, 3, 4})
+	require.NoError(t, err)
+	require.NoError(t, storage.Orders.UpdateStatus(ctx, "2", models.ProcessingStatus))
+	require.NoError(t, storage.Orders.UpdateStatus(ctx, "3", models.InvalidStatus))
+	require.NoError(t, storage.Orders.SetAccrual(ctx, "4", alice.ID, 72998))
+
+	assert.Error(t, storage.Orders.UpdateStatus(ctx, "5", models.ProcessingStatus))
+	assert.Error(t, storage.Orders.SetAccrual(ctx, "5", alice.ID, 100))
+
+	processed, err := storage.Orders.GetByID(ctx, 4)
+	require.NoError(t, err)
+	assert.Equal(t, models.ProcessedStatus, processed.Status)
+	require.NotNil(t, processed.Accrual)
+	assert.Equal(t, float32(729.98), *processed.Accrual)
+
+	// Начисление зачисляется на баланс вместе со сменой статуса
+	balance, err := storage.Balance.GetBalanceUserID(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, float32(729.98), balance.Current)
+	assert.Equal(t, float32(0), balance.Withdrawn)
+
+	// Повторная обработка заказа не зачисляет начисление еще раз и не возвращает его в обработку
+	require.NoError(t, storage.Orders.SetAccrual(ctx, "4", alice.ID, 72998))
+	assert.Error(t, storage.Orders.UpdateStatus(ctx, "4", models.ProcessingStatus))
+	balance, err = storage.Balance.GetBalanceUserID(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, float32(729.98), balance.Current)
+
+	var pending []models.Order
+	err = storage.Orders.SetListForProcessing(ctx, func(order models.Order) bool {
+		pending = append(pending, order)
+		return true
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"1", "2"}, orderNumbers(pending))
+	for _, order := range pending {
+		assert.Equal(t, alice.ID, order.UserID)
+	}
+}
+
+func testProcessingListStopsEarly(t *testing.T, storage repository.Storage) {
+	ctx := context.Background()
+	alice := createUser(t, storage, "alice")
+	_, err := storage.Orders.CreateBatch(ctx, alice.ID, []int64{1, 2, 3})
+	require.NoError(t, err)
+
+	calls := 0
+	err = storage.Orders.SetListForProcessing(ctx, func(models.Order) bool {
+		calls++
+		return false
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func testWithdrawals(t *testing.T, storage repository.Storage) {
+	ctx := context.Background()
+	alice := createUser(t, storage, "alice")
+	bob := createUser(t, storage, "bob")
+	fund(t, storage, alice, 1, 100000)
+
+	require.NoError(t, storage.Withdrawals.Withdraw(ctx, alice.ID, 2377225624, 30050))
+	require.NoError(t, storage.Withdrawals.Withdraw(ctx, alice.ID, 12345678903, 100))
+
+	balance, err := storage.Balance.GetBalanceUserID(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, float32(698.5), balance.Current)
+	assert.Equal(t, float32(301.5), balance.Withdrawn)
+
+	list, err := storage.Withdrawals.GetListByUserID(ctx, alice.ID)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	sums := map[string]float32{}
+	for _, withdrawal := range list {
+		sums[withdrawal.OrderID] = withdrawal.Sum
+		assert.Equal(t, alice.ID, withdrawal.UserID)
+	}
+	assert.Equal(t, map[string]float32{"2377225624": 300.5, "12345678903": 1}, sums)
+
+	page, err := storage.Withdrawals.GetPageByUserID(ctx, alice.ID, repository.WithdrawalListFilter{Sort: repository.SortAsc, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	cursor := &models.ListCursor{At: page[0].ProcessedAt, ID: parseID(t, page[0].OrderID)}
+	next, err := storage.Withdrawals.GetPageByUserID(ctx, alice.ID, repository.WithdrawalListFilter{Sort: repository.SortAsc, Cursor: cursor})
+	require.NoError(t, err)
+	require.Len(t, next, 1)
+	assert.NotEqual(t, page[0].OrderID, next[0].OrderID)
+
+	empty, err := storage.Withdrawals.GetListByUserID(ctx, bob.ID)
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+
+	// У пользователя без начислений баланс нулевой, а списать с него нечего
+	bobBalance, err := storage.Balance.GetBalanceUserID(ctx, bob.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.NewBalance(bob.ID), bobBalance)
+	assert.Error(t, storage.Withdrawals.Withdraw(ctx, bob.ID, 12345678911, 100))
+}
+
+func testWithdrawalUniqueness(t *testing.T, storage repository.Storage) {
+	ctx := context.Background()
+	alice := createUser(t, storage, "alice")
+	bob := createUser(t, storage, "bob")
+	fund(t, storage, alice, 1, 500)
+	fund(t, storage, bob, 2, 500)
+
+	require.NoError(t, storage.Withdrawals.Withdraw(ctx, alice.ID, 2377225624, 100))
+	err := storage.Withdrawals.Withdraw(ctx, bob.ID, 2377225624, 100)
+
+	var customErr customerror.CustomError
+	require.True(t, errors.As(err, &customErr), "expected customerror.CustomError, got %v", err)
+	assert.IsType(t, &customerror.UniqueViolationError{}, customErr)
+}
+
+func testWithdrawKeepsBalanceNonNegative(t *testing.T, storage repository.Storage) {
+	ctx := context.Background()
+	alice := createUser(t, storage, "alice")
+	fund(t, storage, alice, 1, 500)
+
+	assert.Error(t, storage.Withdrawals.Withdraw(ctx, alice.ID, 2377225624, 501))
+
+	balance, err := storage.Balance.GetBalanceUserID(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, float32(5), balance.Current)
+	assert.Equal(t, float32(0), balance.Withdrawn)
+}
+
+func testConcurrentWithdrawals(t *testing.T, storage repository.Storage) {
+	ctx := context.Background()
+	alice := createUser(t, storage, "alice")
+	fund(t, storage, alice, 1, 1000)
+
+	const attempts = 10
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if storage.Withdrawals.Withdraw(ctx, alice.ID, int64(100+i), 200) == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 5, succeeded)
+	balance, err := storage.Balance.GetBalanceUserID(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, float32(0), balance.Current)
+	assert.Equal(t, float32(10), balance.Withdrawn)
+}
+
+// testWithdrawAtomic отклоненное списание не оставляет ни записи о списании, ни изменения баланса
+func testWithdrawAtomic(t *testing.T, storage repository.Storage) {
+	ctx := context.Background()
+	alice := createUser(t, storage, "alice")
+	bob := createUser(t, storage, "bob")
+	fund(t, storage, alice, 1, 500)
+
+	err := storage.Withdrawals.Withdraw(ctx, alice.ID, 2377225624, 501)
+	assert.IsType(t, &customerror.InsufficientFundsError{}, err)
+	err = storage.Withdrawals.Withdraw(ctx, bob.ID, 12345678903, 100)
+	assert.IsType(t, &customerror.InsufficientFundsError{}, err)
+
+	require.NoError(t, storage.Withdrawals.Withdraw(ctx, alice.ID, 2377225624, 200))
+	err = storage.Withdrawals.Withdraw(ctx, alice.ID, 2377225624, 100)
+	assert.IsType(t, &customerror.UniqueViolationError{}, err)
+
+	balance, err := storage.Balance.GetBalanceUserID(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, float32(3), balance.Current)
+	assert.Equal(t, float32(2), balance.Withdrawn)
+
+	list, err := storage.Withdrawals.GetListByUserID(ctx, alice.ID)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "2377225624", list[0].OrderID)
+	empty, err := storage.Withdrawals.GetListByUserID(ctx, bob.ID)
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+}
+
+// testWithdrawService одновременные списания через WithdrawService: записи остаются только
+// у успешных списаний, остальные отклоняются как нехватка средств
+func testWithdrawService(t *testing.T, storage repository.Storage) {
+	ctx := context.Background()
+	alice := createUser(t, storage, "alice")
+	fund(t, storage, alice, 1, 1000)
+	withdrawService := service.NewWithdrawService(storage.Withdrawals)
+
+	const attempts = 10
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			request := schemas.WithdrawRequest{Order: strconv.Itoa(100 + i), Sum: 2}
+			err := withdrawService.Set(ctx, alice, request)
+			if err != nil {
+				assert.IsType(t, &customerror.InsufficientFundsError{}, err)
+				return
+			}
+			mu.Lock()
+			succeeded++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 5, succeeded)
+	balance, err := storage.Balance.GetBalanceUserID(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, float32(0), balance.Current)
+	assert.Equal(t, float32(10), balance.Withdrawn)
+
+	list, err := storage.Withdrawals.GetListByUserID(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.Len(t, list, succeeded)
+}
+
+func testBalanceHistory(t *testing.T, storage repository.Storage) {
+	ctx := context.Background()
+	alice := createUser(t, storage, "alice")
+	fund(t, storage, alice, 1, 1000)
+	require.NoError(t, storage.Withdrawals.Withdraw(ctx, alice.ID, 2377225624, 300))
+
+	events, err := storage.Balance.GetHistory(ctx, alice.ID, repository.BalanceHistoryFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, models.WithdrawalEvent, events[0].Type)
+	assert.Equal(t, "2377225624", events[0].Reference)
+	assert.Equal(t, float32(-3), events[0].Amount)
+	assert.Equal(t, float32(7), events[0].BalanceAfter)
+	assert.Equal(t, models.AccrualEvent, events[1].Type)
+	assert.Equal(t, "1", events[1].Reference)
+	assert.Equal(t, float32(10), events[1].Amount)
+	assert.Equal(t, float32(10), events[1].BalanceAfter)
+
+	accruals, err := storage.Balance.GetHistory(ctx, alice.ID, repository.BalanceHistoryFilter{
+		Types: []models.BalanceEventType{models.AccrualEvent},
+		Limit: 10,
+	})
+	require.NoError(t, err)
+	require.Len(t, accruals, 1)
+	assert.Equal(t, models.AccrualEvent, accruals[0].Type)
+
+	cursor := events[0].Cursor()
+	rest, err := storage.Balance.GetHistory(ctx, alice.ID, repository.BalanceHistoryFilter{Cursor: &cursor, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, rest, 1)
+	assert.Equal(t, events[1], rest[0])
+
+	limited, err := storage.Balance.GetHistory(ctx, alice.ID, repository.BalanceHistoryFilter{Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, events[:1], limited)
+}
+
+func testStreams(t *testing.T, storage repository.Storage) {
+	ctx := context.Background()
+	alice := createUser(t, storage, "alice")
+	fund(t, storage, alice, 1, 1000)
+	require.NoError(t, storage.Orders.Create(ctx, alice.ID, 2))
+	require.NoError(t, storage.Withdrawals.Withdraw(ctx, alice.ID, 2377225624, 300))
+
+	var orders []models.OrderRecord
+	err := storage.Orders.StreamByUserID(ctx, alice.ID, nil, nil, func(record models.OrderRecord) error {
+		orders = append(orders, record)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, orders, 2)
+	byNumber := map[string]models.OrderRecord{}
+	for _, record := range orders {
+		byNumber[record.Number] = record
+	}
+	require.NotNil(t, byNumber["1"].AccrualKopecks)
+	assert.Equal(t, int64(1000), *byNumber["1"].AccrualKopecks)
+	assert.NotNil(t, byNumber["1"].ProcessedAt)
+	assert.Nil(t, byNumber["2"].AccrualKopecks)
+	assert.Equal(t, models.NewStatus, byNumber["2"].Status)
+
+	var withdrawals []models.WithdrawalRecord
+	err = storage.Withdrawals.StreamByUserID(ctx, alice.ID, nil, nil, func(record models.WithdrawalRecord) error {
+		withdrawals = append(withdrawals, record)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, withdrawals, 1)
+	assert.Equal(t, "2377225624", withdrawals[0].Order)
+	assert.Equal(t, int64(300), withdrawals[0].SumKopecks)
+
+	stop := errors.New("stop")
+	err = storage.Orders.StreamByUserID(ctx, alice.ID, nil, nil, func(models.OrderRecord) error { return stop })
+	assert.ErrorIs(t, err, stop)
+}
+
+func orderNumbers(orders []models.Order) []string {
+	result := make([]string, 0, len(orders))
+	for _, order := range orders {
+		result = append(result, order.ID)
+	}
+	return result
+}
+
+func parseID(t *testing.T, value string) int64 {
+	t.Helper()
+	id, err := strconv.ParseInt(value, 10, 64)
+	require.NoError(t, err)
+	return id
+}
@@ -0,0 +1,124 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
+	"github.com/Bessima/diplom-gomarket/internal/retry"
+	"github.com/Bessima/diplom-gomarket/internal/tracing"
+)
+
+type BalanceRepository struct {
+	db *db.SQLiteDB
+}
+
+func NewBalanceRepository(dbObj *db.SQLiteDB) *BalanceRepository {
+	return &BalanceRepository{db: dbObj}
+}
+
+func (repo *BalanceRepository) GetBalanceUserID(ctx context.Context, userID int) (_ models.Balance, err error) {
+	ctx, span := tracing.Start(ctx, "BalanceRepository.GetBalanceUserID")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repo.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT current, withdrawals FROM balance WHERE user_id = ?1`
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) (models.Balance, error) {
+		balance := models.NewBalance(userID)
+
+		var current, withdrawn int32
+		err := repo.db.SQL.QueryRowContext(ctx, query, userID).Scan(&current, &withdrawn)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Строка баланса создается при первом начислении
+			return balance, nil
+		}
+		if err != nil {
+			return balance, err
+		}
+
+		balance.SetCurrent(current)
+		balance.SetWithdrawn(withdrawn)
+		return balance, nil
+	}, StorageRetryConfig)
+}
+
+// GetHistory возвращает начисления и списания пользователя от новых к старым.
+// Баланс после каждого события считается по всей истории до применения фильтров.
+// Переводы и корректировки хранятся только в Postgres, поэтому в истории их нет.
+func (repo *BalanceRepository) GetHistory(ctx context.Context, userID int, filter repository.BalanceHistoryFilter) (_ []models.BalanceEvent, err error) {
+	ctx, span := tracing.Start(ctx, "BalanceRepository.GetHistory")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repo.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `WITH events AS (
+			SELECT 'ACCRUAL' AS type, CAST(id AS TEXT) AS ref, accrual AS amount, COALESCE(processed_at, uploaded_at) AS occurred_at
+			FROM orders WHERE user_id = ?1 AND status = 'PROCESSED' AND accrual > 0
+			UNION ALL
+			SELECT 'WITHDRAWAL', CAST(order_id AS TEXT), -COALESCE(sum, 0), processed_at FROM withdrawals WHERE user_id = ?1
+		), ledger AS (
+			SELECT type, ref, amount, occurred_at,
+				SUM(amount) OVER (ORDER BY occurred_at, type, ref ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW) AS balance_after
+			FROM events
+		)
+		SELECT type, ref, amount, occurred_at, balance_after FROM ledger
+		WHERE (?2 IS NULL OR occurred_at >= ?2)
+			AND (?3 IS NULL OR occurred_at < ?3)
+			AND (?4 IS NULL OR type IN (SELECT value FROM json_each(?4)))
+			AND (?5 IS NULL OR (occurred_at, type, ref) < (?5, ?6, ?7))
+		ORDER BY occurred_at DESC, type DESC, ref DESC
+		LIMIT ?8`
+
+	var from, to, cursorAt *int64
+	if filter.From != nil {
+		value := filter.From.UnixMicro()
+		from = &value
+	}
+	if filter.To != nil {
+		value := filter.To.UnixMicro()
+		to = &value
+	}
+	var types *string
+	if len(filter.Types) > 0 {
+		encoded, err := json.Marshal(filter.Types)
+		if err != nil {
+			return nil, err
+		}
+		value := string(encoded)
+		types = &value
+	}
+	var cursorType, cursorRef string
+	if filter.Cursor != nil {
+		value := filter.Cursor.OccurredAt.UnixMicro()
+		cursorAt = &value
+		cursorType = string(filter.Cursor.Type)
+		cursorRef = filter.Cursor.Reference
+	}
+
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) ([]models.BalanceEvent, error) {
+		rows, err := repo.db.SQL.QueryContext(ctx, query, userID, from, to, types, cursorAt, cursorType, cursorRef, filter.Limit)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		events := []models.BalanceEvent{}
+		for rows.Next() {
+			var event models.BalanceEvent
+			var amount, occurredAt, balanceAfter int64
+			err = rows.Scan(&event.Type, &event.Reference, &amount, &occurredAt, &balanceAfter)
+			if err != nil {
+				return nil, err
+			}
+			event.OccurredAt = fromMicro(occurredAt)
+			event.SetAmounts(amount, balanceAfter)
+			events = append(events, event)
+		}
+		return events, rows.Err()
+	}, StorageRetryConfig)
+}
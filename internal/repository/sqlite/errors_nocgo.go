@@ -0,0 +1,14 @@
+//go:build !cgo
+
+package sqlite
+
+// Без cgo драйвер go-sqlite3 собирается заглушкой: db.NewSQLiteDB возвращает ошибку при открытии базы,
+// и до запросов дело не доходит. Остальные хранилища в такой сборке работают как обычно.
+
+func isBusy(error) bool {
+	return false
+}
+
+func isPrimaryKeyViolation(error) bool {
+	return false
+}
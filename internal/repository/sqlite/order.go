@@ -0,0 +1,296 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
+	"github.com/Bessima/diplom-gomarket/internal/retry"
+	"github.com/Bessima/diplom-gomarket/internal/tracing"
+)
+
+type OrderRepository struct {
+	db *db.SQLiteDB
+}
+
+func NewOrderRepository(dbObj *db.SQLiteDB) *OrderRepository {
+	return &OrderRepository{db: dbObj}
+}
+
+func (repo *OrderRepository) Create(ctx context.Context, userID, orderID int) (err error) {
+	ctx, span := tracing.Start(ctx, "OrderRepository.Create")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repo.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `INSERT INTO orders (id, user_id, status, uploaded_at) VALUES (?1, ?2, ?3, ?4) ON CONFLICT (id) DO NOTHING`
+	return retry.DoRetry(ctx, func(ctx context.Context) error {
+		result, err := repo.db.SQL.ExecContext(ctx, query, orderID, userID, models.NewStatus, now())
+		if err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+			return fmt.Errorf("order with id %v already exists", orderID)
+		}
+		return nil
+	}, StorageRetryConfig)
+}
+
+// CreateBatch добавляет заказы пользователя одной транзакцией и возвращает результат для каждого номера.
+// Номера, уже загруженные этим или другим пользователем, не изменяются.
+func (repo *OrderRepository) CreateBatch(ctx context.Context, userID int, orderIDs []int64) (_ map[int64]models.BatchOrderStatus, err error) {
+	ctx, span := tracing.Start(ctx, "OrderRepository.CreateBatch")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repo.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	queryInsert := `INSERT INTO orders (id, user_id, status, uploaded_at) VALUES (?1, ?2, ?3, ?4) ON CONFLICT (id) DO NOTHING`
+	queryOwner := `SELECT user_id FROM orders WHERE id = ?1`
+
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) (map[int64]models.BatchOrderStatus, error) {
+		tx, err := repo.db.SQL.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+
+		uploadedAt := now()
+		result := make(map[int64]models.BatchOrderStatus, len(orderIDs))
+		for _, id := range orderIDs {
+			if _, ok := result[id]; ok {
+				continue
+			}
+			inserted, err := tx.ExecContext(ctx, queryInsert, id, userID, models.NewStatus, uploadedAt)
+			if err != nil {
+				return nil, err
+			}
+			if affected, err := inserted.RowsAffected(); err != nil {
+				return nil, err
+			} else if affected > 0 {
+				result[id] = models.BatchAccepted
+				continue
+			}
+
+			var ownerID int
+			if err = tx.QueryRowContext(ctx, queryOwner, id).Scan(&ownerID); err != nil {
+				return nil, err
+			}
+			if ownerID == userID {
+				result[id] = models.BatchDuplicateOwn
+			} else {
+				result[id] = models.BatchConflict
+			}
+		}
+		return result, tx.Commit()
+	}, StorageRetryConfig)
+}
+
+func (repo *OrderRepository) GetByID(ctx context.Context, id int) (_ *models.Order, err error) {
+	ctx, span := tracing.Start(ctx, "OrderRepository.GetByID")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repo.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT id,user_id,accrual,status,uploaded_at FROM orders WHERE id = ?1`
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) (*models.Order, error) {
+		order, err := scanOrder(repo.db.SQL.QueryRowContext(ctx, query, id))
+		if err != nil {
+			return nil, noRows(err)
+		}
+		return &order, nil
+	}, StorageRetryConfig)
+}
+
+func (repo *OrderRepository) GetListByUserID(ctx context.Context, userID int) ([]models.Order, error) {
+	return repo.GetPageByUserID(ctx, userID, repository.OrderListFilter{Sort: repository.SortDesc})
+}
+
+// GetPageByUserID возвращает страницу заказов пользователя с учетом фильтров и курсора
+func (repo *OrderRepository) GetPageByUserID(ctx context.Context, userID int, filter repository.OrderListFilter) (_ []models.Order, err error) {
+	ctx, span := tracing.Start(ctx, "OrderRepository.GetPageByUserID")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repo.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	builder := queryBuilder{}
+	builder.add("user_id = %s", userID)
+	if len(filter.Statuses) > 0 {
+		statuses := make([]any, 0, len(filter.Statuses))
+		for _, status := range filter.Statuses {
+			statuses = append(statuses, string(status))
+		}
+		builder.addIn("status", statuses)
+	}
+	builder.addRange("uploaded_at", filter.UploadedFrom, filter.UploadedTo)
+	builder.addRange("processed_at", filter.ProcessedFrom, filter.ProcessedTo)
+	suffix := builder.addPage("uploaded_at", "id", filter.Sort, filter.Cursor, filter.Limit)
+
+	query := `SELECT id,user_id,accrual,status,uploaded_at FROM orders` + builder.where() + suffix
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) ([]models.Order, error) {
+		return repo.queryOrders(ctx, query, builder.args...)
+	}, StorageRetryConfig)
+}
+
+// queryOrders читает выборку целиком: соединение освобождается до того, как заказы передаются дальше
+func (repo *OrderRepository) queryOrders(ctx context.Context, query string, args ...any) ([]models.Order, error) {
+	rows, err := repo.db.SQL.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []models.Order{}
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	return orders, rows.Err()
+}
+
+func scanOrder(row interface{ Scan(dest ...any) error }) (models.Order, error) {
+	var order models.Order
+	var number, uploadedAt int64
+	var accrualInKopecks *int32
+	err := row.Scan(&number, &order.UserID, &accrualInKopecks, &order.Status, &uploadedAt)
+	if err != nil {
+		return order, err
+	}
+	order.ID = strconv.FormatInt(number, 10)
+	order.UploadedAt = fromMicro(uploadedAt)
+	if accrualInKopecks != nil {
+		order.SetAccrualAsFloat(*accrualInKopecks)
+	}
+	return order, nil
+}
+
+// SetListForProcessing передает в enqueue необработанные заказы. Если enqueue вернул false
+// (очередь закрыта при остановке сервиса), передача прекращается.
+func (repo *OrderRepository) SetListForProcessing(ctx context.Context, enqueue func(models.Order) bool) (err error) {
+	ctx, span := tracing.Start(ctx, "OrderRepository.SetListForProcessing")
+	defer func() { tracing.End(span, err) }()
+
+	query := `SELECT id,user_id,accrual,status,uploaded_at FROM orders WHERE status IN (?1, ?2) ORDER BY uploaded_at, id`
+	orders, err := retry.DoRetryWithResult(ctx, func(ctx context.Context) ([]models.Order, error) {
+		return repo.queryOrders(ctx, query, models.NewStatus, models.ProcessingStatus)
+	}, StorageRetryConfig)
+	if err != nil {
+		return err
+	}
+
+	for _, order := range orders {
+		if !enqueue(order) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (repo *OrderRepository) UpdateStatus(ctx context.Context, orderID string, newStatus models.OrderStatus) (err error) {
+	ctx, span := tracing.Start(ctx, "OrderRepository.UpdateStatus")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repo.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE orders SET status = ?1 WHERE id = ?2 AND status <> ?3`
+	return retry.DoRetry(ctx, func(ctx context.Context) error {
+		result, err := repo.db.SQL.ExecContext(ctx, query, newStatus, orderID, models.ProcessedStatus)
+		if err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+			return fmt.Errorf("order with id %v not found or already processed", orderID)
+		}
+		return nil
+	}, StorageRetryConfig)
+}
+
+// SetAccrual сохраняет начисление и зачисляет его на баланс пользователя одной транзакцией.
+// Повторный вызов для обработанного заказа баланс не меняет.
+func (repo *OrderRepository) SetAccrual(ctx context.Context, orderID string, userID int, accrual int32) (err error) {
+	ctx, span := tracing.Start(ctx, "OrderRepository.SetAccrual")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repo.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	queryOrder := `UPDATE orders SET accrual = ?1, status = ?2, processed_at = ?3 WHERE id = ?4 AND status <> ?2`
+	queryExists := `SELECT EXISTS (SELECT 1 FROM orders WHERE id = ?1)`
+	queryBalance := `INSERT INTO balance (user_id, current) VALUES (?1, ?2)
+		ON CONFLICT (user_id) DO UPDATE SET current = balance.current + excluded.current`
+
+	return retry.DoRetry(ctx, func(ctx context.Context) error {
+		tx, err := repo.db.SQL.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		result, err := tx.ExecContext(ctx, queryOrder, accrual, models.ProcessedStatus, now(), orderID)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			var exists bool
+			if err = tx.QueryRowContext(ctx, queryExists, orderID).Scan(&exists); err != nil {
+				return err
+			}
+			if !exists {
+				return fmt.Errorf("order with id %v was not installed accrual value", orderID)
+			}
+			return nil
+		}
+
+		if _, err = tx.ExecContext(ctx, queryBalance, userID, accrual); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}, StorageRetryConfig)
+}
+
+// StreamByUserID построчно передает заказы пользователя в fn, не загружая всю выборку в память.
+// Повторные попытки не выполняются, так как часть строк уже может быть передана.
+func (repo *OrderRepository) StreamByUserID(ctx context.Context, userID int, from, to *time.Time, fn func(models.OrderRecord) error) (err error) {
+	ctx, span := tracing.Start(ctx, "OrderRepository.StreamByUserID")
+	defer func() { tracing.End(span, err) }()
+
+	builder := queryBuilder{}
+	builder.add("user_id = %s", userID)
+	builder.addRange("uploaded_at", from, to)
+	query := `SELECT id,status,accrual,uploaded_at,processed_at FROM orders` + builder.where() + ` ORDER BY uploaded_at, id`
+
+	rows, err := repo.db.SQL.QueryContext(ctx, query, builder.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var record models.OrderRecord
+		var number, uploadedAt int64
+		var processedAt sql.NullInt64
+		err = rows.Scan(&number, &record.Status, &record.AccrualKopecks, &uploadedAt, &processedAt)
+		if err != nil {
+			return err
+		}
+		record.Number = strconv.FormatInt(number, 10)
+		record.UploadedAt = fromMicro(uploadedAt)
+		record.ProcessedAt = fromNullMicro(processedAt)
+
+		if err = fn(record); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,27 @@
+//go:build cgo
+
+package sqlite_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
+	"github.com/Bessima/diplom-gomarket/internal/repository/repositorytest"
+	"github.com/Bessima/diplom-gomarket/internal/repository/sqlite"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageContract(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repository.Storage {
+		dsn := db.SQLiteScheme + filepath.Join(t.TempDir(), "gophermart.db")
+		dbObj, err := db.NewSQLiteDB(context.Background(), dsn, true)
+		require.NoError(t, err)
+		t.Cleanup(dbObj.Close)
+
+		require.NoError(t, dbObj.CheckMigrations(context.Background()))
+		return sqlite.NewStorage(dbObj)
+	})
+}
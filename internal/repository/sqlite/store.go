@@ -0,0 +1,120 @@
+// Package sqlite реализует репозитории пользователей, заказов, списаний и баланса на SQLite.
+// Хранилище выбирается схемой sqlite:// в DATABASE_URI и предназначено для установок на одном сервере
+// без Postgres. Время хранится в микросекундах от начала эпохи, суммы - в копейках, как в Postgres.
+// Драйвер go-sqlite3 требует cgo: сборка с CGO_ENABLED=0 проходит, но база SQLite в ней не открывается.
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
+	"github.com/Bessima/diplom-gomarket/internal/retry"
+	"github.com/jackc/pgx/v5"
+)
+
+// NewStorage репозитории SQLite
+func NewStorage(dbObj *db.SQLiteDB) repository.Storage {
+	return repository.Storage{
+		Users:           NewUserRepository(dbObj),
+		Orders:          NewOrderRepository(dbObj),
+		Withdrawals:     NewWithdrawRepository(dbObj),
+		Balance:         NewBalanceRepository(dbObj),
+		Ping:            dbObj.Ping,
+		CheckMigrations: dbObj.CheckMigrations,
+		Close:           dbObj.Close,
+	}
+}
+
+// StorageRetryConfig повторяет запросы, не дождавшиеся блокировки базы за busy_timeout
+var StorageRetryConfig = retry.RetryConfig{
+	Name:        "sqlite",
+	MaxRetries:  3,
+	Delays:      []time.Duration{100 * time.Millisecond, 500 * time.Millisecond},
+	ShouldRetry: isBusy,
+}
+
+// noRows заменяет sql.ErrNoRows на pgx.ErrNoRows: вызывающий код проверяет отсутствие строки так же, как для Postgres
+func noRows(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return pgx.ErrNoRows
+	}
+	return err
+}
+
+func now() int64 {
+	return time.Now().UnixMicro()
+}
+
+func fromMicro(value int64) time.Time {
+	return time.UnixMicro(value)
+}
+
+func fromNullMicro(value sql.NullInt64) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	result := fromMicro(value.Int64)
+	return &result
+}
+
+// queryBuilder собирает условия WHERE и аргументы запроса с нумерованными плейсхолдерами ?N.
+// Время передается в микросекундах, как хранится в таблицах.
+type queryBuilder struct {
+	conditions []string
+	args       []any
+}
+
+func (builder *queryBuilder) add(condition string, args ...any) {
+	placeholders := make([]any, 0, len(args))
+	for _, arg := range args {
+		if value, ok := arg.(time.Time); ok {
+			arg = value.UnixMicro()
+		}
+		builder.args = append(builder.args, arg)
+		placeholders = append(placeholders, fmt.Sprintf("?%d", len(builder.args)))
+	}
+	builder.conditions = append(builder.conditions, fmt.Sprintf(condition, placeholders...))
+}
+
+func (builder *queryBuilder) addRange(column string, from, to *time.Time) {
+	if from != nil {
+		builder.add(column+" >= %s", *from)
+	}
+	if to != nil {
+		builder.add(column+" < %s", *to)
+	}
+}
+
+// addIn добавляет условие column IN (...) для непустого списка значений
+func (builder *queryBuilder) addIn(column string, values []any) {
+	placeholders := strings.TrimSuffix(strings.Repeat("%s, ", len(values)), ", ")
+	builder.add(column+" IN ("+placeholders+")", values...)
+}
+
+// addPage добавляет условие курсора, сортировку и лимит для пары колонок (timeColumn, idColumn)
+func (builder *queryBuilder) addPage(timeColumn, idColumn string, sort repository.SortOrder, cursor *models.ListCursor, limit int) string {
+	direction, comparison := "DESC", "<"
+	if sort == repository.SortAsc {
+		direction, comparison = "ASC", ">"
+	}
+	if cursor != nil {
+		builder.add(fmt.Sprintf("(%s, %s) %s (%%s, %%s)", timeColumn, idColumn, comparison), cursor.At, cursor.ID)
+	}
+
+	suffix := fmt.Sprintf(" ORDER BY %s %s, %s %s", timeColumn, direction, idColumn, direction)
+	if limit > 0 {
+		builder.args = append(builder.args, limit)
+		suffix += fmt.Sprintf(" LIMIT ?%d", len(builder.args))
+	}
+	return suffix
+}
+
+func (builder *queryBuilder) where() string {
+	return " WHERE " + strings.Join(builder.conditions, " AND ")
+}
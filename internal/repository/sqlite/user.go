@@ -0,0 +1,63 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/retry"
+	"github.com/Bessima/diplom-gomarket/internal/tracing"
+)
+
+type UserRepository struct {
+	db *db.SQLiteDB
+}
+
+func NewUserRepository(dbObj *db.SQLiteDB) *UserRepository {
+	return &UserRepository{db: dbObj}
+}
+
+func (repo *UserRepository) CreateUser(ctx context.Context, username, passwordHash string) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.CreateUser")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repo.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `INSERT INTO users (name, password) VALUES (?1, ?2) RETURNING id, name, password`
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) (*models.User, error) {
+		return repo.scanUser(repo.db.SQL.QueryRowContext(ctx, query, username, passwordHash))
+	}, StorageRetryConfig)
+}
+
+func (repo *UserRepository) GetUserByLogin(ctx context.Context, username string) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.GetUserByLogin")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repo.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	// Логины не уникальны, как и в Postgres: возвращается первый созданный пользователь
+	query := `SELECT id, name, password FROM users WHERE name = ?1 ORDER BY id LIMIT 1`
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) (*models.User, error) {
+		return repo.scanUser(repo.db.SQL.QueryRowContext(ctx, query, username))
+	}, StorageRetryConfig)
+}
+
+func (repo *UserRepository) GetUserByID(ctx context.Context, id int) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.GetUserByID")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repo.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT id, name, password FROM users WHERE id = ?1`
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) (*models.User, error) {
+		return repo.scanUser(repo.db.SQL.QueryRowContext(ctx, query, id))
+	}, StorageRetryConfig)
+}
+
+func (repo *UserRepository) scanUser(row interface{ Scan(dest ...any) error }) (*models.User, error) {
+	user := models.User{}
+	if err := row.Scan(&user.ID, &user.Login, &user.PasswordHash); err != nil {
+		return nil, noRows(err)
+	}
+	return &user, nil
+}
@@ -0,0 +1,140 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/Bessima/diplom-gomarket/internal/customerror"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
+	"github.com/Bessima/diplom-gomarket/internal/retry"
+	"github.com/Bessima/diplom-gomarket/internal/tracing"
+)
+
+type WithdrawRepository struct {
+	db *db.SQLiteDB
+}
+
+func NewWithdrawRepository(dbObj *db.SQLiteDB) *WithdrawRepository {
+	return &WithdrawRepository{db: dbObj}
+}
+
+// Withdraw списывает sum копеек с баланса пользователя и записывает списание одной транзакцией.
+// При нехватке средств возвращает InsufficientFundsError, при повторном номере заказа - UniqueViolationError.
+func (repo *WithdrawRepository) Withdraw(ctx context.Context, userID int, orderID int64, sum int) (err error) {
+	ctx, span := tracing.Start(ctx, "WithdrawRepository.Withdraw")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repo.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	queryDebit := `UPDATE balance SET current = current - ?1, withdrawals = withdrawals + ?1 WHERE user_id = ?2 AND current >= ?1`
+	queryWithdraw := `INSERT INTO withdrawals (user_id, order_id, sum, processed_at) VALUES (?1, ?2, ?3, ?4)`
+
+	return retry.DoRetry(ctx, func(ctx context.Context) error {
+		tx, err := repo.db.SQL.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		result, err := tx.ExecContext(ctx, queryDebit, sum, userID)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return customerror.NewInsufficientFundsError(fmt.Sprintf("user %d has not enough points for withdraw", userID))
+		}
+
+		if _, err = tx.ExecContext(ctx, queryWithdraw, userID, orderID, sum, now()); err != nil {
+			if isPrimaryKeyViolation(err) {
+				return customerror.NewUniqueViolationError(fmt.Sprintf("withdraw with orderID %v already exists", orderID))
+			}
+			return err
+		}
+		return tx.Commit()
+	}, StorageRetryConfig)
+}
+
+func (repo *WithdrawRepository) GetListByUserID(ctx context.Context, userID int) ([]models.Withdrawal, error) {
+	return repo.GetPageByUserID(ctx, userID, repository.WithdrawalListFilter{Sort: repository.SortDesc})
+}
+
+// GetPageByUserID возвращает страницу списаний пользователя с учетом фильтров и курсора
+func (repo *WithdrawRepository) GetPageByUserID(ctx context.Context, userID int, filter repository.WithdrawalListFilter) (_ []models.Withdrawal, err error) {
+	ctx, span := tracing.Start(ctx, "WithdrawRepository.GetPageByUserID")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repo.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	builder := queryBuilder{}
+	builder.add("user_id = %s", userID)
+	builder.addRange("processed_at", filter.From, filter.To)
+	suffix := builder.addPage("processed_at", "order_id", filter.Sort, filter.Cursor, filter.Limit)
+
+	query := `SELECT order_id,user_id,COALESCE(sum, 0),processed_at FROM withdrawals` + builder.where() + suffix
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) ([]models.Withdrawal, error) {
+		rows, err := repo.db.SQL.QueryContext(ctx, query, builder.args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		withdrawals := []models.Withdrawal{}
+		for rows.Next() {
+			var withdrawal models.Withdrawal
+			var orderID, processedAt int64
+			var sumInKopecks int32
+			err = rows.Scan(&orderID, &withdrawal.UserID, &sumInKopecks, &processedAt)
+			if err != nil {
+				return nil, err
+			}
+			withdrawal.OrderID = strconv.FormatInt(orderID, 10)
+			withdrawal.ProcessedAt = fromMicro(processedAt)
+			withdrawal.SetSumInFloat(sumInKopecks)
+			withdrawals = append(withdrawals, withdrawal)
+		}
+		return withdrawals, rows.Err()
+	}, StorageRetryConfig)
+}
+
+// StreamByUserID построчно передает списания пользователя в fn, не загружая всю выборку в память.
+// Повторные попытки не выполняются, так как часть строк уже может быть передана.
+func (repo *WithdrawRepository) StreamByUserID(ctx context.Context, userID int, from, to *time.Time, fn func(models.WithdrawalRecord) error) (err error) {
+	ctx, span := tracing.Start(ctx, "WithdrawRepository.StreamByUserID")
+	defer func() { tracing.End(span, err) }()
+
+	builder := queryBuilder{}
+	builder.add("user_id = %s", userID)
+	builder.addRange("processed_at", from, to)
+	query := `SELECT order_id,COALESCE(sum, 0),processed_at FROM withdrawals` + builder.where() + ` ORDER BY processed_at, order_id`
+
+	rows, err := repo.db.SQL.QueryContext(ctx, query, builder.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var record models.WithdrawalRecord
+		var orderID, processedAt int64
+		err = rows.Scan(&orderID, &record.SumKopecks, &processedAt)
+		if err != nil {
+			return err
+		}
+		record.Order = strconv.FormatInt(orderID, 10)
+		record.ProcessedAt = fromMicro(processedAt)
+
+		if err = fn(record); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/Bessima/diplom-gomarket/internal/config/db"
+)
+
+// Storage репозитории, через которые работают обработчики API и воркеры начислений.
+// Кроме Postgres они реализованы на SQLite (пакет sqlite) и в памяти (пакет memory) для локальных демонстраций.
+type Storage struct {
+	// DB соединение с Postgres, nil для хранилищ без Postgres. Переводы, события заказов,
+	// вебхуки, уведомления и outbox работают только с Postgres.
+	DB          *db.DB
+	Users       UserStorageRepositoryI
+	Orders      OrderStorageRepositoryI
+	Withdrawals WithdrawStorageRepositoryI
+	Balance     BalanceStorageRepositoryI
+	// Caches кеши пользователей и балансов, nil если кеш отключен
+	Caches *Caches
+
+	// Ping проверяет доступность базы для проверки готовности, nil для хранилища в памяти
+	Ping func(ctx context.Context) error
+	// CheckMigrations проверяет версию схемы для проверки готовности, nil для хранилища в памяти
+	CheckMigrations func(ctx context.Context) error
+	// Close закрывает соединения с базой, nil для хранилища в памяти
+	Close func()
+}
+
+// NewStorage репозитории Postgres
+func NewStorage(dbObj *db.DB) Storage {
+	return Storage{
+		DB:              dbObj,
+		Users:           NewUserRepository(dbObj),
+		Orders:          NewOrderRepository(dbObj),
+		Withdrawals:     NewWithdrawRepository(dbObj),
+		Balance:         NewBalanceRepository(dbObj),
+		Ping:            dbObj.Pool.Ping,
+		CheckMigrations: dbObj.CheckMigrations,
+		Close:           dbObj.Close,
+	}
+}
@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/Bessima/diplom-gomarket/internal/customerror"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/retry"
+	"github.com/Bessima/diplom-gomarket/internal/tracing"
+	"github.com/jackc/pgx/v5"
+	"sort"
+)
+
+type TransferRepository struct {
+	db *db.DB
+}
+
+type TransferStorageRepositoryI interface {
+	Create(ctx context.Context, fromUserID, toUserID int, sum int64, dailyLimit int64) error
+	GetListByUserID(ctx context.Context, userID int) ([]models.Transfer, error)
+}
+
+func NewTransferRepository(dbObj *db.DB) *TransferRepository {
+	return &TransferRepository{db: dbObj}
+}
+
+// Create переводит sum копеек с баланса fromUserID на баланс toUserID в одной транзакции.
+// Строки баланса блокируются в порядке возрастания user_id, чтобы встречные переводы не приводили к deadlock.
+// dailyLimit <= 0 отключает проверку суточного лимита. Сутки для лимита отсчитываются от полуночи по UTC
+// независимо от часового пояса сервера базы данных.
+func (repository *TransferRepository) Create(ctx context.Context, fromUserID, toUserID int, sum int64, dailyLimit int64) (err error) {
+	ctx, span := tracing.Start(ctx, "TransferRepository.Create")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	queryLock := `INSERT INTO balance (user_id) VALUES ($1) ON CONFLICT (user_id) DO UPDATE SET current = balance.current RETURNING current`
+	querySentToday := `SELECT COALESCE(SUM(sum), 0) FROM transfers WHERE from_user_id = $1 AND created_at >= date_trunc('day', now() AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'`
+	queryDebit := `UPDATE balance SET current = (balance.current - $1) WHERE user_id = $2`
+	queryCredit := `UPDATE balance SET current = (balance.current + $1) WHERE user_id = $2`
+	queryTransfer := `INSERT INTO transfers (from_user_id, to_user_id, sum) VALUES ($1, $2, $3)`
+
+	repository.db.MarkWrite(fromUserID, toUserID)
+	return retry.DoRetry(ctx, func(ctx context.Context) error {
+		tx, err := repository.db.Pool.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				tx.Rollback(ctx)
+			}
+		}()
+
+		userIDs := []int{fromUserID, toUserID}
+		sort.Ints(userIDs)
+
+		currents := make(map[int]int64, len(userIDs))
+		for _, userID := range userIDs {
+			var current int64
+			err = tx.QueryRow(ctx, queryLock, userID).Scan(&current)
+			if err != nil {
+				return err
+			}
+			currents[userID] = current
+		}
+
+		if currents[fromUserID] < sum {
+			err = customerror.NewInsufficientFundsError(fmt.Sprintf("user %d has not enough points for transfer", fromUserID))
+			return err
+		}
+
+		if dailyLimit > 0 {
+			var sentToday int64
+			err = tx.QueryRow(ctx, querySentToday, fromUserID).Scan(&sentToday)
+			if err != nil {
+				return err
+			}
+			if sentToday+sum > dailyLimit {
+				err = customerror.NewLimitExceededError(fmt.Sprintf("daily transfer limit for user %d is exceeded", fromUserID))
+				return err
+			}
+		}
+
+		err = repository.exec(ctx, tx, queryDebit, sum, fromUserID)
+		if err != nil {
+			return err
+		}
+		err = repository.exec(ctx, tx, queryCredit, sum, toUserID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, queryTransfer, fromUserID, toUserID, sum)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Commit(ctx)
+		return err
+	})
+}
+
+func (repository *TransferRepository) exec(ctx context.Context, tx pgx.Tx, query string, sum int64, userID int) error {
+	row, err := tx.Exec(ctx, query, sum, userID)
+	if err != nil {
+		return err
+	}
+	if row.RowsAffected() == 0 {
+		return fmt.Errorf("not update balance for user %d", userID)
+	}
+	return nil
+}
+
+func (repository *TransferRepository) GetListByUserID(ctx context.Context, userID int) (_ []models.Transfer, err error) {
+	ctx, span := tracing.Start(ctx, "TransferRepository.GetListByUserID")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT t.id, t.from_user_id, t.to_user_id, fu.name, tu.name, t.sum, t.created_at FROM transfers t
+		JOIN users fu ON fu.id = t.from_user_id
+		JOIN users tu ON tu.id = t.to_user_id
+		WHERE t.from_user_id = $1 OR t.to_user_id = $1 ORDER BY t.created_at DESC`
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) ([]models.Transfer, error) {
+		rows, err := repository.db.Pool.Query(
+			ctx,
+			query,
+			userID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		transfers := []models.Transfer{}
+		for rows.Next() {
+			var transfer models.Transfer
+			var fromLogin, toLogin string
+			var sumInKopecks int64
+			err = rows.Scan(&transfer.ID, &transfer.FromUserID, &transfer.ToUserID, &fromLogin, &toLogin, &sumInKopecks, &transfer.CreatedAt)
+			if err != nil {
+				return nil, err
+			}
+
+			transfer.SetSumInFloat(sumInKopecks)
+			transfer.SetDirectionFor(userID, fromLogin, toLogin)
+			transfers = append(transfers, transfer)
+		}
+
+		err = rows.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		return transfers, err
+	})
+}
@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/customerror"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferRepository_Create_Success(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewTransferRepository(dbObj)
+
+	fromUserID := 2
+	toUserID := 1
+	sum := int64(10000)
+
+	mock.ExpectBegin()
+	// Блокировки берутся в порядке возрастания user_id
+	mock.ExpectQuery("INSERT INTO balance").
+		WithArgs(toUserID).
+		WillReturnRows(pgxmock.NewRows([]string{"current"}).AddRow(int64(0)))
+	mock.ExpectQuery("INSERT INTO balance").
+		WithArgs(fromUserID).
+		WillReturnRows(pgxmock.NewRows([]string{"current"}).AddRow(int64(50000)))
+	mock.ExpectQuery(`SELECT COALESCE.+date_trunc\('day', now\(\) AT TIME ZONE 'UTC'\) AT TIME ZONE 'UTC'`).
+		WithArgs(fromUserID).
+		WillReturnRows(pgxmock.NewRows([]string{"sum"}).AddRow(int64(0)))
+	mock.ExpectExec("UPDATE balance SET current").
+		WithArgs(sum, fromUserID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("UPDATE balance SET current").
+		WithArgs(sum, toUserID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("INSERT INTO transfers").
+		WithArgs(fromUserID, toUserID, sum).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+
+	// Act
+	err = repo.Create(context.Background(), fromUserID, toUserID, sum, 1000000)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransferRepository_Create_InsufficientFunds(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewTransferRepository(dbObj)
+
+	fromUserID := 1
+	toUserID := 2
+	sum := int64(10000)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO balance").
+		WithArgs(fromUserID).
+		WillReturnRows(pgxmock.NewRows([]string{"current"}).AddRow(int64(500)))
+	mock.ExpectQuery("INSERT INTO balance").
+		WithArgs(toUserID).
+		WillReturnRows(pgxmock.NewRows([]string{"current"}).AddRow(int64(0)))
+	mock.ExpectRollback()
+
+	// Act
+	err = repo.Create(context.Background(), fromUserID, toUserID, sum, 0)
+
+	// Assert
+	assert.Error(t, err)
+	assert.IsType(t, &customerror.InsufficientFundsError{}, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransferRepository_Create_DailyLimitExceeded(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewTransferRepository(dbObj)
+
+	fromUserID := 1
+	toUserID := 2
+	sum := int64(10000)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO balance").
+		WithArgs(fromUserID).
+		WillReturnRows(pgxmock.NewRows([]string{"current"}).AddRow(int64(50000)))
+	mock.ExpectQuery("INSERT INTO balance").
+		WithArgs(toUserID).
+		WillReturnRows(pgxmock.NewRows([]string{"current"}).AddRow(int64(0)))
+	mock.ExpectQuery(`SELECT COALESCE.+date_trunc\('day', now\(\) AT TIME ZONE 'UTC'\) AT TIME ZONE 'UTC'`).
+		WithArgs(fromUserID).
+		WillReturnRows(pgxmock.NewRows([]string{"sum"}).AddRow(int64(15000)))
+	mock.ExpectRollback()
+
+	// Act
+	err = repo.Create(context.Background(), fromUserID, toUserID, sum, 20000)
+
+	// Assert
+	assert.Error(t, err)
+	assert.IsType(t, &customerror.LimitExceededError{}, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransferRepository_GetListByUserID_Success(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewTransferRepository(dbObj)
+
+	userID := 1
+	now := time.Now()
+
+	rows := pgxmock.NewRows([]string{"id", "from_user_id", "to_user_id", "from_name", "to_name", "sum", "created_at"}).
+		AddRow(int64(2), 2, userID, "mom", "son", int64(5050), now).
+		AddRow(int64(1), userID, 2, "son", "mom", int64(10000), now.Add(-time.Hour))
+
+	mock.ExpectQuery("SELECT t.id, t.from_user_id, t.to_user_id").
+		WithArgs(userID).
+		WillReturnRows(rows)
+
+	// Act
+	transfers, err := repo.GetListByUserID(context.Background(), userID)
+
+	// Assert
+	assert.NoError(t, err)
+	require.Len(t, transfers, 2)
+
+	assert.Equal(t, models.TransferIncoming, transfers[0].Direction)
+	assert.Equal(t, "mom", transfers[0].Counterparty)
+	assert.Equal(t, float32(50.50), transfers[0].Sum)
+
+	assert.Equal(t, models.TransferOutgoing, transfers[1].Direction)
+	assert.Equal(t, "mom", transfers[1].Counterparty)
+	assert.Equal(t, float32(100.00), transfers[1].Sum)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransferRepository_GetListByUserID_QueryError(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewTransferRepository(dbObj)
+
+	userID := 1
+	expectedError := errors.New("query error")
+
+	mock.ExpectQuery("SELECT t.id, t.from_user_id, t.to_user_id").
+		WithArgs(userID).
+		WillReturnError(expectedError)
+
+	// Act
+	transfers, err := repo.GetListByUserID(context.Background(), userID)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Nil(t, transfers)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
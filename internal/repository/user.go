@@ -3,9 +3,11 @@ package repository
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/Bessima/diplom-gomarket/internal/config/db"
 	"github.com/Bessima/diplom-gomarket/internal/models"
 	"github.com/Bessima/diplom-gomarket/internal/retry"
+	"github.com/Bessima/diplom-gomarket/internal/tracing"
 )
 
 type UserRepository struct {
@@ -13,20 +15,25 @@ type UserRepository struct {
 }
 
 type UserStorageRepositoryI interface {
-	CreateUser(username, passwordHash string) (*models.User, error)
-	GetUserByLogin(username string) (*models.User, error)
-	GetUserByID(id int) (*models.User, error)
+	CreateUser(ctx context.Context, username, passwordHash string) (*models.User, error)
+	GetUserByLogin(ctx context.Context, username string) (*models.User, error)
+	GetUserByID(ctx context.Context, id int) (*models.User, error)
 }
 
 func NewUserRepository(dbObj *db.DB) *UserRepository {
 	return &UserRepository{db: dbObj}
 }
 
-func (repository *UserRepository) CreateUser(username, passwordHash string) (*models.User, error) {
+func (repository *UserRepository) CreateUser(ctx context.Context, username, passwordHash string) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.CreateUser")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
 	query := `INSERT INTO users (name, password) VALUES ($1, $2) RETURNING id, name, password`
 
-	return retry.DoRetryWithResult(context.Background(), func() (*models.User, error) {
-		row := repository.db.Pool.QueryRow(context.Background(), query, username, passwordHash)
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) (*models.User, error) {
+		row := repository.db.Pool.QueryRow(ctx, query, username, passwordHash)
 		if row == nil {
 			return nil, errors.New("user was not created")
 		}
@@ -36,11 +43,16 @@ func (repository *UserRepository) CreateUser(username, passwordHash string) (*mo
 	})
 }
 
-func (repository *UserRepository) GetUserByLogin(username string) (*models.User, error) {
+func (repository *UserRepository) GetUserByLogin(ctx context.Context, username string) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.GetUserByLogin")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
 	query := `SELECT id, name, password FROM users WHERE name = $1`
-	return retry.DoRetryWithResult(context.Background(), func() (*models.User, error) {
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) (*models.User, error) {
 		row := repository.db.Pool.QueryRow(
-			context.Background(),
+			ctx,
 			query,
 			username,
 		)
@@ -51,11 +63,16 @@ func (repository *UserRepository) GetUserByLogin(username string) (*models.User,
 	})
 }
 
-func (repository *UserRepository) GetUserByID(id int) (*models.User, error) {
+func (repository *UserRepository) GetUserByID(ctx context.Context, id int) (_ *models.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.GetUserByID")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
 	query := `SELECT id, name, password FROM users WHERE id = $1`
-	return retry.DoRetryWithResult(context.Background(), func() (*models.User, error) {
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) (*models.User, error) {
 		row := repository.db.Pool.QueryRow(
-			context.Background(),
+			ctx,
 			query,
 			id,
 		)
@@ -65,3 +82,23 @@ func (repository *UserRepository) GetUserByID(id int) (*models.User, error) {
 		return &elem, err
 	})
 }
+
+// UpdatePassword заменяет хеш пароля пользователя с логином username
+func (repository *UserRepository) UpdatePassword(ctx context.Context, username, passwordHash string) (err error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.UpdatePassword")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE users SET password = $1 WHERE name = $2`
+	return retry.DoRetry(ctx, func(ctx context.Context) error {
+		row, err := repository.db.Pool.Exec(ctx, query, passwordHash, username)
+		if err != nil {
+			return err
+		}
+		if row.RowsAffected() == 0 {
+			return fmt.Errorf("user %s not found", username)
+		}
+		return nil
+	})
+}
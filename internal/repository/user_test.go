@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"errors"
 	"testing"
 
@@ -8,6 +9,10 @@ import (
 	"github.com/pashagolub/pgxmock/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestUserRepository_CreateUser_Success(t *testing.T) {
@@ -31,7 +36,7 @@ func TestUserRepository_CreateUser_Success(t *testing.T) {
 		WillReturnRows(rows)
 
 	// Act
-	user, err := repo.CreateUser(username, passwordHash)
+	user, err := repo.CreateUser(context.Background(), username, passwordHash)
 
 	// Assert
 	assert.NoError(t, err)
@@ -60,7 +65,7 @@ func TestUserRepository_CreateUser_DatabaseError(t *testing.T) {
 		WillReturnError(expectedError)
 
 	// Act
-	user, err := repo.CreateUser(username, passwordHash)
+	user, err := repo.CreateUser(context.Background(), username, passwordHash)
 
 	// Assert
 	assert.Error(t, err)
@@ -89,7 +94,7 @@ func TestUserRepository_CreateUser_ScanError(t *testing.T) {
 		WillReturnRows(rows)
 
 	// Act
-	user, err := repo.CreateUser(username, passwordHash)
+	user, err := repo.CreateUser(context.Background(), username, passwordHash)
 
 	// Assert
 	assert.Error(t, err)
@@ -118,7 +123,7 @@ func TestUserRepository_GetUserByLogin_Success(t *testing.T) {
 		WillReturnRows(rows)
 
 	// Act
-	user, err := repo.GetUserByLogin(username)
+	user, err := repo.GetUserByLogin(context.Background(), username)
 
 	// Assert
 	assert.NoError(t, err)
@@ -145,7 +150,7 @@ func TestUserRepository_GetUserByLogin_NotFound(t *testing.T) {
 		WillReturnError(pgx.ErrNoRows)
 
 	// Act
-	user, err := repo.GetUserByLogin(username)
+	user, err := repo.GetUserByLogin(context.Background(), username)
 
 	// Assert
 	assert.Error(t, err)
@@ -170,7 +175,7 @@ func TestUserRepository_GetUserByLogin_DatabaseError(t *testing.T) {
 		WillReturnError(expectedError)
 
 	// Act
-	user, err := repo.GetUserByLogin(username)
+	user, err := repo.GetUserByLogin(context.Background(), username)
 
 	// Assert
 	assert.Error(t, err)
@@ -199,7 +204,7 @@ func TestUserRepository_GetUserByID_Success(t *testing.T) {
 		WillReturnRows(rows)
 
 	// Act
-	user, err := repo.GetUserByID(userID)
+	user, err := repo.GetUserByID(context.Background(), userID)
 
 	// Assert
 	assert.NoError(t, err)
@@ -226,7 +231,7 @@ func TestUserRepository_GetUserByID_NotFound(t *testing.T) {
 		WillReturnError(pgx.ErrNoRows)
 
 	// Act
-	user, err := repo.GetUserByID(userID)
+	user, err := repo.GetUserByID(context.Background(), userID)
 
 	// Assert
 	assert.Error(t, err)
@@ -251,7 +256,7 @@ func TestUserRepository_GetUserByID_DatabaseError(t *testing.T) {
 		WillReturnError(expectedError)
 
 	// Act
-	user, err := repo.GetUserByID(userID)
+	user, err := repo.GetUserByID(context.Background(), userID)
 
 	// Assert
 	assert.Error(t, err)
@@ -259,6 +264,35 @@ func TestUserRepository_GetUserByID_DatabaseError(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestUserRepository_GetUserByID_RecordsErrorInSpan(t *testing.T) {
+	// Arrange
+	exporter := tracetest.NewInMemoryExporter()
+	previousProvider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(previousProvider) })
+
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewUserRepository(NewTestDB(mock))
+	mock.ExpectQuery("SELECT id, name, password FROM users WHERE id").
+		WithArgs(1).
+		WillReturnError(errors.New("database connection error"))
+
+	// Act
+	_, err = repo.GetUserByID(context.Background(), 1)
+
+	// Assert
+	require.Error(t, err)
+	spans := exporter.GetSpans()
+	require.NotEmpty(t, spans)
+	repositorySpan := spans[len(spans)-1]
+	assert.Equal(t, "UserRepository.GetUserByID", repositorySpan.Name)
+	assert.Equal(t, codes.Error, repositorySpan.Status.Code)
+	assert.Equal(t, repositorySpan.SpanContext.SpanID(), spans[0].Parent.SpanID())
+}
+
 func TestUserRepository_CreateUser_DifferentUsers(t *testing.T) {
 	testCases := []struct {
 		name         string
@@ -304,7 +338,7 @@ func TestUserRepository_CreateUser_DifferentUsers(t *testing.T) {
 				WillReturnRows(rows)
 
 			// Act
-			user, err := repo.CreateUser(tc.username, tc.passwordHash)
+			user, err := repo.CreateUser(context.Background(), tc.username, tc.passwordHash)
 
 			// Assert
 			assert.NoError(t, err)
@@ -316,3 +350,44 @@ func TestUserRepository_CreateUser_DifferentUsers(t *testing.T) {
 		})
 	}
 }
+
+func TestUserRepository_UpdatePassword_Success(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewUserRepository(NewTestDB(mock))
+
+	mock.ExpectExec("UPDATE users SET password").
+		WithArgs("$2a$10$newhash", "testuser").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	// Act
+	err = repo.UpdatePassword(context.Background(), "testuser", "$2a$10$newhash")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserRepository_UpdatePassword_UserNotFound(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := NewUserRepository(NewTestDB(mock))
+
+	mock.ExpectExec("UPDATE users SET password").
+		WithArgs("$2a$10$newhash", "unknown").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+
+	// Act
+	err = repo.UpdatePassword(context.Background(), "unknown", "$2a$10$newhash")
+
+	// Assert
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not found")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,290 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/Bessima/diplom-gomarket/internal/customerror"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/retry"
+	"github.com/Bessima/diplom-gomarket/internal/tracing"
+	"time"
+)
+
+type WebhookRepository struct {
+	db *db.DB
+}
+
+// WebhookStorageRepositoryI ownerID == nil означает вебхуки партнеров, которыми управляет администратор
+type WebhookStorageRepositoryI interface {
+	Create(ctx context.Context, ownerID *int, url, secret string, eventTypes []models.WebhookEventType) (*models.Webhook, error)
+	GetListByOwner(ctx context.Context, ownerID *int) ([]models.Webhook, error)
+	Delete(ctx context.Context, ownerID *int, webhookID int64) error
+	GetDeliveries(ctx context.Context, ownerID *int, webhookID int64, limit int) ([]models.WebhookDelivery, error)
+}
+
+// WebhookDeliveryRepositoryI операции воркера доставки
+type WebhookDeliveryRepositoryI interface {
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+	MarkDelivered(ctx context.Context, delivery models.WebhookDelivery, responseCode int) error
+	MarkFailed(ctx context.Context, delivery models.WebhookDelivery, responseCode int, reason string, nextAttemptAt *time.Time, maxFailures int) error
+}
+
+func NewWebhookRepository(dbObj *db.DB) *WebhookRepository {
+	return &WebhookRepository{db: dbObj}
+}
+
+func (repository *WebhookRepository) Create(ctx context.Context, ownerID *int, url, secret string, eventTypes []models.WebhookEventType) (_ *models.Webhook, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookRepository.Create")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `INSERT INTO webhooks (user_id, url, secret, event_types) VALUES ($1, $2, $3, $4)
+		RETURNING id, user_id, url, secret, event_types, active, failure_count, created_at`
+
+	types := make([]string, 0, len(eventTypes))
+	for _, eventType := range eventTypes {
+		types = append(types, string(eventType))
+	}
+
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) (*models.Webhook, error) {
+		row := repository.db.Pool.QueryRow(ctx, query, ownerID, url, secret, types)
+		return scanWebhook(row)
+	})
+}
+
+func (repository *WebhookRepository) GetListByOwner(ctx context.Context, ownerID *int) (_ []models.Webhook, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookRepository.GetListByOwner")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT id, user_id, url, '', event_types, active, failure_count, created_at FROM webhooks
+		WHERE user_id IS NOT DISTINCT FROM $1 ORDER BY id`
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) ([]models.Webhook, error) {
+		rows, err := repository.db.Pool.Query(ctx, query, ownerID)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		webhooks := []models.Webhook{}
+		for rows.Next() {
+			webhook, err := scanWebhook(rows)
+			if err != nil {
+				return nil, err
+			}
+			webhooks = append(webhooks, *webhook)
+		}
+
+		err = rows.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		return webhooks, err
+	})
+}
+
+func (repository *WebhookRepository) Delete(ctx context.Context, ownerID *int, webhookID int64) (err error) {
+	ctx, span := tracing.Start(ctx, "WebhookRepository.Delete")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `DELETE FROM webhooks WHERE id = $1 AND user_id IS NOT DISTINCT FROM $2`
+	return retry.DoRetry(ctx, func(ctx context.Context) error {
+		row, err := repository.db.Pool.Exec(ctx, query, webhookID, ownerID)
+		if err != nil {
+			return err
+		}
+		if row.RowsAffected() == 0 {
+			return customerror.NewNotFoundError(fmt.Sprintf("webhook with id %d", webhookID))
+		}
+		return nil
+	})
+}
+
+func (repository *WebhookRepository) GetDeliveries(ctx context.Context, ownerID *int, webhookID int64, limit int) (_ []models.WebhookDelivery, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookRepository.GetDeliveries")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT d.id, d.webhook_id, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at,
+			d.response_code, d.last_error, d.created_at, d.delivered_at
+		FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.webhook_id = $1 AND w.user_id IS NOT DISTINCT FROM $2
+		ORDER BY d.id DESC LIMIT $3`
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) ([]models.WebhookDelivery, error) {
+		rows, err := repository.db.Pool.Query(ctx, query, webhookID, ownerID, limit)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		deliveries := []models.WebhookDelivery{}
+		for rows.Next() {
+			var delivery models.WebhookDelivery
+			err = rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventType, &delivery.Payload, &delivery.Status,
+				&delivery.Attempts, &delivery.NextAttemptAt, &delivery.ResponseCode, &delivery.LastError,
+				&delivery.CreatedAt, &delivery.DeliveredAt)
+			if err != nil {
+				return nil, err
+			}
+			deliveries = append(deliveries, delivery)
+		}
+
+		err = rows.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		return deliveries, err
+	})
+}
+
+// ClaimDue забирает доставки, время которых подошло, и сдвигает их next_attempt_at на lease,
+// чтобы другие реплики не отправили то же событие параллельно
+func (repository *WebhookRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) (_ []models.WebhookDelivery, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookRepository.ClaimDue")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `WITH due AS (
+			SELECT d.id FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+			WHERE d.status = $1 AND d.next_attempt_at <= now() AND w.active
+			ORDER BY d.next_attempt_at LIMIT $2
+			FOR UPDATE OF d SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d SET next_attempt_at = now() + make_interval(secs => $3)
+		FROM due, webhooks w
+		WHERE d.id = due.id AND w.id = d.webhook_id
+		RETURNING d.id, d.webhook_id, d.event_type, d.payload, d.attempts, w.url, w.secret`
+
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) ([]models.WebhookDelivery, error) {
+		rows, err := repository.db.Pool.Query(ctx, query, models.DeliveryPending, limit, lease.Seconds())
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		deliveries := []models.WebhookDelivery{}
+		for rows.Next() {
+			delivery := models.WebhookDelivery{Status: models.DeliveryPending}
+			err = rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventType, &delivery.Payload,
+				&delivery.Attempts, &delivery.URL, &delivery.Secret)
+			if err != nil {
+				return nil, err
+			}
+			deliveries = append(deliveries, delivery)
+		}
+
+		err = rows.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		return deliveries, err
+	})
+}
+
+func (repository *WebhookRepository) MarkDelivered(ctx context.Context, delivery models.WebhookDelivery, responseCode int) (err error) {
+	ctx, span := tracing.Start(ctx, "WebhookRepository.MarkDelivered")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	queryDelivery := `UPDATE webhook_deliveries SET status = $1, attempts = attempts + 1, response_code = $2,
+		last_error = NULL, delivered_at = now() WHERE id = $3`
+	queryWebhook := `UPDATE webhooks SET failure_count = 0 WHERE id = $1`
+
+	return repository.inTx(ctx, func(ctx context.Context, exec execFunc) error {
+		if err := exec(ctx, queryDelivery, models.DeliveryDelivered, responseCode, delivery.ID); err != nil {
+			return err
+		}
+		return exec(ctx, queryWebhook, delivery.WebhookID)
+	})
+}
+
+// MarkFailed фиксирует неудачную попытку. Если nextAttemptAt == nil, попытки исчерпаны:
+// доставка помечается FAILED, а вебхук отключается после maxFailures таких доставок подряд.
+func (repository *WebhookRepository) MarkFailed(ctx context.Context, delivery models.WebhookDelivery, responseCode int, reason string, nextAttemptAt *time.Time, maxFailures int) (err error) {
+	ctx, span := tracing.Start(ctx, "WebhookRepository.MarkFailed")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	var code *int
+	if responseCode != 0 {
+		code = &responseCode
+	}
+
+	if nextAttemptAt != nil {
+		query := `UPDATE webhook_deliveries SET attempts = attempts + 1, response_code = $1, last_error = $2,
+			next_attempt_at = $3 WHERE id = $4`
+		return retry.DoRetry(ctx, func(ctx context.Context) error {
+			_, err := repository.db.Pool.Exec(ctx, query, code, reason, *nextAttemptAt, delivery.ID)
+			return err
+		})
+	}
+
+	queryDelivery := `UPDATE webhook_deliveries SET status = $1, attempts = attempts + 1, response_code = $2,
+		last_error = $3 WHERE id = $4`
+	queryWebhook := `UPDATE webhooks SET failure_count = failure_count + 1,
+		active = active AND failure_count + 1 < $1 WHERE id = $2`
+
+	return repository.inTx(ctx, func(ctx context.Context, exec execFunc) error {
+		if err := exec(ctx, queryDelivery, models.DeliveryFailed, code, reason, delivery.ID); err != nil {
+			return err
+		}
+		return exec(ctx, queryWebhook, maxFailures, delivery.WebhookID)
+	})
+}
+
+type execFunc func(ctx context.Context, query string, args ...any) error
+
+func (repository *WebhookRepository) inTx(ctx context.Context, fn func(ctx context.Context, exec execFunc) error) error {
+	return retry.DoRetry(ctx, func(ctx context.Context) error {
+		tx, err := repository.db.Pool.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				tx.Rollback(ctx)
+			}
+		}()
+
+		err = fn(ctx, func(ctx context.Context, query string, args ...any) error {
+			_, err := tx.Exec(ctx, query, args...)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		err = tx.Commit(ctx)
+		return err
+	})
+}
+
+type webhookScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanWebhook(row webhookScanner) (*models.Webhook, error) {
+	var webhook models.Webhook
+	var types []string
+	err := row.Scan(&webhook.ID, &webhook.UserID, &webhook.URL, &webhook.Secret, &types, &webhook.Active,
+		&webhook.FailureCount, &webhook.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	for _, eventType := range types {
+		webhook.EventTypes = append(webhook.EventTypes, models.WebhookEventType(eventType))
+	}
+	return &webhook, nil
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/customerror"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookRepository_Create_Success(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewWebhookRepository(dbObj)
+
+	userID := 1
+	createdAt := time.Now()
+	mock.ExpectQuery("INSERT INTO webhooks").
+		WithArgs(&userID, "https://example.com/hook", "secret", []string{"order.processed"}).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "user_id", "url", "secret", "event_types", "active", "failure_count", "created_at"}).
+			AddRow(int64(7), &userID, "https://example.com/hook", "secret", []string{"order.processed"}, true, 0, createdAt))
+
+	// Act
+	webhook, err := repo.Create(context.Background(), &userID, "https://example.com/hook", "secret", []models.WebhookEventType{models.OrderProcessedEvent})
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), webhook.ID)
+	assert.Equal(t, "secret", webhook.Secret)
+	assert.Equal(t, []models.WebhookEventType{models.OrderProcessedEvent}, webhook.EventTypes)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebhookRepository_Delete_NotFound(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewWebhookRepository(dbObj)
+
+	userID := 1
+	mock.ExpectExec("DELETE FROM webhooks").
+		WithArgs(int64(3), &userID).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+
+	// Act
+	err = repo.Delete(context.Background(), &userID, 3)
+
+	// Assert
+	var notFoundErr *customerror.NotFoundError
+	assert.ErrorAs(t, err, &notFoundErr)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebhookRepository_ClaimDue(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewWebhookRepository(dbObj)
+
+	payload := json.RawMessage(`{"event":"order.processed"}`)
+	mock.ExpectQuery("WITH due AS").
+		WithArgs(models.DeliveryPending, 10, float64(60)).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "webhook_id", "event_type", "payload", "attempts", "url", "secret"}).
+			AddRow(int64(1), int64(7), models.OrderProcessedEvent, payload, 2, "https://example.com/hook", "secret"))
+
+	// Act
+	deliveries, err := repo.ClaimDue(context.Background(), 10, time.Minute)
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, 2, deliveries[0].Attempts)
+	assert.Equal(t, "https://example.com/hook", deliveries[0].URL)
+	assert.Equal(t, models.DeliveryPending, deliveries[0].Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebhookRepository_MarkFailed_Retry(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewWebhookRepository(dbObj)
+
+	next := time.Now().Add(time.Minute)
+	code := 500
+	mock.ExpectExec("UPDATE webhook_deliveries SET attempts").
+		WithArgs(&code, "boom", next, int64(1)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	// Act
+	err = repo.MarkFailed(context.Background(), models.WebhookDelivery{ID: 1, WebhookID: 7}, code, "boom", &next, 5)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebhookRepository_MarkFailed_Final(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewWebhookRepository(dbObj)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE webhook_deliveries SET status").
+		WithArgs(models.DeliveryFailed, pgxmock.AnyArg(), "timeout", int64(1)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("UPDATE webhooks SET failure_count").
+		WithArgs(5, int64(7)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+
+	// Act
+	err = repo.MarkFailed(context.Background(), models.WebhookDelivery{ID: 1, WebhookID: 7}, 0, "timeout", nil, 5)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebhookRepository_MarkDelivered(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewWebhookRepository(dbObj)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE webhook_deliveries SET status").
+		WithArgs(models.DeliveryDelivered, 200, int64(1)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec("UPDATE webhooks SET failure_count = 0").
+		WithArgs(int64(7)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+
+	// Act
+	err = repo.MarkDelivered(context.Background(), models.WebhookDelivery{ID: 1, WebhookID: 7}, 200)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -8,8 +8,11 @@ import (
 	"github.com/Bessima/diplom-gomarket/internal/customerror"
 	"github.com/Bessima/diplom-gomarket/internal/models"
 	"github.com/Bessima/diplom-gomarket/internal/retry"
+	"github.com/Bessima/diplom-gomarket/internal/tracing"
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5/pgconn"
+	"strconv"
+	"time"
 )
 
 type WithdrawRepository struct {
@@ -17,44 +20,89 @@ type WithdrawRepository struct {
 }
 
 type WithdrawStorageRepositoryI interface {
-	Create(userID int, orderID int64, sum int) error
-	GetListByUserID(id int) ([]models.Withdrawal, error)
+	Withdraw(ctx context.Context, userID int, orderID int64, sum int) error
+	GetListByUserID(ctx context.Context, id int) ([]models.Withdrawal, error)
+	GetPageByUserID(ctx context.Context, userID int, filter WithdrawalListFilter) ([]models.Withdrawal, error)
+	StreamByUserID(ctx context.Context, userID int, from, to *time.Time, fn func(models.WithdrawalRecord) error) error
 }
 
 func NewWithdrawRepository(dbObj *db.DB) *WithdrawRepository {
 	return &WithdrawRepository{db: dbObj}
 }
 
-func (repository *WithdrawRepository) Create(userID int, orderID int64, sum int) error {
-	query := `INSERT INTO withdrawals (user_id,order_id, sum) VALUES ($1, $2, $3)`
+// Withdraw списывает sum копеек с баланса пользователя и записывает списание одной транзакцией, поэтому
+// списание без изменения баланса не остается. При нехватке средств возвращает InsufficientFundsError,
+// при повторном номере заказа - UniqueViolationError.
+func (repository *WithdrawRepository) Withdraw(ctx context.Context, userID int, orderID int64, sum int) (err error) {
+	ctx, span := tracing.Start(ctx, "WithdrawRepository.Withdraw")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
 
-	return retry.DoRetry(context.Background(), func() error {
-		row, err := repository.db.Pool.Exec(context.Background(), query, userID, orderID, sum)
+	queryDebit := `UPDATE balance SET current = (balance.current - $1), withdrawals = (balance.withdrawals + $1)
+		WHERE user_id = $2 AND balance.current >= $1`
+	queryWithdraw := `INSERT INTO withdrawals (user_id,order_id, sum) VALUES ($1, $2, $3)`
+
+	repository.db.MarkWrite(userID)
+	return retry.DoRetry(ctx, func(ctx context.Context) error {
+		tx, err := repository.db.Pool.Begin(ctx)
 		if err != nil {
-			var pgErr *pgconn.PgError
-			if errors.As(err, &pgErr) {
-				if pgErr.Code == pgerrcode.UniqueViolation {
-					errWithMessage := fmt.Sprintf("withdraw with orderID %v already exists", orderID)
-					return customerror.NewUniqueViolationError(errWithMessage)
-				}
-			}
-			return customerror.NewCommonPGError(err.Error())
+			return err
+		}
+		defer tx.Rollback(ctx)
+
+		row, err := tx.Exec(ctx, queryDebit, sum, userID)
+		if err != nil {
+			return err
 		}
 		if row.RowsAffected() == 0 {
-			err = fmt.Errorf("withdraw was not installed for orderID %v", orderID)
-			return customerror.NewCommonPGError(err.Error())
+			return customerror.NewInsufficientFundsError(fmt.Sprintf("user %d has not enough points for withdraw", userID))
+		}
+
+		_, err = tx.Exec(ctx, queryWithdraw, userID, orderID, sum)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+				return customerror.NewUniqueViolationError(fmt.Sprintf("withdraw with orderID %v already exists", orderID))
+			}
+			return err
 		}
-		return nil
+		return tx.Commit(ctx)
 	})
 }
 
-func (repository *WithdrawRepository) GetListByUserID(userID int) ([]models.Withdrawal, error) {
-	query := `SELECT order_id,user_id,sum,processed_at FROM withdrawals WHERE user_id = $1`
-	return retry.DoRetryWithResult(context.Background(), func() ([]models.Withdrawal, error) {
-		rows, err := repository.db.Pool.Query(
-			context.Background(),
+func (repository *WithdrawRepository) GetListByUserID(ctx context.Context, userID int) (_ []models.Withdrawal, err error) {
+	ctx, span := tracing.Start(ctx, "WithdrawRepository.GetListByUserID")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT order_id,user_id,sum,processed_at FROM withdrawals WHERE user_id = $1 ORDER BY processed_at DESC`
+	return repository.getList(ctx, repository.db.ReadPool(ctx, userID), query, userID)
+}
+
+// GetPageByUserID возвращает страницу списаний пользователя с учетом фильтров и курсора
+func (repository *WithdrawRepository) GetPageByUserID(ctx context.Context, userID int, filter WithdrawalListFilter) (_ []models.Withdrawal, err error) {
+	ctx, span := tracing.Start(ctx, "WithdrawRepository.GetPageByUserID")
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := repository.db.WithQueryTimeout(ctx)
+	defer cancel()
+
+	builder := queryBuilder{}
+	builder.add("user_id = %s", userID)
+	builder.addRange("processed_at", filter.From, filter.To)
+	suffix := builder.addPage("processed_at", "order_id", filter.Sort, filter.Cursor, filter.Limit)
+
+	query := `SELECT order_id,user_id,sum,processed_at FROM withdrawals` + builder.where() + suffix
+	return repository.getList(ctx, repository.db.ReadPool(ctx, userID), query, builder.args...)
+}
+
+func (repository *WithdrawRepository) getList(ctx context.Context, pool db.PgxPoolInterface, query string, args ...any) ([]models.Withdrawal, error) {
+	return retry.DoRetryWithResult(ctx, func(ctx context.Context) ([]models.Withdrawal, error) {
+		rows, err := pool.Query(
+			ctx,
 			query,
-			userID,
+			args...,
 		)
 		if err != nil {
 			return nil, err
@@ -83,3 +131,36 @@ func (repository *WithdrawRepository) GetListByUserID(userID int) ([]models.With
 		return withdrawals, err
 	})
 }
+
+// StreamByUserID построчно передает списания пользователя в fn, не загружая всю выборку в память.
+// Повторные попытки не выполняются, так как часть строк уже может быть передана.
+func (repository *WithdrawRepository) StreamByUserID(ctx context.Context, userID int, from, to *time.Time, fn func(models.WithdrawalRecord) error) (err error) {
+	ctx, span := tracing.Start(ctx, "WithdrawRepository.StreamByUserID")
+	defer func() { tracing.End(span, err) }()
+
+	query := `SELECT order_id,COALESCE(sum, 0),processed_at FROM withdrawals
+		WHERE user_id = $1 AND ($2::timestamptz IS NULL OR processed_at >= $2) AND ($3::timestamptz IS NULL OR processed_at < $3)
+		ORDER BY processed_at`
+
+	rows, err := repository.db.Pool.Query(ctx, query, userID, from, to)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var record models.WithdrawalRecord
+		var orderID int64
+		err = rows.Scan(&orderID, &record.SumKopecks, &record.ProcessedAt)
+		if err != nil {
+			return err
+		}
+		record.Order = strconv.FormatInt(orderID, 10)
+
+		if err = fn(record); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -1,11 +1,13 @@
 package repository
 
 import (
+	"context"
 	"errors"
 	"testing"
 	"time"
 
 	"github.com/Bessima/diplom-gomarket/internal/customerror"
+	"github.com/Bessima/diplom-gomarket/internal/models"
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/pashagolub/pgxmock/v3"
@@ -13,118 +15,92 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func TestWithdrawRepository_Create_Success(t *testing.T) {
+func TestWithdrawRepository_Withdraw_Success(t *testing.T) {
 	// Arrange
 	mock, err := pgxmock.NewPool()
 	require.NoError(t, err)
 	defer mock.Close()
 
-	dbObj := NewTestDB(mock)
-	repo := NewWithdrawRepository(dbObj)
+	repo := NewWithdrawRepository(NewTestDB(mock))
 
 	userID := 1
 	orderID := int64(12345)
 	sum := 10000
 
+	// Баланс и списание меняются в одной транзакции
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE balance SET current").
+		WithArgs(sum, userID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
 	mock.ExpectExec("INSERT INTO withdrawals").
 		WithArgs(userID, orderID, sum).
 		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
 
 	// Act
-	err = repo.Create(userID, orderID, sum)
+	err = repo.Withdraw(context.Background(), userID, orderID, sum)
 
 	// Assert
 	assert.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestWithdrawRepository_Create_UniqueViolation(t *testing.T) {
+func TestWithdrawRepository_Withdraw_InsufficientFunds(t *testing.T) {
 	// Arrange
 	mock, err := pgxmock.NewPool()
 	require.NoError(t, err)
 	defer mock.Close()
 
-	dbObj := NewTestDB(mock)
-	repo := NewWithdrawRepository(dbObj)
-
-	userID := 1
-	orderID := int64(12345)
-	sum := 10000
-
-	pgErr := &pgconn.PgError{
-		Code:    pgerrcode.UniqueViolation,
-		Message: "duplicate key value",
-	}
-
-	mock.ExpectExec("INSERT INTO withdrawals").
-		WithArgs(userID, orderID, sum).
-		WillReturnError(pgErr)
-
-	// Act
-	err = repo.Create(userID, orderID, sum)
-
-	// Assert
-	assert.Error(t, err)
-	assert.IsType(t, &customerror.UniqueViolationError{}, err)
-	assert.Contains(t, err.Error(), "already exists")
-	assert.NoError(t, mock.ExpectationsWereMet())
-}
-
-func TestWithdrawRepository_Create_NoRowsAffected(t *testing.T) {
-	// Arrange
-	mock, err := pgxmock.NewPool()
-	require.NoError(t, err)
-	defer mock.Close()
-
-	dbObj := NewTestDB(mock)
-	repo := NewWithdrawRepository(dbObj)
+	repo := NewWithdrawRepository(NewTestDB(mock))
 
 	userID := 1
 	orderID := int64(12345)
 	sum := 10000
 
-	mock.ExpectExec("INSERT INTO withdrawals").
-		WithArgs(userID, orderID, sum).
-		WillReturnResult(pgxmock.NewResult("INSERT", 0))
+	// Строка баланса не обновлена: средств меньше, чем sum. Списание не записывается.
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE balance SET current").
+		WithArgs(sum, userID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	mock.ExpectRollback()
 
 	// Act
-	err = repo.Create(userID, orderID, sum)
+	err = repo.Withdraw(context.Background(), userID, orderID, sum)
 
 	// Assert
-	assert.Error(t, err)
-	assert.IsType(t, &customerror.CommonPGError{}, err)
-	assert.Contains(t, err.Error(), "was not installed")
+	var fundsErr *customerror.InsufficientFundsError
+	assert.ErrorAs(t, err, &fundsErr)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestWithdrawRepository_Create_DatabaseError(t *testing.T) {
+func TestWithdrawRepository_Withdraw_UniqueViolation(t *testing.T) {
 	// Arrange
 	mock, err := pgxmock.NewPool()
 	require.NoError(t, err)
 	defer mock.Close()
 
-	dbObj := NewTestDB(mock)
-	repo := NewWithdrawRepository(dbObj)
+	repo := NewWithdrawRepository(NewTestDB(mock))
 
 	userID := 1
 	orderID := int64(12345)
 	sum := 10000
 
-	pgErr := &pgconn.PgError{
-		Code:    pgerrcode.ConnectionException,
-		Message: "connection error",
-	}
-
+	// Повторный номер заказа откатывает и изменение баланса
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE balance SET current").
+		WithArgs(sum, userID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
 	mock.ExpectExec("INSERT INTO withdrawals").
 		WithArgs(userID, orderID, sum).
-		WillReturnError(pgErr)
+		WillReturnError(&pgconn.PgError{Code: pgerrcode.UniqueViolation, Message: "duplicate key value"})
+	mock.ExpectRollback()
 
 	// Act
-	err = repo.Create(userID, orderID, sum)
+	err = repo.Withdraw(context.Background(), userID, orderID, sum)
 
 	// Assert
-	assert.Error(t, err)
-	assert.IsType(t, &customerror.CommonPGError{}, err)
+	var uniqueErr *customerror.UniqueViolationError
+	assert.ErrorAs(t, err, &uniqueErr)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -149,7 +125,7 @@ func TestWithdrawRepository_GetListByUserID_Success(t *testing.T) {
 		WillReturnRows(rows)
 
 	// Act
-	withdrawals, err := repo.GetListByUserID(userID)
+	withdrawals, err := repo.GetListByUserID(context.Background(), userID)
 
 	// Assert
 	assert.NoError(t, err)
@@ -185,7 +161,7 @@ func TestWithdrawRepository_GetListByUserID_Empty(t *testing.T) {
 		WillReturnRows(rows)
 
 	// Act
-	withdrawals, err := repo.GetListByUserID(userID)
+	withdrawals, err := repo.GetListByUserID(context.Background(), userID)
 
 	// Assert
 	assert.NoError(t, err)
@@ -210,7 +186,7 @@ func TestWithdrawRepository_GetListByUserID_QueryError(t *testing.T) {
 		WillReturnError(expectedError)
 
 	// Act
-	withdrawals, err := repo.GetListByUserID(userID)
+	withdrawals, err := repo.GetListByUserID(context.Background(), userID)
 
 	// Assert
 	assert.Error(t, err)
@@ -239,7 +215,7 @@ func TestWithdrawRepository_GetListByUserID_ScanError(t *testing.T) {
 		WillReturnRows(rows)
 
 	// Act
-	withdrawals, err := repo.GetListByUserID(userID)
+	withdrawals, err := repo.GetListByUserID(context.Background(), userID)
 
 	// Assert
 	assert.Error(t, err)
@@ -247,57 +223,6 @@ func TestWithdrawRepository_GetListByUserID_ScanError(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestWithdrawRepository_Create_DifferentAmounts(t *testing.T) {
-	testCases := []struct {
-		name    string
-		userID  int
-		orderID int64
-		sum     int
-	}{
-		{
-			name:    "small sum",
-			userID:  1,
-			orderID: 12345,
-			sum:     100,
-		},
-		{
-			name:    "large sum",
-			userID:  2,
-			orderID: 67890,
-			sum:     100000,
-		},
-		{
-			name:    "medium sum",
-			userID:  3,
-			orderID: 11111,
-			sum:     50000,
-		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			// Arrange
-			mock, err := pgxmock.NewPool()
-			require.NoError(t, err)
-			defer mock.Close()
-
-			dbObj := NewTestDB(mock)
-			repo := NewWithdrawRepository(dbObj)
-
-			mock.ExpectExec("INSERT INTO withdrawals").
-				WithArgs(tc.userID, tc.orderID, tc.sum).
-				WillReturnResult(pgxmock.NewResult("INSERT", 1))
-
-			// Act
-			err = repo.Create(tc.userID, tc.orderID, tc.sum)
-
-			// Assert
-			assert.NoError(t, err)
-			assert.NoError(t, mock.ExpectationsWereMet())
-		})
-	}
-}
-
 func TestWithdrawRepository_GetListByUserID_MultipleUsers(t *testing.T) {
 	testCases := []struct {
 		name        string
@@ -351,7 +276,7 @@ func TestWithdrawRepository_GetListByUserID_MultipleUsers(t *testing.T) {
 				WillReturnRows(rows)
 
 			// Act
-			withdrawals, err := repo.GetListByUserID(tc.userID)
+			withdrawals, err := repo.GetListByUserID(context.Background(), tc.userID)
 
 			// Assert
 			assert.NoError(t, err)
@@ -364,3 +289,69 @@ func TestWithdrawRepository_GetListByUserID_MultipleUsers(t *testing.T) {
 		})
 	}
 }
+
+func TestWithdrawRepository_StreamByUserID_Success(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewWithdrawRepository(dbObj)
+
+	userID := 1
+	from := time.Now().Add(-24 * time.Hour)
+	now := time.Now()
+
+	rows := pgxmock.NewRows([]string{"order_id", "sum", "processed_at"}).
+		AddRow(int64(2377225624), int64(50000), now)
+
+	mock.ExpectQuery("SELECT order_id,COALESCE\\(sum, 0\\),processed_at FROM withdrawals").
+		WithArgs(userID, &from, pgxmock.AnyArg()).
+		WillReturnRows(rows)
+
+	// Act
+	var records []models.WithdrawalRecord
+	err = repo.StreamByUserID(context.Background(), userID, &from, nil, func(record models.WithdrawalRecord) error {
+		records = append(records, record)
+		return nil
+	})
+
+	// Assert
+	assert.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "2377225624", records[0].Order)
+	assert.Equal(t, int64(50000), records[0].SumKopecks)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithdrawRepository_GetPageByUserID_WithCursor(t *testing.T) {
+	// Arrange
+	mock, err := pgxmock.NewPool(pgxmock.QueryMatcherOption(pgxmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer mock.Close()
+
+	dbObj := NewTestDB(mock)
+	repo := NewWithdrawRepository(dbObj)
+
+	userID := 1
+	to := time.Now()
+	cursor := &models.ListCursor{At: time.Now().Add(-time.Hour), ID: 2377225624}
+	filter := WithdrawalListFilter{To: &to, Cursor: cursor, Limit: 3}
+
+	rows := pgxmock.NewRows([]string{"order_id", "user_id", "sum", "processed_at"}).
+		AddRow("12345", userID, int32(10000), time.Now().Add(-2*time.Hour))
+
+	mock.ExpectQuery("SELECT order_id,user_id,sum,processed_at FROM withdrawals WHERE user_id = $1 AND processed_at < $2 AND (processed_at, order_id) < ($3, $4) ORDER BY processed_at DESC, order_id DESC LIMIT $5").
+		WithArgs(userID, to, cursor.At, cursor.ID, 3).
+		WillReturnRows(rows)
+
+	// Act
+	withdrawals, err := repo.GetPageByUserID(context.Background(), userID, filter)
+
+	// Assert
+	assert.NoError(t, err)
+	require.Len(t, withdrawals, 1)
+	assert.Equal(t, float32(100.00), withdrawals[0].Sum)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
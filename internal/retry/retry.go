@@ -4,20 +4,29 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/Bessima/diplom-gomarket/internal/metrics"
+	"github.com/Bessima/diplom-gomarket/internal/tracing"
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"log"
+	"slices"
+	"sync"
 	"time"
 )
 
 // RetryConfig конфигурация для повторных попыток
 type RetryConfig struct {
+	// Name политика повторов в метрике retry_attempts_total
+	Name        string
 	MaxRetries  int
 	Delays      []time.Duration
 	ShouldRetry func(error) bool
 }
 
 var AccrualRetryConfig = RetryConfig{
+	Name:       "accrual",
 	MaxRetries: 3,
 	Delays:     []time.Duration{1 * time.Second, 3 * time.Second, 5 * time.Second},
 	ShouldRetry: func(err error) bool {
@@ -25,7 +34,29 @@ var AccrualRetryConfig = RetryConfig{
 	},
 }
 
+// WebhookRetryConfig задержки между попытками доставки вебхука. Попытки выполняются
+// воркером доставки по расписанию, а не в цикле DoRetry, поэтому переживают перезапуск.
+var WebhookRetryConfig = RetryConfig{
+	Name:       "webhook",
+	MaxRetries: 6,
+	Delays:     []time.Duration{10 * time.Second, 30 * time.Second, 1 * time.Minute, 5 * time.Minute, 30 * time.Minute},
+	ShouldRetry: func(err error) bool {
+		return true
+	},
+}
+
+// NotificationRetryConfig повторные попытки отправки уведомления в канал
+var NotificationRetryConfig = RetryConfig{
+	Name:       "notification",
+	MaxRetries: 4,
+	Delays:     []time.Duration{1 * time.Second, 5 * time.Second, 30 * time.Second},
+	ShouldRetry: func(err error) bool {
+		return true
+	},
+}
+
 var PostgresStorageRetryConfig = RetryConfig{
+	Name:       "postgres",
 	MaxRetries: 3,
 	Delays:     []time.Duration{1 * time.Second, 3 * time.Second, 5 * time.Second},
 	ShouldRetry: func(err error) bool {
@@ -33,6 +64,34 @@ var PostgresStorageRetryConfig = RetryConfig{
 	},
 }
 
+// policyOverrides параметры политик, заданные конфигурацией, по имени политики.
+// Хранятся отдельно от переменных политик, чтобы их можно было менять на лету без гонок.
+var policyOverrides sync.Map
+
+type policyOverride struct {
+	maxRetries int
+	delays     []time.Duration
+}
+
+// SetPolicy задает число попыток и задержки для политики cfg.Name, ShouldRetry не меняется.
+// Применяется к повторам DoRetry и DoRetryWithResult, начатым после вызова.
+func SetPolicy(cfg RetryConfig) {
+	policyOverrides.Store(cfg.policyName(), policyOverride{
+		maxRetries: cfg.MaxRetries,
+		delays:     slices.Clone(cfg.Delays),
+	})
+}
+
+// effective возвращает политику с учетом параметров, заданных через SetPolicy
+func (cfg RetryConfig) effective() RetryConfig {
+	if value, ok := policyOverrides.Load(cfg.policyName()); ok {
+		override := value.(policyOverride)
+		cfg.MaxRetries = override.maxRetries
+		cfg.Delays = override.delays
+	}
+	return cfg
+}
+
 func IsConnectionExceptionPG(err error) bool {
 	var pgErr *pgconn.PgError
 	if errors.As(err, &pgErr) {
@@ -53,17 +112,21 @@ func IsConnectionExceptionPG(err error) bool {
 	return false
 }
 
-// DoRetry выполняет функцию с повторными попытками при ошибках соединения
-func DoRetry(ctx context.Context, fn func() error, config ...RetryConfig) error {
+// DoRetry выполняет функцию с повторными попытками при ошибках соединения. fn получает контекст
+// спана попытки, чтобы запросы внутри попытки попадали в трассу дочерними спанами.
+func DoRetry(ctx context.Context, fn func(ctx context.Context) error, config ...RetryConfig) error {
 	cfg := PostgresStorageRetryConfig
 	if len(config) > 0 {
 		cfg = config[0]
 	}
+	cfg = cfg.effective()
 
 	var lastErr error
 
 	for attempt := 0; attempt < cfg.MaxRetries; attempt++ {
-		lastErr = fn()
+		attemptCtx, span := cfg.startAttempt(ctx, attempt)
+		lastErr = fn(attemptCtx)
+		tracing.End(span, lastErr)
 		if lastErr == nil {
 			return nil
 		}
@@ -74,11 +137,14 @@ func DoRetry(ctx context.Context, fn func() error, config ...RetryConfig) error
 		}
 
 		log.Printf("DoRetry attempt %d failed: %v\n", attempt+1, lastErr)
+		if attempt+1 == cfg.MaxRetries {
+			break
+		}
+		metrics.RetryAttempts.WithLabelValues(cfg.policyName()).Inc()
 
 		// Выбираем задержку для текущей попытки
-		delay := getDelay(cfg.Delays, attempt)
-		if delay > 0 {
-			time.Sleep(delay)
+		if err := sleep(ctx, getDelay(cfg.Delays, attempt)); err != nil {
+			return fmt.Errorf("retry was interrupted: %w, last error: %v", err, lastErr)
 		}
 	}
 
@@ -86,18 +152,21 @@ func DoRetry(ctx context.Context, fn func() error, config ...RetryConfig) error
 }
 
 // DoRetryWithResult выполняет функцию с возвращаемым значением и повторными попытками
-func DoRetryWithResult[T any](ctx context.Context, fn func() (T, error), config ...RetryConfig) (T, error) {
+func DoRetryWithResult[T any](ctx context.Context, fn func(ctx context.Context) (T, error), config ...RetryConfig) (T, error) {
 	var zero T
 	cfg := PostgresStorageRetryConfig
 	if len(config) > 0 {
 		cfg = config[0]
 	}
+	cfg = cfg.effective()
 
 	var lastErr error
 	var result T
 
 	for attempt := 0; attempt < cfg.MaxRetries; attempt++ {
-		result, lastErr = fn()
+		attemptCtx, span := cfg.startAttempt(ctx, attempt)
+		result, lastErr = fn(attemptCtx)
+		tracing.End(span, lastErr)
 		if lastErr == nil {
 			return result, nil
 		}
@@ -108,17 +177,56 @@ func DoRetryWithResult[T any](ctx context.Context, fn func() (T, error), config
 		}
 
 		log.Printf("DoRetry attempt %d failed: %v\n", attempt+1, lastErr)
+		if attempt+1 == cfg.MaxRetries {
+			break
+		}
+		metrics.RetryAttempts.WithLabelValues(cfg.policyName()).Inc()
 
 		// Выбираем задержку для текущей попытки
-		delay := getDelay(cfg.Delays, attempt)
-		if delay > 0 {
-			time.Sleep(delay)
+		if err := sleep(ctx, getDelay(cfg.Delays, attempt)); err != nil {
+			return zero, fmt.Errorf("retry was interrupted: %w, last error: %v", err, lastErr)
 		}
 	}
 
 	return zero, fmt.Errorf("after %d retries operation failed, last error: %v", cfg.MaxRetries, lastErr)
 }
 
+// sleep ждет delay или отмены ctx, чтобы отмененный запрос или остановка сервиса не ждали повторных попыток
+func sleep(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (cfg RetryConfig) policyName() string {
+	if cfg.Name == "" {
+		return "custom"
+	}
+	return cfg.Name
+}
+
+// startAttempt открывает спан на одну попытку, чтобы повторы были видны в трассе
+func (cfg RetryConfig) startAttempt(ctx context.Context, attempt int) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "retry.attempt",
+		attribute.String("retry.policy", cfg.policyName()),
+		attribute.Int("retry.attempt", attempt+1),
+	)
+}
+
+// GetDelay возвращает задержку после неудачной попытки attempt (нумерация с нуля)
+func (cfg RetryConfig) GetDelay(attempt int) time.Duration {
+	return getDelay(cfg.Delays, attempt)
+}
+
 // getDelay возвращает задержку для текущей попытки
 func getDelay(delays []time.Duration, attempt int) time.Duration {
 	if attempt < len(delays) {
@@ -0,0 +1,117 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var errTemporary = errors.New("temporary")
+
+func testConfig(delay time.Duration) RetryConfig {
+	return RetryConfig{
+		Name:        "test",
+		MaxRetries:  3,
+		Delays:      []time.Duration{delay},
+		ShouldRetry: func(err error) bool { return errors.Is(err, errTemporary) },
+	}
+}
+
+func TestDoRetry_SucceedsAfterRetry(t *testing.T) {
+	calls := 0
+	err := DoRetry(context.Background(), func(context.Context) error {
+		calls++
+		if calls < 2 {
+			return errTemporary
+		}
+		return nil
+	}, testConfig(time.Millisecond))
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestDoRetry_StopsOnPermanentError(t *testing.T) {
+	permanent := errors.New("permanent")
+	calls := 0
+	err := DoRetry(context.Background(), func(context.Context) error {
+		calls++
+		return permanent
+	}, testConfig(time.Millisecond))
+
+	assert.ErrorIs(t, err, permanent)
+	assert.Equal(t, 1, calls)
+}
+
+func TestDoRetry_DoesNotSleepAfterLastAttempt(t *testing.T) {
+	cfg := testConfig(50 * time.Millisecond)
+	start := time.Now()
+	_, err := DoRetryWithResult(context.Background(), func(context.Context) (int, error) {
+		return 0, errTemporary
+	}, cfg)
+
+	require.Error(t, err)
+	// Две паузы между тремя попытками, без паузы после последней
+	assert.Less(t, time.Since(start), 140*time.Millisecond)
+}
+
+func TestDoRetry_SleepInterruptedByContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	start := time.Now()
+
+	time.AfterFunc(20*time.Millisecond, cancel)
+	_, err := DoRetryWithResult(ctx, func(ctx context.Context) (int, error) {
+		calls++
+		return 0, errTemporary
+	}, testConfig(time.Minute))
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, calls)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestSetPolicy_OverridesAttemptsByName(t *testing.T) {
+	cfg := testConfig(0)
+	cfg.Name = "test-override"
+	SetPolicy(RetryConfig{Name: cfg.Name, MaxRetries: 5})
+
+	calls := 0
+	err := DoRetry(context.Background(), func(context.Context) error {
+		calls++
+		return errTemporary
+	}, cfg)
+
+	assert.Error(t, err)
+	assert.Equal(t, 5, calls)
+	// Переменная политики не меняется, параметры применяются при каждом вызове
+	assert.Equal(t, 3, cfg.MaxRetries)
+}
+
+func TestDoRetry_AttemptSpanIsParentOfQuerySpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	previousProvider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(previousProvider) })
+
+	err := DoRetry(context.Background(), func(ctx context.Context) error {
+		_, span := tracing.Start(ctx, "db.query")
+		span.End()
+		return nil
+	}, testConfig(0))
+
+	require.NoError(t, err)
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "db.query", spans[0].Name)
+	assert.Equal(t, "retry.attempt", spans[1].Name)
+	assert.Equal(t, spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID())
+}
@@ -2,62 +2,144 @@ package server
 
 import (
 	"context"
-	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/Bessima/diplom-gomarket/internal/customerror"
 	"github.com/Bessima/diplom-gomarket/internal/handlers"
+	"github.com/Bessima/diplom-gomarket/internal/health"
+	"github.com/Bessima/diplom-gomarket/internal/metrics"
 	middleware "github.com/Bessima/diplom-gomarket/internal/middlewares"
 	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
-	"github.com/Bessima/diplom-gomarket/internal/models"
 	"github.com/Bessima/diplom-gomarket/internal/repository"
+	"github.com/Bessima/diplom-gomarket/internal/service"
+	"github.com/Bessima/diplom-gomarket/internal/tracing"
 	"github.com/go-chi/chi/v5"
 	"net"
 	"net/http"
-	"time"
 )
 
 type ServerService struct {
-	Server *http.Server
-	db     *db.DB
+	Server      *http.Server
+	storage     repository.Storage
+	rootContext context.Context
 }
 
-func NewServerService(rootContext context.Context, address string, db *db.DB) ServerService {
+func NewServerService(rootContext context.Context, address string, storage repository.Storage) ServerService {
 	server := &http.Server{
 		Addr: address,
 		BaseContext: func(_ net.Listener) context.Context {
 			return rootContext
 		},
 	}
-	return ServerService{Server: server, db: db}
+	return ServerService{Server: server, storage: storage, rootContext: rootContext}
 }
 
-func (serverService *ServerService) SetRouter(jwtConfig *handlers.JWTConfig, ordersForProcessing chan models.Order) {
-	serverService.Server.Handler = serverService.getRouter(jwtConfig, ordersForProcessing)
+func (serverService *ServerService) SetRouter(
+	jwtConfig *handlers.JWTConfig,
+	orderQueue *service.OrderQueue,
+	transferDailyLimit int64,
+	orderEvents handlers.OrderEventSubscriber,
+	adminToken string,
+	readiness *health.Checker,
+	accessLog logger.AccessLogConfig,
+) {
+	serverService.Server.Handler = serverService.getRouter(jwtConfig, orderQueue, transferDailyLimit, orderEvents, adminToken, readiness, accessLog)
 }
 
-func (serverService *ServerService) getRouter(jwtConfig *handlers.JWTConfig, ordersForProcessing chan models.Order) chi.Router {
+func (serverService *ServerService) getRouter(
+	jwtConfig *handlers.JWTConfig,
+	orderQueue *service.OrderQueue,
+	transferDailyLimit int64,
+	orderEvents handlers.OrderEventSubscriber,
+	adminToken string,
+	readiness *health.Checker,
+	accessLog logger.AccessLogConfig,
+) chi.Router {
 	router := chi.NewRouter()
 
-	router.Use(logger.RequestLogger)
+	router.Use(tracing.Middleware)
+	router.Use(logger.RequestID)
+	router.Use(logger.NewRequestLogger(accessLog))
 	//router.Use(compress.GZIPMiddleware)
+	router.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		customerror.Write(w, r, customerror.NewNotFoundError(r.URL.Path))
+	})
 
-	userRepository := repository.NewUserRepository(serverService.db)
-	orderRepository := repository.NewOrderRepository(serverService.db)
-	withdrawalRepository := repository.NewWithdrawRepository(serverService.db)
-	balanceRepository := repository.NewBalanceRepository(serverService.db)
+	// Пробы доступны без авторизации
+	healthHandler := handlers.NewHealthHandler(readiness)
+	router.Get("/healthz", healthHandler.Liveness)
+	router.Get("/readyz", healthHandler.Readiness)
+	router.Method(http.MethodGet, "/metrics", metrics.Handler())
+
+	userRepository := serverService.storage.Users
+	orderRepository := serverService.storage.Orders
+	withdrawalRepository := serverService.storage.Withdrawals
+	balanceRepository := serverService.storage.Balance
 
 	authHandler := handlers.NewAuthHandler(jwtConfig, userRepository)
 	router.Post("/api/user/register", authHandler.RegisterHandler)
 	router.Post("/api/user/login", authHandler.LoginHandler)
 	router.Post("/api/user/refresh", authHandler.RefreshHandler)
 
-	orderHandler := handlers.NewOrderHandler(orderRepository, balanceRepository, ordersForProcessing)
+	orderHandler := handlers.NewOrderHandler(serverService.rootContext, orderRepository, balanceRepository, orderQueue)
 	router.With(middleware.AuthMiddleware(authHandler)).Post("/api/user/logout", authHandler.LogoutHandler)
 	router.With(middleware.AuthMiddleware(authHandler)).Post("/api/user/orders", orderHandler.Add)
-	router.With(middleware.AuthMiddleware(authHandler)).Get("/api/user/orders", orderHandler.GetOrders)
-	router.With(middleware.AuthMiddleware(authHandler)).Get("/api/user/balance", orderHandler.GetBalance)
+	router.With(middleware.AuthMiddleware(authHandler)).Post("/api/user/orders/batch", orderHandler.BatchAdd)
+	router.With(middleware.AuthMiddleware(authHandler), middleware.ReplicaReadMiddleware).Get("/api/user/orders", orderHandler.GetOrders)
+
+	router.With(middleware.AuthMiddleware(authHandler), middleware.ReplicaReadMiddleware).Get("/api/user/balance", orderHandler.GetBalance)
+
+	balanceHandler := handlers.NewBalanceHandler(balanceRepository)
+	router.With(middleware.AuthMiddleware(authHandler)).Get("/api/user/balance/history", balanceHandler.GetHistory)
 
 	withdrawalHandler := handlers.NewWithdrawHandler(withdrawalRepository, orderRepository, balanceRepository)
 	router.With(middleware.AuthMiddleware(authHandler)).Post("/api/user/balance/withdraw", withdrawalHandler.Add)
-	router.With(middleware.AuthMiddleware(authHandler)).Get("/api/user/withdrawals", withdrawalHandler.GetList)
+	router.With(middleware.AuthMiddleware(authHandler), middleware.ReplicaReadMiddleware).Get("/api/user/withdrawals", withdrawalHandler.GetList)
+
+	exportHandler := handlers.NewExportHandler(orderRepository, withdrawalRepository)
+	router.With(middleware.AuthMiddleware(authHandler)).Get("/api/user/orders/export", exportHandler.ExportOrders)
+	router.With(middleware.AuthMiddleware(authHandler)).Get("/api/user/withdrawals/export", exportHandler.ExportWithdrawals)
+
+	// Остальные возможности хранятся только в Postgres. С другими хранилищами их маршруты отвечают 501,
+	// чтобы клиент отличал недоступную возможность от ошибки в адресе
+	dbObj := serverService.storage.DB
+	postgresOnly := func(handler http.HandlerFunc) http.HandlerFunc {
+		if dbObj != nil {
+			return handler
+		}
+		return func(w http.ResponseWriter, r *http.Request) {
+			customerror.Write(w, r, customerror.NewNotImplementedError("this feature requires the postgres storage"))
+		}
+	}
+
+	var transferRepository repository.TransferStorageRepositoryI = repository.NewTransferRepository(dbObj)
+	if caches := serverService.storage.Caches; caches != nil {
+		transferRepository = caches.WrapTransfers(transferRepository)
+	}
+	orderEventRepository := repository.NewOrderEventRepository(dbObj)
+	webhookRepository := repository.NewWebhookRepository(dbObj)
+	notificationSettingsRepository := repository.NewNotificationSettingsRepository(dbObj)
+
+	orderStreamHandler := handlers.NewOrderStreamHandler(orderEventRepository, orderEvents)
+	router.With(middleware.AuthMiddleware(authHandler)).Get("/api/user/orders/stream", postgresOnly(orderStreamHandler.Stream))
+
+	transferHandler := handlers.NewTransferHandler(transferRepository, userRepository, transferDailyLimit)
+	router.With(middleware.AuthMiddleware(authHandler)).Post("/api/user/balance/transfer", postgresOnly(transferHandler.Add))
+	router.With(middleware.AuthMiddleware(authHandler)).Get("/api/user/transfers", postgresOnly(transferHandler.GetList))
+
+	notificationHandler := handlers.NewNotificationHandler(notificationSettingsRepository)
+	router.With(middleware.AuthMiddleware(authHandler)).Get("/api/user/notifications/settings", postgresOnly(notificationHandler.GetSettings))
+	router.With(middleware.AuthMiddleware(authHandler)).Put("/api/user/notifications/settings", postgresOnly(notificationHandler.UpdateSettings))
+
+	webhookHandler := handlers.NewWebhookHandler(webhookRepository)
+	router.With(middleware.AuthMiddleware(authHandler)).Post("/api/user/webhooks", postgresOnly(webhookHandler.Create))
+	router.With(middleware.AuthMiddleware(authHandler)).Get("/api/user/webhooks", postgresOnly(webhookHandler.GetList))
+	router.With(middleware.AuthMiddleware(authHandler)).Delete("/api/user/webhooks/{id}", postgresOnly(webhookHandler.Delete))
+	router.With(middleware.AuthMiddleware(authHandler)).Get("/api/user/webhooks/{id}/deliveries", postgresOnly(webhookHandler.GetDeliveries))
+
+	adminWebhookHandler := handlers.NewAdminWebhookHandler(webhookRepository)
+	router.With(middleware.AdminMiddleware(adminToken)).Post("/api/admin/webhooks", postgresOnly(adminWebhookHandler.Create))
+	router.With(middleware.AdminMiddleware(adminToken)).Get("/api/admin/webhooks", postgresOnly(adminWebhookHandler.GetList))
+	router.With(middleware.AdminMiddleware(adminToken)).Delete("/api/admin/webhooks/{id}", postgresOnly(adminWebhookHandler.Delete))
+	router.With(middleware.AdminMiddleware(adminToken)).Get("/api/admin/webhooks/{id}/deliveries", postgresOnly(adminWebhookHandler.GetDeliveries))
 
 	return router
 }
@@ -70,12 +152,9 @@ func (serverService *ServerService) RunServer(serverErr *chan error) {
 	}
 }
 
-func (serverService *ServerService) Shutdown() error {
-	// Graceful shutdown
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer shutdownCancel()
-
-	if shutdownErr := serverService.Server.Shutdown(shutdownCtx); shutdownErr != nil {
+// Shutdown перестает принимать соединения и ждет завершения активных запросов до истечения ctx
+func (serverService *ServerService) Shutdown(ctx context.Context) error {
+	if shutdownErr := serverService.Server.Shutdown(ctx); shutdownErr != nil {
 		return shutdownErr
 	}
 
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Bessima/diplom-gomarket/internal/health"
+)
+
+// AccrualWorkerPool управляет числом воркеров начислений. При уменьшении пула лишние воркеры
+// доделывают текущий заказ и выходят, не прерывая запрос к системе начислений.
+type AccrualWorkerPool struct {
+	ctx     context.Context
+	service *OrderService
+	queue   *OrderQueue
+	group   *health.WorkerGroup
+
+	mu    sync.Mutex
+	stops []context.CancelFunc
+}
+
+// NewAccrualWorkerPool ctx ограничивает обработку заказов всеми воркерами пула
+func NewAccrualWorkerPool(ctx context.Context, service *OrderService, queue *OrderQueue, group *health.WorkerGroup) *AccrualWorkerPool {
+	return &AccrualWorkerPool{ctx: ctx, service: service, queue: queue, group: group}
+}
+
+// Resize запускает или останавливает воркеры, чтобы их стало size
+func (pool *AccrualWorkerPool) Resize(size int) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	for len(pool.stops) < size {
+		stopCtx, stop := context.WithCancel(pool.ctx)
+		pool.stops = append(pool.stops, stop)
+		pool.group.Go(func() {
+			pool.service.runAccrualWorker(pool.ctx, stopCtx, pool.queue)
+		})
+	}
+	for len(pool.stops) > size {
+		last := len(pool.stops) - 1
+		pool.stops[last]()
+		pool.stops = pool.stops[:last]
+		pool.group.Retire()
+	}
+}
+
+// Size число воркеров, которые должны работать
+func (pool *AccrualWorkerPool) Size() int {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return len(pool.stops)
+}
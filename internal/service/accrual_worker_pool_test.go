@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/clients/accrual"
+	"github.com/Bessima/diplom-gomarket/internal/health"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccrualWorkerPool_Resize(t *testing.T) {
+	mockRepo := new(MockOrderRepository)
+	mockClient := new(MockAccrualClient)
+	service := &OrderService{repository: mockRepo, accrualClient: mockClient}
+
+	ctx := context.Background()
+	queue := NewOrderQueue(10)
+	group := health.NewWorkerGroup("accrual")
+	pool := NewAccrualWorkerPool(ctx, service, queue, group)
+
+	pool.Resize(3)
+	assert.Equal(t, 3, pool.Size())
+	assert.Eventually(t, func() bool { return group.Running() == 3 }, time.Second, time.Millisecond)
+
+	pool.Resize(1)
+	assert.Equal(t, 1, pool.Size())
+	assert.Eventually(t, func() bool { return group.Running() == 1 }, time.Second, time.Millisecond)
+	assert.NoError(t, group.Check(ctx))
+
+	// Оставшийся воркер продолжает обрабатывать заказы
+	processed := make(chan struct{})
+	mockClient.On("Get", mock.Anything, "1").Return(&accrual.AccrualResponse{Order: "1", Status: string(models.InvalidStatus)}, nil)
+	mockRepo.On("UpdateStatus", "1", models.InvalidStatus).Return(nil).Run(func(mock.Arguments) { close(processed) })
+	require.True(t, queue.Push(ctx, models.Order{ID: "1", UserID: 1, Status: models.NewStatus}))
+	select {
+	case <-processed:
+	case <-time.After(time.Second):
+		t.Fatal("order was not processed")
+	}
+
+	queue.Close()
+	waitCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	assert.NoError(t, group.Wait(waitCtx))
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Bessima/diplom-gomarket/internal/models"
+)
+
+// OrderQueue очередь заказов на опрос системы начислений. Канал очереди никогда не закрывается:
+// после Close новые заказы не принимаются и воркеры перестают брать заказы, поэтому отправка
+// в очередь не может завершиться паникой. Необработанные заказы остаются в базе в статусах
+// NEW и PROCESSING и возвращаются в очередь при следующем запуске.
+type OrderQueue struct {
+	orders    chan models.Order
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func NewOrderQueue(size int) *OrderQueue {
+	return &OrderQueue{
+		orders: make(chan models.Order, size),
+		closed: make(chan struct{}),
+	}
+}
+
+// Push ставит заказ в очередь, ожидая свободного места. Возвращает false, если очередь закрыта или ctx отменен.
+func (queue *OrderQueue) Push(ctx context.Context, order models.Order) bool {
+	select {
+	case <-queue.closed:
+		return false
+	default:
+	}
+
+	select {
+	case queue.orders <- order:
+		return true
+	case <-queue.closed:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Pop ждет следующий заказ. Возвращает false, если очередь закрыта или ctx отменен.
+func (queue *OrderQueue) Pop(ctx context.Context) (models.Order, bool) {
+	select {
+	case <-queue.closed:
+		return models.Order{}, false
+	default:
+	}
+
+	select {
+	case order := <-queue.orders:
+		return order, true
+	case <-queue.closed:
+		return models.Order{}, false
+	case <-ctx.Done():
+		return models.Order{}, false
+	}
+}
+
+// Close прекращает прием и выдачу заказов, повторный вызов ничего не делает
+func (queue *OrderQueue) Close() {
+	queue.closeOnce.Do(func() {
+		close(queue.closed)
+	})
+}
+
+// Done закрывается вместе с очередью
+func (queue *OrderQueue) Done() <-chan struct{} {
+	return queue.closed
+}
+
+// Len число заказов, ожидающих воркера
+func (queue *OrderQueue) Len() int {
+	return len(queue.orders)
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderQueue_PushPop(t *testing.T) {
+	queue := NewOrderQueue(2)
+	ctx := context.Background()
+
+	assert.True(t, queue.Push(ctx, models.Order{ID: "1"}))
+	assert.True(t, queue.Push(ctx, models.Order{ID: "2"}))
+	assert.Equal(t, 2, queue.Len())
+
+	order, ok := queue.Pop(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "1", order.ID)
+	assert.Equal(t, 1, queue.Len())
+}
+
+func TestOrderQueue_Close(t *testing.T) {
+	queue := NewOrderQueue(1)
+	ctx := context.Background()
+
+	assert.True(t, queue.Push(ctx, models.Order{ID: "1"}))
+	queue.Close()
+	queue.Close()
+
+	// После закрытия заказы не принимаются и не выдаются, но и не приводят к панике
+	assert.False(t, queue.Push(ctx, models.Order{ID: "2"}))
+	_, ok := queue.Pop(ctx)
+	assert.False(t, ok)
+
+	select {
+	case <-queue.Done():
+	default:
+		t.Fatal("Done should be closed")
+	}
+}
+
+func TestOrderQueue_CloseUnblocksWaiters(t *testing.T) {
+	queue := NewOrderQueue(1)
+	ctx := context.Background()
+	assert.True(t, queue.Push(ctx, models.Order{ID: "1"}))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// Очередь заполнена, отправка ждет места или закрытия
+		assert.False(t, queue.Push(ctx, models.Order{ID: "2"}))
+	}()
+
+	empty := NewOrderQueue(1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, ok := empty.Pop(ctx)
+		assert.False(t, ok)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	queue.Close()
+	empty.Close()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("waiters were not released by Close")
+	}
+}
+
+func TestOrderQueue_ContextCanceled(t *testing.T) {
+	queue := NewOrderQueue(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.False(t, queue.Push(ctx, models.Order{ID: "1"}))
+	_, ok := queue.Pop(ctx)
+	assert.False(t, ok)
+}
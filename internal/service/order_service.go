@@ -4,71 +4,107 @@ import (
 	"context"
 	"fmt"
 	"github.com/Bessima/diplom-gomarket/internal/clients/accrual"
-	"github.com/Bessima/diplom-gomarket/internal/config/db"
+	"github.com/Bessima/diplom-gomarket/internal/metrics"
 	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
 	"github.com/Bessima/diplom-gomarket/internal/models"
 	"github.com/Bessima/diplom-gomarket/internal/repository"
+	"github.com/Bessima/diplom-gomarket/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 	"time"
 )
 
 type OrderService struct {
 	repository    repository.OrderStorageRepositoryI
 	accrualClient accrual.AccrualClientI
+
+	errorDelay time.Duration
 }
 
-func NewOrderService(dbObj *db.DB, accrualAddress string) *OrderService {
-	rep := repository.NewOrderRepository(dbObj)
-	accrualClient := accrual.NewAccrualClient(accrualAddress)
+// NewOrderService errorDelay пауза перед возвратом заказа в очередь после ошибки системы начислений
+func NewOrderService(orderRepository repository.OrderStorageRepositoryI, accrualClient accrual.AccrualClientI, errorDelay time.Duration) *OrderService {
+	return &OrderService{repository: orderRepository, accrualClient: accrualClient, errorDelay: errorDelay}
+}
 
-	return &OrderService{repository: rep, accrualClient: accrualClient}
+// GetAccrualForOrder воркер начислений: берет заказы из очереди, пока она не закрыта.
+// Заказ, взятый до закрытия, обрабатывается до конца; прервать его можно только отменой ctx.
+func (service OrderService) GetAccrualForOrder(ctx context.Context, queue *OrderQueue) {
+	service.runAccrualWorker(ctx, ctx, queue)
 }
 
-func (service OrderService) GetAccrualForOrder(ctx context.Context, ordersForProcessing chan models.Order) {
+// runAccrualWorker берет заказы, пока не закрыта очередь или не отменен stopCtx,
+// а обрабатывает их в ctx, чтобы остановка воркера не прерывала начатый заказ
+func (service OrderService) runAccrualWorker(ctx, stopCtx context.Context, queue *OrderQueue) {
+	for {
+		if stopCtx.Err() != nil {
+			return
+		}
+		order, ok := queue.Pop(stopCtx)
+		if !ok {
+			return
+		}
+		metrics.AccrualWorkersBusy.Inc()
+		service.processOrder(ctx, order, queue)
+		metrics.AccrualWorkersBusy.Dec()
+	}
+}
+
+func (service OrderService) processOrder(ctx context.Context, order models.Order, queue *OrderQueue) {
+	ctx, span := tracing.Start(ctx, "OrderService.processOrder", attribute.String("order.number", order.ID))
+	defer span.End()
+	log := logger.FromContext(ctx)
 
-	for order := range ordersForProcessing {
-		resp, err := service.accrualClient.Get(ctx, order.ID)
+	resp, err := service.accrualClient.Get(ctx, order.ID)
+	if err != nil {
+		log.Warn(err.Error())
+		//Заказы всегда будут в канале, если цель не достигнута
+		select {
+		case <-time.After(service.errorDelay):
+		case <-queue.Done():
+			return
+		case <-ctx.Done():
+			return
+		}
+		queue.Push(ctx, order)
+		return
+	}
+	switch newStatus := models.OrderStatus(resp.Status); newStatus {
+	case models.InvalidStatus:
+		log.Info(fmt.Sprintf("Order %s has invalid status", order.ID))
+		err = service.repository.UpdateStatus(ctx, order.ID, newStatus)
 		if err != nil {
-			logger.Log.Warn(err.Error())
-			//Заказы всегда будут в канале, если цель не достигнута
-			time.Sleep(10 * time.Second)
-			ordersForProcessing <- order
-			continue
+			log.Warn(err.Error())
 		}
-		switch newStatus := models.OrderStatus(resp.Status); newStatus {
-		case models.InvalidStatus:
-			logger.Log.Info(fmt.Sprintf("Order %s has invalid status", order.ID))
-			err = service.repository.UpdateStatus(order.ID, newStatus)
-			if err != nil {
-				logger.Log.Warn(err.Error())
-			}
-			continue
-		case models.ProcessedStatus:
-			logger.Log.Info(fmt.Sprintf("Order %s has already processed status", order.ID))
-			accrualInt := int32(resp.Accrual * 100)
-			err = service.repository.SetAccrual(order.ID, order.UserID, accrualInt)
-			if err != nil {
-				logger.Log.Warn(fmt.Sprintf("Order %s was not saved in DB, %s", order.ID, err.Error()))
-				ordersForProcessing <- order
-				continue
-			}
+		return
+	case models.ProcessedStatus:
+		log.Info(fmt.Sprintf("Order %s has already processed status", order.ID))
+		accrualInt := int32(resp.Accrual * 100)
+		err = service.repository.SetAccrual(ctx, order.ID, order.UserID, accrualInt)
+		if err != nil {
+			log.Warn(fmt.Sprintf("Order %s was not saved in DB, %s", order.ID, err.Error()))
+			queue.Push(ctx, order)
+			return
+		}
+		metrics.PointsAccrued.Add(float64(accrualInt) / 100)
 
-		case models.ProcessingStatus:
-		case models.RegisterAcSystemStatus:
-			if newStatus != order.Status && newStatus != models.RegisterAcSystemStatus {
-				err = service.repository.UpdateStatus(order.ID, newStatus)
-				if err != nil {
-					logger.Log.Warn(err.Error())
-				}
-				order.Status = newStatus
+	case models.ProcessingStatus:
+	case models.RegisterAcSystemStatus:
+		if newStatus != order.Status && newStatus != models.RegisterAcSystemStatus {
+			err = service.repository.UpdateStatus(ctx, order.ID, newStatus)
+			if err != nil {
+				log.Warn(err.Error())
 			}
-			ordersForProcessing <- order
+			order.Status = newStatus
 		}
+		queue.Push(ctx, order)
 	}
 }
 
-func (service OrderService) AddNotProcessedOrders(ordersForProcessing chan models.Order) {
-	err := service.repository.SetListForProcessing(ordersForProcessing)
+// AddNotProcessedOrders возвращает в очередь заказы, не обработанные до предыдущей остановки сервиса
+func (service OrderService) AddNotProcessedOrders(ctx context.Context, queue *OrderQueue) {
+	err := service.repository.SetListForProcessing(ctx, func(order models.Order) bool {
+		return queue.Push(ctx, order)
+	})
 	if err != nil {
-		logger.Log.Warn(err.Error())
+		logger.FromContext(ctx).Warn(err.Error())
 	}
 }
@@ -8,6 +8,7 @@ import (
 
 	"github.com/Bessima/diplom-gomarket/internal/clients/accrual"
 	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -17,12 +18,20 @@ type MockOrderRepository struct {
 	mock.Mock
 }
 
-func (m *MockOrderRepository) Create(userID, orderID int) error {
+func (m *MockOrderRepository) Create(ctx context.Context, userID, orderID int) error {
 	args := m.Called(userID, orderID)
 	return args.Error(0)
 }
 
-func (m *MockOrderRepository) GetByID(id int) (*models.Order, error) {
+func (m *MockOrderRepository) CreateBatch(ctx context.Context, userID int, orderIDs []int64) (map[int64]models.BatchOrderStatus, error) {
+	args := m.Called(userID, orderIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[int64]models.BatchOrderStatus), args.Error(1)
+}
+
+func (m *MockOrderRepository) GetByID(ctx context.Context, id int) (*models.Order, error) {
 	args := m.Called(id)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -30,26 +39,36 @@ func (m *MockOrderRepository) GetByID(id int) (*models.Order, error) {
 	return args.Get(0).(*models.Order), args.Error(1)
 }
 
-func (m *MockOrderRepository) GetListByUserID(userID int) ([]models.Order, error) {
+func (m *MockOrderRepository) GetListByUserID(ctx context.Context, userID int) ([]models.Order, error) {
 	args := m.Called(userID)
 	return args.Get(0).([]models.Order), args.Error(1)
 }
 
-func (m *MockOrderRepository) SetListForProcessing(ch chan models.Order) error {
-	args := m.Called(ch)
+func (m *MockOrderRepository) GetPageByUserID(ctx context.Context, userID int, filter repository.OrderListFilter) ([]models.Order, error) {
+	args := m.Called(userID, filter)
+	return args.Get(0).([]models.Order), args.Error(1)
+}
+
+func (m *MockOrderRepository) SetListForProcessing(ctx context.Context, enqueue func(models.Order) bool) error {
+	args := m.Called(enqueue)
 	return args.Error(0)
 }
 
-func (m *MockOrderRepository) UpdateStatus(orderID string, newStatus models.OrderStatus) error {
+func (m *MockOrderRepository) UpdateStatus(ctx context.Context, orderID string, newStatus models.OrderStatus) error {
 	args := m.Called(orderID, newStatus)
 	return args.Error(0)
 }
 
-func (m *MockOrderRepository) SetAccrual(orderID string, userID int, accrual int32) error {
+func (m *MockOrderRepository) SetAccrual(ctx context.Context, orderID string, userID int, accrual int32) error {
 	args := m.Called(orderID, userID, accrual)
 	return args.Error(0)
 }
 
+func (m *MockOrderRepository) StreamByUserID(ctx context.Context, userID int, from, to *time.Time, fn func(models.OrderRecord) error) error {
+	args := m.Called(userID, from, to, fn)
+	return args.Error(0)
+}
+
 // MockAccrualClient - мок для AccrualClient
 type MockAccrualClient struct {
 	mock.Mock
@@ -74,7 +93,7 @@ func TestOrderService_GetAccrualForOrder_ProcessedStatus(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	ordersChannel := make(chan models.Order, 10)
+	queue := NewOrderQueue(10)
 
 	order := models.Order{
 		ID:      "12345",
@@ -92,15 +111,15 @@ func TestOrderService_GetAccrualForOrder_ProcessedStatus(t *testing.T) {
 	expectedAccrual := int32(10050) // 100.50 * 100
 
 	// Настройка ожиданий
-	mockClient.On("Get", ctx, order.ID).Return(accrualResponse, nil)
-	mockRepo.On("SetAccrual", order.ID, order.UserID, expectedAccrual).Return(nil)
+	mockClient.On("Get", mock.Anything, order.ID).Return(accrualResponse, nil)
+	mockRepo.On("SetAccrual", order.ID, order.UserID, expectedAccrual).Return(nil).
+		Run(func(mock.Arguments) { queue.Close() })
 
 	// Act
-	ordersChannel <- order
-	close(ordersChannel)
+	queue.Push(ctx, order)
 
-	// Запускаем обработку
-	service.GetAccrualForOrder(ctx, ordersChannel)
+	// Запускаем обработку, воркер завершится после закрытия очереди
+	service.GetAccrualForOrder(ctx, queue)
 
 	// Assert
 	mockClient.AssertExpectations(t)
@@ -118,7 +137,7 @@ func TestOrderService_GetAccrualForOrder_InvalidStatus(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	ordersChannel := make(chan models.Order, 10)
+	queue := NewOrderQueue(10)
 
 	order := models.Order{
 		ID:      "12345",
@@ -133,14 +152,14 @@ func TestOrderService_GetAccrualForOrder_InvalidStatus(t *testing.T) {
 	}
 
 	// Настройка ожиданий
-	mockClient.On("Get", ctx, order.ID).Return(accrualResponse, nil)
-	mockRepo.On("UpdateStatus", order.ID, models.InvalidStatus).Return(nil)
+	mockClient.On("Get", mock.Anything, order.ID).Return(accrualResponse, nil)
+	mockRepo.On("UpdateStatus", order.ID, models.InvalidStatus).Return(nil).
+		Run(func(mock.Arguments) { queue.Close() })
 
 	// Act
-	ordersChannel <- order
-	close(ordersChannel)
+	queue.Push(ctx, order)
 
-	service.GetAccrualForOrder(ctx, ordersChannel)
+	service.GetAccrualForOrder(ctx, queue)
 
 	// Assert
 	mockClient.AssertExpectations(t)
@@ -160,7 +179,7 @@ func TestOrderService_GetAccrualForOrder_ProcessingStatus(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	ordersChannel := make(chan models.Order, 10)
+	queue := NewOrderQueue(10)
 
 	order := models.Order{
 		ID:      "12345",
@@ -174,40 +193,17 @@ func TestOrderService_GetAccrualForOrder_ProcessingStatus(t *testing.T) {
 		Status: string(models.ProcessingStatus),
 	}
 
-	// Настройка ожиданий - заказ со статусом PROCESSING вернется в канал
+	// Настройка ожиданий - заказ со статусом PROCESSING вернется в очередь
 	// Статус может быть обновлен, если условие выполнится
-	mockClient.On("Get", ctx, order.ID).Return(accrualResponse, nil).Once()
+	mockClient.On("Get", mock.Anything, order.ID).Return(accrualResponse, nil).Once()
 	mockRepo.On("UpdateStatus", order.ID, models.ProcessingStatus).Return(nil).Maybe()
 
 	// Act
-	ordersChannel <- order
-
-	done := make(chan bool)
-	returnedOrderReceived := false
+	service.processOrder(ctx, order, queue)
 
-	go func() {
-		// Читаем заказ, который вернулся в канал
-		select {
-		case returnedOrder := <-ordersChannel:
-			assert.Equal(t, order.ID, returnedOrder.ID)
-			returnedOrderReceived = true
-			close(ordersChannel)
-		case <-time.After(1 * time.Second):
-			close(ordersChannel)
-		}
-		done <- true
-	}()
-
-	// Запускаем обработку в отдельной горутине
-	go service.GetAccrualForOrder(ctx, ordersChannel)
-
-	// Ждем завершения
-	select {
-	case <-done:
-		assert.True(t, returnedOrderReceived, "Order should have been returned to channel")
-	case <-time.After(2 * time.Second):
-		t.Fatal("Test timeout")
-	}
+	returnedOrder, ok := queue.Pop(ctx)
+	assert.True(t, ok, "Order should have been returned to queue")
+	assert.Equal(t, order.ID, returnedOrder.ID)
 
 	// Assert
 	mockClient.AssertExpectations(t)
@@ -221,10 +217,11 @@ func TestOrderService_GetAccrualForOrder_AccrualClientError(t *testing.T) {
 	service := &OrderService{
 		repository:    mockRepo,
 		accrualClient: mockClient,
+		errorDelay:    time.Millisecond,
 	}
 
 	ctx := context.Background()
-	ordersChannel := make(chan models.Order, 10)
+	queue := NewOrderQueue(10)
 
 	order := models.Order{
 		ID:      "12345",
@@ -235,47 +232,21 @@ func TestOrderService_GetAccrualForOrder_AccrualClientError(t *testing.T) {
 
 	expectedError := errors.New("connection error")
 
-	// Настройка ожиданий - при ошибке заказ вернется в канал после задержки
-	mockClient.On("Get", ctx, order.ID).Return((*accrual.AccrualResponse)(nil), expectedError).Once()
+	// Настройка ожиданий - при ошибке заказ вернется в очередь после задержки
+	mockClient.On("Get", mock.Anything, order.ID).Return((*accrual.AccrualResponse)(nil), expectedError).Once()
 
 	// Act
-	ordersChannel <- order
-
-	done := make(chan bool)
-	returnedOrderReceived := false
+	service.processOrder(ctx, order, queue)
 
-	go func() {
-		// Ждем, когда заказ вернется в канал
-		select {
-		case returnedOrder := <-ordersChannel:
-			assert.Equal(t, order.ID, returnedOrder.ID)
-			returnedOrderReceived = true
-			close(ordersChannel)
-		case <-time.After(12 * time.Second):
-			// Таймаут - закрываем канал
-			close(ordersChannel)
-		}
-		done <- true
-	}()
-
-	// Запускаем обработку
-	go service.GetAccrualForOrder(ctx, ordersChannel)
-
-	// Ждем завершения
-	select {
-	case <-done:
-		assert.True(t, returnedOrderReceived, "Order should have been returned to channel after error")
-	case <-time.After(15 * time.Second):
-		t.Fatal("Test timeout")
-	}
+	returnedOrder, ok := queue.Pop(ctx)
+	assert.True(t, ok, "Order should have been returned to queue after error")
+	assert.Equal(t, order.ID, returnedOrder.ID)
 
 	// Assert
 	mockClient.AssertExpectations(t)
 }
 
-// Этот тест может быть нестабильным из-за асинхронности
 func TestOrderService_GetAccrualForOrder_SetAccrualError(t *testing.T) {
-	t.Skip("Skipping due to test instability")
 	// Arrange
 	mockRepo := new(MockOrderRepository)
 	mockClient := new(MockAccrualClient)
@@ -286,7 +257,7 @@ func TestOrderService_GetAccrualForOrder_SetAccrualError(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	ordersChannel := make(chan models.Order, 10)
+	queue := NewOrderQueue(10)
 
 	order := models.Order{
 		ID:      "12345",
@@ -304,39 +275,16 @@ func TestOrderService_GetAccrualForOrder_SetAccrualError(t *testing.T) {
 	expectedAccrual := int32(10050)
 	expectedError := errors.New("database error")
 
-	// Настройка ожиданий - при ошибке SetAccrual заказ вернется в канал
-	mockClient.On("Get", ctx, order.ID).Return(accrualResponse, nil).Once()
+	// Настройка ожиданий - при ошибке SetAccrual заказ вернется в очередь
+	mockClient.On("Get", mock.Anything, order.ID).Return(accrualResponse, nil).Once()
 	mockRepo.On("SetAccrual", order.ID, order.UserID, expectedAccrual).Return(expectedError).Once()
 
 	// Act
-	ordersChannel <- order
-
-	done := make(chan bool)
-	returnedOrderReceived := false
-
-	go func() {
-		// Ждем, когда заказ вернется в канал после ошибки SetAccrual
-		select {
-		case returnedOrder := <-ordersChannel:
-			assert.Equal(t, order.ID, returnedOrder.ID)
-			returnedOrderReceived = true
-			close(ordersChannel)
-		case <-time.After(1 * time.Second):
-			close(ordersChannel)
-		}
-		done <- true
-	}()
+	service.processOrder(ctx, order, queue)
 
-	// Запускаем обработку
-	go service.GetAccrualForOrder(ctx, ordersChannel)
-
-	// Ждем завершения
-	select {
-	case <-done:
-		assert.True(t, returnedOrderReceived, "Order should have been returned to channel after SetAccrual error")
-	case <-time.After(2 * time.Second):
-		t.Fatal("Test timeout")
-	}
+	returnedOrder, ok := queue.Pop(ctx)
+	assert.True(t, ok, "Order should have been returned to queue after SetAccrual error")
+	assert.Equal(t, order.ID, returnedOrder.ID)
 
 	// Assert
 	mockClient.AssertExpectations(t)
@@ -353,13 +301,13 @@ func TestOrderService_AddNotProcessedOrders_Success(t *testing.T) {
 		accrualClient: mockClient,
 	}
 
-	ordersChannel := make(chan models.Order, 10)
+	queue := NewOrderQueue(10)
 
 	// Настройка ожиданий
-	mockRepo.On("SetListForProcessing", ordersChannel).Return(nil)
+	mockRepo.On("SetListForProcessing", mock.Anything).Return(nil)
 
 	// Act
-	service.AddNotProcessedOrders(ordersChannel)
+	service.AddNotProcessedOrders(context.Background(), queue)
 
 	// Assert
 	mockRepo.AssertExpectations(t)
@@ -375,14 +323,14 @@ func TestOrderService_AddNotProcessedOrders_Error(t *testing.T) {
 		accrualClient: mockClient,
 	}
 
-	ordersChannel := make(chan models.Order, 10)
+	queue := NewOrderQueue(10)
 	expectedError := errors.New("database error")
 
 	// Настройка ожиданий
-	mockRepo.On("SetListForProcessing", ordersChannel).Return(expectedError)
+	mockRepo.On("SetListForProcessing", mock.Anything).Return(expectedError)
 
 	// Act
-	service.AddNotProcessedOrders(ordersChannel)
+	service.AddNotProcessedOrders(context.Background(), queue)
 
 	// Assert - метод не возвращает ошибку, только логирует
 	mockRepo.AssertExpectations(t)
@@ -399,7 +347,7 @@ func TestOrderService_GetAccrualForOrder_UpdateStatusError(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	ordersChannel := make(chan models.Order, 10)
+	queue := NewOrderQueue(10)
 
 	order := models.Order{
 		ID:      "12345",
@@ -416,16 +364,57 @@ func TestOrderService_GetAccrualForOrder_UpdateStatusError(t *testing.T) {
 	expectedError := errors.New("database error")
 
 	// Настройка ожиданий
-	mockClient.On("Get", ctx, order.ID).Return(accrualResponse, nil)
-	mockRepo.On("UpdateStatus", order.ID, models.InvalidStatus).Return(expectedError)
+	mockClient.On("Get", mock.Anything, order.ID).Return(accrualResponse, nil)
+	mockRepo.On("UpdateStatus", order.ID, models.InvalidStatus).Return(expectedError).
+		Run(func(mock.Arguments) { queue.Close() })
 
 	// Act
-	ordersChannel <- order
-	close(ordersChannel)
+	queue.Push(ctx, order)
 
-	service.GetAccrualForOrder(ctx, ordersChannel)
+	service.GetAccrualForOrder(ctx, queue)
 
 	// Assert - метод не возвращает ошибку при UpdateStatus, только логирует
 	mockClient.AssertExpectations(t)
 	mockRepo.AssertExpectations(t)
 }
+
+func TestOrderService_GetAccrualForOrder_AccrualClientErrorQueueClosed(t *testing.T) {
+	// Arrange
+	mockRepo := new(MockOrderRepository)
+	mockClient := new(MockAccrualClient)
+
+	service := &OrderService{
+		repository:    mockRepo,
+		accrualClient: mockClient,
+		errorDelay:    time.Hour,
+	}
+
+	ctx := context.Background()
+	queue := NewOrderQueue(10)
+
+	order := models.Order{
+		ID:     "12345",
+		UserID: 1,
+		Status: models.NewStatus,
+	}
+
+	// Очередь закрывается во время запроса: воркер не должен ждать паузу после ошибки
+	mockClient.On("Get", mock.Anything, order.ID).Return((*accrual.AccrualResponse)(nil), errors.New("connection error")).
+		Run(func(mock.Arguments) { queue.Close() }).Once()
+
+	// Act
+	done := make(chan struct{})
+	go func() {
+		service.processOrder(ctx, order, queue)
+		close(done)
+	}()
+
+	// Assert
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("processOrder did not return after queue was closed")
+	}
+	assert.Equal(t, 0, queue.Len())
+	mockClient.AssertExpectations(t)
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/Bessima/diplom-gomarket/internal/handlers/schemas"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
+)
+
+var (
+	ErrTransferToSelf      = errors.New("can't transfer points to yourself")
+	ErrTransferNonPositive = errors.New("sum of transfer must be positive")
+)
+
+type TransferService struct {
+	TransferRepository repository.TransferStorageRepositoryI
+	// dailyLimit - суточный лимит исходящих переводов в копейках, 0 - без ограничений
+	dailyLimit int64
+}
+
+func NewTransferService(transferRep repository.TransferStorageRepositoryI, dailyLimit int64) *TransferService {
+	return &TransferService{TransferRepository: transferRep, dailyLimit: dailyLimit}
+}
+
+func (service *TransferService) Transfer(ctx context.Context, from *models.User, to *models.User, transferRequest schemas.TransferRequest) error {
+	if from.ID == to.ID {
+		return ErrTransferToSelf
+	}
+
+	sum := transferRequest.GetSumAsInt()
+	if sum <= 0 {
+		return ErrTransferNonPositive
+	}
+
+	return service.TransferRepository.Create(ctx, from.ID, to.ID, sum, service.dailyLimit)
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Bessima/diplom-gomarket/internal/handlers/schemas"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockTransferRepository - мок для TransferStorageRepositoryI
+type MockTransferRepository struct {
+	mock.Mock
+}
+
+func (m *MockTransferRepository) Create(ctx context.Context, fromUserID, toUserID int, sum int64, dailyLimit int64) error {
+	args := m.Called(fromUserID, toUserID, sum, dailyLimit)
+	return args.Error(0)
+}
+
+func (m *MockTransferRepository) GetListByUserID(ctx context.Context, userID int) ([]models.Transfer, error) {
+	args := m.Called(userID)
+	return args.Get(0).([]models.Transfer), args.Error(1)
+}
+
+func TestTransferService_Transfer_Success(t *testing.T) {
+	// Arrange
+	mockTransferRepo := new(MockTransferRepository)
+	service := NewTransferService(mockTransferRepo, 1000000)
+
+	from := &models.User{ID: 1, Login: "son"}
+	to := &models.User{ID: 2, Login: "mom"}
+
+	// 0.29 * 100 во float32 даёт 28.99..., сумма должна округляться
+	mockTransferRepo.On("Create", from.ID, to.ID, int64(29), int64(1000000)).Return(nil)
+
+	// Act
+	err := service.Transfer(context.Background(), from, to, schemas.TransferRequest{Login: to.Login, Sum: 0.29})
+
+	// Assert
+	assert.NoError(t, err)
+	mockTransferRepo.AssertExpectations(t)
+}
+
+func TestTransferService_Transfer_ToSelf(t *testing.T) {
+	// Arrange
+	mockTransferRepo := new(MockTransferRepository)
+	service := NewTransferService(mockTransferRepo, 0)
+
+	user := &models.User{ID: 1, Login: "son"}
+
+	// Act
+	err := service.Transfer(context.Background(), user, user, schemas.TransferRequest{Login: user.Login, Sum: 10})
+
+	// Assert
+	assert.ErrorIs(t, err, ErrTransferToSelf)
+	mockTransferRepo.AssertNotCalled(t, "Create")
+}
+
+func TestTransferService_Transfer_NonPositiveSum(t *testing.T) {
+	testCases := []struct {
+		name string
+		sum  float32
+	}{
+		{name: "zero", sum: 0},
+		{name: "negative", sum: -10},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Arrange
+			mockTransferRepo := new(MockTransferRepository)
+			service := NewTransferService(mockTransferRepo, 0)
+
+			from := &models.User{ID: 1, Login: "son"}
+			to := &models.User{ID: 2, Login: "mom"}
+
+			// Act
+			err := service.Transfer(context.Background(), from, to, schemas.TransferRequest{Login: to.Login, Sum: tc.sum})
+
+			// Assert
+			assert.ErrorIs(t, err, ErrTransferNonPositive)
+			mockTransferRepo.AssertNotCalled(t, "Create")
+		})
+	}
+}
+
+func TestTransferService_Transfer_RepositoryError(t *testing.T) {
+	// Arrange
+	mockTransferRepo := new(MockTransferRepository)
+	service := NewTransferService(mockTransferRepo, 0)
+
+	from := &models.User{ID: 1, Login: "son"}
+	to := &models.User{ID: 2, Login: "mom"}
+	expectedError := errors.New("database error")
+
+	mockTransferRepo.On("Create", from.ID, to.ID, int64(1000), int64(0)).Return(expectedError)
+
+	// Act
+	err := service.Transfer(context.Background(), from, to, schemas.TransferRequest{Login: to.Login, Sum: 10})
+
+	// Assert
+	assert.Equal(t, expectedError, err)
+	mockTransferRepo.AssertExpectations(t)
+}
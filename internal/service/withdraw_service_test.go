@@ -1,11 +1,15 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"testing"
+	"time"
 
+	"github.com/Bessima/diplom-gomarket/internal/customerror"
 	"github.com/Bessima/diplom-gomarket/internal/handlers/schemas"
 	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -15,32 +19,31 @@ type MockWithdrawRepository struct {
 	mock.Mock
 }
 
-func (m *MockWithdrawRepository) Create(userID int, orderID int64, sum int) error {
+func (m *MockWithdrawRepository) Withdraw(ctx context.Context, userID int, orderID int64, sum int) error {
 	args := m.Called(userID, orderID, sum)
 	return args.Error(0)
 }
 
-func (m *MockWithdrawRepository) GetListByUserID(id int) ([]models.Withdrawal, error) {
+func (m *MockWithdrawRepository) GetListByUserID(ctx context.Context, id int) ([]models.Withdrawal, error) {
 	args := m.Called(id)
 	return args.Get(0).([]models.Withdrawal), args.Error(1)
 }
 
-// MockBalanceRepository - мок для BalanceRepository
-type MockBalanceRepository struct {
-	mock.Mock
+func (m *MockWithdrawRepository) GetPageByUserID(ctx context.Context, userID int, filter repository.WithdrawalListFilter) ([]models.Withdrawal, error) {
+	args := m.Called(userID, filter)
+	return args.Get(0).([]models.Withdrawal), args.Error(1)
 }
 
-func (m *MockBalanceRepository) SetWithdrawForUserID(userID int, withdraw int) error {
-	args := m.Called(userID, withdraw)
+func (m *MockWithdrawRepository) StreamByUserID(ctx context.Context, userID int, from, to *time.Time, fn func(models.WithdrawalRecord) error) error {
+	args := m.Called(userID, from, to, fn)
 	return args.Error(0)
 }
 
 func TestWithdrawService_Set_Success(t *testing.T) {
 	// Arrange
 	mockWithdrawRepo := new(MockWithdrawRepository)
-	mockBalanceRepo := new(MockBalanceRepository)
 
-	service := NewWithdrawService(mockWithdrawRepo, mockBalanceRepo)
+	service := NewWithdrawService(mockWithdrawRepo)
 
 	user := &models.User{
 		ID:    1,
@@ -56,24 +59,21 @@ func TestWithdrawService_Set_Success(t *testing.T) {
 	expectedSum := 10050 // 100.50 * 100
 
 	// Настройка ожиданий для моков
-	mockWithdrawRepo.On("Create", user.ID, expectedOrderID, expectedSum).Return(nil)
-	mockBalanceRepo.On("SetWithdrawForUserID", user.ID, expectedSum).Return(nil)
+	mockWithdrawRepo.On("Withdraw", user.ID, expectedOrderID, expectedSum).Return(nil)
 
 	// Act
-	err := service.Set(user, withdrawRequest)
+	err := service.Set(context.Background(), user, withdrawRequest)
 
 	// Assert
 	assert.NoError(t, err)
 	mockWithdrawRepo.AssertExpectations(t)
-	mockBalanceRepo.AssertExpectations(t)
 }
 
 func TestWithdrawService_Set_InvalidOrderNumber(t *testing.T) {
 	// Arrange
 	mockWithdrawRepo := new(MockWithdrawRepository)
-	mockBalanceRepo := new(MockBalanceRepository)
 
-	service := NewWithdrawService(mockWithdrawRepo, mockBalanceRepo)
+	service := NewWithdrawService(mockWithdrawRepo)
 
 	user := &models.User{
 		ID:    1,
@@ -86,22 +86,20 @@ func TestWithdrawService_Set_InvalidOrderNumber(t *testing.T) {
 	}
 
 	// Act
-	err := service.Set(user, withdrawRequest)
+	err := service.Set(context.Background(), user, withdrawRequest)
 
 	// Assert
 	assert.Error(t, err)
 	assert.Equal(t, "can't parse number of order", err.Error())
 	// Проверяем, что моки не были вызваны
-	mockWithdrawRepo.AssertNotCalled(t, "Create")
-	mockBalanceRepo.AssertNotCalled(t, "SetWithdrawForUserID")
+	mockWithdrawRepo.AssertNotCalled(t, "Withdraw")
 }
 
-func TestWithdrawService_Set_WithdrawRepositoryCreateError(t *testing.T) {
+func TestWithdrawService_Set_WithdrawRepositoryError(t *testing.T) {
 	// Arrange
 	mockWithdrawRepo := new(MockWithdrawRepository)
-	mockBalanceRepo := new(MockBalanceRepository)
 
-	service := NewWithdrawService(mockWithdrawRepo, mockBalanceRepo)
+	service := NewWithdrawService(mockWithdrawRepo)
 
 	user := &models.User{
 		ID:    1,
@@ -118,25 +116,22 @@ func TestWithdrawService_Set_WithdrawRepositoryCreateError(t *testing.T) {
 	expectedError := errors.New("database error")
 
 	// Настройка ожиданий для моков
-	mockWithdrawRepo.On("Create", user.ID, expectedOrderID, expectedSum).Return(expectedError)
+	mockWithdrawRepo.On("Withdraw", user.ID, expectedOrderID, expectedSum).Return(expectedError)
 
 	// Act
-	err := service.Set(user, withdrawRequest)
+	err := service.Set(context.Background(), user, withdrawRequest)
 
 	// Assert
 	assert.Error(t, err)
 	assert.Equal(t, expectedError, err)
 	mockWithdrawRepo.AssertExpectations(t)
-	// Проверяем, что SetWithdrawForUserID не был вызван из-за ошибки
-	mockBalanceRepo.AssertNotCalled(t, "SetWithdrawForUserID")
 }
 
-func TestWithdrawService_Set_BalanceRepositoryError(t *testing.T) {
+func TestWithdrawService_Set_InsufficientFunds(t *testing.T) {
 	// Arrange
 	mockWithdrawRepo := new(MockWithdrawRepository)
-	mockBalanceRepo := new(MockBalanceRepository)
 
-	service := NewWithdrawService(mockWithdrawRepo, mockBalanceRepo)
+	service := NewWithdrawService(mockWithdrawRepo)
 
 	user := &models.User{
 		ID:    1,
@@ -150,20 +145,18 @@ func TestWithdrawService_Set_BalanceRepositoryError(t *testing.T) {
 
 	expectedOrderID := int64(12345)
 	expectedSum := 10050
-	expectedError := errors.New("insufficient balance")
+	expectedError := customerror.NewInsufficientFundsError("user 1 has not enough points for withdraw")
 
-	// Настройка ожиданий для моков
-	mockWithdrawRepo.On("Create", user.ID, expectedOrderID, expectedSum).Return(nil)
-	mockBalanceRepo.On("SetWithdrawForUserID", user.ID, expectedSum).Return(expectedError)
+	// Репозиторий отклоняет списание, если на балансе не хватает средств
+	mockWithdrawRepo.On("Withdraw", user.ID, expectedOrderID, expectedSum).Return(expectedError)
 
 	// Act
-	err := service.Set(user, withdrawRequest)
+	err := service.Set(context.Background(), user, withdrawRequest)
 
 	// Assert
 	assert.Error(t, err)
 	assert.Equal(t, expectedError, err)
 	mockWithdrawRepo.AssertExpectations(t)
-	mockBalanceRepo.AssertExpectations(t)
 }
 
 func TestWithdrawService_Set_DifferentAmounts(t *testing.T) {
@@ -191,6 +184,12 @@ func TestWithdrawService_Set_DifferentAmounts(t *testing.T) {
 			sum:         50.25,
 			expectedSum: 5025,
 		},
+		{
+			name:        "amount not representable in float32",
+			order:       "55555",
+			sum:         0.53,
+			expectedSum: 53,
+		},
 		{
 			name:        "zero amount",
 			order:       "44444",
@@ -203,9 +202,8 @@ func TestWithdrawService_Set_DifferentAmounts(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			// Arrange
 			mockWithdrawRepo := new(MockWithdrawRepository)
-			mockBalanceRepo := new(MockBalanceRepository)
 
-			service := NewWithdrawService(mockWithdrawRepo, mockBalanceRepo)
+			service := NewWithdrawService(mockWithdrawRepo)
 
 			user := &models.User{
 				ID:    1,
@@ -220,16 +218,14 @@ func TestWithdrawService_Set_DifferentAmounts(t *testing.T) {
 			expectedOrderID, _ := withdrawRequest.GetOrderAsInt()
 
 			// Настройка ожиданий для моков
-			mockWithdrawRepo.On("Create", user.ID, expectedOrderID, tc.expectedSum).Return(nil)
-			mockBalanceRepo.On("SetWithdrawForUserID", user.ID, tc.expectedSum).Return(nil)
+			mockWithdrawRepo.On("Withdraw", user.ID, expectedOrderID, tc.expectedSum).Return(nil)
 
 			// Act
-			err := service.Set(user, withdrawRequest)
+			err := service.Set(context.Background(), user, withdrawRequest)
 
 			// Assert
 			assert.NoError(t, err)
 			mockWithdrawRepo.AssertExpectations(t)
-			mockBalanceRepo.AssertExpectations(t)
 		})
 	}
 }
@@ -237,9 +233,8 @@ func TestWithdrawService_Set_DifferentAmounts(t *testing.T) {
 func TestWithdrawService_Set_ConcurrentCalls(t *testing.T) {
 	// Arrange
 	mockWithdrawRepo := new(MockWithdrawRepository)
-	mockBalanceRepo := new(MockBalanceRepository)
 
-	service := NewWithdrawService(mockWithdrawRepo, mockBalanceRepo)
+	service := NewWithdrawService(mockWithdrawRepo)
 
 	user := &models.User{
 		ID:    1,
@@ -255,16 +250,14 @@ func TestWithdrawService_Set_ConcurrentCalls(t *testing.T) {
 	expectedSum := 10050
 
 	// Настройка ожиданий для моков (ожидаем 3 вызова)
-	mockWithdrawRepo.On("Create", user.ID, expectedOrderID, expectedSum).Return(nil).Times(3)
-	mockBalanceRepo.On("SetWithdrawForUserID", user.ID, expectedSum).Return(nil).Times(3)
+	mockWithdrawRepo.On("Withdraw", user.ID, expectedOrderID, expectedSum).Return(nil).Times(3)
 
 	// Act - выполняем несколько вызовов последовательно
 	for range 3 {
-		err := service.Set(user, withdrawRequest)
+		err := service.Set(context.Background(), user, withdrawRequest)
 		assert.NoError(t, err)
 	}
 
 	// Assert
 	mockWithdrawRepo.AssertExpectations(t)
-	mockBalanceRepo.AssertExpectations(t)
 }
@@ -0,0 +1,190 @@
+// Package validation проверяет поля запросов по тегам validate, например `validate:"required,min=3,max=50"`.
+// Правила перечисляются через запятую, параметр правила указывается после =. Для поля возвращается
+// ошибка первого нарушенного правила, имя поля берется из тега json.
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Bessima/diplom-gomarket/internal/customerror"
+)
+
+// Rule проверяет значение поля с параметром param из тега и возвращает сообщение об ошибке,
+// пустая строка - значение подходит
+type Rule func(value reflect.Value, param string) string
+
+// rules правила, доступные в тегах validate
+var rules = map[string]Rule{
+	"required": required,
+	"min":      minimum,
+	"max":      maximum,
+	"luhn":     luhn,
+	"money":    money,
+}
+
+// Register добавляет правило name. Вызывается при инициализации пакета, до обработки запросов.
+func Register(name string, rule Rule) {
+	rules[name] = rule
+}
+
+// Struct проверяет поля структуры value (или указателя на нее) по тегам validate.
+// Неизвестное правило в теге - ошибка в коде, поэтому Struct паникует.
+func Struct(value any) []customerror.FieldError {
+	structValue := reflect.Indirect(reflect.ValueOf(value))
+	if structValue.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validation: %T is not a struct", value))
+	}
+
+	var fieldErrors []customerror.FieldError
+	structType := structValue.Type()
+	for i := range structType.NumField() {
+		field := structType.Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" || !field.IsExported() {
+			continue
+		}
+
+		for _, item := range strings.Split(tag, ",") {
+			name, param, _ := strings.Cut(item, "=")
+			rule, ok := rules[name]
+			if !ok {
+				panic(fmt.Sprintf("validation: unknown rule %q in %s.%s", name, structType.Name(), field.Name))
+			}
+			if message := rule(structValue.Field(i), param); message != "" {
+				fieldErrors = append(fieldErrors, customerror.FieldError{Field: fieldName(field), Code: name, Message: message})
+				break
+			}
+		}
+	}
+	return fieldErrors
+}
+
+// fieldName имя поля в JSON
+func fieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+// required не пропускает нулевые значения, пустые строки, списки и словари
+func required(value reflect.Value, _ string) string {
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map:
+		if value.Len() == 0 {
+			return "is required"
+		}
+	default:
+		if value.IsZero() {
+			return "is required"
+		}
+	}
+	return ""
+}
+
+// minimum для строк ограничивает число символов, для списков - число элементов, для чисел - значение
+func minimum(value reflect.Value, param string) string {
+	size, unit := measure(value)
+	if size >= parseLimit(param) {
+		return ""
+	}
+	if unit == "" {
+		return "must be at least " + param
+	}
+	return fmt.Sprintf("must contain at least %s %s", param, unit)
+}
+
+// maximum то же, что minimum, для верхней границы
+func maximum(value reflect.Value, param string) string {
+	size, unit := measure(value)
+	if size <= parseLimit(param) {
+		return ""
+	}
+	if unit == "" {
+		return "must be at most " + param
+	}
+	return fmt.Sprintf("must contain at most %s %s", param, unit)
+}
+
+// measure значение, которое сравнивается с границами min и max, и единица измерения для сообщения
+func measure(value reflect.Value) (float64, string) {
+	switch value.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String())), "characters"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(value.Len()), "items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), ""
+	}
+	panic(fmt.Sprintf("validation: min and max are not supported for %s", value.Type()))
+}
+
+func parseLimit(param string) float64 {
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validation: invalid limit %q", param))
+	}
+	return limit
+}
+
+// luhn принимает строку из цифр, контрольная сумма которой сходится по алгоритму Луна
+func luhn(value reflect.Value, _ string) string {
+	if !Luhn(value.String()) {
+		return "must be a valid order number"
+	}
+	return ""
+}
+
+// Luhn проверяет, что number состоит из цифр и проходит проверку по алгоритму Луна
+func Luhn(number string) bool {
+	if number == "" {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		if number[i] < '0' || number[i] > '9' {
+			return false
+		}
+		digit := int(number[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// money принимает положительную сумму в баллах не больше чем с двумя знаками после запятой:
+// суммы хранятся в копейках
+func money(value reflect.Value, _ string) string {
+	const message = "must be a positive amount with at most two decimal places"
+
+	bitSize := 64
+	if value.Kind() == reflect.Float32 {
+		bitSize = 32
+	}
+	amount := value.Float()
+	if amount <= 0 {
+		return message
+	}
+	// Кратчайшая запись числа в его разрядности: для float32 значение 0.1 записывается как 0.1
+	_, fraction, _ := strings.Cut(strconv.FormatFloat(amount, 'f', -1, bitSize), ".")
+	if len(fraction) > 2 {
+		return message
+	}
+	return ""
+}
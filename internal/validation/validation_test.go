@@ -0,0 +1,122 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/Bessima/diplom-gomarket/internal/customerror"
+	"github.com/Bessima/diplom-gomarket/internal/handlers/schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStruct_RegisterRequest(t *testing.T) {
+	// Arrange
+	request := schemas.RegisterRequest{Login: "al", Password: ""}
+
+	// Act
+	fieldErrors := Struct(&request)
+
+	// Assert
+	assert.Equal(t, []customerror.FieldError{
+		{Field: "login", Code: "min", Message: "must contain at least 3 characters"},
+		{Field: "password", Code: "required", Message: "is required"},
+	}, fieldErrors)
+}
+
+func TestStruct_Valid(t *testing.T) {
+	// Arrange
+	register := schemas.RegisterRequest{Login: "алиса", Password: "secret"}
+	withdraw := schemas.WithdrawRequest{Order: "2377225624", Sum: 751.5}
+	webhook := schemas.WebhookRequest{URL: "https://example.com/hook", EventTypes: []string{"order.processed"}}
+
+	// Act
+	registerErrors := Struct(register)
+	withdrawErrors := Struct(withdraw)
+	webhookErrors := Struct(webhook)
+
+	// Assert
+	assert.Empty(t, registerErrors)
+	assert.Empty(t, withdrawErrors)
+	assert.Empty(t, webhookErrors)
+}
+
+func TestStruct_WithdrawRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		request schemas.WithdrawRequest
+		want    []customerror.FieldError
+	}{
+		{
+			name:    "invalid order number",
+			request: schemas.WithdrawRequest{Order: "2377225625", Sum: 100},
+			want:    []customerror.FieldError{{Field: "order", Code: "luhn", Message: "must be a valid order number"}},
+		},
+		{
+			name:    "order number with letters",
+			request: schemas.WithdrawRequest{Order: "23772256a4", Sum: 100},
+			want:    []customerror.FieldError{{Field: "order", Code: "luhn", Message: "must be a valid order number"}},
+		},
+		{
+			name:    "zero sum",
+			request: schemas.WithdrawRequest{Order: "2377225624", Sum: 0},
+			want:    []customerror.FieldError{{Field: "sum", Code: "required", Message: "is required"}},
+		},
+		{
+			name:    "negative sum",
+			request: schemas.WithdrawRequest{Order: "2377225624", Sum: -10},
+			want: []customerror.FieldError{
+				{Field: "sum", Code: "money", Message: "must be a positive amount with at most two decimal places"},
+			},
+		},
+		{
+			name:    "three decimal places",
+			request: schemas.WithdrawRequest{Order: "2377225624", Sum: 10.005},
+			want: []customerror.FieldError{
+				{Field: "sum", Code: "money", Message: "must be a positive amount with at most two decimal places"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			fieldErrors := Struct(tt.request)
+
+			// Assert
+			assert.Equal(t, tt.want, fieldErrors)
+		})
+	}
+}
+
+func TestStruct_WebhookRequest(t *testing.T) {
+	// Arrange
+	request := schemas.WebhookRequest{EventTypes: []string{}}
+
+	// Act
+	fieldErrors := Struct(request)
+
+	// Assert
+	assert.Equal(t, []customerror.FieldError{
+		{Field: "url", Code: "required", Message: "is required"},
+		{Field: "event_types", Code: "required", Message: "is required"},
+	}, fieldErrors)
+}
+
+func TestStruct_MaxAndUnknownRule(t *testing.T) {
+	// Arrange
+	type limited struct {
+		Count int    `json:"count" validate:"max=3"`
+		Name  string `validate:"max=2"`
+	}
+	type broken struct {
+		Name string `validate:"unknown"`
+	}
+
+	// Act
+	fieldErrors := Struct(limited{Count: 4, Name: "abc"})
+
+	// Assert
+	assert.Equal(t, []customerror.FieldError{
+		{Field: "count", Code: "max", Message: "must be at most 3"},
+		{Field: "Name", Code: "max", Message: "must contain at most 2 characters"},
+	}, fieldErrors)
+	assert.Panics(t, func() { Struct(broken{}) })
+}
@@ -0,0 +1,161 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/Bessima/diplom-gomarket/internal/netguard"
+	"github.com/Bessima/diplom-gomarket/internal/repository"
+	"github.com/Bessima/diplom-gomarket/internal/retry"
+	"go.uber.org/zap"
+)
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+
+	defaultPollInterval = time.Second
+	defaultBatchSize    = 20
+	defaultTimeout      = 10 * time.Second
+	// defaultMaxFailures количество доставок подряд, исчерпавших попытки, после которого вебхук отключается
+	defaultMaxFailures = 5
+	// lease время, на которое доставка резервируется за репликой на период отправки
+	lease = time.Minute
+)
+
+// Dispatcher периодически забирает доставки, время которых подошло, и отправляет их подписчикам
+type Dispatcher struct {
+	repository   repository.WebhookDeliveryRepositoryI
+	httpClient   *http.Client
+	retryConfig  retry.RetryConfig
+	maxFailures  int
+	pollInterval time.Duration
+	batchSize    int
+}
+
+func NewDispatcher(deliveryRepository repository.WebhookDeliveryRepositoryI) *Dispatcher {
+	return &Dispatcher{
+		repository:   deliveryRepository,
+		httpClient:   netguard.NewHTTPClient(defaultTimeout),
+		retryConfig:  retry.WebhookRetryConfig,
+		maxFailures:  defaultMaxFailures,
+		pollInterval: defaultPollInterval,
+		batchSize:    defaultBatchSize,
+	}
+}
+
+func (dispatcher *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(dispatcher.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			dispatcher.DispatchDue(ctx)
+		}
+	}
+}
+
+// DispatchDue отправляет одну пачку доставок
+func (dispatcher *Dispatcher) DispatchDue(ctx context.Context) {
+	deliveries, err := dispatcher.repository.ClaimDue(ctx, dispatcher.batchSize, lease)
+	if err != nil {
+		logger.Log.Warn("Can't claim webhook deliveries", zap.Error(err))
+		return
+	}
+
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return
+		}
+		dispatcher.dispatch(ctx, delivery)
+	}
+}
+
+func (dispatcher *Dispatcher) dispatch(ctx context.Context, delivery models.WebhookDelivery) {
+	responseCode, err := dispatcher.send(ctx, delivery)
+	// Результат отправки сохраняется и при остановке сервиса, иначе доставка повторится после истечения аренды
+	saveCtx := context.WithoutCancel(ctx)
+	if err == nil {
+		if err = dispatcher.repository.MarkDelivered(saveCtx, delivery, responseCode); err != nil {
+			logger.Log.Warn("Can't mark webhook delivery as delivered", zap.Int64("delivery_id", delivery.ID), zap.Error(err))
+		}
+		return
+	}
+
+	var nextAttemptAt *time.Time
+	if delivery.Attempts+1 < dispatcher.retryConfig.MaxRetries {
+		next := time.Now().Add(dispatcher.retryConfig.GetDelay(delivery.Attempts))
+		nextAttemptAt = &next
+	}
+	logger.Log.Info("Webhook delivery failed",
+		zap.Int64("delivery_id", delivery.ID),
+		zap.Int64("webhook_id", delivery.WebhookID),
+		zap.Int("attempt", delivery.Attempts+1),
+		zap.Bool("final", nextAttemptAt == nil),
+		zap.Error(err),
+	)
+
+	if err = dispatcher.repository.MarkFailed(saveCtx, delivery, responseCode, err.Error(), nextAttemptAt, dispatcher.maxFailures); err != nil {
+		logger.Log.Warn("Can't mark webhook delivery as failed", zap.Int64("delivery_id", delivery.ID), zap.Error(err))
+	}
+}
+
+func (dispatcher *Dispatcher) send(ctx context.Context, delivery models.WebhookDelivery) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, string(delivery.EventType))
+	request.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	request.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	request.Header.Set(SignatureHeader, Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	response, err := dispatcher.httpClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("webhook answered with status code %d", response.StatusCode)
+	}
+	return response.StatusCode, nil
+}
+
+// Sign подписывает тело запроса: HMAC-SHA256 от "<timestamp>.<body>" с секретом вебхука
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// GenerateSecret создает случайный секрет для подписи доставок
+func GenerateSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
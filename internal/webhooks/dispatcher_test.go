@@ -0,0 +1,157 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Bessima/diplom-gomarket/internal/middlewares/logger"
+	"github.com/Bessima/diplom-gomarket/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failedCall struct {
+	delivery      models.WebhookDelivery
+	responseCode  int
+	nextAttemptAt *time.Time
+	maxFailures   int
+}
+
+type mockDeliveryRepository struct {
+	due       []models.WebhookDelivery
+	delivered []models.WebhookDelivery
+	failed    []failedCall
+}
+
+func (m *mockDeliveryRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	due := m.due
+	m.due = nil
+	return due, nil
+}
+
+func (m *mockDeliveryRepository) MarkDelivered(ctx context.Context, delivery models.WebhookDelivery, responseCode int) error {
+	m.delivered = append(m.delivered, delivery)
+	return nil
+}
+
+func (m *mockDeliveryRepository) MarkFailed(ctx context.Context, delivery models.WebhookDelivery, responseCode int, reason string, nextAttemptAt *time.Time, maxFailures int) error {
+	m.failed = append(m.failed, failedCall{delivery: delivery, responseCode: responseCode, nextAttemptAt: nextAttemptAt, maxFailures: maxFailures})
+	return nil
+}
+
+func TestDispatcher_DeliversSignedPayload(t *testing.T) {
+	require.NoError(t, logger.Initialize("error"))
+
+	payload := []byte(`{"event":"order.processed","user_id":1,"data":{"number":"79927398713"}}`)
+
+	var gotBody []byte
+	var gotHeaders http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = io.ReadAll(r.Body)
+		gotHeaders = r.Header.Clone()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	repo := &mockDeliveryRepository{due: []models.WebhookDelivery{{
+		ID: 11, WebhookID: 7, EventType: models.OrderProcessedEvent, Payload: payload, URL: server.URL, Secret: "secret",
+	}}}
+	dispatcher := NewDispatcher(repo)
+	// Тестовый сервер слушает loopback, куда клиент вебхуков не соединяется
+	dispatcher.httpClient = server.Client()
+
+	dispatcher.DispatchDue(context.Background())
+
+	require.Len(t, repo.delivered, 1)
+	assert.Empty(t, repo.failed)
+	assert.Equal(t, payload, gotBody)
+	assert.Equal(t, "order.processed", gotHeaders.Get(EventHeader))
+	assert.Equal(t, "11", gotHeaders.Get(DeliveryHeader))
+
+	timestamp, err := strconv.ParseInt(gotHeaders.Get(TimestampHeader), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, Sign("secret", timestamp, payload), gotHeaders.Get(SignatureHeader))
+}
+
+func TestDispatcher_SchedulesRetryOnError(t *testing.T) {
+	require.NoError(t, logger.Initialize("error"))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	repo := &mockDeliveryRepository{due: []models.WebhookDelivery{{
+		ID: 11, WebhookID: 7, Payload: []byte(`{}`), Attempts: 1, URL: server.URL, Secret: "secret",
+	}}}
+	dispatcher := NewDispatcher(repo)
+	// Тестовый сервер слушает loopback, куда клиент вебхуков не соединяется
+	dispatcher.httpClient = server.Client()
+
+	before := time.Now()
+	dispatcher.DispatchDue(context.Background())
+
+	require.Len(t, repo.failed, 1)
+	assert.Empty(t, repo.delivered)
+	assert.Equal(t, http.StatusInternalServerError, repo.failed[0].responseCode)
+	require.NotNil(t, repo.failed[0].nextAttemptAt)
+	// Вторая попытка: задержка 30 секунд
+	assert.WithinDuration(t, before.Add(30*time.Second), *repo.failed[0].nextAttemptAt, 5*time.Second)
+}
+
+func TestDispatcher_GivesUpAfterMaxRetries(t *testing.T) {
+	require.NoError(t, logger.Initialize("error"))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	repo := &mockDeliveryRepository{due: []models.WebhookDelivery{{
+		ID: 11, WebhookID: 7, Payload: []byte(`{}`), Attempts: 5, URL: server.URL, Secret: "secret",
+	}}}
+	dispatcher := NewDispatcher(repo)
+	// Тестовый сервер слушает loopback, куда клиент вебхуков не соединяется
+	dispatcher.httpClient = server.Client()
+
+	dispatcher.DispatchDue(context.Background())
+
+	require.Len(t, repo.failed, 1)
+	assert.Nil(t, repo.failed[0].nextAttemptAt)
+	assert.Equal(t, defaultMaxFailures, repo.failed[0].maxFailures)
+}
+
+func TestDispatcher_RefusesInternalAddress(t *testing.T) {
+	require.NoError(t, logger.Initialize("error"))
+
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	repo := &mockDeliveryRepository{due: []models.WebhookDelivery{{
+		ID: 11, WebhookID: 7, Payload: []byte(`{}`), Attempts: 1, URL: server.URL, Secret: "secret",
+	}}}
+	dispatcher := NewDispatcher(repo)
+
+	dispatcher.DispatchDue(context.Background())
+
+	assert.False(t, called)
+	assert.Empty(t, repo.delivered)
+	require.Len(t, repo.failed, 1)
+	assert.Zero(t, repo.failed[0].responseCode)
+}
+
+func TestSign(t *testing.T) {
+	// HMAC-SHA256("key", "1700000000.{}")
+	signature := Sign("key", 1700000000, []byte(`{}`))
+	assert.Equal(t, "sha256=9d713ed406bb7076d4123f0dc2c39d2df5c654ed4b0cd56b52c8b4c940bd63ae", signature)
+	assert.NotEqual(t, Sign("other", 1700000000, []byte(`{}`)), signature)
+}
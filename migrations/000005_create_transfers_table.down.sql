@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_transfers_to_user_created;
+DROP INDEX IF EXISTS idx_transfers_from_user_created;
+DROP TABLE IF EXISTS transfers;
\ No newline at end of file
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS transfers
+(
+    id           BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    from_user_id INT                      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    to_user_id   INT                      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    sum          BIGINT                   NOT NULL CHECK (sum > 0),
+    created_at   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK (from_user_id <> to_user_id)
+);
+
+CREATE INDEX idx_transfers_from_user_created ON transfers (from_user_id, created_at);
+CREATE INDEX idx_transfers_to_user_created ON transfers (to_user_id, created_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_balance_adjustments_user_created;
+DROP TABLE IF EXISTS balance_adjustments;
\ No newline at end of file
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS balance_adjustments
+(
+    id         BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    user_id    INT                      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    sum        BIGINT                   NOT NULL,
+    reason     TEXT                     NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_balance_adjustments_user_created ON balance_adjustments (user_id, created_at);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_withdrawals_user_processed;
+DROP INDEX IF EXISTS idx_orders_user_processed;
+DROP INDEX IF EXISTS idx_orders_user_status;
+DROP INDEX IF EXISTS idx_orders_user_uploaded;
\ No newline at end of file
@@ -0,0 +1,4 @@
+CREATE INDEX IF NOT EXISTS idx_orders_user_uploaded ON orders (user_id, uploaded_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_user_status ON orders (user_id, status);
+CREATE INDEX IF NOT EXISTS idx_orders_user_processed ON orders (user_id, processed_at);
+CREATE INDEX IF NOT EXISTS idx_withdrawals_user_processed ON withdrawals (user_id, processed_at DESC, order_id DESC);
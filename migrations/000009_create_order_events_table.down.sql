@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS orders_status_changed ON orders;
+DROP FUNCTION IF EXISTS notify_order_event();
+DROP INDEX IF EXISTS idx_order_events_user_id;
+DROP TABLE IF EXISTS order_events;
\ No newline at end of file
@@ -0,0 +1,40 @@
+CREATE TABLE IF NOT EXISTS order_events
+(
+    id         BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    order_id   BIGINT                   NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    user_id    INT                      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    status     order_status             NOT NULL,
+    accrual    BIGINT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_order_events_user_id ON order_events (user_id, id);
+
+CREATE OR REPLACE FUNCTION notify_order_event() RETURNS trigger AS
+$$
+DECLARE
+    event_id         BIGINT;
+    event_created_at TIMESTAMP WITH TIME ZONE;
+BEGIN
+    INSERT INTO order_events (order_id, user_id, status, accrual)
+    VALUES (NEW.id, NEW.user_id, NEW.status, NEW.accrual)
+    RETURNING id, created_at INTO event_id, event_created_at;
+
+    PERFORM pg_notify('order_events', json_build_object(
+            'id', event_id,
+            'order', NEW.id::text,
+            'user_id', NEW.user_id,
+            'status', NEW.status,
+            'accrual', NEW.accrual,
+            'created_at', event_created_at
+        )::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER orders_status_changed
+    AFTER UPDATE OF status, accrual
+    ON orders
+    FOR EACH ROW
+    WHEN (OLD.status IS DISTINCT FROM NEW.status OR OLD.accrual IS DISTINCT FROM NEW.accrual)
+EXECUTE FUNCTION notify_order_event();
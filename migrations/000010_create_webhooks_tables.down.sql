@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS balance_webhook_event ON balance;
+DROP TRIGGER IF EXISTS withdrawals_webhook_event ON withdrawals;
+DROP TRIGGER IF EXISTS orders_webhook_event ON orders;
+DROP FUNCTION IF EXISTS webhook_balance_event();
+DROP FUNCTION IF EXISTS webhook_withdrawal_event();
+DROP FUNCTION IF EXISTS webhook_order_event();
+DROP FUNCTION IF EXISTS enqueue_webhook_event(INT, TEXT, JSONB);
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
\ No newline at end of file
@@ -0,0 +1,105 @@
+CREATE TABLE IF NOT EXISTS webhooks
+(
+    id            BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    -- NULL - вебхук партнера, зарегистрированный администратором, получает события всех пользователей
+    user_id       INT REFERENCES users (id) ON DELETE CASCADE,
+    url           TEXT                     NOT NULL,
+    secret        TEXT                     NOT NULL,
+    event_types   TEXT[]                   NOT NULL,
+    active        BOOLEAN                  NOT NULL DEFAULT TRUE,
+    failure_count INT                      NOT NULL DEFAULT 0,
+    created_at    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_webhooks_user_id ON webhooks (user_id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id              BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    webhook_id      BIGINT                   NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+    event_type      TEXT                     NOT NULL,
+    payload         JSONB                    NOT NULL,
+    status          TEXT                     NOT NULL DEFAULT 'PENDING',
+    attempts        INT                      NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    response_code   INT,
+    last_error      TEXT,
+    created_at      TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    delivered_at    TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'PENDING';
+CREATE INDEX idx_webhook_deliveries_webhook ON webhook_deliveries (webhook_id, id DESC);
+
+-- Доставки создаются триггерами в той же транзакции, что и изменение, вызвавшее событие
+CREATE OR REPLACE FUNCTION enqueue_webhook_event(p_user_id INT, p_event_type TEXT, p_data JSONB) RETURNS void AS
+$$
+BEGIN
+    INSERT INTO webhook_deliveries (webhook_id, event_type, payload)
+    SELECT id, p_event_type, jsonb_build_object('event', p_event_type, 'user_id', p_user_id, 'data', p_data)
+    FROM webhooks
+    WHERE active
+      AND p_event_type = ANY (event_types)
+      AND (user_id = p_user_id OR user_id IS NULL);
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION webhook_order_event() RETURNS trigger AS
+$$
+BEGIN
+    IF NEW.status = 'PROCESSED' THEN
+        PERFORM enqueue_webhook_event(NEW.user_id, 'order.processed',
+                                      jsonb_build_object('number', NEW.id::text, 'status', NEW.status, 'accrual', round(NEW.accrual / 100.0, 2)));
+    ELSIF NEW.status = 'INVALID' THEN
+        PERFORM enqueue_webhook_event(NEW.user_id, 'order.invalid',
+                                      jsonb_build_object('number', NEW.id::text, 'status', NEW.status));
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER orders_webhook_event
+    AFTER UPDATE OF status
+    ON orders
+    FOR EACH ROW
+    WHEN (OLD.status IS DISTINCT FROM NEW.status)
+EXECUTE FUNCTION webhook_order_event();
+
+CREATE OR REPLACE FUNCTION webhook_withdrawal_event() RETURNS trigger AS
+$$
+BEGIN
+    PERFORM enqueue_webhook_event(NEW.user_id, 'withdrawal.created',
+                                  jsonb_build_object('order', NEW.order_id::text, 'sum', round(NEW.sum / 100.0, 2), 'processed_at', NEW.processed_at));
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER withdrawals_webhook_event
+    AFTER INSERT
+    ON withdrawals
+    FOR EACH ROW
+EXECUTE FUNCTION webhook_withdrawal_event();
+
+CREATE OR REPLACE FUNCTION webhook_balance_event() RETURNS trigger AS
+$$
+DECLARE
+    previous BIGINT := 0;
+BEGIN
+    IF TG_OP = 'UPDATE' THEN
+        previous := OLD.current;
+    END IF;
+    IF NEW.current IS DISTINCT FROM previous THEN
+        PERFORM enqueue_webhook_event(NEW.user_id, 'balance.changed',
+                                      jsonb_build_object('current', round(NEW.current / 100.0, 2),
+                                                         'withdrawn', round(NEW.withdrawals / 100.0, 2),
+                                                         'delta', round((NEW.current - previous) / 100.0, 2)));
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER balance_webhook_event
+    AFTER INSERT OR UPDATE OF current
+    ON balance
+    FOR EACH ROW
+EXECUTE FUNCTION webhook_balance_event();
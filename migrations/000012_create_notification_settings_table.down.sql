@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS withdrawals_outbox_event ON withdrawals;
+DROP FUNCTION IF EXISTS outbox_withdrawal_event();
+DROP TABLE IF EXISTS notification_settings;
\ No newline at end of file
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS notification_settings
+(
+    user_id    INT PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    language   TEXT                     NOT NULL DEFAULT 'ru',
+    channels   TEXT[]                   NOT NULL DEFAULT '{}',
+    events     TEXT[]                   NOT NULL DEFAULT '{}',
+    email      TEXT,
+    http_url   TEXT,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Списание записывается одним INSERT, поэтому событие для outbox добавляется триггером в той же транзакции
+CREATE OR REPLACE FUNCTION outbox_withdrawal_event() RETURNS trigger AS
+$$
+BEGIN
+    INSERT INTO outbox (user_id, event_type, payload)
+    VALUES (NEW.user_id, 'withdrawal.created',
+            jsonb_build_object('order', NEW.order_id::text, 'sum', round(COALESCE(NEW.sum, 0) / 100.0, 2)));
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER withdrawals_outbox_event
+    AFTER INSERT
+    ON withdrawals
+    FOR EACH ROW
+EXECUTE FUNCTION outbox_withdrawal_event();
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_admin_audit_created;
+DROP TABLE IF EXISTS admin_audit;
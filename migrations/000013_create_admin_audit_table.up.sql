@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS admin_audit
+(
+    id         BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    action     TEXT                     NOT NULL,
+    target     TEXT                     NOT NULL,
+    actor      TEXT                     NOT NULL,
+    reason     TEXT                     NOT NULL DEFAULT '',
+    details    JSONB                    NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_admin_audit_created ON admin_audit (created_at);
@@ -0,0 +1,31 @@
+CREATE OR REPLACE FUNCTION notify_cache_invalidation() RETURNS trigger AS
+$$
+DECLARE
+    changed JSONB;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        changed := to_jsonb(OLD);
+    ELSE
+        changed := to_jsonb(NEW);
+    END IF;
+
+    -- TG_ARGV[0] закешированная сущность, TG_ARGV[1] колонка с идентификатором пользователя
+    PERFORM pg_notify('cache_invalidation', json_build_object(
+            'entity', TG_ARGV[0],
+            'user_id', (changed ->> TG_ARGV[1])::int
+        )::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER balance_cache_invalidation
+    AFTER INSERT OR UPDATE OR DELETE
+    ON balance
+    FOR EACH ROW
+EXECUTE FUNCTION notify_cache_invalidation('balance', 'user_id');
+
+CREATE TRIGGER users_cache_invalidation
+    AFTER UPDATE OR DELETE
+    ON users
+    FOR EACH ROW
+EXECUTE FUNCTION notify_cache_invalidation('user', 'id');
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_orders_requeued;
+
+ALTER TABLE orders DROP COLUMN IF EXISTS requeued_at;
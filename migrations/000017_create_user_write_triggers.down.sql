@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS withdrawals_cache_invalidation ON withdrawals;
+DROP TRIGGER IF EXISTS orders_cache_invalidation ON orders;
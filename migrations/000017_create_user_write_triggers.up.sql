@@ -0,0 +1,13 @@
+-- Реплики сервиса узнают о новых заказах и списаниях пользователя, чтобы направлять его чтения
+-- в основной сервер, пока реплика базы может их не содержать
+CREATE TRIGGER orders_cache_invalidation
+    AFTER INSERT OR UPDATE
+    ON orders
+    FOR EACH ROW
+EXECUTE FUNCTION notify_cache_invalidation('order', 'user_id');
+
+CREATE TRIGGER withdrawals_cache_invalidation
+    AFTER INSERT
+    ON withdrawals
+    FOR EACH ROW
+EXECUTE FUNCTION notify_cache_invalidation('withdrawal', 'user_id');
@@ -0,0 +1,15 @@
+// Package migrations содержит SQL-миграции схемы, встроенные в бинарный файл
+package migrations
+
+import "embed"
+
+// FS файлы миграций Postgres в формате golang-migrate: NNNNNN_name.up.sql и NNNNNN_name.down.sql
+//
+//go:embed *.sql
+var FS embed.FS
+
+// SQLiteFS миграции SQLite в каталоге sqlite. Версии нумеруются независимо от Postgres,
+// схема содержит только таблицы пользователей, заказов, списаний и баланса.
+//
+//go:embed sqlite/*.sql
+var SQLiteFS embed.FS
@@ -0,0 +1,42 @@
+-- Время хранится в микросекундах от начала эпохи: так сравнение и сортировка по курсорам
+-- совпадают с timestamptz в Postgres
+CREATE TABLE IF NOT EXISTS users (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    name       TEXT    NOT NULL,
+    password   TEXT    NOT NULL,
+    created_at INTEGER NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000000 AS INTEGER))
+);
+
+CREATE INDEX IF NOT EXISTS idx_users_name ON users (name);
+
+CREATE TABLE IF NOT EXISTS orders
+(
+    id           INTEGER PRIMARY KEY,
+    user_id      INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    accrual      INTEGER,
+    status       TEXT    NOT NULL DEFAULT 'NEW' CHECK (status IN ('NEW', 'INVALID', 'PROCESSING', 'PROCESSED')),
+    uploaded_at  INTEGER NOT NULL,
+    processed_at INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idx_orders_user_uploaded ON orders (user_id, uploaded_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_user_status ON orders (user_id, status);
+CREATE INDEX IF NOT EXISTS idx_orders_user_processed ON orders (user_id, processed_at);
+CREATE INDEX IF NOT EXISTS idx_orders_status ON orders (status);
+
+CREATE TABLE IF NOT EXISTS withdrawals
+(
+    order_id     INTEGER PRIMARY KEY,
+    user_id      INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    sum          INTEGER,
+    processed_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_withdrawals_user_processed ON withdrawals (user_id, processed_at DESC, order_id DESC);
+
+CREATE TABLE IF NOT EXISTS balance
+(
+    user_id     INTEGER UNIQUE NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    current     INTEGER DEFAULT 0 NOT NULL CHECK (current >= 0),
+    withdrawals INTEGER DEFAULT 0 NOT NULL
+);